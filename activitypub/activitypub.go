@@ -0,0 +1,393 @@
+// Package activitypub makes the blog an ActivityPub actor
+// (https://www.w3.org/TR/activitypub/) that fediverse accounts can follow.
+//
+// The actor is found by WebFinger and publishes each post as an Article.
+// Publish queues a Create when a post goes live, and an Update or Delete
+// when a post that was sent changes or is removed. The worker started by Run
+// sends each activity to every follower's inbox, signed with the actor's
+// key using HTTP Signatures, and retries failed deliveries with backoff.
+//
+// Receive handles what remote servers POST to the inbox: a Follow adds the
+// sender as a follower and is answered with an Accept, and an Undo of it
+// removes them again. Every inbox request must be signed by its actor.
+package activitypub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/templates"
+)
+
+// ContentType is the media type of every ActivityPub document served and
+// sent
+const ContentType = "application/activity+json"
+
+// Public is the special collection addressing an activity to everyone
+const Public = "https://www.w3.org/ns/activitystreams#Public"
+
+// keyBits is the size of the actor's RSA key, the kind every fediverse
+// server can verify
+const keyBits = 2048
+
+// jsonLDContext is the JSON-LD context of documents that carry a public key
+var jsonLDContext = []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"}
+
+// Config describes the blog's actor. BaseURL is the site's public origin,
+// e.g. https://example.com; every ID the actor hands out starts with it, so
+// it must stay the same once the blog has followers.
+type Config struct {
+	BaseURL  string
+	Username string // The part before the @ in @blog@example.com
+	Name     string
+	Summary  string
+}
+
+// Service is the blog's actor: its identity, its key and the client used to
+// talk to other servers
+type Service struct {
+	Config
+	db     *sql.DB
+	client *http.Client
+	key    *rsa.PrivateKey
+}
+
+// New returns the actor described by cfg, creating its key on first use.
+// client is used for every request to another server.
+func New(db *sql.DB, client *http.Client, cfg Config) (*Service, error) {
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q is not an absolute http(s) URL", cfg.BaseURL)
+	}
+
+	key, err := loadKey(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{Config: cfg, db: db, client: client, key: key}, nil
+}
+
+// loadKey returns the actor's private key, generating and storing one if
+// the database has none
+func loadKey(db *sql.DB) (*rsa.PrivateKey, error) {
+	stored, err := database.GetActivityPubKey(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored == "" {
+		key, err := rsa.GenerateKey(rand.Reader, keyBits)
+		if err != nil {
+			return nil, fmt.Errorf("generate actor key: %w", err)
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("marshal actor key: %w", err)
+		}
+
+		stored, err = database.CreateActivityPubKey(db, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block, _ := pem.Decode([]byte(stored))
+	if block == nil {
+		return nil, errors.New("stored actor key is not PEM encoded")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse actor key: %w", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("stored actor key is not an RSA key")
+	}
+
+	return key, nil
+}
+
+// ActorID returns the URL of the actor document
+func (s *Service) ActorID() string { return s.BaseURL + "/ap/actor" }
+
+// KeyID returns the ID of the actor's public key, named in signatures
+func (s *Service) KeyID() string { return s.ActorID() + "#main-key" }
+
+// InboxURL returns the URL remote servers POST activities to
+func (s *Service) InboxURL() string { return s.BaseURL + "/ap/inbox" }
+
+// OutboxURL returns the URL of the collection of published posts
+func (s *Service) OutboxURL() string { return s.BaseURL + "/ap/outbox" }
+
+// FollowersURL returns the URL of the followers collection
+func (s *Service) FollowersURL() string { return s.BaseURL + "/ap/followers" }
+
+// ArticleID returns the ID of the Article for the post with slug
+func (s *Service) ArticleID(slug string) string { return s.BaseURL + "/ap/posts/" + slug }
+
+// Host returns the host in the actor's handle, e.g. example.com
+func (s *Service) Host() string {
+	u, _ := url.Parse(s.BaseURL)
+	return u.Host
+}
+
+// Account returns the actor's WebFinger resource, e.g. acct:blog@example.com
+func (s *Service) Account() string { return "acct:" + s.Username + "@" + s.Host() }
+
+// JRD is a WebFinger document (RFC 7033)
+type JRD struct {
+	Subject string   `json:"subject"`
+	Aliases []string `json:"aliases,omitempty"`
+	Links   []Link   `json:"links"`
+}
+
+// Link is one link of a WebFinger document
+type Link struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type"`
+	Href string `json:"href"`
+}
+
+// WebFinger returns the document resolving resource, the blog's acct:
+// handle or its actor URL, to the actor, or nil for any other resource
+func (s *Service) WebFinger(resource string) *JRD {
+	if !strings.EqualFold(resource, s.Account()) && resource != s.ActorID() {
+		return nil
+	}
+
+	return &JRD{
+		Subject: s.Account(),
+		Aliases: []string{s.ActorID(), s.BaseURL + "/"},
+		Links: []Link{
+			{Rel: "self", Type: ContentType, Href: s.ActorID()},
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: s.BaseURL + "/"},
+		},
+	}
+}
+
+// Actor is an ActivityPub actor document: the blog's own, or a remote one
+// fetched to verify a signature or find an inbox
+type Actor struct {
+	Context           any        `json:"@context,omitempty"`
+	ID                string     `json:"id"`
+	Type              string     `json:"type"`
+	PreferredUsername string     `json:"preferredUsername,omitempty"`
+	Name              string     `json:"name,omitempty"`
+	Summary           string     `json:"summary,omitempty"`
+	URL               string     `json:"url,omitempty"`
+	Inbox             string     `json:"inbox"`
+	Outbox            string     `json:"outbox,omitempty"`
+	Followers         string     `json:"followers,omitempty"`
+	Endpoints         *Endpoints `json:"endpoints,omitempty"`
+	PublicKey         *PublicKey `json:"publicKey,omitempty"`
+
+	ManuallyApprovesFollowers bool `json:"manuallyApprovesFollowers"`
+
+	// Owner is set instead of the fields above when a key ID names a
+	// standalone key document
+	Owner string `json:"owner,omitempty"`
+}
+
+// Endpoints lists an actor's server-wide endpoints
+type Endpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+// PublicKey is the key an actor signs its requests with
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// Handle returns the actor's @user@host handle, or its ID if it has no
+// username
+func (a *Actor) Handle() string {
+	u, err := url.Parse(a.ID)
+	if a.PreferredUsername == "" || err != nil {
+		return a.ID
+	}
+	return "@" + a.PreferredUsername + "@" + u.Host
+}
+
+// ActorDocument returns the blog's actor document
+func (s *Service) ActorDocument() (*Actor, error) {
+	der, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("marshal public key: %w", err)
+	}
+
+	return &Actor{
+		Context:           jsonLDContext,
+		ID:                s.ActorID(),
+		Type:              "Person",
+		PreferredUsername: s.Username,
+		Name:              s.Name,
+		Summary:           s.Summary,
+		URL:               s.BaseURL + "/",
+		Inbox:             s.InboxURL(),
+		Outbox:            s.OutboxURL(),
+		Followers:         s.FollowersURL(),
+		Endpoints:         &Endpoints{SharedInbox: s.InboxURL()},
+		PublicKey: &PublicKey{
+			ID:           s.KeyID(),
+			Owner:        s.ActorID(),
+			PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		},
+	}, nil
+}
+
+// Activity is an ActivityPub activity. Object is a nested document or the
+// ID of one; when decoded it is a map or a string.
+type Activity struct {
+	Context   any      `json:"@context,omitempty"`
+	ID        string   `json:"id"`
+	Type      string   `json:"type"`
+	Actor     string   `json:"actor"`
+	Object    any      `json:"object"`
+	Published string   `json:"published,omitempty"`
+	To        []string `json:"to,omitempty"`
+	CC        []string `json:"cc,omitempty"`
+}
+
+// Object is a post as an Article, or a Tombstone once it is deleted
+type Object struct {
+	Context      any      `json:"@context,omitempty"`
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	AttributedTo string   `json:"attributedTo,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	Content      string   `json:"content,omitempty"`
+	MediaType    string   `json:"mediaType,omitempty"`
+	URL          string   `json:"url,omitempty"`
+	Published    string   `json:"published,omitempty"`
+	Updated      string   `json:"updated,omitempty"`
+	To           []string `json:"to,omitempty"`
+	CC           []string `json:"cc,omitempty"`
+}
+
+// Article returns post as an Article addressed to the public and the
+// blog's followers
+func (s *Service) Article(post *models.BlogPost) *Object {
+	return &Object{
+		ID:           s.ArticleID(post.Slug),
+		Type:         "Article",
+		AttributedTo: s.ActorID(),
+		Name:         post.Title,
+		Content:      templates.RenderMarkdown(post.Content),
+		MediaType:    "text/html",
+		URL:          s.BaseURL + "/blog/" + post.Slug,
+		Published:    post.PublishedAt.UTC().Format(time.RFC3339),
+		To:           []string{Public},
+		CC:           []string{s.FollowersURL()},
+	}
+}
+
+// PostActivity returns the Create or Update activity wrapping post's
+// Article. at is when the activity happened.
+func (s *Service) PostActivity(activityType string, post *models.BlogPost, at time.Time) *Activity {
+	article := s.Article(post)
+
+	id := article.ID + "#create"
+	if activityType == models.ActivityUpdate {
+		// Each update is a new activity, so its ID must differ
+		article.Updated = at.UTC().Format(time.RFC3339)
+		id = fmt.Sprintf("%s#update-%d", article.ID, at.Unix())
+	}
+
+	return &Activity{
+		Context:   jsonLDContext,
+		ID:        id,
+		Type:      activityType,
+		Actor:     s.ActorID(),
+		Object:    article,
+		Published: at.UTC().Format(time.RFC3339),
+		To:        article.To,
+		CC:        article.CC,
+	}
+}
+
+// deleteActivity returns the Delete activity for the post with slug
+func (s *Service) deleteActivity(slug string, at time.Time) *Activity {
+	id := s.ArticleID(slug)
+	return &Activity{
+		Context:   jsonLDContext,
+		ID:        id + "#delete",
+		Type:      models.ActivityDelete,
+		Actor:     s.ActorID(),
+		Object:    &Object{ID: id, Type: "Tombstone"},
+		Published: at.UTC().Format(time.RFC3339),
+		To:        []string{Public},
+		CC:        []string{s.FollowersURL()},
+	}
+}
+
+// Publish queues post to be sent to followers: as a Create once it is
+// live, or as an Update if it was sent before
+func Publish(db *sql.DB, post *models.BlogPost) error {
+	federated, err := database.PostFederated(db, post.ID)
+	if err != nil {
+		return err
+	}
+
+	item := &models.OutboxItem{PostID: post.ID, Slug: post.Slug, Activity: models.ActivityCreate, DueAt: post.PublishedAt}
+	if federated {
+		item.Activity = models.ActivityUpdate
+		item.DueAt = time.Now()
+	}
+
+	if err := database.QueueOutboxItem(db, item); err != nil {
+		return err
+	}
+
+	wake()
+	return nil
+}
+
+// Retract queues a Delete of post for followers if it was sent to them, and
+// otherwise drops whatever was queued for it
+func Retract(db *sql.DB, post *models.BlogPost) error {
+	federated, err := database.PostFederated(db, post.ID)
+	if err != nil {
+		return err
+	}
+
+	if !federated {
+		return database.CancelOutboxItems(db, post.ID)
+	}
+
+	item := &models.OutboxItem{PostID: post.ID, Slug: post.Slug, Activity: models.ActivityDelete, DueAt: time.Now()}
+	if err := database.QueueOutboxItem(db, item); err != nil {
+		return err
+	}
+
+	wake()
+	return nil
+}
+
+// randomID returns a random fragment for the IDs of activities that are
+// not about a post
+func randomID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,349 @@
+package activitypub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/internal/testdb"
+	"portfolio-v2/safehttp"
+)
+
+// newTestBlog returns the blog's actor, served on a local server with the
+// WebFinger, actor and inbox endpoints routed as in main
+func newTestBlog(t *testing.T) (*Service, *sql.DB) {
+	t.Helper()
+
+	db := testdb.Open(t)
+
+	var s *Service
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		jrd := s.WebFinger(r.URL.Query().Get("resource"))
+		if jrd == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeDocument(w, jrd)
+	})
+	mux.HandleFunc("GET /ap/actor", func(w http.ResponseWriter, r *http.Request) {
+		actor, err := s.ActorDocument()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeDocument(w, actor)
+	})
+	mux.HandleFunc("POST /ap/inbox", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch err := s.Receive(r, body); {
+		case err == nil:
+			w.WriteHeader(http.StatusAccepted)
+		case errors.Is(err, ErrUnauthorized):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	s, err := New(db, safehttp.NewClient(true), Config{BaseURL: server.URL, Username: "blog", Name: "Test blog"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s, db
+}
+
+// handle returns the blog's user@host handle
+func handle(s *Service) string { return s.Username + "@" + s.Host() }
+
+// isFollower reports whether actor follows the blog
+func isFollower(t *testing.T, db *sql.DB, actor string) bool {
+	t.Helper()
+	following, err := database.IsFollower(db, actor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return following
+}
+
+func TestWebFinger(t *testing.T) {
+	s, _ := newTestBlog(t)
+
+	for _, resource := range []string{s.Account(), strings.ToUpper(s.Account()), s.ActorID()} {
+		jrd := s.WebFinger(resource)
+		if jrd == nil {
+			t.Errorf("WebFinger(%q) = nil", resource)
+			continue
+		}
+		if jrd.Subject != s.Account() || jrd.Links[0].Rel != "self" || jrd.Links[0].Href != s.ActorID() {
+			t.Errorf("WebFinger(%q) = %+v, want the actor as self", resource, jrd)
+		}
+	}
+
+	for _, resource := range []string{"acct:someone@" + s.Host(), "acct:blog@other.example", s.BaseURL + "/"} {
+		if jrd := s.WebFinger(resource); jrd != nil {
+			t.Errorf("WebFinger(%q) = %+v, want nil", resource, jrd)
+		}
+	}
+
+	// And over HTTP the way a remote server finds the blog
+	fake := newFakeInstance(t, "alice")
+	actor, err := fake.lookup(handle(s))
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if actor.ID != s.ActorID() || actor.Inbox != s.InboxURL() {
+		t.Errorf("looked up %s with inbox %s, want %s with %s", actor.ID, actor.Inbox, s.ActorID(), s.InboxURL())
+	}
+}
+
+func TestFetchActor(t *testing.T) {
+	s, _ := newTestBlog(t)
+	fake := newFakeInstance(t, "alice")
+
+	actor, err := s.FetchActor(t.Context(), fake.actorID())
+	if err != nil {
+		t.Fatalf("FetchActor: %v", err)
+	}
+	if actor.Handle() != "@alice@"+strings.TrimPrefix(fake.baseURL, "http://") {
+		t.Errorf("handle = %s", actor.Handle())
+	}
+
+	key, err := parsePublicKey(actor.PublicKey.PublicKeyPem)
+	if err != nil {
+		t.Fatalf("parse key: %v", err)
+	}
+	if !key.Equal(&fake.key.PublicKey) {
+		t.Error("fetched key is not the actor's")
+	}
+
+	if _, err := s.FetchActor(t.Context(), fake.baseURL+"/users/nobody"); !errors.Is(err, errGone) {
+		t.Errorf("FetchActor of a missing actor = %v, want errGone", err)
+	}
+}
+
+func TestFollowAndUndo(t *testing.T) {
+	s, db := newTestBlog(t)
+	fake := newFakeInstance(t, "alice")
+
+	followed, err := fake.follow(handle(s))
+	if err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+	if followed != s.ActorID() {
+		t.Errorf("followed %s, want %s", followed, s.ActorID())
+	}
+	if !isFollower(t, db, fake.actorID()) {
+		t.Fatal("follower was not saved")
+	}
+
+	// The Accept is queued and signed by the blog
+	s.deliverDue(t.Context())
+	deliveries := fake.deliveries()
+	if len(deliveries) != 1 || deliveries[0].Type != "Accept" || deliveries[0].Signer != s.ActorID() {
+		t.Fatalf("deliveries = %+v, rejections = %v; want one Accept signed by the blog", deliveries, fake.rejections())
+	}
+	if accepted := objectID(deliveries[0].Object); !strings.HasPrefix(accepted, fake.actorID()+"#follow-") {
+		t.Errorf("Accept of %q, want the Follow", accepted)
+	}
+
+	if err := fake.unfollow(followed); err != nil {
+		t.Fatalf("unfollow: %v", err)
+	}
+	if isFollower(t, db, fake.actorID()) {
+		t.Error("follower was not removed by the Undo")
+	}
+}
+
+func TestArticleDeliveredToFollowers(t *testing.T) {
+	s, db := newTestBlog(t)
+	alice := newFakeInstance(t, "alice")
+	bob := newFakeInstance(t, "bob")
+	for _, fake := range []*fakeInstance{alice, bob} {
+		if _, err := fake.follow(handle(s)); err != nil {
+			t.Fatalf("follow: %v", err)
+		}
+	}
+	s.deliverDue(t.Context()) // The Accepts
+
+	slug, err := database.CreateBlogPost(db, "Federated post", "Excerpt", "Hello **fediverse**", nil, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := database.GetBlogPostBySlug(db, slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Publish(db, post); err != nil {
+		t.Fatal(err)
+	}
+
+	s.sendOutbox(t.Context())
+	s.deliverDue(t.Context())
+
+	for _, fake := range []*fakeInstance{alice, bob} {
+		deliveries := fake.deliveries()
+		if len(deliveries) != 2 {
+			t.Fatalf("%s got %d deliveries, rejections %v; want the Accept and the Create", fake.username, len(deliveries), fake.rejections())
+		}
+
+		create := deliveries[1]
+		if create.Type != "Create" || create.Signer != s.ActorID() || create.Inbox != "/inbox" {
+			t.Errorf("%s got %s by %s at %s, want a Create by the blog at the shared inbox", fake.username, create.Type, create.Signer, create.Inbox)
+		}
+
+		article, _ := create.Object.(map[string]any)
+		if article["type"] != "Article" || article["id"] != s.ArticleID(slug) || article["name"] != "Federated post" {
+			t.Errorf("%s got object %v, want the post's Article", fake.username, create.Object)
+		}
+		if content, _ := article["content"].(string); !strings.Contains(content, "<strong>fediverse</strong>") {
+			t.Errorf("content = %q, want rendered markdown", content)
+		}
+	}
+}
+
+func TestInboxRejectsBadSignatures(t *testing.T) {
+	s, db := newTestBlog(t)
+	fake := newFakeInstance(t, "alice")
+
+	follow := &Activity{
+		ID:     fake.actorID() + "#follow-1",
+		Type:   "Follow",
+		Actor:  fake.actorID(),
+		Object: s.ActorID(),
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(req *http.Request, body []byte) []byte
+	}{
+		{"unsigned", func(req *http.Request, body []byte) []byte {
+			req.Header.Del("Signature")
+			return body
+		}},
+		{"body changed after signing", func(req *http.Request, body []byte) []byte {
+			return []byte(strings.Replace(string(body), "follow-1", "follow-2", 1))
+		}},
+		{"digest changed to match the new body", func(req *http.Request, body []byte) []byte {
+			body = []byte(strings.Replace(string(body), "follow-1", "follow-2", 1))
+			req.Header.Set("Digest", digest(body))
+			return body
+		}},
+		{"signature from another key", func(req *http.Request, body []byte) []byte {
+			other, err := rsa.GenerateKey(rand.Reader, keyBits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Sign(req, body, fake.keyID(), other); err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}},
+		{"signed on behalf of another actor", func(req *http.Request, body []byte) []byte {
+			body = []byte(strings.Replace(string(body), `"actor":"`+fake.actorID(), `"actor":"`+fake.baseURL+"/users/mallory", 1))
+			if err := Sign(req, body, fake.keyID(), fake.key); err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, body, err := fake.signedRequest(s.InboxURL(), follow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = tt.tamper(req, body)
+			req.Body = io.NopCloser(strings.NewReader(string(body)))
+			req.ContentLength = int64(len(body))
+
+			resp, err := fake.client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("inbox answered %d, want 401", resp.StatusCode)
+			}
+			if isFollower(t, db, fake.actorID()) {
+				t.Error("follower was saved")
+			}
+		})
+	}
+}
+
+func TestSignatureVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte(`{"type":"Follow"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		sign    func(req *http.Request) error
+		body    []byte
+		key     *rsa.PublicKey
+		now     time.Time
+		wantErr string
+	}{
+		{"valid", signWith(body, key), body, &key.PublicKey, now, ""},
+		{"digest mismatch", signWith(body, key), []byte(`{"type":"Undo"}`), &key.PublicKey, now, "digest does not match the body"},
+		{"wrong key", signWith(body, key), body, &other.PublicKey, now, "signature does not match"},
+		{"date too old", signWith(body, key), body, &key.PublicKey, now.Add(Tolerance + time.Minute), "date is outside the allowed tolerance"},
+		{"digest not covered", signWith(nil, key), body, &key.PublicKey, now, "signature does not cover digest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "https://blog.example/ap/inbox", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.sign(req); err != nil {
+				t.Fatal(err)
+			}
+			// As the receiving server sees it
+			req.Host = req.URL.Host
+
+			sig, err := ParseSignature(req.Header)
+			if err != nil {
+				t.Fatalf("ParseSignature: %v", err)
+			}
+
+			err = sig.Verify(req, tt.body, tt.key, tt.now)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Verify = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("Verify = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// signWith returns a function signing a request for body with key
+func signWith(body []byte, key *rsa.PrivateKey) func(*http.Request) error {
+	return func(req *http.Request) error {
+		return Sign(req, body, "https://remote.example/users/alice#main-key", key)
+	}
+}
@@ -0,0 +1,285 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"portfolio-v2/safehttp"
+)
+
+// fakeInstance is a minimal fediverse server with a single account: it can
+// follow and unfollow the blog, and it verifies the signature of everything
+// delivered to its inbox before recording it
+type fakeInstance struct {
+	baseURL  string
+	username string
+	client   *http.Client
+	key      *rsa.PrivateKey
+
+	mu        sync.Mutex
+	follows   map[string]string // Followed actor ID to the ID of our Follow
+	delivered []fakeDelivery
+	rejected  []error
+}
+
+// fakeDelivery is an activity the fake's inbox accepted
+type fakeDelivery struct {
+	Signer string // Actor ID of the verified signer
+	Inbox  string // Path it was delivered to
+	Activity
+}
+
+// newFakeInstance starts a fake instance with one account on a local server
+// that is stopped when the test ends
+func newFakeInstance(t *testing.T, username string) *fakeInstance {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	f := &fakeInstance{
+		username: username,
+		client:   safehttp.NewClient(true),
+		key:      key,
+		follows:  map[string]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/"+username, f.serveActor)
+	mux.HandleFunc("POST /users/"+username+"/inbox", f.serveInbox)
+	mux.HandleFunc("POST /inbox", f.serveInbox)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	f.baseURL = server.URL
+
+	return f
+}
+
+// actorID returns the ID of the fake account
+func (f *fakeInstance) actorID() string { return f.baseURL + "/users/" + f.username }
+
+func (f *fakeInstance) keyID() string { return f.actorID() + "#main-key" }
+
+// deliveries returns the activities accepted so far
+func (f *fakeInstance) deliveries() []fakeDelivery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeDelivery(nil), f.delivered...)
+}
+
+// rejections returns why deliveries were refused so far
+func (f *fakeInstance) rejections() []error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]error(nil), f.rejected...)
+}
+
+func (f *fakeInstance) serveActor(w http.ResponseWriter, r *http.Request) {
+	der, err := x509.MarshalPKIXPublicKey(&f.key.PublicKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeDocument(w, &Actor{
+		Context:           jsonLDContext,
+		ID:                f.actorID(),
+		Type:              "Person",
+		PreferredUsername: f.username,
+		Inbox:             f.actorID() + "/inbox",
+		Endpoints:         &Endpoints{SharedInbox: f.baseURL + "/inbox"},
+		PublicKey: &PublicKey{
+			ID:           f.keyID(),
+			Owner:        f.actorID(),
+			PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		},
+	})
+}
+
+// serveInbox verifies and records a delivery
+func (f *fakeInstance) serveInbox(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDocumentSize))
+	if err != nil {
+		http.Error(w, "Error reading body", http.StatusBadRequest)
+		return
+	}
+
+	reject := func(status int, err error) {
+		f.mu.Lock()
+		f.rejected = append(f.rejected, err)
+		f.mu.Unlock()
+		http.Error(w, err.Error(), status)
+	}
+
+	signer, err := verifyRequest(f.client, r, body, f.keyID(), f.key)
+	if err != nil {
+		reject(http.StatusUnauthorized, err)
+		return
+	}
+
+	var activity Activity
+	if err := json.Unmarshal(body, &activity); err != nil || activity.Actor != signer.ID {
+		reject(http.StatusBadRequest, fmt.Errorf("not an activity by %s", signer.ID))
+		return
+	}
+
+	f.mu.Lock()
+	f.delivered = append(f.delivered, fakeDelivery{Signer: signer.ID, Inbox: r.URL.Path, Activity: activity})
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// follow looks up handle (user@host) by WebFinger and sends the account a
+// Follow. It returns the followed actor's ID; the Accept arrives at the
+// inbox.
+func (f *fakeInstance) follow(handle string) (string, error) {
+	target, err := f.lookup(handle)
+	if err != nil {
+		return "", err
+	}
+
+	follow := &Activity{
+		Context: jsonLDContext,
+		ID:      fmt.Sprintf("%s#follow-%d", f.actorID(), time.Now().UnixNano()),
+		Type:    "Follow",
+		Actor:   f.actorID(),
+		Object:  target.ID,
+	}
+	if err := f.deliver(target.Inbox, follow); err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	f.follows[target.ID] = follow.ID
+	f.mu.Unlock()
+
+	return target.ID, nil
+}
+
+// unfollow sends an Undo of the Follow of actor
+func (f *fakeInstance) unfollow(actor string) error {
+	f.mu.Lock()
+	followID, ok := f.follows[actor]
+	delete(f.follows, actor)
+	f.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("not following %s", actor)
+	}
+
+	target, err := fetchActor(context.Background(), f.client, actor, f.keyID(), f.key)
+	if err != nil {
+		return err
+	}
+
+	undo := &Activity{
+		Context: jsonLDContext,
+		ID:      followID + "-undo",
+		Type:    "Undo",
+		Actor:   f.actorID(),
+		Object: &Activity{
+			ID:     followID,
+			Type:   "Follow",
+			Actor:  f.actorID(),
+			Object: actor,
+		},
+	}
+	return f.deliver(target.Inbox, undo)
+}
+
+// lookup resolves handle to its actor document, over plain http like the
+// local servers the tests run
+func (f *fakeInstance) lookup(handle string) (*Actor, error) {
+	handle = strings.TrimPrefix(handle, "@")
+	_, host, ok := strings.Cut(handle, "@")
+	if !ok || host == "" {
+		return nil, fmt.Errorf("%q is not a user@host handle", handle)
+	}
+
+	resource := url.Values{"resource": {"acct:" + handle}}
+	resp, err := f.client.Get("http://" + host + "/.well-known/webfinger?" + resource.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("webfinger: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webfinger answered %d", resp.StatusCode)
+	}
+
+	var jrd JRD
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&jrd); err != nil {
+		return nil, fmt.Errorf("decode webfinger: %w", err)
+	}
+
+	for _, link := range jrd.Links {
+		if link.Rel == "self" && link.Type == ContentType {
+			return fetchActor(context.Background(), f.client, link.Href, f.keyID(), f.key)
+		}
+	}
+	return nil, errors.New("webfinger has no ActivityPub actor")
+}
+
+// signedRequest returns a POST of activity to inbox, signed by the fake
+// account, and its body
+func (f *fakeInstance) signedRequest(inbox string, activity *Activity) (*http.Request, []byte, error) {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	if err := Sign(req, body, f.keyID(), f.key); err != nil {
+		return nil, nil, err
+	}
+
+	return req, body, nil
+}
+
+// deliver POSTs a signed activity to inbox
+func (f *fakeInstance) deliver(inbox string, activity *Activity) error {
+	req, _, err := f.signedRequest(inbox, activity)
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		return fmt.Errorf("%s answered %d: %s", inbox, resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	return nil
+}
+
+// writeDocument writes v as an ActivityPub document
+func writeDocument(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
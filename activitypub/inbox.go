@@ -0,0 +1,263 @@
+package activitypub
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+)
+
+// maxDocumentSize is the most read of an inbox request or a fetched actor
+const maxDocumentSize = 1 << 20
+
+// Errors returned by Receive, so the inbox can answer with the right status
+var (
+	ErrInvalidActivity = errors.New("invalid activity")
+	ErrUnauthorized    = errors.New("request signature is not valid")
+)
+
+// errGone is returned by FetchActor when the actor was deleted
+var errGone = errors.New("actor is gone")
+
+// Receive handles an activity POSTed to the inbox with body as its body.
+// The request must be signed by the activity's actor. Follow and Undo of a
+// Follow are acted on, a Delete of a follower's account removes them, and
+// anything else is accepted and ignored.
+func (s *Service) Receive(r *http.Request, body []byte) error {
+	var activity struct {
+		Type   string `json:"type"`
+		Actor  string `json:"actor"`
+		Object any    `json:"object"`
+	}
+	if err := json.Unmarshal(body, &activity); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidActivity, err)
+	}
+	if activity.Type == "" || !validURL(activity.Actor) {
+		return fmt.Errorf("%w: type and actor are required", ErrInvalidActivity)
+	}
+
+	if activity.Type == "Delete" && objectID(activity.Object) == activity.Actor {
+		// A deleted account can no longer be fetched to check its
+		// signature, so check that it is really gone instead
+		return s.removeDeletedFollower(r.Context(), activity.Actor)
+	}
+
+	signer, err := s.verify(r, body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	if signer.ID != activity.Actor {
+		return fmt.Errorf("%w: signed by %s on behalf of %s", ErrUnauthorized, signer.ID, activity.Actor)
+	}
+
+	switch activity.Type {
+	case "Follow":
+		return s.follow(signer, activity.Object, body)
+	case "Undo":
+		undone, ok := activity.Object.(map[string]any)
+		if ok && undone["type"] == "Follow" && objectID(undone["object"]) == s.ActorID() {
+			return s.unfollow(signer.ID)
+		}
+	}
+
+	return nil
+}
+
+// follow adds the follower and queues an Accept of their Follow, whose
+// object is followed and body is follow
+func (s *Service) follow(follower *Actor, followed any, follow []byte) error {
+	if objectID(followed) != s.ActorID() {
+		return fmt.Errorf("%w: can only follow %s", ErrInvalidActivity, s.ActorID())
+	}
+	if !validURL(follower.Inbox) {
+		return fmt.Errorf("%w: follower has no inbox", ErrInvalidActivity)
+	}
+
+	f := &models.Follower{Actor: follower.ID, Inbox: follower.Inbox, Handle: follower.Handle()}
+	if follower.Endpoints != nil && validURL(follower.Endpoints.SharedInbox) {
+		f.SharedInbox = follower.Endpoints.SharedInbox
+	}
+	if err := database.SaveFollower(s.db, f); err != nil {
+		return err
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return fmt.Errorf("generate activity id: %w", err)
+	}
+
+	// The Follow is echoed back whole so the follower's server can match
+	// the Accept to it
+	accept := &Activity{
+		Context: jsonLDContext,
+		ID:      s.ActorID() + "#accept-" + id,
+		Type:    "Accept",
+		Actor:   s.ActorID(),
+		Object:  json.RawMessage(follow),
+		To:      []string{follower.ID},
+	}
+
+	payload, err := json.Marshal(accept)
+	if err != nil {
+		return fmt.Errorf("marshal accept: %w", err)
+	}
+
+	if err := database.CreateFederationDeliveries(s.db, []string{follower.Inbox}, accept.Type, string(payload)); err != nil {
+		return err
+	}
+
+	slog.Info("ActivityPub: new follower", "actor", f.Handle)
+	wake()
+	return nil
+}
+
+// unfollow removes a follower
+func (s *Service) unfollow(actor string) error {
+	removed, err := database.DeleteFollower(s.db, actor)
+	if err != nil {
+		return err
+	}
+
+	if removed {
+		slog.Info("ActivityPub: follower left", "actor", actor)
+	}
+	return nil
+}
+
+// removeDeletedFollower removes actor if it follows the blog and fetching
+// it shows the account was deleted
+func (s *Service) removeDeletedFollower(ctx context.Context, actor string) error {
+	following, err := database.IsFollower(s.db, actor)
+	if err != nil || !following {
+		return err
+	}
+
+	if _, err := s.FetchActor(ctx, actor); !errors.Is(err, errGone) {
+		return fmt.Errorf("%w: %s still exists", ErrUnauthorized, actor)
+	}
+	return s.unfollow(actor)
+}
+
+// verify checks the request's signature and returns the actor that signed
+// it
+func (s *Service) verify(r *http.Request, body []byte) (*Actor, error) {
+	return verifyRequest(s.client, r, body, s.KeyID(), s.key)
+}
+
+// FetchActor GETs the actor document at id with a signed request, which
+// servers in secure mode require. The document must have id as its ID.
+func (s *Service) FetchActor(ctx context.Context, id string) (*Actor, error) {
+	return fetchActor(ctx, s.client, id, s.KeyID(), s.key)
+}
+
+// verifyRequest checks a request's signature and returns the actor that
+// signed it. The key is fetched from its keyId, and must be the one the
+// owning actor's document lists. Fetches are signed with keyID and key.
+func verifyRequest(client *http.Client, r *http.Request, body []byte, keyID string, key *rsa.PrivateKey) (*Actor, error) {
+	sig, err := ParseSignature(r.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	keyURL, err := url.Parse(sig.KeyID)
+	if err != nil || !validURL(sig.KeyID) {
+		return nil, errors.New("keyId is not an http(s) URL")
+	}
+	keyURL.Fragment = ""
+
+	actor, err := fetchActor(r.Context(), client, keyURL.String(), keyID, key)
+	if err != nil {
+		return nil, fmt.Errorf("fetch key: %w", err)
+	}
+
+	if actor.PublicKey == nil || actor.PublicKey.ID != sig.KeyID {
+		// The keyId named a standalone key document, which says which
+		// actor owns it
+		if !validURL(actor.Owner) {
+			return nil, errors.New("key document has no owner")
+		}
+		actor, err = fetchActor(r.Context(), client, actor.Owner, keyID, key)
+		if err != nil {
+			return nil, fmt.Errorf("fetch key owner: %w", err)
+		}
+		if actor.PublicKey == nil || actor.PublicKey.ID != sig.KeyID {
+			return nil, errors.New("key owner does not list the key")
+		}
+	}
+
+	public, err := parsePublicKey(actor.PublicKey.PublicKeyPem)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sig.Verify(r, body, public, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return actor, nil
+}
+
+// fetchActor GETs the actor document at id, signed with keyID and key
+func fetchActor(ctx context.Context, client *http.Client, id, keyID string, key *rsa.PrivateKey) (*Actor, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Accept", ContentType+`, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`)
+	req.Header.Set("User-Agent", userAgent)
+	if err := Sign(req, nil, keyID, key); err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound:
+		return nil, errGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, fmt.Errorf("%s answered %d", id, resp.StatusCode)
+	}
+
+	var actor Actor
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&actor); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", id, err)
+	}
+
+	if actor.ID != id {
+		return nil, fmt.Errorf("%s has the id %q", id, actor.ID)
+	}
+
+	return &actor, nil
+}
+
+// objectID returns the ID of an activity's object, whether it is nested or
+// given by ID
+func objectID(object any) string {
+	switch o := object.(type) {
+	case string:
+		return o
+	case map[string]any:
+		id, _ := o["id"].(string)
+		return id
+	}
+	return ""
+}
+
+// validURL reports whether raw is an absolute http:// or https:// URL
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,214 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Tolerance is how far a signed request's Date may be from the receiver's
+// clock before it is rejected as a possible replay
+const Tolerance = time.Hour
+
+// signatureParam matches one key="value" pair of a Signature header
+var signatureParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Signature is a parsed Signature header, as defined by the draft HTTP
+// Signatures spec that fediverse servers use
+// (https://datatracker.ietf.org/doc/html/draft-cavage-http-signatures-12)
+type Signature struct {
+	KeyID     string
+	Algorithm string
+	Headers   []string // Lower case, in signing order
+	Value     []byte
+}
+
+// Sign adds Date, Digest (when body is not nil) and Signature headers to
+// req, signed with key. The signature covers the method and path, Host,
+// Date and Digest, which is what Mastodon and most other servers require.
+func Sign(req *http.Request, body []byte, keyID string, key *rsa.PrivateKey) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		req.Header.Set("Digest", digest(body))
+		headers = append(headers, "digest")
+	}
+
+	signing, err := signingString(req.Method, req.URL.RequestURI(), req.URL.Host, req.Header, headers)
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256([]byte(signing))
+	value, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return fmt.Errorf("sign request: %w", err)
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(value)))
+	return nil
+}
+
+// ParseSignature reads the Signature header of a request
+func ParseSignature(header http.Header) (*Signature, error) {
+	raw := header.Get("Signature")
+	if raw == "" {
+		return nil, errors.New("request is not signed")
+	}
+
+	sig := &Signature{Headers: []string{"date"}}
+	for _, m := range signatureParam.FindAllStringSubmatch(raw, -1) {
+		switch m[1] {
+		case "keyId":
+			sig.KeyID = m[2]
+		case "algorithm":
+			sig.Algorithm = m[2]
+		case "headers":
+			sig.Headers = strings.Fields(strings.ToLower(m[2]))
+		case "signature":
+			value, err := base64.StdEncoding.DecodeString(m[2])
+			if err != nil {
+				return nil, errors.New("signature is not valid base64")
+			}
+			sig.Value = value
+		}
+	}
+
+	if sig.KeyID == "" || len(sig.Value) == 0 {
+		return nil, errors.New("signature has no keyId or value")
+	}
+
+	// hs2019 leaves the algorithm to the key, which is RSA for every
+	// server this talks to
+	if sig.Algorithm != "" && sig.Algorithm != "rsa-sha256" && sig.Algorithm != "hs2019" {
+		return nil, fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+
+	return sig, nil
+}
+
+// Verify checks that sig signs r with key. It requires the method and path,
+// Host and Date to be covered, and for requests with a body the Digest too,
+// which must match body. Dates more than Tolerance from now are rejected.
+func (sig *Signature) Verify(r *http.Request, body []byte, key *rsa.PublicKey, now time.Time) error {
+	required := []string{"(request-target)", "host", "date"}
+	if r.Method == http.MethodPost {
+		required = append(required, "digest")
+	}
+	for _, name := range required {
+		if !sig.covers(name) {
+			return fmt.Errorf("signature does not cover %s", name)
+		}
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return errors.New("missing or invalid Date")
+	}
+	if age := now.Sub(date); age > Tolerance || age < -Tolerance {
+		return errors.New("date is outside the allowed tolerance")
+	}
+
+	if r.Method == http.MethodPost && !digestMatches(r.Header.Get("Digest"), body) {
+		return errors.New("digest does not match the body")
+	}
+
+	signing, err := signingString(r.Method, r.URL.RequestURI(), r.Host, r.Header, sig.Headers)
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256([]byte(signing))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig.Value); err != nil {
+		return errors.New("signature does not match")
+	}
+
+	return nil
+}
+
+func (sig *Signature) covers(name string) bool {
+	for _, h := range sig.Headers {
+		if h == name {
+			return true
+		}
+	}
+	return false
+}
+
+// signingString builds the string a signature over headers is computed on
+func signingString(method, target, host string, header http.Header, headers []string) (string, error) {
+	lines := make([]string, 0, len(headers))
+	for _, name := range headers {
+		var value string
+		switch name {
+		case "(request-target)":
+			value = strings.ToLower(method) + " " + target
+		case "host":
+			value = host
+		default:
+			values := header.Values(name)
+			if len(values) == 0 {
+				return "", fmt.Errorf("signed header %s is missing", name)
+			}
+			value = strings.Join(values, ", ")
+		}
+		lines = append(lines, name+": "+value)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// digest returns the Digest header value for body
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// digestMatches reports whether a Digest header has a SHA-256 entry
+// matching body
+func digestMatches(value string, body []byte) bool {
+	expected := digest(body)
+	for _, d := range strings.Split(value, ",") {
+		algorithm, sum, ok := strings.Cut(strings.TrimSpace(d), "=")
+		if ok && strings.EqualFold(algorithm, "SHA-256") && "SHA-256="+sum == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePublicKey decodes a PEM encoded RSA public key, in the PKIX form
+// most servers publish or the PKCS #1 form some older ones do
+func parsePublicKey(encoded string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+
+	return key, nil
+}
@@ -0,0 +1,238 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+)
+
+// MaxAttempts is how many times a delivery is tried before it is marked
+// failed. With the backoff below the last retry is about two hours after
+// the activity.
+const MaxAttempts = 8
+
+// Retention is how long finished deliveries are kept for the admin page
+const Retention = 30 * 24 * time.Hour
+
+const (
+	retryBase       = time.Minute // Delay before the first retry, doubled for each one after
+	batchSize       = 20          // Outbox items or deliveries loaded per query
+	maxResponseBody = 256         // Bytes of an error response kept as the error
+	userAgent       = "portfolio-v2-activitypub"
+)
+
+// wakeup lets Publish and Receive start a running worker early instead of
+// waiting for its next tick, so followers see posts straight away
+var wakeup = make(chan struct{}, 1)
+
+func wake() {
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due outbox items and deliveries now, then whenever something is
+// queued and every interval, until ctx is cancelled (run in a goroutine).
+// Both queues live in the database, so work left when the process stops is
+// done after it restarts.
+func Run(ctx context.Context, s *Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastPruned time.Time
+	for {
+		s.sendOutbox(ctx)
+		s.deliverDue(ctx)
+
+		if time.Since(lastPruned) > 24*time.Hour {
+			removed, err := database.PruneFederationDeliveries(s.db, time.Now().Add(-Retention))
+			if err != nil {
+				slog.Error("Failed to prune federation deliveries", "err", err)
+			} else if removed > 0 {
+				slog.Info("Pruned federation deliveries", "count", removed)
+			}
+			lastPruned = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wakeup:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendOutbox queues a delivery of every due outbox item to each follower's
+// inbox, a batch at a time, until ctx is cancelled
+func (s *Service) sendOutbox(ctx context.Context) {
+	for {
+		items, err := database.GetDueOutboxItems(s.db, time.Now(), batchSize)
+		if err != nil {
+			slog.Error("Failed to load the ActivityPub outbox", "err", err)
+			return
+		}
+
+		for i := range items {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := s.send(&items[i]); err != nil {
+				slog.Error("Failed to send activity to followers", "activity", items[i].Activity, "post_id", items[i].PostID, "err", err)
+				return
+			}
+		}
+
+		if len(items) < batchSize {
+			return
+		}
+	}
+}
+
+// send builds the activity for item and queues it for every follower
+func (s *Service) send(item *models.OutboxItem) error {
+	var activity *Activity
+	if item.Activity == models.ActivityDelete {
+		activity = s.deleteActivity(item.Slug, time.Now())
+	} else {
+		post, err := database.GetBlogPostByID(s.db, int(item.PostID))
+		if err != nil {
+			return err
+		}
+		if post == nil {
+			// Deleted while queued and never sent, so there is nothing
+			// to tell followers
+			return database.SendOutboxItem(s.db, item, nil, item.Activity, "")
+		}
+		activity = s.PostActivity(item.Activity, post, time.Now())
+	}
+
+	payload, err := json.Marshal(activity)
+	if err != nil {
+		return fmt.Errorf("marshal activity: %w", err)
+	}
+
+	followers, err := database.GetFollowers(s.db)
+	if err != nil {
+		return err
+	}
+
+	// Followers on the same server share an inbox, which gets one copy
+	seen := map[string]bool{}
+	var inboxes []string
+	for i := range followers {
+		inbox := followers[i].DeliveryInbox()
+		if !seen[inbox] {
+			seen[inbox] = true
+			inboxes = append(inboxes, inbox)
+		}
+	}
+
+	if err := database.SendOutboxItem(s.db, item, inboxes, activity.Type, string(payload)); err != nil {
+		return err
+	}
+
+	slog.Info("ActivityPub: activity queued", "activity", item.Activity, "slug", item.Slug, "inboxes", len(inboxes))
+	return nil
+}
+
+// deliverDue attempts every delivery that is due, a batch at a time, until
+// ctx is cancelled
+func (s *Service) deliverDue(ctx context.Context) {
+	for {
+		deliveries, err := database.GetDueFederationDeliveries(s.db, time.Now(), batchSize)
+		if err != nil {
+			slog.Error("Failed to load federation deliveries", "err", err)
+			return
+		}
+
+		for i := range deliveries {
+			if ctx.Err() != nil {
+				return
+			}
+			delivery := &deliveries[i]
+
+			s.attempt(ctx, delivery)
+			if ctx.Err() != nil {
+				// Cut off by shutdown, which is not the inbox's fault; the
+				// delivery stays due and is retried after a restart
+				return
+			}
+			if err := database.RecordFederationAttempt(s.db, delivery); err != nil {
+				slog.Error("Failed to record federation delivery", "delivery_id", delivery.ID, "err", err)
+				return
+			}
+		}
+
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// attempt POSTs delivery to its inbox once and updates it with the outcome
+func (s *Service) attempt(ctx context.Context, delivery *models.FederationDelivery) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = 0
+	delivery.Error = ""
+
+	status, err := s.post(ctx, delivery.Inbox, []byte(delivery.Activity))
+	delivery.ResponseStatus = status
+
+	if err == nil {
+		delivery.Status = models.DeliveryDelivered
+		return
+	}
+	delivery.Error = err.Error()
+
+	// A server saying the inbox is gone will not take it back
+	if status == http.StatusGone || delivery.Attempts >= MaxAttempts {
+		delivery.Status = models.DeliveryFailed
+		slog.Warn("ActivityPub delivery failed for good", "delivery_id", delivery.ID, "inbox", delivery.Inbox, "attempts", delivery.Attempts, "reason", delivery.Error)
+		return
+	}
+
+	delivery.Status = models.DeliveryPending
+	delivery.NextAttemptAt = now.Add(retryBase << (delivery.Attempts - 1))
+	slog.Warn("ActivityPub delivery failed", "delivery_id", delivery.ID, "inbox", delivery.Inbox, "attempt", delivery.Attempts, "reason", delivery.Error)
+}
+
+// post sends a signed activity to inbox and returns the response status.
+// Any 2xx status means it was accepted.
+func (s *Service) post(ctx context.Context, inbox string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("User-Agent", userAgent)
+	if err := Sign(req, body, s.KeyID(), s.key); err != nil {
+		return 0, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		return resp.StatusCode, fmt.Errorf("inbox answered %d: %s", resp.StatusCode, strings.TrimSpace(strings.ToValidUTF8(string(snippet), "�")))
+	}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,122 @@
+// Package analytics counts which pages people read, without cookies and
+// without keeping anything that identifies them.
+//
+// For each page a browser loads the Recorder keeps the path, the host of
+// the referring site, a coarse device class and a visitor hash from the
+// visitor package, which changes daily. IP addresses, user agents, query
+// strings and times of day are never stored. Bots, prefetches and requests
+// sent with Do Not Track or Global Privacy Control are not counted.
+//
+// Views are kept one by one only for the current day. Maintain then rolls
+// them up into daily counts per path, referrer and device, which are kept
+// for Retention. Requests for missing pages, by people and bots alike, are
+// counted per path and day for NotFoundRetention.
+package analytics
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"portfolio-v2/models"
+)
+
+// maxPathLength is the longest path recorded; longer ones are cut off
+const maxPathLength = 200
+
+// botMarkers are user agent fragments of crawlers, link previewers,
+// monitors and HTTP libraries, matched case-insensitively
+var botMarkers = []string{
+	"bot", "crawl", "spider", "slurp", "archiver", "scraper",
+	"preview", "monitor", "uptime", "headless", "lighthouse", "pingdom",
+	"facebookexternalhit", "embedly", "feedfetcher", "feedly",
+	"curl", "wget", "httpie", "python-", "go-http-client", "java/",
+	"okhttp", "axios", "node-fetch", "libwww", "apache-httpclient",
+}
+
+// excludedPrefixes are paths that are never counted: the admin area and
+// machine endpoints
+var excludedPrefixes = []string{"/admin", "/api/", "/ap/", "/static/", "/.well-known/"}
+
+// IsBot reports whether userAgent looks like an automated client rather
+// than a browser
+func IsBot(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+
+	ua := strings.ToLower(userAgent)
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeviceClass returns the coarse device class of userAgent
+func DeviceClass(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "Tablet"),
+		strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile"):
+		return models.DeviceTablet
+	case strings.Contains(userAgent, "Mobi"), strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "Android"):
+		return models.DeviceMobile
+	}
+	return models.DeviceDesktop
+}
+
+// ReferrerHost returns the host of the site that linked to the page, without
+// a leading "www.", or "" if there is none or it is the site itself
+func ReferrerHost(referrer, siteHost string) string {
+	u, err := url.Parse(referrer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	site, _, _ := strings.Cut(strings.ToLower(siteHost), ":")
+	if host == strings.TrimPrefix(site, "www.") {
+		return ""
+	}
+	return host
+}
+
+// counted reports whether r, a GET request, is a page load by a person who
+// has not opted out of being counted
+func counted(r *http.Request) bool {
+	for _, prefix := range excludedPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+
+	// HTMX fragments are parts of a page already counted, and browsers ask
+	// for text/html when navigating while most scripts do not
+	if r.Header.Get("HX-Request") == "true" || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+
+	if r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1" {
+		return false
+	}
+
+	purpose := r.Header.Get("Sec-Purpose") + r.Header.Get("Purpose")
+	if strings.Contains(purpose, "prefetch") || strings.Contains(purpose, "prerender") {
+		return false
+	}
+
+	return !IsBot(r.UserAgent())
+}
+
+// pagePath returns the path a view of r is counted under
+func pagePath(r *http.Request) string {
+	path := r.URL.Path
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if len(path) > maxPathLength {
+		path = path[:maxPathLength]
+	}
+	return path
+}
@@ -0,0 +1,206 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/visitor"
+)
+
+// Retention is how long the daily counts of page views are kept
+const Retention = 2 * 365 * 24 * time.Hour
+
+// NotFoundRetention is how long the daily counts of 404s are kept
+const NotFoundRetention = 90 * 24 * time.Hour
+
+const (
+	queueSize = 1000 // Hits waiting to be stored before new ones are dropped
+	batchSize = 100  // Hits stored per batch
+)
+
+// hit is a page view or a 404 waiting to be stored
+type hit struct {
+	view     *models.PageView
+	notFound *models.NotFoundHit
+}
+
+// Recorder counts page views and 404s. They are queued and stored in the
+// background, so recording never slows a response down.
+type Recorder struct {
+	db       *sql.DB
+	visitors *visitor.Hasher
+	hits     chan hit
+}
+
+// NewRecorder returns a Recorder storing views in db. Run must be started
+// for them to be stored.
+func NewRecorder(db *sql.DB, visitors *visitor.Hasher) *Recorder {
+	return &Recorder{
+		db:       db,
+		visitors: visitors,
+		hits:     make(chan hit, queueSize),
+	}
+}
+
+// statusWriter remembers the status code and content type a handler
+// responded with
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	contentType string
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Write sniffs the content type of responses that do not set one, as
+// net/http does, so Middleware can tell pages from other responses
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	if sw.contentType == "" {
+		sw.contentType = sw.Header().Get("Content-Type")
+		if sw.contentType == "" {
+			sw.contentType = http.DetectContentType(b)
+		}
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Middleware counts a view of every page next serves successfully as HTML
+// to a person, and every GET request it answers with a 404
+func (rec *Recorder) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		next(sw, r)
+
+		now := time.Now()
+		day := now.UTC().Format("2006-01-02")
+
+		if sw.status == http.StatusNotFound {
+			rec.enqueue(hit{notFound: &models.NotFoundHit{Day: day, Path: pagePath(r)}})
+			return
+		}
+
+		if sw.status != http.StatusOK || !strings.HasPrefix(sw.contentType, "text/html") || !counted(r) {
+			return
+		}
+
+		hash, err := rec.visitors.Hash(visitor.ClientIP(r), r.UserAgent(), now)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to hash visitor for page view", "err", err)
+			return
+		}
+
+		rec.enqueue(hit{view: &models.PageView{
+			Day:          day,
+			Path:         pagePath(r),
+			ReferrerHost: ReferrerHost(r.Referer(), r.Host),
+			Device:       DeviceClass(r.UserAgent()),
+			Visitor:      hash,
+		}})
+	}
+}
+
+// enqueue queues h to be stored. A full queue means the database is
+// falling behind; h is dropped rather than holding up the response.
+func (rec *Recorder) enqueue(h hit) {
+	select {
+	case rec.hits <- h:
+	default:
+	}
+}
+
+// Run stores queued hits in batches until ctx is cancelled, then stores
+// those still queued and returns (run in a goroutine)
+func (rec *Recorder) Run(ctx context.Context) {
+	for {
+		var h hit
+		select {
+		case h = <-rec.hits:
+		case <-ctx.Done():
+			if len(rec.hits) == 0 {
+				return
+			}
+			h = <-rec.hits
+		}
+		batch := []hit{h}
+
+	fill:
+		for len(batch) < batchSize {
+			select {
+			case h := <-rec.hits:
+				batch = append(batch, h)
+			default:
+				break fill
+			}
+		}
+
+		var views []models.PageView
+		var notFound []models.NotFoundHit
+		for _, h := range batch {
+			if h.view != nil {
+				views = append(views, *h.view)
+			} else {
+				notFound = append(notFound, *h.notFound)
+			}
+		}
+
+		if len(views) > 0 {
+			if err := database.InsertPageViews(rec.db, views); err != nil {
+				slog.Error("Failed to store page views", "count", len(views), "err", err)
+			}
+		}
+		if len(notFound) > 0 {
+			if err := database.InsertNotFoundHits(rec.db, notFound); err != nil {
+				slog.Error("Failed to store not found hits", "count", len(notFound), "err", err)
+			}
+		}
+	}
+}
+
+// Maintain rolls up the views of days before now and prunes counts older
+// than Retention, and 404s older than NotFoundRetention
+func Maintain(db *sql.DB, now time.Time) error {
+	rolled, err := database.RollupPageViews(db, now)
+	if err != nil {
+		return err
+	}
+	if rolled > 0 {
+		slog.Info("Rolled up page views", "count", rolled)
+	}
+
+	removed, err := database.PruneAnalytics(db, now.Add(-Retention))
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		slog.Info("Pruned page view counts", "count", removed, "older_than_days", int(Retention.Hours()/24))
+	}
+
+	removed, err = database.PruneNotFoundHits(db, now.Add(-NotFoundRetention))
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		slog.Info("Pruned not found counts", "count", removed, "older_than_days", int(NotFoundRetention.Hours()/24))
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package analytics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"portfolio-v2/internal/testdb"
+	"portfolio-v2/visitor"
+)
+
+// TestMiddlewareIgnoresForgedForwardedFor checks that a client cannot count
+// as a new visitor on every request by sending its own X-Forwarded-For
+func TestMiddlewareIgnoresForgedForwardedFor(t *testing.T) {
+	db := testdb.Open(t)
+	rec := NewRecorder(db, visitor.New(db))
+	page := rec.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<p>Hello</p>")
+	})
+
+	visitors := map[string]bool{}
+	for _, forged := range []string{"203.0.113.9", "203.0.113.10", "203.0.113.11"} {
+		r := httptest.NewRequest(http.MethodGet, "/blog", nil)
+		r.RemoteAddr = "127.0.0.1:4711"
+		r.Header.Set("Accept", "text/html")
+		r.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:140.0) Gecko/20100101 Firefox/140.0")
+		r.Header.Set("X-Forwarded-For", forged+", 198.51.100.7")
+		page(httptest.NewRecorder(), r)
+
+		select {
+		case h := <-rec.hits:
+			visitors[h.view.Visitor] = true
+		default:
+			t.Fatalf("view with X-Forwarded-For %s was not recorded", forged)
+		}
+	}
+
+	if len(visitors) != 1 {
+		t.Errorf("forged addresses counted as %d visitors, want 1", len(visitors))
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"portfolio-v2/config"
+	"portfolio-v2/handlers"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/openapi"
+)
+
+// apiMux is where API routes are registered: the server's ServeMux, or an
+// openapi.Routes when checking the routes against the spec
+type apiMux interface {
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// apiSpec documents every route registerAPIRoutes registers. Run
+// `go test` after changing either.
+var apiSpec = openapi.Spec()
+
+// registerAPIRoutes registers every /api endpoint
+func registerAPIRoutes(mux apiMux, db *sql.DB, cfg *config.Config) {
+	// HTML fragments for the home page's HTMX feeds
+	mux.HandleFunc("/api/blog/posts", handlers.BlogPostsAPIHandler(db, cfg.Pages.Posts))
+	mux.HandleFunc("/api/projects", handlers.ProjectsAPIHandler(db, cfg.Pages.Projects))
+
+	// Versioned JSON API: reads are public, writes need an API token with
+	// the matching scope
+	apiAuth := func(scope models.Scope, next http.HandlerFunc) http.HandlerFunc {
+		return middleware.BearerAuthWithErrors(db, scope, handlers.APITokenError)(next)
+	}
+	mux.HandleFunc("/api/v1/posts", handlers.APIPostsHandler(db, apiAuth(models.ScopePostsWrite, handlers.APICreatePostHandler(db, cfg.SiteURL))))
+	mux.HandleFunc("/api/v1/posts/", handlers.APIPostHandler(db, apiAuth(models.ScopePostsWrite, handlers.APIWritePostHandler(db, cfg.SiteURL))))
+	mux.HandleFunc("/api/v1/projects", handlers.APIProjectsHandler(db, apiAuth(models.ScopeProjectsWrite, handlers.APICreateProjectHandler(db))))
+	mux.HandleFunc("/api/v1/projects/", handlers.APIProjectHandler(db, apiAuth(models.ScopeProjectsWrite, handlers.APIWriteProjectHandler(db))))
+	mux.HandleFunc("/api/v1/messages", handlers.APIAllow(apiAuth(models.ScopeMessagesRead, handlers.MessagesAPIHandler(db)), http.MethodGet))
+
+	// The contract for the above
+	mux.HandleFunc("/api/openapi.json", handlers.OpenAPIHandler(apiSpec))
+	mux.HandleFunc("/api/docs", handlers.APIDocsHandler(apiSpec))
+}
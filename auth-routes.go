@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"portfolio-v2/handlers"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/passkey"
+	"portfolio-v2/ratelimit"
+	"portfolio-v2/session"
+)
+
+// authRoutes are the login, account and security routes, with what they
+// need to sign users in and keep them signed in
+type authRoutes struct {
+	db         *sql.DB
+	sessions   session.Store
+	logins     *ratelimit.Limiter // Password and passkey logins, per IP
+	mfa        *ratelimit.Limiter // Second-factor attempts, per account
+	challenges *session.ChallengeStore
+	webAuthn   *webauthn.WebAuthn
+	ceremonies *passkey.CeremonyStore
+}
+
+// adminAuth requires a session with at least role, and a matching CSRF
+// token on unsafe methods. Every admin route is wrapped in it.
+func (a *authRoutes) adminAuth(role models.Role, next http.HandlerFunc) http.HandlerFunc {
+	return middleware.SessionAuth(a.sessions, true)(middleware.RequireRole(a.db, role)(middleware.CSRF(next)))
+}
+
+// register registers the routes on mux
+func (a *authRoutes) register(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handlers.LoginPageHandler(a.sessions)(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.LoginHandler(a.sessions, a.logins, a.db, a.challenges)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/admin/login/verify", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handlers.LoginVerifyPageHandler(a.challenges)(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.LoginVerifyHandler(a.sessions, a.mfa, a.db, a.challenges)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/admin/login/passkey/begin", handlers.BeginPasskeyLoginHandler(a.webAuthn, a.ceremonies))
+	mux.HandleFunc("/admin/login/passkey/finish", handlers.FinishPasskeyLoginHandler(a.sessions, a.logins, a.db, a.webAuthn, a.ceremonies))
+	mux.HandleFunc("/admin/logout", a.adminAuth(models.RoleViewer, handlers.LogoutHandler(a.sessions, a.db)))
+
+	// Every signed-in user manages their own account and sessions
+	mux.HandleFunc("/admin/account/2fa", a.adminAuth(models.RoleViewer, handlers.TwoFactorPageHandler(a.db)))
+	mux.HandleFunc("/admin/account/2fa/enable", a.adminAuth(models.RoleViewer, handlers.EnableTwoFactorHandler(a.db, a.sessions)))
+	mux.HandleFunc("/admin/account/2fa/disable", a.adminAuth(models.RoleViewer, handlers.DisableTwoFactorHandler(a.db, a.sessions)))
+	mux.HandleFunc("/admin/account/2fa/recovery-codes", a.adminAuth(models.RoleViewer, handlers.RegenerateRecoveryCodesHandler(a.db)))
+	mux.HandleFunc("/admin/account/passkeys", a.adminAuth(models.RoleViewer, handlers.PasskeysPageHandler(a.db)))
+	mux.HandleFunc("/admin/account/passkeys/register/begin", a.adminAuth(models.RoleViewer, handlers.BeginPasskeyRegistrationHandler(a.db, a.webAuthn, a.ceremonies)))
+	mux.HandleFunc("/admin/account/passkeys/register/finish", a.adminAuth(models.RoleViewer, handlers.FinishPasskeyRegistrationHandler(a.db, a.sessions, a.webAuthn, a.ceremonies)))
+	mux.HandleFunc("/admin/account/passkeys/delete/", a.adminAuth(models.RoleViewer, handlers.DeletePasskeyHandler(a.db, a.sessions)))
+	mux.HandleFunc("/admin/account/passkeys/", a.adminAuth(models.RoleViewer, handlers.RenamePasskeyHandler(a.db)))
+	mux.HandleFunc("/admin/account/password", a.adminAuth(models.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handlers.ChangePasswordPageHandler()(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.ChangePasswordHandler(a.db, a.sessions, a.logins)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	mux.HandleFunc("/admin/account/tokens", a.adminAuth(models.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handlers.TokensPageHandler(a.db)(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.CreateTokenHandler(a.db)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	mux.HandleFunc("/admin/account/tokens/delete/", a.adminAuth(models.RoleViewer, handlers.DeleteTokenHandler(a.db)))
+	mux.HandleFunc("/admin/security", a.adminAuth(models.RoleViewer, handlers.SecurityPageHandler(a.sessions)))
+	mux.HandleFunc("/admin/security/sessions/revoke", a.adminAuth(models.RoleViewer, handlers.RevokeSessionHandler(a.sessions, a.db)))
+	mux.HandleFunc("/admin/security/sessions/revoke-all", a.adminAuth(models.RoleViewer, handlers.RevokeAllSessionsHandler(a.sessions, a.db)))
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"golang.org/x/crypto/bcrypt"
+
+	"portfolio-v2/database"
+	"portfolio-v2/internal/testdb"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/passkey"
+	"portfolio-v2/ratelimit"
+	"portfolio-v2/session"
+	"portfolio-v2/totp"
+)
+
+const (
+	testRPID     = "localhost"
+	testOrigin   = "http://localhost"
+	testPassword = "correct-horse-battery"
+)
+
+// authServer serves the login, account and security routes as main
+// registers them
+type authServer struct {
+	*httptest.Server
+	db       *sql.DB
+	sessions session.Store
+}
+
+func newAuthServer(t *testing.T) *authServer {
+	t.Helper()
+
+	db := testdb.Open(t)
+
+	wa, err := passkey.New(testRPID, testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := session.NewSQLiteStore(db, session.DefaultOptions)
+	auth := &authRoutes{
+		db:         db,
+		sessions:   sessions,
+		logins:     ratelimit.NewLimiter(100, time.Minute),
+		mfa:        ratelimit.NewLimiter(100, time.Minute),
+		challenges: session.NewChallengeStore(time.Minute, 5),
+		webAuthn:   wa,
+		ceremonies: passkey.NewCeremonyStore(time.Minute),
+	}
+
+	mux := http.NewServeMux()
+	auth.register(mux)
+	// Stands in for the dashboard, naming the signed-in user
+	mux.HandleFunc("/admin", auth.adminAuth(models.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		user, _ := middleware.GetUser(r)
+		io.WriteString(w, user.Username)
+	}))
+
+	s := &authServer{Server: httptest.NewServer(mux), db: db, sessions: sessions}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// createUser stores an owner with testPassword
+func (s *authServer) createUser(t *testing.T, username string) *models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Username: username, PasswordHash: string(hash), Role: models.RoleOwner}
+	if err := database.CreateUser(s.db, user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// browser is a cookie-keeping client that does not follow redirects
+type browser struct {
+	t      *testing.T
+	server *authServer
+	client *http.Client
+}
+
+func (s *authServer) browser(t *testing.T) *browser {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &browser{t: t, server: s, client: &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// cookie returns the value of the cookie name sent to path, or ""
+func (b *browser) cookie(path, name string) string {
+	u, _ := url.Parse(b.server.URL + path)
+	for _, c := range b.client.Jar.Cookies(u) {
+		if c.Name == name {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// do sends a request and returns the status and body
+func (b *browser) do(method, path, contentType string, body io.Reader, header http.Header) (int, []byte) {
+	b.t.Helper()
+	req, err := http.NewRequest(method, b.server.URL+path, body)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// loginCSRF loads the login page and returns its CSRF token
+func (b *browser) loginCSRF() string {
+	b.t.Helper()
+	if status, _ := b.do(http.MethodGet, "/admin/login", "", nil, nil); status != http.StatusOK {
+		b.t.Fatalf("login page status %d", status)
+	}
+	token := b.cookie("/admin/login", "csrf_token")
+	if token == "" {
+		b.t.Fatal("login page set no CSRF cookie")
+	}
+	return token
+}
+
+// postForm posts form values, adding the login page's CSRF token
+func (b *browser) postForm(path, csrf string, values url.Values) (int, []byte) {
+	values.Set("csrf_token", csrf)
+	return b.do(http.MethodPost, path, "application/x-www-form-urlencoded", strings.NewReader(values.Encode()), nil)
+}
+
+// login signs in with the password, completing no second factor
+func (b *browser) login(username string) int {
+	status, _ := b.postForm("/admin/login", b.loginCSRF(), url.Values{"username": {username}, "password": {testPassword}})
+	return status
+}
+
+// sessionCSRF returns the CSRF token of the browser's session
+func (b *browser) sessionCSRF() string {
+	b.t.Helper()
+	sess, ok := b.server.sessions.Get(b.cookie("/admin", "session_id"))
+	if !ok {
+		b.t.Fatal("browser has no session")
+	}
+	return sess.CSRFToken
+}
+
+// whoami returns the user the browser's session belongs to, or "" if the
+// browser is not signed in
+func (b *browser) whoami() string {
+	b.t.Helper()
+	status, body := b.do(http.MethodGet, "/admin", "", nil, nil)
+	if status != http.StatusOK {
+		return ""
+	}
+	return string(body)
+}
+
+// softAuthenticator is a software passkey: a P-256 key bound to one relying
+// party, with a signature counter the test controls
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{key: key, credentialID: id}
+}
+
+// creationOptions and requestOptions are the parts of the options
+// handlers return that an authenticator needs
+type creationOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		User      struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+type requestOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+	} `json:"publicKey"`
+}
+
+// authData builds authenticator data with the user present and verified
+// flags, and attested credential data when attested is set
+func (a *softAuthenticator) authData(attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	flags := byte(0x01 | 0x04) // UP, UV
+	if attested != nil {
+		flags |= 0x40 // AT
+	}
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	return append(data, attested...)
+}
+
+func clientData(t *testing.T, ceremony, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": testOrigin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// create answers registration options with a "none" attestation
+func (a *softAuthenticator) create(t *testing.T, optionsJSON []byte) []byte {
+	t.Helper()
+	var options creationOptions
+	if err := json.Unmarshal(optionsJSON, &options); err != nil {
+		t.Fatalf("decode creation options: %v", err)
+	}
+	handle, err := base64.RawURLEncoding.DecodeString(options.PublicKey.User.ID)
+	if err != nil {
+		t.Fatalf("decode user handle: %v", err)
+	}
+	a.userHandle = handle
+
+	pub, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := pub.Bytes() // 0x04 || X || Y
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: point[1:33],
+		YCoord: point[33:],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(struct {
+		Format   string         `cbor:"fmt"`
+		AttStmt  map[string]any `cbor:"attStmt"`
+		AuthData []byte         `cbor:"authData"`
+	}{"none", map[string]any{}, a.authData(attested)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64(clientData(t, "webauthn.create", options.PublicKey.Challenge)),
+		"attestationObject": b64(attestation),
+	})
+}
+
+// get answers login options with an assertion signed by a's key
+func (a *softAuthenticator) get(t *testing.T, optionsJSON []byte) []byte {
+	t.Helper()
+	var options requestOptions
+	if err := json.Unmarshal(optionsJSON, &options); err != nil {
+		t.Fatalf("decode request options: %v", err)
+	}
+
+	authData := a.authData(nil)
+	client := clientData(t, "webauthn.get", options.PublicKey.Challenge)
+	clientHash := sha256.Sum256(client)
+	digest := sha256.Sum256(append(bytes.Clone(authData), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64(client),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// register signs b in with the password and registers auth as a passkey
+func (b *browser) register(auth *softAuthenticator, username string) {
+	b.t.Helper()
+	if status := b.login(username); status != http.StatusSeeOther {
+		b.t.Fatalf("password login status %d", status)
+	}
+
+	csrf := http.Header{middleware.CSRFHeader: {b.sessionCSRF()}}
+	status, options := b.do(http.MethodPost, "/admin/account/passkeys/register/begin", "", nil, csrf)
+	if status != http.StatusOK {
+		b.t.Fatalf("begin registration status %d: %s", status, options)
+	}
+
+	status, body := b.do(http.MethodPost, "/admin/account/passkeys/register/finish?name=Laptop", "application/json", bytes.NewReader(auth.create(b.t, options)), csrf)
+	if status != http.StatusOK {
+		b.t.Fatalf("finish registration status %d: %s", status, body)
+	}
+}
+
+// passkeyLogin runs a discoverable login with auth and returns the status
+// of the finish request
+func (b *browser) passkeyLogin(auth *softAuthenticator) int {
+	b.t.Helper()
+	csrf := http.Header{middleware.CSRFHeader: {b.loginCSRF()}}
+	status, options := b.do(http.MethodPost, "/admin/login/passkey/begin", "", nil, csrf)
+	if status != http.StatusOK {
+		b.t.Fatalf("begin login status %d: %s", status, options)
+	}
+
+	status, _ = b.do(http.MethodPost, "/admin/login/passkey/finish", "application/json", bytes.NewReader(auth.get(b.t, options)), csrf)
+	return status
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	s := newAuthServer(t)
+	user := s.createUser(t, "owner")
+	auth := newSoftAuthenticator(t)
+
+	s.browser(t).register(auth, "owner")
+
+	passkeys, err := database.GetPasskeysByUser(s.db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 {
+		t.Fatalf("%d passkeys stored, want 1", len(passkeys))
+	}
+	if passkeys[0].Name != "Laptop" || !bytes.Equal(passkeys[0].Credential.ID, auth.credentialID) {
+		t.Errorf("stored passkey %q with ID %x, want Laptop with %x", passkeys[0].Name, passkeys[0].Credential.ID, auth.credentialID)
+	}
+	if id, ok := passkey.ParseUserHandle(auth.userHandle); !ok || id != user.ID {
+		t.Errorf("user handle names user %d, want %d", id, user.ID)
+	}
+}
+
+func TestPasskeyDiscoverableLogin(t *testing.T) {
+	s := newAuthServer(t)
+	s.createUser(t, "owner")
+	auth := newSoftAuthenticator(t)
+	s.browser(t).register(auth, "owner")
+
+	// A fresh browser signs in with the passkey alone, without a username
+	b := s.browser(t)
+	auth.counter = 1
+	if status := b.passkeyLogin(auth); status != http.StatusOK {
+		t.Fatalf("passkey login status %d, want 200", status)
+	}
+	if who := b.whoami(); who != "owner" {
+		t.Fatalf("signed in as %q, want owner", who)
+	}
+
+	// A key that is not the registered one cannot sign in
+	impostor := newSoftAuthenticator(t)
+	impostor.credentialID, impostor.userHandle, impostor.counter = auth.credentialID, auth.userHandle, 2
+	if status := s.browser(t).passkeyLogin(impostor); status != http.StatusUnauthorized {
+		t.Fatalf("login with a forged signature status %d, want 401", status)
+	}
+}
+
+func TestPasskeyLoginRejectsCloneWarning(t *testing.T) {
+	s := newAuthServer(t)
+	user := s.createUser(t, "owner")
+	auth := newSoftAuthenticator(t)
+	s.browser(t).register(auth, "owner")
+
+	auth.counter = 5
+	if status := s.browser(t).passkeyLogin(auth); status != http.StatusOK {
+		t.Fatalf("first login status %d, want 200", status)
+	}
+
+	// A counter that went backwards means a copy of the key is in use
+	auth.counter = 3
+	b := s.browser(t)
+	if status := b.passkeyLogin(auth); status != http.StatusUnauthorized {
+		t.Fatalf("login with a lower counter status %d, want 401", status)
+	}
+	if who := b.whoami(); who != "" {
+		t.Fatalf("signed in as %q after a clone warning", who)
+	}
+
+	passkeys, err := database.GetPasskeysByUser(s.db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := passkeys[0].Credential.Authenticator.SignCount; got != 5 {
+		t.Errorf("stored counter %d, want 5", got)
+	}
+}
+
+func TestPasswordAndTOTPFallback(t *testing.T) {
+	s := newAuthServer(t)
+	user := s.createUser(t, "owner")
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetTOTPSecret(s.db, user.ID, secret); err != nil {
+		t.Fatal(err)
+	}
+	recovery := "abcde-12345"
+	if err := database.EnableTOTP(s.db, user.ID, 0, []string{totp.HashRecoveryCode(recovery)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// verify posts a second factor after the password step
+	verify := func(b *browser, code string) int {
+		t.Helper()
+		csrf := b.loginCSRF()
+		status, _ := b.postForm("/admin/login", csrf, url.Values{"username": {"owner"}, "password": {testPassword}})
+		if status != http.StatusSeeOther || b.cookie("/admin/login", "login_challenge") == "" {
+			t.Fatalf("password step status %d without a challenge", status)
+		}
+		if who := b.whoami(); who != "" {
+			t.Fatalf("signed in as %q by the password alone", who)
+		}
+		status, _ = b.postForm("/admin/login/verify", csrf, url.Values{"code": {code}})
+		return status
+	}
+
+	b := s.browser(t)
+	if status := verify(b, "000000"); status != http.StatusOK || b.whoami() != "" {
+		t.Fatalf("wrong code status %d, want the form again without a session", status)
+	}
+
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := verify(b, code); status != http.StatusSeeOther {
+		t.Fatalf("TOTP step status %d, want 303", status)
+	}
+	if who := b.whoami(); who != "owner" {
+		t.Fatalf("signed in as %q, want owner", who)
+	}
+
+	// The same code cannot be replayed
+	if status := verify(s.browser(t), code); status != http.StatusOK {
+		t.Fatalf("replayed code status %d, want the form again", status)
+	}
+
+	// A recovery code works once
+	b = s.browser(t)
+	if status := verify(b, recovery); status != http.StatusSeeOther || b.whoami() != "owner" {
+		t.Fatalf("recovery code status %d, want a session", status)
+	}
+	b = s.browser(t)
+	if status := verify(b, recovery); status != http.StatusOK || b.whoami() != "" {
+		t.Fatalf("reused recovery code status %d, want the form again", status)
+	}
+}
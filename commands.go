@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"portfolio-v2/config"
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/passwords"
+	"portfolio-v2/session"
+)
+
+const commandUsage = `Usage: portfolio-v2 [command] [flags]
+
+Without a command the web server is started. Its flags are listed by -h,
+and each can also be set by an environment variable or in a TOML file
+passed with -config (see config.example.toml).
+
+Commands:
+  create-owner    Create the first owner account (password is read from stdin)
+  reset-password  Set a new password for a locked out user (password is read from stdin)
+`
+
+// runCommand executes a CLI subcommand and returns the process exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "create-owner":
+		return createOwnerCommand(args[1:])
+	case "reset-password":
+		return resetPasswordCommand(args[1:])
+	case "help":
+		fmt.Print(commandUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", args[0], commandUsage)
+		return 2
+	}
+}
+
+// commandDatabase returns the database a command acts on: dbPath if set,
+// and otherwise the server's, from the config file at configPath and the
+// environment as the server reads them
+func commandDatabase(configPath, dbPath string) (string, error) {
+	if dbPath != "" {
+		return dbPath, nil
+	}
+
+	var args []string
+	if configPath != "" {
+		args = []string{"-config", configPath}
+	}
+	cfg, err := config.Load(args)
+	if err != nil {
+		return "", fmt.Errorf("config: %w", err)
+	}
+	return cfg.Database, nil
+}
+
+// databaseExists reports whether the database file at path exists, so a
+// mistyped path is not silently created as an empty database
+func databaseExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// databaseFlags adds the flags that choose a command's database to fs
+func databaseFlags(fs *flag.FlagSet) (configPath, dbPath *string) {
+	configPath = fs.String("config", os.Getenv("CONFIG_FILE"), "TOML file the server reads its settings from (default $CONFIG_FILE)")
+	dbPath = fs.String("db", "", "path to the SQLite database (default the server's, from -config or $DATABASE_PATH)")
+	return configPath, dbPath
+}
+
+// createOwnerCommand creates the first owner account on a fresh database
+func createOwnerCommand(args []string) int {
+	fs := flag.NewFlagSet("create-owner", flag.ContinueOnError)
+	username := fs.String("username", "", "login name for the owner (required)")
+	displayName := fs.String("name", "", "name shown as the author of posts")
+	configPath, dbPath := databaseFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *username == "" {
+		fmt.Fprintln(os.Stderr, "create-owner: -username is required")
+		return 2
+	}
+
+	path, err := commandDatabase(*configPath, *dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "create-owner: %v\n", err)
+		return 1
+	}
+	exists, err := databaseExists(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "create-owner: %v\n", err)
+		return 1
+	}
+	if !exists {
+		// A new install may create its owner before the server first runs
+		fmt.Printf("Creating database %s\n", path)
+	}
+
+	db, err := database.InitDB(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "create-owner: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	count, err := database.CountUsers(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "create-owner: %v\n", err)
+		return 1
+	}
+	if count > 0 {
+		fmt.Fprintln(os.Stderr, "create-owner: users already exist; add more from /admin/users")
+		return 1
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "create-owner: %v\n", err)
+		return 1
+	}
+
+	if err := passwords.Check(password, *username); err != nil {
+		fmt.Fprintf(os.Stderr, "create-owner: %v\n", err)
+		return 1
+	}
+
+	if err := createOwner(db, *username, *displayName, password); err != nil {
+		fmt.Fprintf(os.Stderr, "create-owner: %v\n", err)
+		return 1
+	}
+
+	recordCommandAudit(db, "cli", models.AuditCreate, *username, map[string]string{"role": string(models.RoleOwner)})
+	fmt.Printf("Owner %s created\n", *username)
+	return 0
+}
+
+// resetPasswordCommand sets a new password for a user who cannot log in and
+// ends all of their sessions
+func resetPasswordCommand(args []string) int {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	username := fs.String("username", "", "user whose password is reset (required)")
+	disable2FA := fs.Bool("disable-2fa", false, "also turn off two-factor authentication, for a lost authenticator")
+	configPath, dbPath := databaseFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *username == "" {
+		fmt.Fprintln(os.Stderr, "reset-password: -username is required")
+		return 2
+	}
+
+	path, err := commandDatabase(*configPath, *dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reset-password: %v\n", err)
+		return 1
+	}
+	exists, err := databaseExists(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reset-password: %v\n", err)
+		return 1
+	}
+	if !exists {
+		fmt.Fprintf(os.Stderr, "reset-password: database %s does not exist; pass the server's -config or -db\n", path)
+		return 1
+	}
+
+	db, err := database.InitDB(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reset-password: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	user, err := database.GetUserByUsername(db, *username)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reset-password: %v\n", err)
+		return 1
+	}
+	if user == nil {
+		fmt.Fprintf(os.Stderr, "reset-password: user %q not found\n", *username)
+		return 1
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reset-password: %v\n", err)
+		return 1
+	}
+
+	if err := passwords.Check(password, user.Username); err != nil {
+		fmt.Fprintf(os.Stderr, "reset-password: %v\n", err)
+		return 1
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reset-password: hash password: %v\n", err)
+		return 1
+	}
+
+	if err := database.UpdateUserPassword(db, user.ID, string(hash)); err != nil {
+		fmt.Fprintf(os.Stderr, "reset-password: %v\n", err)
+		return 1
+	}
+
+	if *disable2FA {
+		if err := database.DisableTOTP(db, user.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "reset-password: %v\n", err)
+			return 1
+		}
+	}
+
+	removed, err := session.NewSQLiteStore(db, session.DefaultOptions).RevokeAll(user.Username)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reset-password: %v\n", err)
+		return 1
+	}
+
+	recordCommandAudit(db, "cli", models.AuditPasswordSet, user.Username, map[string]any{"sessions_revoked": removed})
+	if *disable2FA {
+		recordCommandAudit(db, "cli", models.AuditTwoFactorOff, user.Username, nil)
+	}
+
+	fmt.Printf("Password for %s reset, %d sessions logged out\n", user.Username, removed)
+	if *disable2FA {
+		fmt.Println("Two-factor authentication disabled")
+	}
+	return 0
+}
+
+// bootstrapOwner creates an owner from the admin settings, usually
+// ADMIN_USERNAME and ADMIN_PASSWORD, when the users table is empty, so
+// existing deployments keep working after upgrading. The settings are
+// ignored once a user exists.
+func bootstrapOwner(db *sql.DB, admin config.Admin) error {
+	count, err := database.CountUsers(db)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	adminUser, adminPass := admin.Username, admin.Password
+	if adminUser == "" || adminPass == "" {
+		slog.Warn("No admin users exist. Run `portfolio-v2 create-owner -username NAME` to create one")
+		return nil
+	}
+
+	if err := passwords.Check(adminPass, adminUser); err != nil {
+		slog.Warn("ADMIN_PASSWORD is weak. Change it from /admin/account/password", "reason", err)
+	}
+
+	if err := createOwner(db, adminUser, "", adminPass); err != nil {
+		return err
+	}
+
+	recordCommandAudit(db, "env", models.AuditCreate, adminUser, map[string]string{"role": string(models.RoleOwner)})
+	slog.Info("Created owner from ADMIN_USERNAME/ADMIN_PASSWORD", "user", adminUser)
+	return nil
+}
+
+// createOwner hashes the password and stores a new owner account
+func createOwner(db *sql.DB, username, displayName, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+
+	user := &models.User{
+		Username:     username,
+		DisplayName:  displayName,
+		PasswordHash: string(hash),
+		Role:         models.RoleOwner,
+	}
+	return database.CreateUser(db, user)
+}
+
+// recordCommandAudit records a change made outside the web interface against
+// the user username. actor names where it came from, e.g. "cli".
+func recordCommandAudit(db *sql.DB, actor, action, username string, after any) {
+	entry := &models.AuditEntry{
+		Actor:      actor,
+		Action:     action,
+		TargetType: models.AuditTargetUser,
+		TargetID:   username,
+	}
+
+	if after != nil {
+		data, err := json.Marshal(after)
+		if err == nil {
+			entry.After = string(data)
+		}
+	}
+
+	if err := database.RecordAudit(db, entry); err != nil {
+		slog.Error("Error recording audit entry", "action", action, "user", username, "err", err)
+	}
+}
+
+// readPassword reads a single line password from stdin
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return password, nil
+}
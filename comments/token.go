@@ -0,0 +1,155 @@
+// Package comments proves who wrote a blog comment without asking for an
+// email address or an account. Posting a comment grants the browser a
+// signed token for it, kept in a cookie, and only requests carrying the
+// token can edit or delete the comment.
+package comments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenLifetime is how long after posting a comment its author can edit
+// or delete it
+const TokenLifetime = 7 * 24 * time.Hour
+
+// CookieName is the cookie holding the tokens of a browser's comments
+const CookieName = "comment_tokens"
+
+// maxTokens is how many comments one cookie holds tokens for. Granting
+// another drops the oldest.
+const maxTokens = 20
+
+// token is a grant to edit or delete one comment until it expires
+type token struct {
+	id      int64
+	expires int64 // Unix seconds
+}
+
+// Tokens signs and reads the comment token cookie
+type Tokens struct {
+	key []byte
+}
+
+// NewTokens returns a Tokens signing with key
+func NewTokens(key []byte) *Tokens {
+	return &Tokens{key: key}
+}
+
+// Owned returns the IDs of the comments r holds an unexpired token for
+func (t *Tokens) Owned(r *http.Request, now time.Time) []int64 {
+	tokens := t.read(r, now)
+	ids := make([]int64, len(tokens))
+	for i, tok := range tokens {
+		ids[i] = tok.id
+	}
+	return ids
+}
+
+// Owns reports whether r holds an unexpired token for comment id
+func (t *Tokens) Owns(r *http.Request, id int64, now time.Time) bool {
+	for _, tok := range t.read(r, now) {
+		if tok.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Grant adds a token for comment id to the cookie of r's browser
+func (t *Tokens) Grant(w http.ResponseWriter, r *http.Request, id int64, now time.Time) {
+	tokens := append(t.read(r, now), token{id: id, expires: now.Add(TokenLifetime).Unix()})
+	if len(tokens) > maxTokens {
+		tokens = tokens[len(tokens)-maxTokens:]
+	}
+	t.write(w, tokens)
+}
+
+// Revoke removes the token for comment id from the cookie of r's browser
+func (t *Tokens) Revoke(w http.ResponseWriter, r *http.Request, id int64, now time.Time) {
+	var kept []token
+	for _, tok := range t.read(r, now) {
+		if tok.id != id {
+			kept = append(kept, tok)
+		}
+	}
+	t.write(w, kept)
+}
+
+// read returns the unexpired tokens in r's cookie. A cookie that was not
+// signed with t's key holds none.
+func (t *Tokens) read(r *http.Request, now time.Time) []token {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil
+	}
+
+	payload, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok || payload == "" || !hmac.Equal([]byte(sig), []byte(t.sign(payload))) {
+		return nil
+	}
+
+	var tokens []token
+	for _, entry := range strings.Split(payload, "_") {
+		idText, expiresText, ok := strings.Cut(entry, "-")
+		if !ok {
+			return nil
+		}
+		id, err := strconv.ParseInt(idText, 10, 64)
+		if err != nil {
+			return nil
+		}
+		expires, err := strconv.ParseInt(expiresText, 10, 64)
+		if err != nil {
+			return nil
+		}
+
+		if expires > now.Unix() {
+			tokens = append(tokens, token{id: id, expires: expires})
+		}
+	}
+	return tokens
+}
+
+// write replaces the cookie with tokens, or clears it if there are none.
+// The cookie lasts as long as its newest token.
+func (t *Tokens) write(w http.ResponseWriter, tokens []token) {
+	if len(tokens) == 0 {
+		http.SetCookie(w, &http.Cookie{
+			Name:     CookieName,
+			Value:    "",
+			Path:     "/",
+			HttpOnly: true,
+			MaxAge:   -1,
+		})
+		return
+	}
+
+	entries := make([]string, len(tokens))
+	var latest int64
+	for i, tok := range tokens {
+		entries[i] = strconv.FormatInt(tok.id, 10) + "-" + strconv.FormatInt(tok.expires, 10)
+		latest = max(latest, tok.expires)
+	}
+	payload := strings.Join(entries, "_")
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    payload + "." + t.sign(payload),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Unix(latest, 0),
+	})
+}
+
+func (t *Tokens) sign(payload string) string {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,314 @@
+// Package config loads the server's settings. Each setting has a default,
+// which a TOML file, an environment variable and a command-line flag
+// override in that order. The file is optional and named by -config or
+// CONFIG_FILE; config.example.toml lists every key with its default.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config holds every setting of the server
+type Config struct {
+	Port     int    `toml:"port"`     // Port the server listens on
+	Database string `toml:"database"` // Path to the SQLite database
+
+	// SiteURL is the site's public origin. ActivityPub IDs, the post URLs
+	// given to Micropub clients and the sources of sent webmentions are
+	// built from it, so it must not change once the blog has followers.
+	SiteURL   string `toml:"site_url"`
+	BackupDir string `toml:"backup_dir"` // Where the nightly backups are written
+
+	// OutboundAllowPrivate lets webhooks, webmentions and ActivityPub reach
+	// private addresses, which is only meant for testing against local
+	// servers
+	OutboundAllowPrivate bool `toml:"outbound_allow_private"`
+
+	ActivityPub ActivityPub `toml:"activitypub"`
+	WebAuthn    WebAuthn    `toml:"webauthn"`
+	Admin       Admin       `toml:"admin"`
+	RateLimits  RateLimits  `toml:"rate_limits"`
+	Pages       Pages       `toml:"pages"`
+	Log         Log         `toml:"log"`
+}
+
+// ActivityPub describes the blog's fediverse account
+type ActivityPub struct {
+	Username string `toml:"username"` // The account is @Username@host
+}
+
+// WebAuthn binds passkeys to the site's domain
+type WebAuthn struct {
+	RPID   string `toml:"rp_id"`  // Domain passkeys are registered for
+	Origin string `toml:"origin"` // Origin the admin pages are served from
+}
+
+// Admin is the first owner, created while no users exist
+type Admin struct {
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+// RateLimits are the limits per client of the public and login endpoints
+type RateLimits struct {
+	Login      RateLimit `toml:"login"`      // Password and passkey logins, per IP
+	MFA        RateLimit `toml:"mfa"`        // Second-factor codes, per account
+	Webmention RateLimit `toml:"webmention"` // Received webmentions, per IP
+	Comment    RateLimit `toml:"comment"`    // Comments, per IP
+	Contact    RateLimit `toml:"contact"`    // Contact messages, per IP
+	Reaction   RateLimit `toml:"reaction"`   // Reactions, per IP
+}
+
+// Pages sets how many items the home page's feeds load at a time
+type Pages struct {
+	Posts    int `toml:"posts"`
+	Projects int `toml:"projects"`
+}
+
+// Log sets how the server logs
+type Log struct {
+	Format string `toml:"format"` // text or json
+	Level  string `toml:"level"`  // debug, info, warn or error
+	Access bool   `toml:"access"` // Whether every request is logged
+}
+
+// SlogLevel returns the level records must reach to be logged. Validate
+// has checked it parses.
+func (l Log) SlogLevel() slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(l.Level))
+	return level
+}
+
+// maxPageSize is the most items a feed may load at a time
+const maxPageSize = 100
+
+// Default returns the settings used when nothing overrides them, which
+// suit local development
+func Default() *Config {
+	return &Config{
+		Port:        8080,
+		Database:    "./portfolio.db",
+		SiteURL:     "http://localhost:8080",
+		BackupDir:   "./backups",
+		ActivityPub: ActivityPub{Username: "blog"},
+		WebAuthn:    WebAuthn{RPID: "localhost", Origin: "http://localhost:8080"},
+		RateLimits: RateLimits{
+			Login:      RateLimit{Attempts: 5, Window: 15 * minute},
+			MFA:        RateLimit{Attempts: 5, Window: 15 * minute},
+			Webmention: RateLimit{Attempts: 30, Window: hour},
+			Comment:    RateLimit{Attempts: 10, Window: hour},
+			Contact:    RateLimit{Attempts: 5, Window: hour},
+			Reaction:   RateLimit{Attempts: 60, Window: hour},
+		},
+		Pages: Pages{Posts: 3, Projects: 3},
+		Log:   Log{Format: "text", Level: "info", Access: true},
+	}
+}
+
+// setting binds a Config field to its file key, environment variable and
+// flag. Secrets have no flag, as flags show up in process listings.
+type setting struct {
+	key    string
+	env    string
+	flag   string
+	usage  string
+	value  flag.Value
+	secret bool
+}
+
+// settings lists the settings of c in the order they are printed
+func (c *Config) settings() []setting {
+	return []setting{
+		{"port", "PORT", "port", "port to listen on", intValue{&c.Port}, false},
+		{"database", "DATABASE_PATH", "db", "path to the SQLite database", stringValue{&c.Database}, false},
+		{"site_url", "SITE_URL", "site-url", "public origin of the site", stringValue{&c.SiteURL}, false},
+		{"backup_dir", "BACKUP_DIR", "backup-dir", "directory of the nightly backups", stringValue{&c.BackupDir}, false},
+		{"outbound_allow_private", "OUTBOUND_ALLOW_PRIVATE", "outbound-allow-private", "let outbound requests reach private addresses (testing only)", boolValue{&c.OutboundAllowPrivate}, false},
+		{"activitypub.username", "ACTIVITYPUB_USERNAME", "activitypub-username", "username of the blog's fediverse account", stringValue{&c.ActivityPub.Username}, false},
+		{"webauthn.rp_id", "WEBAUTHN_RP_ID", "webauthn-rp-id", "domain passkeys are registered for", stringValue{&c.WebAuthn.RPID}, false},
+		{"webauthn.origin", "WEBAUTHN_ORIGIN", "webauthn-origin", "origin the admin pages are served from", stringValue{&c.WebAuthn.Origin}, false},
+		{"admin.username", "ADMIN_USERNAME", "admin-username", "first owner, created while no users exist", stringValue{&c.Admin.Username}, false},
+		{"admin.password", "ADMIN_PASSWORD", "", "", stringValue{&c.Admin.Password}, true},
+		{"rate_limits.login", "RATE_LIMIT_LOGIN", "rate-limit-login", "login attempts per IP, as attempts/window", &c.RateLimits.Login, false},
+		{"rate_limits.mfa", "RATE_LIMIT_MFA", "rate-limit-mfa", "second-factor attempts per account, as attempts/window", &c.RateLimits.MFA, false},
+		{"rate_limits.webmention", "RATE_LIMIT_WEBMENTION", "rate-limit-webmention", "received webmentions per IP, as attempts/window", &c.RateLimits.Webmention, false},
+		{"rate_limits.comment", "RATE_LIMIT_COMMENT", "rate-limit-comment", "comments per IP, as attempts/window", &c.RateLimits.Comment, false},
+		{"rate_limits.contact", "RATE_LIMIT_CONTACT", "rate-limit-contact", "contact messages per IP, as attempts/window", &c.RateLimits.Contact, false},
+		{"rate_limits.reaction", "RATE_LIMIT_REACTION", "rate-limit-reaction", "reactions per IP, as attempts/window", &c.RateLimits.Reaction, false},
+		{"pages.posts", "POSTS_PER_PAGE", "posts-per-page", "blog posts loaded at a time on the home page", intValue{&c.Pages.Posts}, false},
+		{"pages.projects", "PROJECTS_PER_PAGE", "projects-per-page", "projects loaded at a time on the home page", intValue{&c.Pages.Projects}, false},
+		{"log.format", "LOG_FORMAT", "log-format", "log output format, text or json", stringValue{&c.Log.Format}, false},
+		{"log.level", "LOG_LEVEL", "log-level", "least severe level logged: debug, info, warn or error", stringValue{&c.Log.Level}, false},
+		{"log.access", "LOG_ACCESS", "log-access", "log every request", boolValue{&c.Log.Access}, false},
+	}
+}
+
+// Load reads the settings from the defaults, the config file, the
+// environment and the flags in args, and validates the result. It returns
+// flag.ErrHelp if args ask for usage, which has then been printed.
+func Load(args []string) (*Config, error) {
+	c := Default()
+	settings := c.settings()
+
+	fs := flag.NewFlagSet("portfolio-v2", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "TOML file to read settings from (default $CONFIG_FILE)")
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+		usage := s.usage + " (default $" + s.env
+		if def := s.value.String(); def != "" {
+			usage += " or " + def
+		}
+		boolFlag, isBool := s.value.(interface{ IsBoolFlag() bool })
+		fs.Var(&pendingFlag{isBool: isBool && boolFlag.IsBoolFlag()}, s.flag, usage+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if *path != "" {
+		meta, err := toml.DecodeFile(*path, c)
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("read config file: unknown key %s", undecoded[0])
+		}
+	}
+
+	for _, s := range settings {
+		if v := os.Getenv(s.env); v != "" {
+			if err := s.value.Set(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	byFlag := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byFlag[s.flag] = s
+	}
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if s, ok := byFlag[f.Name]; ok && flagErr == nil {
+			if err := s.value.Set(f.Value.String()); err != nil {
+				flagErr = fmt.Errorf("-%s: %w", f.Name, err)
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate reports every setting that is out of range or malformed
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		invalid("port", "%d is not a port number", c.Port)
+	}
+	if c.Database == "" {
+		invalid("database", "must be set")
+	}
+	if !isOrigin(c.SiteURL) {
+		invalid("site_url", "%q is not an http(s) origin such as https://example.com", c.SiteURL)
+	}
+	if c.BackupDir == "" {
+		invalid("backup_dir", "must be set")
+	}
+	if c.ActivityPub.Username == "" || strings.ContainsAny(c.ActivityPub.Username, "@/ ") {
+		invalid("activitypub.username", "%q is not a username", c.ActivityPub.Username)
+	}
+	if c.WebAuthn.RPID == "" || strings.ContainsAny(c.WebAuthn.RPID, ":/") {
+		invalid("webauthn.rp_id", "%q is not a domain", c.WebAuthn.RPID)
+	}
+	if !isOrigin(c.WebAuthn.Origin) {
+		invalid("webauthn.origin", "%q is not an http(s) origin such as https://example.com", c.WebAuthn.Origin)
+	}
+	if (c.Admin.Username == "") != (c.Admin.Password == "") {
+		invalid("admin", "username and password must be set together")
+	}
+
+	limits := []struct {
+		key   string
+		limit RateLimit
+	}{
+		{"rate_limits.login", c.RateLimits.Login},
+		{"rate_limits.mfa", c.RateLimits.MFA},
+		{"rate_limits.webmention", c.RateLimits.Webmention},
+		{"rate_limits.comment", c.RateLimits.Comment},
+		{"rate_limits.contact", c.RateLimits.Contact},
+		{"rate_limits.reaction", c.RateLimits.Reaction},
+	}
+	for _, l := range limits {
+		if l.limit.Attempts < 1 || l.limit.Window <= 0 {
+			invalid(l.key, "needs at least 1 attempt in a positive window")
+		}
+	}
+
+	if c.Pages.Posts < 1 || c.Pages.Posts > maxPageSize {
+		invalid("pages.posts", "must be between 1 and %d", maxPageSize)
+	}
+	if c.Pages.Projects < 1 || c.Pages.Projects > maxPageSize {
+		invalid("pages.projects", "must be between 1 and %d", maxPageSize)
+	}
+
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		invalid("log.format", "%q is not text or json", c.Log.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		invalid("log.level", "%q is not debug, info, warn or error", c.Log.Level)
+	}
+
+	return errors.Join(errs...)
+}
+
+// LogValue logs the settings as one attribute per key, with secrets
+// redacted
+func (c *Config) LogValue() slog.Value {
+	var attrs []slog.Attr
+	for _, s := range c.settings() {
+		value := s.value.String()
+		if s.secret && value != "" {
+			value = "[redacted]"
+		}
+		attrs = append(attrs, slog.String(s.key, value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Addr returns the address the server listens on
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// isOrigin reports whether s is an absolute http(s) URL without a path,
+// not even a trailing slash
+func isOrigin(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "" && u.RawQuery == ""
+}
@@ -0,0 +1,43 @@
+package config
+
+import "testing"
+
+func TestLoadBoolFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		args     []string
+		access   bool
+		outbound bool
+	}{
+		{name: "bare flags", args: []string{"-log-access", "-outbound-allow-private"}, access: true, outbound: true},
+		{name: "flag with a value", args: []string{"-log-access=false"}, access: false},
+		{name: "environment", env: "false", access: false},
+		{name: "bare flag overrides environment", env: "false", args: []string{"-log-access"}, access: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("LOG_ACCESS", tt.env)
+			t.Setenv("OUTBOUND_ALLOW_PRIVATE", "")
+
+			c, err := Load(tt.args)
+			if err != nil {
+				t.Fatalf("Load(%q): %v", tt.args, err)
+			}
+			if c.Log.Access != tt.access || c.OutboundAllowPrivate != tt.outbound {
+				t.Errorf("log.access = %t, outbound_allow_private = %t; want %t, %t", c.Log.Access, c.OutboundAllowPrivate, tt.access, tt.outbound)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsFlagArgument(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+
+	// A bare boolean flag does not take the next argument as its value
+	if _, err := Load([]string{"-log-access", "false"}); err == nil {
+		t.Error("Load accepted a stray argument after a boolean flag")
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minute = time.Minute
+	hour   = time.Hour
+)
+
+// RateLimit allows Attempts within a sliding Window. It is written as
+// attempts/window, e.g. "5/15m" for five attempts in 15 minutes.
+type RateLimit struct {
+	Attempts int
+	Window   time.Duration
+}
+
+// String formats l as attempts/window
+func (l *RateLimit) String() string {
+	window := l.Window.String()
+	if strings.HasSuffix(window, "m0s") {
+		window = strings.TrimSuffix(window, "0s")
+	}
+	if strings.HasSuffix(window, "h0m") {
+		window = strings.TrimSuffix(window, "0m")
+	}
+	return strconv.Itoa(l.Attempts) + "/" + window
+}
+
+// Set parses attempts/window into l
+func (l *RateLimit) Set(s string) error {
+	attempts, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return fmt.Errorf("%q is not attempts/window, e.g. 5/15m", s)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(attempts))
+	if err != nil {
+		return fmt.Errorf("%q is not attempts/window: bad attempts", s)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil {
+		return fmt.Errorf("%q is not attempts/window: bad window", s)
+	}
+
+	l.Attempts, l.Window = n, d
+	return nil
+}
+
+// UnmarshalText lets the config file hold rate limits as attempts/window
+func (l *RateLimit) UnmarshalText(text []byte) error {
+	return l.Set(string(text))
+}
+
+// intValue, stringValue and boolValue set a Config field from an
+// environment variable or flag
+
+type intValue struct{ p *int }
+
+func (v intValue) String() string { return strconv.Itoa(*v.p) }
+
+func (v intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", s)
+	}
+	*v.p = n
+	return nil
+}
+
+type stringValue struct{ p *string }
+
+func (v stringValue) String() string { return *v.p }
+
+func (v stringValue) Set(s string) error {
+	*v.p = s
+	return nil
+}
+
+type boolValue struct{ p *bool }
+
+func (v boolValue) String() string { return strconv.FormatBool(*v.p) }
+
+func (v boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", s)
+	}
+	*v.p = b
+	return nil
+}
+
+// IsBoolFlag lets a boolean setting be passed as a bare flag, e.g.
+// -log-access for -log-access=true
+func (v boolValue) IsBoolFlag() bool { return true }
+
+// pendingFlag holds a flag's value until the config file and environment
+// have been read, so that flags override both
+type pendingFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *pendingFlag) String() string { return f.value }
+
+func (f *pendingFlag) Set(s string) error {
+	f.value = s
+	return nil
+}
+
+func (f *pendingFlag) IsBoolFlag() bool { return f.isBool }
@@ -0,0 +1,425 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"portfolio-v2/models"
+)
+
+// activityPubTimeFormat matches SQLite's datetime() output so the outbox and
+// delivery queues can be ordered and compared as text
+const activityPubTimeFormat = "2006-01-02 15:04:05"
+
+// followerColumns lists the columns scanned into a models.Follower, in order
+const followerColumns = `id, actor, inbox, shared_inbox, handle, created_at`
+
+// outboxColumns lists the columns scanned into a models.OutboxItem, in order
+const outboxColumns = `id, post_id, slug, activity, due_at, sent_at, created_at`
+
+// federationDeliveryColumns lists the columns scanned into a
+// models.FederationDelivery, in order
+const federationDeliveryColumns = `id, inbox, activity, type, status, attempts, next_attempt_at, last_attempt_at, response_status, error, created_at`
+
+// GetActivityPubKey retrieves the PEM encoded private key of the blog's
+// actor, returning an empty string if none was created yet
+func GetActivityPubKey(db *sql.DB) (string, error) {
+	var key string
+	err := db.QueryRow(`SELECT private_key FROM activitypub_keys WHERE id = 1`).Scan(&key)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("query activitypub key: %w", err)
+	}
+
+	return key, nil
+}
+
+// CreateActivityPubKey stores the actor's private key unless one exists and
+// returns the stored key, so processes starting together agree on one
+func CreateActivityPubKey(db *sql.DB, key string) (string, error) {
+	_, err := db.Exec(
+		`INSERT OR IGNORE INTO activitypub_keys (id, private_key, created_at) VALUES (1, ?, ?)`,
+		key, time.Now().UTC().Format(activityPubTimeFormat),
+	)
+	if err != nil {
+		return "", fmt.Errorf("insert activitypub key: %w", err)
+	}
+
+	return GetActivityPubKey(db)
+}
+
+// SaveFollower adds a follower, or refreshes its inboxes and handle if the
+// actor already follows
+func SaveFollower(db *sql.DB, f *models.Follower) error {
+	query := `
+		INSERT INTO activitypub_followers (actor, inbox, shared_inbox, handle, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (actor) DO UPDATE SET
+			inbox = excluded.inbox,
+			shared_inbox = excluded.shared_inbox,
+			handle = excluded.handle
+		RETURNING id, created_at
+	`
+
+	now := time.Now().UTC().Format(activityPubTimeFormat)
+	err := db.QueryRow(query, f.Actor, f.Inbox, f.SharedInbox, f.Handle, now).Scan(&f.ID, &f.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("save follower: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFollower removes a follower by actor ID and reports whether it was
+// following
+func DeleteFollower(db *sql.DB, actor string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM activitypub_followers WHERE actor = ?`, actor)
+	if err != nil {
+		return false, fmt.Errorf("delete follower: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+
+	return rows > 0, nil
+}
+
+// IsFollower reports whether actor follows the blog
+func IsFollower(db *sql.DB, actor string) (bool, error) {
+	var following bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM activitypub_followers WHERE actor = ?)`, actor).Scan(&following)
+	if err != nil {
+		return false, fmt.Errorf("query follower: %w", err)
+	}
+
+	return following, nil
+}
+
+// GetFollowers retrieves every follower, newest first
+func GetFollowers(db *sql.DB) ([]models.Follower, error) {
+	rows, err := db.Query(`SELECT ` + followerColumns + ` FROM activitypub_followers ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("query followers: %w", err)
+	}
+	defer rows.Close()
+
+	var followers []models.Follower
+	for rows.Next() {
+		var f models.Follower
+		if err := rows.Scan(&f.ID, &f.Actor, &f.Inbox, &f.SharedInbox, &f.Handle, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan follower: %w", err)
+		}
+
+		followers = append(followers, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate followers: %w", err)
+	}
+
+	return followers, nil
+}
+
+// CountFollowers returns the number of followers
+func CountFollowers(db *sql.DB) (int, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM activitypub_followers`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count followers: %w", err)
+	}
+
+	return count, nil
+}
+
+// PostFederated reports whether a Create for the post has been sent to
+// followers, so later changes go out as Update and Delete
+func PostFederated(db *sql.DB, postID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM activitypub_outbox
+			WHERE post_id = ? AND activity = ? AND sent_at IS NOT NULL
+		)
+	`
+
+	var federated bool
+	if err := db.QueryRow(query, postID, models.ActivityCreate).Scan(&federated); err != nil {
+		return false, fmt.Errorf("query federated post: %w", err)
+	}
+
+	return federated, nil
+}
+
+// QueueOutboxItem queues an activity about a post, replacing any that was
+// queued for the post and not sent yet: only its latest state goes out
+func QueueOutboxItem(db *sql.DB, item *models.OutboxItem) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM activitypub_outbox WHERE post_id = ? AND sent_at IS NULL`, item.PostID); err != nil {
+		return fmt.Errorf("delete queued activities: %w", err)
+	}
+
+	query := `
+		INSERT INTO activitypub_outbox (post_id, slug, activity, due_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	item.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := tx.Exec(query,
+		item.PostID,
+		item.Slug,
+		item.Activity,
+		item.DueAt.UTC().Format(activityPubTimeFormat),
+		item.CreatedAt.Format(activityPubTimeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("insert outbox item: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit outbox item: %w", err)
+	}
+
+	item.ID = id
+	return nil
+}
+
+// CancelOutboxItems drops the activities queued for a post and not sent
+// yet, e.g. when a post that never went out is deleted
+func CancelOutboxItems(db *sql.DB, postID int64) error {
+	if _, err := db.Exec(`DELETE FROM activitypub_outbox WHERE post_id = ? AND sent_at IS NULL`, postID); err != nil {
+		return fmt.Errorf("delete queued activities: %w", err)
+	}
+
+	return nil
+}
+
+// GetDueOutboxItems retrieves up to limit unsent activities due at now,
+// oldest first
+func GetDueOutboxItems(db *sql.DB, now time.Time, limit int) ([]models.OutboxItem, error) {
+	query := `
+		SELECT ` + outboxColumns + `
+		FROM activitypub_outbox
+		WHERE sent_at IS NULL AND due_at <= ?
+		ORDER BY due_at, id
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, now.UTC().Format(activityPubTimeFormat), limit)
+	if err != nil {
+		return nil, fmt.Errorf("query outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.OutboxItem
+	for rows.Next() {
+		var item models.OutboxItem
+		var sentAt sql.NullTime
+
+		err := rows.Scan(&item.ID, &item.PostID, &item.Slug, &item.Activity, &item.DueAt, &sentAt, &item.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan outbox item: %w", err)
+		}
+		if sentAt.Valid {
+			item.SentAt = &sentAt.Time
+		}
+
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate outbox: %w", err)
+	}
+
+	return items, nil
+}
+
+// SendOutboxItem queues activity for each inbox and marks item sent, in one
+// transaction so a restart neither skips nor repeats it. An item that has
+// nothing to send, e.g. because its post was unpublished, is passed no
+// inboxes.
+func SendOutboxItem(db *sql.DB, item *models.OutboxItem, inboxes []string, activityType, activity string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := insertFederationDeliveries(tx, inboxes, activityType, activity, now); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE activitypub_outbox SET sent_at = ? WHERE id = ?`, now.Format(activityPubTimeFormat), item.ID); err != nil {
+		return fmt.Errorf("update outbox item: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit outbox item: %w", err)
+	}
+
+	item.SentAt = &now
+	return nil
+}
+
+// CreateFederationDeliveries queues activity for each inbox, due
+// immediately
+func CreateFederationDeliveries(db *sql.DB, inboxes []string, activityType, activity string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertFederationDeliveries(tx, inboxes, activityType, activity, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit federation deliveries: %w", err)
+	}
+
+	return nil
+}
+
+func insertFederationDeliveries(tx *sql.Tx, inboxes []string, activityType, activity string, now time.Time) error {
+	query := `
+		INSERT INTO activitypub_deliveries (inbox, activity, type, status, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	at := now.Format(activityPubTimeFormat)
+	for _, inbox := range inboxes {
+		if _, err := tx.Exec(query, inbox, activity, activityType, models.DeliveryPending, at, at); err != nil {
+			return fmt.Errorf("insert federation delivery: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetDueFederationDeliveries retrieves up to limit pending deliveries whose
+// next attempt is due at now, oldest first
+func GetDueFederationDeliveries(db *sql.DB, now time.Time, limit int) ([]models.FederationDelivery, error) {
+	query := `
+		SELECT ` + federationDeliveryColumns + `
+		FROM activitypub_deliveries
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?
+	`
+
+	return queryFederationDeliveries(db, query, models.DeliveryPending, now.UTC().Format(activityPubTimeFormat), limit)
+}
+
+// GetFederationDeliveries retrieves the latest deliveries, newest first
+func GetFederationDeliveries(db *sql.DB, limit int) ([]models.FederationDelivery, error) {
+	query := `
+		SELECT ` + federationDeliveryColumns + `
+		FROM activitypub_deliveries
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	return queryFederationDeliveries(db, query, limit)
+}
+
+// RecordFederationAttempt saves the outcome of an attempt: the delivery's
+// status, attempt count, next attempt time and latest response or error
+func RecordFederationAttempt(db *sql.DB, delivery *models.FederationDelivery) error {
+	query := `
+		UPDATE activitypub_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?,
+			response_status = ?, error = ?
+		WHERE id = ?
+	`
+
+	var lastAttempt any
+	if delivery.LastAttemptAt != nil {
+		lastAttempt = delivery.LastAttemptAt.UTC().Format(activityPubTimeFormat)
+	}
+
+	_, err := db.Exec(query,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt.UTC().Format(activityPubTimeFormat),
+		lastAttempt,
+		delivery.ResponseStatus,
+		delivery.Error,
+		delivery.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update federation delivery: %w", err)
+	}
+
+	return nil
+}
+
+// PruneFederationDeliveries deletes finished deliveries created before
+// cutoff and returns how many were removed. Pending deliveries are always
+// kept.
+func PruneFederationDeliveries(db *sql.DB, cutoff time.Time) (int64, error) {
+	result, err := db.Exec(
+		`DELETE FROM activitypub_deliveries WHERE status != ? AND created_at < ?`,
+		models.DeliveryPending, cutoff.UTC().Format(activityPubTimeFormat),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("prune federation deliveries: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func queryFederationDeliveries(db *sql.DB, query string, args ...any) ([]models.FederationDelivery, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query federation deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.FederationDelivery
+	for rows.Next() {
+		var d models.FederationDelivery
+		var lastAttempt sql.NullTime
+
+		err := rows.Scan(
+			&d.ID,
+			&d.Inbox,
+			&d.Activity,
+			&d.Type,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&lastAttempt,
+			&d.ResponseStatus,
+			&d.Error,
+			&d.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan federation delivery: %w", err)
+		}
+		if lastAttempt.Valid {
+			d.LastAttemptAt = &lastAttempt.Time
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate federation deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
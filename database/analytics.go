@@ -0,0 +1,410 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"portfolio-v2/models"
+)
+
+// analyticsDayFormat is the format of the day page views are stored under
+const analyticsDayFormat = "2006-01-02"
+
+// analyticsTopLimit is how many pages, referrers and devices a report lists
+const analyticsTopLimit = 20
+
+// pageViewColumns maps each rollup dimension to the page_views column it
+// groups by. The column names are fixed, so they are safe to build into
+// queries.
+var pageViewColumns = map[string]string{
+	models.DimensionTotal:    "''",
+	models.DimensionPath:     "path",
+	models.DimensionReferrer: "referrer_host",
+	models.DimensionDevice:   "device",
+}
+
+// InsertPageViews stores recorded page views in one transaction
+func InsertPageViews(db *sql.DB, views []models.PageView) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO page_views (day, path, referrer_host, device, visitor) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare page view insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, v := range views {
+		if _, err := stmt.Exec(v.Day, v.Path, v.ReferrerHost, v.Device, v.Visitor); err != nil {
+			return fmt.Errorf("insert page view: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit page views: %w", err)
+	}
+
+	return nil
+}
+
+// InsertNotFoundHits adds recorded 404s to the daily count of their path
+func InsertNotFoundHits(db *sql.DB, hits []models.NotFoundHit) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO not_found_hits (day, path, hits) VALUES (?, ?, 1)
+		ON CONFLICT (day, path) DO UPDATE SET hits = hits + 1
+	`)
+	if err != nil {
+		return fmt.Errorf("prepare not found hit insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, h := range hits {
+		if _, err := stmt.Exec(h.Day, h.Path); err != nil {
+			return fmt.Errorf("insert not found hit: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit not found hits: %w", err)
+	}
+
+	return nil
+}
+
+// RollupPageViews folds the page views of days before today into daily
+// counts per dimension and deletes them, returning how many were rolled
+// up. Views of a day that arrive after it was rolled up are added to its
+// counts.
+func RollupPageViews(db *sql.DB, today time.Time) (int64, error) {
+	day := today.UTC().Format(analyticsDayFormat)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for dimension, column := range pageViewColumns {
+		_, err := tx.Exec(`
+			INSERT INTO page_view_rollups (day, dimension, value, views, visitors)
+			SELECT day, ?, `+column+`, COUNT(*), COUNT(DISTINCT visitor)
+			FROM page_views
+			WHERE day < ?
+			GROUP BY day, `+column+`
+			ON CONFLICT (day, dimension, value) DO UPDATE SET
+				views = views + excluded.views,
+				visitors = visitors + excluded.visitors
+		`, dimension, day)
+		if err != nil {
+			return 0, fmt.Errorf("roll up page views by %s: %w", dimension, err)
+		}
+	}
+
+	result, err := tx.Exec(`DELETE FROM page_views WHERE day < ?`, day)
+	if err != nil {
+		return 0, fmt.Errorf("delete rolled up page views: %w", err)
+	}
+
+	rolled, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get rows affected: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit page view rollup: %w", err)
+	}
+
+	return rolled, nil
+}
+
+// PruneAnalytics deletes the daily counts of days before cutoff, returning
+// how many rows were removed
+func PruneAnalytics(db *sql.DB, cutoff time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM page_view_rollups WHERE day < ?`, cutoff.UTC().Format(analyticsDayFormat))
+	if err != nil {
+		return 0, fmt.Errorf("prune page view rollups: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get rows affected: %w", err)
+	}
+
+	return removed, nil
+}
+
+// PruneNotFoundHits deletes the 404 counts of days before cutoff, returning
+// how many rows were removed
+func PruneNotFoundHits(db *sql.DB, cutoff time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM not_found_hits WHERE day < ?`, cutoff.UTC().Format(analyticsDayFormat))
+	if err != nil {
+		return 0, fmt.Errorf("prune not found hits: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get rows affected: %w", err)
+	}
+
+	return removed, nil
+}
+
+// analyticsRange returns the first and last day of the days days up to and
+// including now's
+func analyticsRange(days int, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return today.AddDate(0, 0, 1-days), today
+}
+
+// GetDailyViews returns the page views of each of the days days up to and
+// including now's, oldest first
+func GetDailyViews(db *sql.DB, days int, now time.Time) ([]models.AnalyticsDay, error) {
+	first, today := analyticsRange(days, now)
+
+	counts, err := getAnalyticsDays(db, first.Format(analyticsDayFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	daily := make([]models.AnalyticsDay, 0, days)
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		c := counts[day.Format(analyticsDayFormat)]
+		daily = append(daily, models.AnalyticsDay{Day: day, Views: c.Views, Visitors: c.Visitors})
+	}
+
+	return daily, nil
+}
+
+// GetDailyNotFound returns the number of 404s on each of the days days up
+// to and including now's, oldest first
+func GetDailyNotFound(db *sql.DB, days int, now time.Time) ([]models.DateCount, error) {
+	first, today := analyticsRange(days, now)
+
+	rows, err := db.Query(`SELECT day, SUM(hits) FROM not_found_hits WHERE day >= ? GROUP BY day`, first.Format(analyticsDayFormat))
+	if err != nil {
+		return nil, fmt.Errorf("query daily not found hits: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var day string
+		var hits int
+		if err := rows.Scan(&day, &hits); err != nil {
+			return nil, fmt.Errorf("scan daily not found hits: %w", err)
+		}
+		counts[day] = hits
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate daily not found hits: %w", err)
+	}
+
+	daily := make([]models.DateCount, 0, days)
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		daily = append(daily, models.DateCount{Date: day, Count: counts[day.Format(analyticsDayFormat)]})
+	}
+
+	return daily, nil
+}
+
+// GetTopNotFound returns the paths most often not found in the days days up
+// to and including now's, at most limit of them, with their hits as Views
+func GetTopNotFound(db *sql.DB, days int, now time.Time, limit int) ([]models.AnalyticsCount, error) {
+	first, _ := analyticsRange(days, now)
+
+	rows, err := db.Query(`
+		SELECT path, SUM(hits) FROM not_found_hits
+		WHERE day >= ?
+		GROUP BY path
+		ORDER BY SUM(hits) DESC, path
+		LIMIT ?
+	`, first.Format(analyticsDayFormat), limit)
+	if err != nil {
+		return nil, fmt.Errorf("query top not found paths: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []models.AnalyticsCount
+	for rows.Next() {
+		var c models.AnalyticsCount
+		if err := rows.Scan(&c.Value, &c.Views); err != nil {
+			return nil, fmt.Errorf("scan not found path: %w", err)
+		}
+		paths = append(paths, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate not found paths: %w", err)
+	}
+
+	return paths, nil
+}
+
+// GetAnalyticsReport returns the page views of the days days up to and
+// including today's. Days already rolled up are read from their daily
+// counts and the rest from the recorded views.
+func GetAnalyticsReport(db *sql.DB, days int, now time.Time) (*models.AnalyticsReport, error) {
+	first, _ := analyticsRange(days, now)
+	since := first.Format(analyticsDayFormat)
+
+	report := &models.AnalyticsReport{Days: days}
+
+	daily, err := GetDailyViews(db, days, now)
+	if err != nil {
+		return nil, err
+	}
+	report.Daily = daily
+
+	for _, day := range daily {
+		report.Views += day.Views
+		report.Visitors += day.Visitors
+
+		monday := day.Day.AddDate(0, 0, -((int(day.Day.Weekday()) + 6) % 7))
+		if n := len(report.Weekly); n == 0 || !report.Weekly[n-1].Day.Equal(monday) {
+			report.Weekly = append(report.Weekly, models.AnalyticsDay{Day: monday})
+		}
+		week := &report.Weekly[len(report.Weekly)-1]
+		week.Views += day.Views
+		week.Visitors += day.Visitors
+	}
+
+	if report.Pages, err = getAnalyticsCounts(db, models.DimensionPath, since, analyticsTopLimit); err != nil {
+		return nil, err
+	}
+	if report.Referrers, err = getAnalyticsCounts(db, models.DimensionReferrer, since, analyticsTopLimit); err != nil {
+		return nil, err
+	}
+	if report.Devices, err = getAnalyticsCounts(db, models.DimensionDevice, since, analyticsTopLimit); err != nil {
+		return nil, err
+	}
+	if report.Posts, err = getPostViews(db, since, now); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// getAnalyticsDays returns the views of each day since since that had any,
+// by day
+func getAnalyticsDays(db *sql.DB, since string) (map[string]models.AnalyticsCount, error) {
+	rows, err := db.Query(`
+		SELECT day, SUM(views), SUM(visitors) FROM (
+			SELECT day, views, visitors FROM page_view_rollups
+			WHERE dimension = ? AND day >= ?
+			UNION ALL
+			SELECT day, COUNT(*), COUNT(DISTINCT visitor) FROM page_views
+			WHERE day >= ?
+			GROUP BY day
+		)
+		GROUP BY day
+	`, models.DimensionTotal, since, since)
+	if err != nil {
+		return nil, fmt.Errorf("query daily page views: %w", err)
+	}
+	defer rows.Close()
+
+	days := map[string]models.AnalyticsCount{}
+	for rows.Next() {
+		var c models.AnalyticsCount
+		if err := rows.Scan(&c.Value, &c.Views, &c.Visitors); err != nil {
+			return nil, fmt.Errorf("scan daily page views: %w", err)
+		}
+		days[c.Value] = c
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate daily page views: %w", err)
+	}
+
+	return days, nil
+}
+
+// getAnalyticsCounts returns the most viewed values of dimension since
+// since, at most limit of them
+func getAnalyticsCounts(db *sql.DB, dimension, since string, limit int) ([]models.AnalyticsCount, error) {
+	column := pageViewColumns[dimension]
+
+	rows, err := db.Query(`
+		SELECT value, SUM(views), SUM(visitors) FROM (
+			SELECT value, views, visitors FROM page_view_rollups
+			WHERE dimension = ? AND day >= ?
+			UNION ALL
+			SELECT `+column+`, COUNT(*), COUNT(DISTINCT visitor) FROM page_views
+			WHERE day >= ?
+			GROUP BY day, `+column+`
+		)
+		GROUP BY value
+		ORDER BY SUM(views) DESC, value
+		LIMIT ?
+	`, dimension, since, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query page views by %s: %w", dimension, err)
+	}
+	defer rows.Close()
+
+	var counts []models.AnalyticsCount
+	for rows.Next() {
+		var c models.AnalyticsCount
+		if err := rows.Scan(&c.Value, &c.Views, &c.Visitors); err != nil {
+			return nil, fmt.Errorf("scan page views by %s: %w", dimension, err)
+		}
+		counts = append(counts, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate page views by %s: %w", dimension, err)
+	}
+
+	return counts, nil
+}
+
+// getPostViews returns the views since since of every blog post published
+// by now, most viewed first
+func getPostViews(db *sql.DB, since string, now time.Time) ([]models.PostViews, error) {
+	rows, err := db.Query(`
+		SELECT p.id, p.title, p.slug, COALESCE(SUM(v.views), 0), COALESCE(SUM(v.visitors), 0)
+		FROM blog_posts p
+		LEFT JOIN (
+			SELECT value AS path, views, visitors FROM page_view_rollups
+			WHERE dimension = ? AND day >= ?
+			UNION ALL
+			SELECT path, COUNT(*), COUNT(DISTINCT visitor) FROM page_views
+			WHERE day >= ?
+			GROUP BY day, path
+		) v ON v.path = '/blog/' || p.slug
+		WHERE p.published_at <= ?
+		GROUP BY p.id
+		ORDER BY 4 DESC, p.published_at DESC
+	`, models.DimensionPath, since, since, now)
+	if err != nil {
+		return nil, fmt.Errorf("query post views: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []models.PostViews
+	for rows.Next() {
+		var p models.PostViews
+		if err := rows.Scan(&p.PostID, &p.Title, &p.Slug, &p.Views, &p.Visitors); err != nil {
+			return nil, fmt.Errorf("scan post views: %w", err)
+		}
+		posts = append(posts, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate post views: %w", err)
+	}
+
+	return posts, nil
+}
@@ -0,0 +1,214 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"portfolio-v2/models"
+)
+
+// AuditRetention is how long audit entries are kept. Entries younger than
+// this cannot be deleted, even by hand, because of the triggers below.
+const AuditRetention = 365 * 24 * time.Hour
+
+const auditRetentionDays = int(AuditRetention / (24 * time.Hour))
+
+// auditTimeFormat matches SQLite's datetime() output so created_at can be
+// compared against datetime('now', ...) inside triggers
+const auditTimeFormat = "2006-01-02 15:04:05"
+
+// auditTriggers make audit_log append-only: rows can never be changed and
+// can only be deleted once they fall outside AuditRetention. They are
+// recreated on startup so a changed retention takes effect.
+var auditTriggers = fmt.Sprintf(`
+	DROP TRIGGER IF EXISTS audit_log_no_update;
+	CREATE TRIGGER audit_log_no_update
+	BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;
+
+	DROP TRIGGER IF EXISTS audit_log_retention;
+	CREATE TRIGGER audit_log_retention
+	BEFORE DELETE ON audit_log
+	WHEN OLD.created_at > datetime('now', '-%d days')
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log entries are kept for %d days');
+	END;
+`, auditRetentionDays, auditRetentionDays)
+
+// auditColumns lists the columns scanned into a models.AuditEntry, in order
+const auditColumns = `id, created_at, actor, action, target_type, target_id, ip, user_agent, before, after`
+
+// RecordAudit appends an entry to the audit log
+func RecordAudit(db *sql.DB, entry *models.AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (created_at, actor, action, target_type, target_id, ip, user_agent, before, after)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := db.Exec(query,
+		entry.CreatedAt.Format(auditTimeFormat),
+		entry.Actor,
+		entry.Action,
+		entry.TargetType,
+		entry.TargetID,
+		entry.IP,
+		entry.UserAgent,
+		entry.Before,
+		entry.After,
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit entry: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+
+	entry.ID = id
+	return nil
+}
+
+// GetAuditEntries retrieves entries matching filter, newest first. A limit
+// of zero or less returns every match.
+func GetAuditEntries(db *sql.DB, filter models.AuditFilter, limit, offset int) ([]models.AuditEntry, error) {
+	where, args := auditWhere(filter)
+	query := `
+		SELECT ` + auditColumns + `
+		FROM audit_log` + where + `
+		ORDER BY created_at DESC, id DESC
+	`
+	if limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan audit entry: %w", err)
+		}
+
+		entries = append(entries, *entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate audit log: %w", err)
+	}
+
+	return entries, nil
+}
+
+// CountAuditEntries returns the number of entries matching filter
+func CountAuditEntries(db *sql.DB, filter models.AuditFilter) (int, error) {
+	where, args := auditWhere(filter)
+
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count audit log: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetAuditActors returns every distinct actor, for the filter dropdown
+func GetAuditActors(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT actor FROM audit_log ORDER BY actor`)
+	if err != nil {
+		return nil, fmt.Errorf("query audit actors: %w", err)
+	}
+	defer rows.Close()
+
+	var actors []string
+	for rows.Next() {
+		var actor string
+		if err := rows.Scan(&actor); err != nil {
+			return nil, fmt.Errorf("scan audit actor: %w", err)
+		}
+		actors = append(actors, actor)
+	}
+
+	return actors, rows.Err()
+}
+
+// PruneAuditLog deletes entries older than AuditRetention and returns how
+// many were removed
+func PruneAuditLog(db *sql.DB) (int64, error) {
+	result, err := db.Exec(
+		`DELETE FROM audit_log WHERE created_at <= datetime('now', ?)`,
+		"-"+strconv.Itoa(auditRetentionDays)+" days",
+	)
+	if err != nil {
+		return 0, fmt.Errorf("prune audit log: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// auditWhere builds the WHERE clause and arguments for filter
+func auditWhere(filter models.AuditFilter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC().Format(auditTimeFormat))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC().Format(auditTimeFormat))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func scanAuditEntry(row interface{ Scan(...any) error }) (*models.AuditEntry, error) {
+	var entry models.AuditEntry
+
+	err := row.Scan(
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.Actor,
+		&entry.Action,
+		&entry.TargetType,
+		&entry.TargetID,
+		&entry.IP,
+		&entry.UserAgent,
+		&entry.Before,
+		&entry.After,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
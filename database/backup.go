@@ -0,0 +1,43 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// backupPattern matches the files Backup writes. Their names sort by when
+// they were taken.
+const backupPattern = "portfolio-*.db"
+
+// Backup writes a consistent copy of the database into dir, named after
+// now, and deletes all but the newest keep copies there. It returns the
+// path of the new copy.
+func Backup(db *sql.DB, dir string, keep int, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create backup directory: %w", err)
+	}
+
+	path := filepath.Join(dir, "portfolio-"+now.UTC().Format("20060102-150405")+".db")
+	if _, err := db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return "", fmt.Errorf("back up database: %w", err)
+	}
+
+	backups, err := filepath.Glob(filepath.Join(dir, backupPattern))
+	if err != nil {
+		return "", fmt.Errorf("list backups: %w", err)
+	}
+	sort.Strings(backups)
+
+	for len(backups) > keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return "", fmt.Errorf("remove old backup: %w", err)
+		}
+		backups = backups[1:]
+	}
+
+	return path, nil
+}
@@ -10,12 +10,15 @@ import (
 	"portfolio-v2/models"
 )
 
-// GetBlogPosts retrieves paginated blog posts, optionally filtered by tag
-func GetBlogPosts(db *sql.DB, page, limit int, tagFilter string) ([]models.BlogPostPreview, error) {
-	offset := (page - 1) * limit
+// blogFeedKeyset orders the home page feed, newest first
+var blogFeedKeyset = blogPostKeysets["-published_at"]
 
+// GetBlogPosts retrieves a page of published post previews, newest first,
+// optionally filtered by tag. It returns the cursor for the next page, or
+// nil if this is the last.
+func GetBlogPosts(db *sql.DB, limit int, tagFilter string, after *Cursor) ([]models.BlogPostPreview, *Cursor, error) {
 	query := `
-		SELECT id, title, slug, excerpt, published_at, tags
+		SELECT id, title, slug, excerpt, published_at, tags, ` + blogFeedKeyset.selectKeys() + `
 		FROM blog_posts
 		WHERE published_at <= ?
 	`
@@ -27,34 +30,45 @@ func GetBlogPosts(db *sql.DB, page, limit int, tagFilter string) ([]models.BlogP
 		args = append(args, "%\""+tagFilter+"\"%")
 	}
 
+	condition, cursorArgs, err := blogFeedKeyset.after(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if condition != "" {
+		query += ` AND ` + condition
+		args = append(args, cursorArgs...)
+	}
+
 	query += `
-		ORDER BY published_at DESC
-		LIMIT ? OFFSET ?
+		ORDER BY ` + blogFeedKeyset.orderBy() + `
+		LIMIT ?
 	`
 
-	args = append(args, limit, offset)
+	args = append(args, limit+1)
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("query blog posts: %w", err)
+		return nil, nil, fmt.Errorf("query blog posts: %w", err)
 	}
 	defer rows.Close()
 
 	var posts []models.BlogPostPreview
+	var keys [][]any
 	for rows.Next() {
 		var post models.BlogPostPreview
 		var tagsJSON string
+		key, keyDest := blogFeedKeyset.scanKeys()
 
-		err := rows.Scan(
+		err := rows.Scan(append([]any{
 			&post.ID,
 			&post.Title,
 			&post.Slug,
 			&post.Excerpt,
 			&post.PublishedAt,
 			&tagsJSON,
-		)
+		}, keyDest...)...)
 		if err != nil {
-			return nil, fmt.Errorf("scan blog post: %w", err)
+			return nil, nil, fmt.Errorf("scan blog post: %w", err)
 		}
 
 		if err := json.Unmarshal([]byte(tagsJSON), &post.Tags); err != nil {
@@ -62,13 +76,17 @@ func GetBlogPosts(db *sql.DB, page, limit int, tagFilter string) ([]models.BlogP
 		}
 
 		posts = append(posts, post)
+		keys = append(keys, key)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterate blog posts: %w", err)
+		return nil, nil, fmt.Errorf("iterate blog posts: %w", err)
 	}
 
-	return posts, nil
+	if len(posts) > limit {
+		return posts[:limit], blogFeedKeyset.cursorAt(keys[limit-1], posts[limit-1].ID), nil
+	}
+	return posts, nil, nil
 }
 
 // GetBlogPostBySlug retrieves a single blog post by slug
@@ -107,21 +125,103 @@ func GetBlogPostBySlug(db *sql.DB, slug string) (*models.BlogPost, error) {
 	return &post, nil
 }
 
-// CountBlogPosts returns total number of published posts, optionally filtered by tag
-func CountBlogPosts(db *sql.DB, tagFilter string) (int, error) {
-	var count int
-	query := `SELECT COUNT(*) FROM blog_posts WHERE published_at <= ?`
+// blogPostKeysets maps each of models.BlogPostSorts to its keyset
+var blogPostKeysets = map[string]keyset{
+	"-published_at": {sort: "-published_at", columns: []string{"published_at"}, keys: []string{"CAST(published_at AS TEXT)"}, desc: true},
+	"published_at":  {sort: "published_at", columns: []string{"published_at"}, keys: []string{"CAST(published_at AS TEXT)"}},
+	"title":         {sort: "title", columns: []string{"title COLLATE NOCASE"}, keys: []string{"title"}},
+	"-title":        {sort: "-title", columns: []string{"title COLLATE NOCASE"}, keys: []string{"title"}, desc: true},
+}
+
+// ListBlogPosts retrieves a page of published posts matching filter. It
+// returns the cursor for the next page, or nil if this is the last.
+func ListBlogPosts(db *sql.DB, filter models.BlogPostFilter, limit int, after *Cursor) ([]models.BlogPost, *Cursor, error) {
+	ks, ok := blogPostKeysets[filter.Sort]
+	if !ok {
+		ks = blogPostKeysets["-published_at"]
+	}
+
+	where := ` WHERE published_at <= ?`
 	args := []any{time.Now()}
 
-	if tagFilter != "" {
-		query += ` AND tags LIKE ?`
-		args = append(args, "%\""+tagFilter+"\"%")
+	if filter.Tag != "" {
+		where += ` AND tags LIKE ?`
+		args = append(args, "%\""+filter.Tag+"\"%")
+	}
+	if filter.Search != "" {
+		where += ` AND (title LIKE ? OR excerpt LIKE ? OR content LIKE ?)`
+		pattern := "%" + filter.Search + "%"
+		args = append(args, pattern, pattern, pattern)
 	}
 
-	err := db.QueryRow(query, args...).Scan(&count)
+	condition, cursorArgs, err := ks.after(after)
 	if err != nil {
+		return nil, nil, err
+	}
+	if condition != "" {
+		where += ` AND ` + condition
+		args = append(args, cursorArgs...)
+	}
+
+	query := `
+		SELECT id, title, slug, excerpt, content, published_at, tags, author, ` + ks.selectKeys() + `
+		FROM blog_posts` + where + `
+		ORDER BY ` + ks.orderBy() + `
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, append(args, limit+1)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query blog posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []models.BlogPost
+	var keys [][]any
+	for rows.Next() {
+		var post models.BlogPost
+		var tagsJSON string
+		key, keyDest := ks.scanKeys()
+
+		err := rows.Scan(append([]any{
+			&post.ID,
+			&post.Title,
+			&post.Slug,
+			&post.Excerpt,
+			&post.Content,
+			&post.PublishedAt,
+			&tagsJSON,
+			&post.Author,
+		}, keyDest...)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scan blog post: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(tagsJSON), &post.Tags); err != nil {
+			post.Tags = []string{}
+		}
+
+		posts = append(posts, post)
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterate blog posts: %w", err)
+	}
+
+	if len(posts) > limit {
+		return posts[:limit], ks.cursorAt(keys[limit-1], posts[limit-1].ID), nil
+	}
+	return posts, nil, nil
+}
+
+// CountPublishedBlogPosts returns the number of posts that are live
+func CountPublishedBlogPosts(db *sql.DB) (int, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM blog_posts WHERE published_at <= ?`, time.Now()).Scan(&count); err != nil {
 		return 0, fmt.Errorf("count blog posts: %w", err)
 	}
+
 	return count, nil
 }
 
@@ -167,8 +267,8 @@ func GetAllTags(db *sql.DB) ([]string, error) {
 	return uniqueTags, nil
 }
 
-// CreateBlogPost inserts a new blog post into the database
-func CreateBlogPost(db *sql.DB, title, excerpt, content string, tags []string) (string, error) {
+// CreateBlogPost inserts a new blog post into the database, crediting author
+func CreateBlogPost(db *sql.DB, title, excerpt, content string, tags []string, author string) (string, error) {
 	slug := generateSlug(title)
 	tagsJSON, err := json.Marshal(tags)
 	if err != nil {
@@ -180,7 +280,7 @@ func CreateBlogPost(db *sql.DB, title, excerpt, content string, tags []string) (
 		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err = db.Exec(query, title, slug, excerpt, content, time.Now(), string(tagsJSON), "Michael")
+	_, err = db.Exec(query, title, slug, excerpt, content, time.Now(), string(tagsJSON), author)
 	if err != nil {
 		return "", fmt.Errorf("insert blog post: %w", err)
 	}
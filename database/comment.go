@@ -0,0 +1,252 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"portfolio-v2/models"
+)
+
+// commentTimeFormat matches SQLite's datetime() output so comment times
+// sort and compare as text
+const commentTimeFormat = "2006-01-02 15:04:05"
+
+// commentColumns lists the columns scanned into a models.Comment, in order.
+// Queries join blog_posts as p.
+const commentColumns = `c.id, c.post_id, p.slug, COALESCE(c.parent_id, 0), c.author_name, c.author_url, c.body, c.status, c.spam_score, c.spam_reasons, c.ip_address, c.user_agent, c.created_at, c.edited_at`
+
+// CreateComment stores a new comment and sets its ID and creation time
+func CreateComment(db *sql.DB, c *models.Comment) error {
+	query := `
+		INSERT INTO comments (post_id, parent_id, author_name, author_url, body, status, spam_score, spam_reasons, ip_address, user_agent, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_at
+	`
+
+	var parentID any
+	if c.ParentID != 0 {
+		parentID = c.ParentID
+	}
+
+	err := db.QueryRow(query,
+		c.PostID,
+		parentID,
+		c.AuthorName,
+		c.AuthorURL,
+		c.Body,
+		c.Status,
+		c.SpamScore,
+		c.SpamReasons,
+		c.IPAddress,
+		c.UserAgent,
+		time.Now().UTC().Format(commentTimeFormat),
+	).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert comment: %w", err)
+	}
+
+	return nil
+}
+
+// GetCommentByID retrieves a comment, returning nil if not found
+func GetCommentByID(db *sql.DB, id int64) (*models.Comment, error) {
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments c
+		JOIN blog_posts p ON p.id = c.post_id
+		WHERE c.id = ?
+	`
+
+	c, err := scanComment(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query comment: %w", err)
+	}
+
+	return c, nil
+}
+
+// GetPostComments retrieves the comments shown under a post as threads,
+// oldest first: the approved ones, and those in own still waiting for
+// review, which only their author sees. Comments flagged as spam are shown
+// to their author as waiting too, so a spammer learns nothing.
+func GetPostComments(db *sql.DB, postID int64, own []int64) ([]models.Comment, error) {
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments c
+		JOIN blog_posts p ON p.id = c.post_id
+		WHERE c.post_id = ? AND (c.status = ?
+	`
+	args := []any{postID, models.CommentApproved}
+
+	if len(own) > 0 {
+		query += ` OR (c.status IN (?, ?) AND c.id IN (?` + strings.Repeat(", ?", len(own)-1) + `))`
+		args = append(args, models.CommentPending, models.CommentSpam)
+		for _, id := range own {
+			args = append(args, id)
+		}
+	}
+
+	query += `)
+		ORDER BY c.created_at, c.id
+	`
+
+	comments, err := queryComments(db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ThreadComments(comments), nil
+}
+
+// GetComments retrieves up to limit comments in a moderation state, newest
+// first
+func GetComments(db *sql.DB, status string, limit int) ([]models.Comment, error) {
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments c
+		JOIN blog_posts p ON p.id = c.post_id
+		WHERE c.status = ?
+		ORDER BY c.id DESC
+		LIMIT ?
+	`
+
+	return queryComments(db, query, status, limit)
+}
+
+// CountComments returns the number of comments in a moderation state
+func CountComments(db *sql.DB, status string) (int, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM comments WHERE status = ?`, status).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count comments: %w", err)
+	}
+
+	return count, nil
+}
+
+// SetCommentStatus records a moderator's decision on a comment
+func SetCommentStatus(db *sql.DB, id int64, status string) error {
+	result, err := db.Exec(`UPDATE comments SET status = ? WHERE id = ?`, status, id)
+	if err != nil {
+		return fmt.Errorf("update comment status: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("comment with id %d not found", id)
+	}
+
+	return nil
+}
+
+// UpdateCommentBody saves an author's edit of a comment: its body, its
+// new state and spam score, and the time it was edited
+func UpdateCommentBody(db *sql.DB, c *models.Comment) error {
+	query := `
+		UPDATE comments
+		SET body = ?, status = ?, spam_score = ?, spam_reasons = ?, edited_at = ?
+		WHERE id = ?
+		RETURNING edited_at
+	`
+
+	var edited time.Time
+	err := db.QueryRow(query,
+		c.Body,
+		c.Status,
+		c.SpamScore,
+		c.SpamReasons,
+		time.Now().UTC().Format(commentTimeFormat),
+		c.ID,
+	).Scan(&edited)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("comment with id %d not found", c.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("update comment: %w", err)
+	}
+
+	c.EditedAt = &edited
+	return nil
+}
+
+// DeleteComment removes a comment and its replies
+func DeleteComment(db *sql.DB, id int64) error {
+	result, err := db.Exec(`DELETE FROM comments WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete comment: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("comment with id %d not found", id)
+	}
+
+	return nil
+}
+
+func queryComments(db *sql.DB, query string, args ...any) ([]models.Comment, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query comments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan comment: %w", err)
+		}
+
+		comments = append(comments, *c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate comments: %w", err)
+	}
+
+	return comments, nil
+}
+
+func scanComment(row interface{ Scan(...any) error }) (*models.Comment, error) {
+	var c models.Comment
+	var edited sql.NullTime
+
+	err := row.Scan(
+		&c.ID,
+		&c.PostID,
+		&c.PostSlug,
+		&c.ParentID,
+		&c.AuthorName,
+		&c.AuthorURL,
+		&c.Body,
+		&c.Status,
+		&c.SpamScore,
+		&c.SpamReasons,
+		&c.IPAddress,
+		&c.UserAgent,
+		&c.CreatedAt,
+		&edited,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if edited.Valid {
+		c.EditedAt = &edited.Time
+	}
+
+	return &c, nil
+}
@@ -28,29 +28,52 @@ func CreateContactSubmission(db *sql.DB, name, email, message, ipAddress, userAg
 	return id, nil
 }
 
-// GetContactSubmissions retrieves paginated contact submissions (for admin view - future)
-func GetContactSubmissions(db *sql.DB, page, limit int) ([]models.ContactSubmission, error) {
-	offset := (page - 1) * limit
+// contactKeyset orders contact submissions, newest first
+var contactKeyset = keyset{
+	sort:    "-submitted_at",
+	columns: []string{"submitted_at"},
+	keys:    []string{"CAST(submitted_at AS TEXT)"},
+	desc:    true,
+}
 
+// GetContactSubmissions retrieves a page of contact submissions, newest
+// first. It returns the cursor for the next page, or nil if this is the last.
+func GetContactSubmissions(db *sql.DB, limit int, after *Cursor) ([]models.ContactSubmission, *Cursor, error) {
 	query := `
-		SELECT id, name, email, message, submitted_at, ip_address, user_agent
+		SELECT id, name, email, message, submitted_at, ip_address, user_agent, ` + contactKeyset.selectKeys() + `
 		FROM contact_submissions
-		ORDER BY submitted_at DESC
-		LIMIT ? OFFSET ?
 	`
 
-	rows, err := db.Query(query, limit, offset)
+	var args []any
+
+	condition, cursorArgs, err := contactKeyset.after(after)
 	if err != nil {
-		return nil, fmt.Errorf("query contact submissions: %w", err)
+		return nil, nil, err
+	}
+	if condition != "" {
+		query += ` WHERE ` + condition
+		args = append(args, cursorArgs...)
+	}
+
+	query += `
+		ORDER BY ` + contactKeyset.orderBy() + `
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, append(args, limit+1)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query contact submissions: %w", err)
 	}
 	defer rows.Close()
 
 	var submissions []models.ContactSubmission
+	var keys [][]any
 	for rows.Next() {
 		var submission models.ContactSubmission
 		var ipAddress, userAgent sql.NullString
+		key, keyDest := contactKeyset.scanKeys()
 
-		err := rows.Scan(
+		err := rows.Scan(append([]any{
 			&submission.ID,
 			&submission.Name,
 			&submission.Email,
@@ -58,9 +81,9 @@ func GetContactSubmissions(db *sql.DB, page, limit int) ([]models.ContactSubmiss
 			&submission.SubmittedAt,
 			&ipAddress,
 			&userAgent,
-		)
+		}, keyDest...)...)
 		if err != nil {
-			return nil, fmt.Errorf("scan contact submission: %w", err)
+			return nil, nil, fmt.Errorf("scan contact submission: %w", err)
 		}
 
 		if ipAddress.Valid {
@@ -71,13 +94,17 @@ func GetContactSubmissions(db *sql.DB, page, limit int) ([]models.ContactSubmiss
 		}
 
 		submissions = append(submissions, submission)
+		keys = append(keys, key)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterate contact submissions: %w", err)
+		return nil, nil, fmt.Errorf("iterate contact submissions: %w", err)
 	}
 
-	return submissions, nil
+	if len(submissions) > limit {
+		return submissions[:limit], contactKeyset.cursorAt(keys[limit-1], submissions[limit-1].ID), nil
+	}
+	return submissions, nil, nil
 }
 
 // CountContactSubmissions returns the total number of submissions
@@ -91,3 +118,28 @@ func CountContactSubmissions(db *sql.DB) (int, error) {
 	}
 	return count, nil
 }
+
+// GetContactSubmissionTimes returns when each submission since since was
+// received, oldest first
+func GetContactSubmissionTimes(db *sql.DB, since time.Time) ([]time.Time, error) {
+	rows, err := db.Query(`SELECT submitted_at FROM contact_submissions WHERE submitted_at >= ? ORDER BY submitted_at`, since)
+	if err != nil {
+		return nil, fmt.Errorf("query contact submission times: %w", err)
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("scan contact submission time: %w", err)
+		}
+		times = append(times, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate contact submission times: %w", err)
+	}
+
+	return times, nil
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for a cursor that was not issued by this
+// package or was issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the position after the last row of a page in a keyset
+// paginated listing: that row's sort key, exactly as stored, and its id to
+// break ties. Rows inserted or deleted between pages cannot shift it, unlike
+// an offset. Clients only ever see it encoded by String.
+type Cursor struct {
+	Sort string `json:"s"`
+	Key  []any  `json:"k"`
+	ID   int64  `json:"i"`
+}
+
+// String encodes the cursor as an opaque URL-safe token; nil encodes as ""
+func (c *Cursor) String() string {
+	if c == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a token from Cursor.String. An empty token means the
+// first page and returns nil.
+func ParseCursor(token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keyset describes the order of a keyset paginated listing. Rows are
+// ordered by columns, then id, all in the same direction.
+type keyset struct {
+	sort    string   // Name recorded in cursors, e.g. one of models.BlogPostSorts
+	columns []string // Expressions ordered and compared on
+	keys    []string // Expressions selected into cursors, one per column. DATETIME columns are cast so the stored text survives the round trip.
+	desc    bool
+}
+
+// orderBy returns the ORDER BY clause
+func (k keyset) orderBy() string {
+	direction := " ASC"
+	if k.desc {
+		direction = " DESC"
+	}
+	return strings.Join(append(append([]string{}, k.columns...), "id"), direction+", ") + direction
+}
+
+// selectKeys returns the extra select list that scans into a cursor key
+func (k keyset) selectKeys() string {
+	return strings.Join(k.keys, ", ")
+}
+
+// after returns the condition for rows following cursor and its arguments,
+// or "" if cursor is nil
+func (k keyset) after(cursor *Cursor) (string, []any, error) {
+	if cursor == nil {
+		return "", nil, nil
+	}
+	if cursor.Sort != k.sort || len(cursor.Key) != len(k.columns) {
+		return "", nil, ErrInvalidCursor
+	}
+
+	op := " > "
+	if k.desc {
+		op = " < "
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(k.columns)+1), ", ")
+	condition := "(" + strings.Join(k.columns, ", ") + ", id)" + op + "(" + placeholders + ")"
+
+	args := append(append([]any{}, cursor.Key...), cursor.ID)
+	return condition, args, nil
+}
+
+// scanKeys returns a fresh key slice and the pointers to scan into it
+func (k keyset) scanKeys() ([]any, []any) {
+	key := make([]any, len(k.keys))
+	dest := make([]any, len(key))
+	for i := range key {
+		dest[i] = &key[i]
+	}
+	return key, dest
+}
+
+// cursorAt returns the cursor after the row with key and id. Listings
+// fetch one row more than the page size and, if it arrives, return the
+// cursor after the last row kept, so no COUNT is needed to detect the end.
+func (k keyset) cursorAt(key []any, id int64) *Cursor {
+	return &Cursor{Sort: k.sort, Key: key, ID: id}
+}
@@ -1,16 +1,28 @@
+// Package database stores the site's data in SQLite.
+//
+// Functions return their errors instead of logging them, so the handler or
+// worker that called them logs the failure with its own context, such as
+// the request ID. The package only logs while the database is opened and
+// prepared at startup, when there is no request to attribute it to.
 package database
 
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
 
 // InitDB initializes the SQLite database and creates tables
 func InitDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	// Foreign keys are off by default in SQLite and must be enabled per
+	// connection. The busy timeout makes a connection wait for another's
+	// write, e.g. a background worker's, instead of failing with SQLITE_BUSY.
+	// In WAL mode readers no longer wait for writers at all; Close folds the
+	// log back into the database file.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
@@ -23,10 +35,28 @@ func InitDB(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("create tables: %w", err)
 	}
 
-	log.Println("Database initialized successfully")
+	if err := migrate(db); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	slog.Info("Database initialized", "path", dbPath)
 	return db, nil
 }
 
+// Close checkpoints the write-ahead log into the database file and closes
+// db, so the file alone is a complete copy once the process has stopped
+func Close(db *sql.DB) error {
+	if _, err := db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		db.Close()
+		return fmt.Errorf("checkpoint wal: %w", err)
+	}
+
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("close database: %w", err)
+	}
+	return nil
+}
+
 func createTables(db *sql.DB) error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS blog_posts (
@@ -71,6 +101,290 @@ func createTables(db *sql.DB) error {
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_contact_submissions_submitted_at ON contact_submissions(submitted_at DESC);
+
+	CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT UNIQUE NOT NULL,
+		display_name TEXT NOT NULL DEFAULT '',
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		code_hash TEXT NOT NULL,
+		used_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);
+
+	CREATE TABLE IF NOT EXISTS passkeys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		credential_id BLOB UNIQUE NOT NULL,
+		name TEXT NOT NULL,
+		credential TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_passkeys_user_id ON passkeys(user_id);
+
+	CREATE TABLE IF NOT EXISTS sessions (
+		id_hash TEXT PRIMARY KEY,
+		username TEXT NOT NULL,
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		csrf_token TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_seen_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+	CREATE INDEX IF NOT EXISTS idx_sessions_username ON sessions(username);
+
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		prefix TEXT NOT NULL,
+		scopes TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME,
+		last_used_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL DEFAULT '',
+		target_id TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		before TEXT NOT NULL DEFAULT '',
+		after TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '[]',
+		active INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL CHECK (status IN ('pending', 'delivered', 'failed')),
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		last_attempt_at DATETIME,
+		response_status INTEGER NOT NULL DEFAULT 0,
+		response_body TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id DESC);
+
+	CREATE TABLE IF NOT EXISTS webmentions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+		source TEXT NOT NULL,
+		target TEXT NOT NULL,
+		status TEXT NOT NULL CHECK (status IN ('pending', 'verified', 'invalid')),
+		moderation TEXT NOT NULL DEFAULT '' CHECK (moderation IN ('', 'approved', 'rejected')),
+		type TEXT NOT NULL DEFAULT 'mention',
+		author_name TEXT NOT NULL DEFAULT '',
+		author_url TEXT NOT NULL DEFAULT '',
+		author_photo TEXT NOT NULL DEFAULT '',
+		content TEXT NOT NULL DEFAULT '',
+		url TEXT NOT NULL DEFAULT '',
+		published_at DATETIME,
+		error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		verified_at DATETIME,
+		UNIQUE (source, target)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webmentions_post_id ON webmentions(post_id, status, moderation);
+	CREATE INDEX IF NOT EXISTS idx_webmentions_status ON webmentions(status, id);
+
+	CREATE TABLE IF NOT EXISTS webmention_send_queue (
+		post_id INTEGER PRIMARY KEY REFERENCES blog_posts(id) ON DELETE CASCADE,
+		source TEXT NOT NULL,
+		due_at DATETIME NOT NULL,
+		generation INTEGER NOT NULL DEFAULT 1
+	);
+
+	CREATE TABLE IF NOT EXISTS outgoing_webmentions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+		target TEXT NOT NULL,
+		linked INTEGER NOT NULL DEFAULT 1,
+		protocol TEXT NOT NULL DEFAULT '',
+		endpoint TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL CHECK (status IN ('sent', 'failed', 'unsupported')),
+		response_status INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		sent_at DATETIME NOT NULL,
+		UNIQUE (post_id, target)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webmention_send_queue_due ON webmention_send_queue(due_at);
+	CREATE INDEX IF NOT EXISTS idx_outgoing_webmentions_sent_at ON outgoing_webmentions(sent_at DESC);
+
+	CREATE TABLE IF NOT EXISTS activitypub_keys (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		private_key TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS activitypub_followers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor TEXT UNIQUE NOT NULL,
+		inbox TEXT NOT NULL,
+		shared_inbox TEXT NOT NULL DEFAULT '',
+		handle TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS activitypub_outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL,
+		slug TEXT NOT NULL,
+		activity TEXT NOT NULL CHECK (activity IN ('Create', 'Update', 'Delete')),
+		due_at DATETIME NOT NULL,
+		sent_at DATETIME,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS activitypub_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		inbox TEXT NOT NULL,
+		activity TEXT NOT NULL,
+		type TEXT NOT NULL,
+		status TEXT NOT NULL CHECK (status IN ('pending', 'delivered', 'failed')),
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		last_attempt_at DATETIME,
+		response_status INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_activitypub_outbox_post_id ON activitypub_outbox(post_id);
+	CREATE INDEX IF NOT EXISTS idx_activitypub_outbox_due ON activitypub_outbox(sent_at, due_at);
+	CREATE INDEX IF NOT EXISTS idx_activitypub_deliveries_due ON activitypub_deliveries(status, next_attempt_at);
+
+	CREATE TABLE IF NOT EXISTS signing_keys (
+		name TEXT PRIMARY KEY,
+		secret TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS comments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+		parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+		author_name TEXT NOT NULL,
+		author_url TEXT NOT NULL DEFAULT '',
+		body TEXT NOT NULL,
+		status TEXT NOT NULL CHECK (status IN ('pending', 'approved', 'rejected', 'spam')),
+		spam_score INTEGER NOT NULL DEFAULT 0,
+		spam_reasons TEXT NOT NULL DEFAULT '',
+		ip_address TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		edited_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id, status);
+	CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);
+	CREATE INDEX IF NOT EXISTS idx_comments_status ON comments(status, id);
+
+	CREATE TABLE IF NOT EXISTS visitor_salts (
+		day TEXT PRIMARY KEY,
+		salt TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS reactions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+		kind TEXT NOT NULL CHECK (kind IN ('useful', 'insightful')),
+		visitor TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE (post_id, kind, visitor)
+	);
+
+	CREATE TABLE IF NOT EXISTS page_views (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		day TEXT NOT NULL,
+		path TEXT NOT NULL,
+		referrer_host TEXT NOT NULL DEFAULT '',
+		device TEXT NOT NULL,
+		visitor TEXT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_page_views_day ON page_views(day);
+
+	CREATE TABLE IF NOT EXISTS page_view_rollups (
+		day TEXT NOT NULL,
+		dimension TEXT NOT NULL,
+		value TEXT NOT NULL,
+		views INTEGER NOT NULL,
+		visitors INTEGER NOT NULL,
+		PRIMARY KEY (day, dimension, value)
+	);
+
+	CREATE TABLE IF NOT EXISTS not_found_hits (
+		day TEXT NOT NULL,
+		path TEXT NOT NULL,
+		hits INTEGER NOT NULL,
+		PRIMARY KEY (day, path)
+	);
+
+	CREATE TABLE IF NOT EXISTS jobs (
+		name TEXT PRIMARY KEY,
+		spec TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT '' CHECK (status IN ('', 'running', 'ok', 'failed', 'panicked')),
+		last_started_at DATETIME,
+		last_finished_at DATETIME,
+		last_duration_ms INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_run_at DATETIME,
+		runs INTEGER NOT NULL DEFAULT 0,
+		failures INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS job_failures (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job TEXT NOT NULL,
+		status TEXT NOT NULL CHECK (status IN ('failed', 'panicked')),
+		error TEXT NOT NULL,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_job_failures_started_at ON job_failures(started_at DESC);
 	`
 
 	_, err := db.Exec(schema)
@@ -78,6 +392,73 @@ func createTables(db *sql.DB) error {
 		return fmt.Errorf("execute schema: %w", err)
 	}
 
+	if _, err := db.Exec(auditTriggers); err != nil {
+		return fmt.Errorf("create audit triggers: %w", err)
+	}
+
+	return nil
+}
+
+// columnMigrations adds columns introduced after a table was first created.
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so every new
+// column must also be listed here.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"users", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+	{"users", "totp_enabled", "INTEGER NOT NULL DEFAULT 0"},
+	{"users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+	{"sessions", "ip", "TEXT NOT NULL DEFAULT ''"},
+	{"sessions", "user_agent", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// migrate brings tables created by older versions up to date
+func migrate(db *sql.DB) error {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", m.table, m.column, err)
+		}
+		slog.Info("Added column", "table", m.table, "column", m.column)
+	}
 	return nil
 }
 
+// columnExists reports whether table has a column with the given name
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("table info %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, fmt.Errorf("scan table info: %w", err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// IsUniqueViolation reports whether err came from inserting or updating a
+// row that clashes with a UNIQUE column, such as a duplicate slug
+func IsUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"portfolio-v2/models"
+)
+
+// jobTimeFormat matches SQLite's datetime() output so job times compare
+// as text
+const jobTimeFormat = "2006-01-02 15:04:05"
+
+// jobColumns lists the jobs columns in the order scanJob reads them
+const jobColumns = `name, spec, status, last_started_at, last_finished_at, last_duration_ms, last_error, next_run_at, runs, failures`
+
+// GetJob retrieves a job's state by name, or nil if it never was scheduled
+func GetJob(db *sql.DB, name string) (*models.Job, error) {
+	job, err := scanJob(db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query job: %w", err)
+	}
+	return job, nil
+}
+
+// GetJobs returns the state of every scheduled job, by name
+func GetJobs(db *sql.DB) ([]models.Job, error) {
+	rows, err := db.Query(`SELECT ` + jobColumns + ` FROM jobs ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// ScheduleJob saves a job's spec and next run, adding it if it is new
+func ScheduleJob(db *sql.DB, name, spec string, next time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO jobs (name, spec, next_run_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET spec = excluded.spec, next_run_at = excluded.next_run_at
+	`, name, spec, next.UTC().Format(jobTimeFormat))
+	if err != nil {
+		return fmt.Errorf("schedule job: %w", err)
+	}
+	return nil
+}
+
+// DeleteJobsExcept deletes the state of jobs no longer scheduled, keeping
+// those named in names. Their failures are kept until pruned.
+func DeleteJobsExcept(db *sql.DB, names []string) error {
+	if len(names) == 0 {
+		_, err := db.Exec(`DELETE FROM jobs`)
+		if err != nil {
+			return fmt.Errorf("delete jobs: %w", err)
+		}
+		return nil
+	}
+
+	args := make([]any, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	if _, err := db.Exec(`DELETE FROM jobs WHERE name NOT IN (`+placeholders+`)`, args...); err != nil {
+		return fmt.Errorf("delete jobs: %w", err)
+	}
+	return nil
+}
+
+// StartJobRun marks a job as running since started, with its next run due
+// at next
+func StartJobRun(db *sql.DB, name string, started, next time.Time) error {
+	_, err := db.Exec(
+		`UPDATE jobs SET status = ?, last_started_at = ?, next_run_at = ? WHERE name = ?`,
+		models.JobRunning, started.UTC().Format(jobTimeFormat), next.UTC().Format(jobTimeFormat), name,
+	)
+	if err != nil {
+		return fmt.Errorf("start job run: %w", err)
+	}
+	return nil
+}
+
+// FinishJobRun records the outcome of a job's run that started at started.
+// Runs that did not end in models.JobOK are also added to the failures.
+func FinishJobRun(db *sql.DB, name, status, errText string, started, finished time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	failed := 0
+	if status != models.JobOK {
+		failed = 1
+	}
+
+	_, err = tx.Exec(`
+		UPDATE jobs SET
+			status = ?, last_finished_at = ?, last_duration_ms = ?, last_error = ?,
+			runs = runs + 1, failures = failures + ?
+		WHERE name = ?
+	`, status, finished.UTC().Format(jobTimeFormat), finished.Sub(started).Milliseconds(), errText, failed, name)
+	if err != nil {
+		return fmt.Errorf("update job: %w", err)
+	}
+
+	if failed == 1 {
+		_, err := tx.Exec(
+			`INSERT INTO job_failures (job, status, error, started_at, finished_at) VALUES (?, ?, ?, ?, ?)`,
+			name, status, errText, started.UTC().Format(jobTimeFormat), finished.UTC().Format(jobTimeFormat),
+		)
+		if err != nil {
+			return fmt.Errorf("insert job failure: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit job run: %w", err)
+	}
+
+	return nil
+}
+
+// SetJobNextRun moves a job's next run to next, e.g. after skipping one
+func SetJobNextRun(db *sql.DB, name string, next time.Time) error {
+	_, err := db.Exec(`UPDATE jobs SET next_run_at = ? WHERE name = ?`, next.UTC().Format(jobTimeFormat), name)
+	if err != nil {
+		return fmt.Errorf("set job next run: %w", err)
+	}
+	return nil
+}
+
+// GetJobFailures returns the most recent failed runs of any job, newest
+// first
+func GetJobFailures(db *sql.DB, limit int) ([]models.JobFailure, error) {
+	rows, err := db.Query(`
+		SELECT id, job, status, error, started_at, finished_at
+		FROM job_failures
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query job failures: %w", err)
+	}
+	defer rows.Close()
+
+	var failures []models.JobFailure
+	for rows.Next() {
+		var f models.JobFailure
+		if err := rows.Scan(&f.ID, &f.Job, &f.Status, &f.Error, &f.StartedAt, &f.FinishedAt); err != nil {
+			return nil, fmt.Errorf("scan job failure: %w", err)
+		}
+		failures = append(failures, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate job failures: %w", err)
+	}
+
+	return failures, nil
+}
+
+// PruneJobFailures deletes failures of runs started before cutoff,
+// returning how many were removed
+func PruneJobFailures(db *sql.DB, cutoff time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM job_failures WHERE started_at < ?`, cutoff.UTC().Format(jobTimeFormat))
+	if err != nil {
+		return 0, fmt.Errorf("prune job failures: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get rows affected: %w", err)
+	}
+
+	return removed, nil
+}
+
+// scanJob reads a row of jobColumns
+func scanJob(row interface{ Scan(...any) error }) (*models.Job, error) {
+	var job models.Job
+	var started, finished, next sql.NullTime
+	var durationMS int64
+
+	err := row.Scan(
+		&job.Name,
+		&job.Spec,
+		&job.Status,
+		&started,
+		&finished,
+		&durationMS,
+		&job.LastError,
+		&next,
+		&job.Runs,
+		&job.Failures,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.LastDuration = time.Duration(durationMS) * time.Millisecond
+	if started.Valid {
+		job.LastStartedAt = &started.Time
+	}
+	if finished.Valid {
+		job.LastFinishedAt = &finished.Time
+	}
+	if next.Valid {
+		job.NextRunAt = &next.Time
+	}
+
+	return &job, nil
+}
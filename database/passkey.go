@@ -0,0 +1,175 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"portfolio-v2/models"
+)
+
+// passkeyColumns lists the columns scanned into a models.Passkey, in order
+const passkeyColumns = `id, user_id, name, credential, created_at, last_used_at`
+
+// CreatePasskey stores a newly registered WebAuthn credential
+func CreatePasskey(db *sql.DB, passkey *models.Passkey) error {
+	credentialJSON, err := json.Marshal(passkey.Credential)
+	if err != nil {
+		return fmt.Errorf("marshal credential: %w", err)
+	}
+
+	query := `
+		INSERT INTO passkeys (user_id, credential_id, name, credential, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	passkey.CreatedAt = time.Now()
+	result, err := db.Exec(query, passkey.UserID, passkey.Credential.ID, passkey.Name, string(credentialJSON), passkey.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert passkey: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+
+	passkey.ID = id
+	return nil
+}
+
+// GetPasskeysByUser retrieves all passkeys registered by a user
+func GetPasskeysByUser(db *sql.DB, userID int64) ([]models.Passkey, error) {
+	query := `
+		SELECT ` + passkeyColumns + `
+		FROM passkeys
+		WHERE user_id = ?
+		ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	var passkeys []models.Passkey
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan passkey: %w", err)
+		}
+
+		passkeys = append(passkeys, *passkey)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate passkeys: %w", err)
+	}
+
+	return passkeys, nil
+}
+
+// GetPasskeyByCredentialID retrieves a passkey by its WebAuthn credential ID,
+// returning nil if not found
+func GetPasskeyByCredentialID(db *sql.DB, credentialID []byte) (*models.Passkey, error) {
+	query := `
+		SELECT ` + passkeyColumns + `
+		FROM passkeys
+		WHERE credential_id = ?
+	`
+
+	passkey, err := scanPasskey(db.QueryRow(query, credentialID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query passkey: %w", err)
+	}
+	return passkey, nil
+}
+
+// UpdatePasskeyCredential stores the credential after a login, which carries
+// the new signature counter, and records when it was used
+func UpdatePasskeyCredential(db *sql.DB, id int64, credential webauthn.Credential) error {
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return fmt.Errorf("marshal credential: %w", err)
+	}
+
+	query := `UPDATE passkeys SET credential = ?, last_used_at = ? WHERE id = ?`
+	if _, err := db.Exec(query, string(credentialJSON), time.Now(), id); err != nil {
+		return fmt.Errorf("update passkey: %w", err)
+	}
+	return nil
+}
+
+// RenamePasskey changes the name of one of a user's passkeys
+func RenamePasskey(db *sql.DB, userID, id int64, name string) error {
+	result, err := db.Exec(`UPDATE passkeys SET name = ? WHERE id = ? AND user_id = ?`, name, id, userID)
+	if err != nil {
+		return fmt.Errorf("rename passkey: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("passkey with id %d not found", id)
+	}
+
+	return nil
+}
+
+// DeletePasskey revokes one of a user's passkeys
+func DeletePasskey(db *sql.DB, userID, id int64) error {
+	result, err := db.Exec(`DELETE FROM passkeys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("delete passkey: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("passkey with id %d not found", id)
+	}
+
+	return nil
+}
+
+// scanPasskey scans a single passkey row
+func scanPasskey(row interface{ Scan(...any) error }) (*models.Passkey, error) {
+	var passkey models.Passkey
+	var credentialJSON string
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&passkey.ID,
+		&passkey.UserID,
+		&passkey.Name,
+		&credentialJSON,
+		&passkey.CreatedAt,
+		&lastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(credentialJSON), &passkey.Credential); err != nil {
+		return nil, fmt.Errorf("unmarshal credential: %w", err)
+	}
+
+	if lastUsedAt.Valid {
+		passkey.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &passkey, nil
+}
@@ -4,64 +4,19 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 
 	"portfolio-v2/models"
 )
 
-// GetProjects retrieves paginated projects, with featured projects first
-func GetProjects(db *sql.DB, page, limit int) ([]models.Project, error) {
-	offset := (page - 1) * limit
+// projectFeedKeyset orders the home page feed, featured first, then newest
+var projectFeedKeyset = projectKeysets["-featured"]
 
-	query := `
-		SELECT id, title, slug, description, technologies, github_url, image_url, featured, created_at
-		FROM projects
-		ORDER BY featured DESC, created_at DESC
-		LIMIT ? OFFSET ?
-	`
-
-	rows, err := db.Query(query, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("query projects: %w", err)
-	}
-	defer rows.Close()
-
-	var projects []models.Project
-	for rows.Next() {
-		var project models.Project
-		var technologiesJSON string
-		var featured int
-
-		err := rows.Scan(
-			&project.ID,
-			&project.Title,
-			&project.Slug,
-			&project.Description,
-			&technologiesJSON,
-			&project.GithubURL,
-			&project.ImageURL,
-			&featured,
-			&project.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("scan project: %w", err)
-		}
-
-		project.Featured = featured == 1
-
-		if err := json.Unmarshal([]byte(technologiesJSON), &project.Technologies); err != nil {
-			project.Technologies = []string{}
-		}
-
-		projects = append(projects, project)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterate projects: %w", err)
-	}
-
-	return projects, nil
+// GetProjects retrieves a page of projects, with featured projects first.
+// It returns the cursor for the next page, or nil if this is the last.
+func GetProjects(db *sql.DB, limit int, after *Cursor) ([]models.Project, *Cursor, error) {
+	return ListProjects(db, models.ProjectFilter{Sort: projectFeedKeyset.sort}, limit, after)
 }
 
 // GetProjectBySlug retrieves a single project by slug
@@ -116,6 +71,114 @@ func CountProjects(db *sql.DB) (int, error) {
 	return count, nil
 }
 
+// projectKeysets maps each of models.ProjectSorts to its keyset
+var projectKeysets = map[string]keyset{
+	"-featured":   {sort: "-featured", columns: []string{"featured", "created_at"}, keys: []string{"featured", "CAST(created_at AS TEXT)"}, desc: true},
+	"-created_at": {sort: "-created_at", columns: []string{"created_at"}, keys: []string{"CAST(created_at AS TEXT)"}, desc: true},
+	"created_at":  {sort: "created_at", columns: []string{"created_at"}, keys: []string{"CAST(created_at AS TEXT)"}},
+	"title":       {sort: "title", columns: []string{"title COLLATE NOCASE"}, keys: []string{"title"}},
+	"-title":      {sort: "-title", columns: []string{"title COLLATE NOCASE"}, keys: []string{"title"}, desc: true},
+}
+
+// ListProjects retrieves a page of projects matching filter. It returns the
+// cursor for the next page, or nil if this is the last.
+func ListProjects(db *sql.DB, filter models.ProjectFilter, limit int, after *Cursor) ([]models.Project, *Cursor, error) {
+	ks, ok := projectKeysets[filter.Sort]
+	if !ok {
+		ks = projectKeysets["-featured"]
+	}
+
+	var conditions []string
+	var args []any
+
+	if filter.Technology != "" {
+		conditions = append(conditions, "technologies LIKE ?")
+		args = append(args, "%\""+filter.Technology+"\"%")
+	}
+	if filter.Featured != nil {
+		featured := 0
+		if *filter.Featured {
+			featured = 1
+		}
+		conditions = append(conditions, "featured = ?")
+		args = append(args, featured)
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, "(title LIKE ? OR description LIKE ?)")
+		pattern := "%" + filter.Search + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	condition, cursorArgs, err := ks.after(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if condition != "" {
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := `
+		SELECT id, title, slug, description, technologies, github_url, image_url, featured, created_at, ` + ks.selectKeys() + `
+		FROM projects` + where + `
+		ORDER BY ` + ks.orderBy() + `
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, append(args, limit+1)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query projects: %w", err)
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	var keys [][]any
+	for rows.Next() {
+		var project models.Project
+		var technologiesJSON string
+		var featured int
+		key, keyDest := ks.scanKeys()
+
+		err := rows.Scan(append([]any{
+			&project.ID,
+			&project.Title,
+			&project.Slug,
+			&project.Description,
+			&technologiesJSON,
+			&project.GithubURL,
+			&project.ImageURL,
+			&featured,
+			&project.CreatedAt,
+		}, keyDest...)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scan project: %w", err)
+		}
+
+		project.Featured = featured == 1
+
+		if err := json.Unmarshal([]byte(technologiesJSON), &project.Technologies); err != nil {
+			project.Technologies = []string{}
+		}
+
+		projects = append(projects, project)
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterate projects: %w", err)
+	}
+
+	if len(projects) > limit {
+		return projects[:limit], ks.cursorAt(keys[limit-1], projects[limit-1].ID), nil
+	}
+	return projects, nil, nil
+}
+
 // SeedProjects adds sample projects for development
 func SeedProjects(db *sql.DB) error {
 	count, err := CountProjects(db)
@@ -124,7 +187,7 @@ func SeedProjects(db *sql.DB) error {
 	}
 
 	if count > 0 {
-		log.Println("Projects already exist, skipping seed")
+		slog.Debug("Projects already exist, skipping seed")
 		return nil
 	}
 
@@ -227,7 +290,7 @@ func SeedProjects(db *sql.DB) error {
 		}
 	}
 
-	log.Printf("Seeded %d projects", len(projects))
+	slog.Info("Seeded projects", "count", len(projects))
 	return nil
 }
 
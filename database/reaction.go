@@ -0,0 +1,128 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"portfolio-v2/models"
+)
+
+// ToggleReaction adds visitor's reaction of kind to a post, or removes it if
+// they already left it. It reports whether the reaction is now there.
+func ToggleReaction(db *sql.DB, postID int64, kind models.ReactionKind, visitor string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`DELETE FROM reactions WHERE post_id = ? AND kind = ? AND visitor = ?`,
+		postID, string(kind), visitor,
+	)
+	if err != nil {
+		return false, fmt.Errorf("delete reaction: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+
+	if removed == 0 {
+		_, err := tx.Exec(
+			`INSERT INTO reactions (post_id, kind, visitor, created_at) VALUES (?, ?, ?, ?)`,
+			postID, string(kind), visitor, time.Now().UTC().Format("2006-01-02 15:04:05"),
+		)
+		if err != nil {
+			return false, fmt.Errorf("insert reaction: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit reaction: %w", err)
+	}
+
+	return removed == 0, nil
+}
+
+// GetReactionCounts returns how many visitors left each reaction on a post
+func GetReactionCounts(db *sql.DB, postID int64) (models.ReactionCounts, error) {
+	rows, err := db.Query(`SELECT kind, COUNT(*) FROM reactions WHERE post_id = ? GROUP BY kind`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("query reaction counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := models.ReactionCounts{}
+	for rows.Next() {
+		var kind string
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, fmt.Errorf("scan reaction count: %w", err)
+		}
+		counts[models.ReactionKind(kind)] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate reaction counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// GetAllReactionCounts returns the reaction counts of every post that has
+// any, by post ID
+func GetAllReactionCounts(db *sql.DB) (map[int64]models.ReactionCounts, error) {
+	rows, err := db.Query(`SELECT post_id, kind, COUNT(*) FROM reactions GROUP BY post_id, kind`)
+	if err != nil {
+		return nil, fmt.Errorf("query reaction counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[int64]models.ReactionCounts{}
+	for rows.Next() {
+		var postID int64
+		var kind string
+		var count int
+		if err := rows.Scan(&postID, &kind, &count); err != nil {
+			return nil, fmt.Errorf("scan reaction count: %w", err)
+		}
+
+		if counts[postID] == nil {
+			counts[postID] = models.ReactionCounts{}
+		}
+		counts[postID][models.ReactionKind(kind)] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate reaction counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// GetVisitorReactions returns the reactions visitor left on a post
+func GetVisitorReactions(db *sql.DB, postID int64, visitor string) (map[models.ReactionKind]bool, error) {
+	rows, err := db.Query(`SELECT kind FROM reactions WHERE post_id = ? AND visitor = ?`, postID, visitor)
+	if err != nil {
+		return nil, fmt.Errorf("query visitor reactions: %w", err)
+	}
+	defer rows.Close()
+
+	mine := map[models.ReactionKind]bool{}
+	for rows.Next() {
+		var kind string
+		if err := rows.Scan(&kind); err != nil {
+			return nil, fmt.Errorf("scan visitor reaction: %w", err)
+		}
+		mine[models.ReactionKind(kind)] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate visitor reactions: %w", err)
+	}
+
+	return mine, nil
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// signingKeySize is the length in bytes of a generated signing key
+const signingKeySize = 32
+
+// SigningKey returns the HMAC key stored under name, generating and storing
+// one on first use. Keys live in the database so that tokens signed with
+// them stay valid across restarts.
+func SigningKey(db *sql.DB, name string) ([]byte, error) {
+	secret := make([]byte, signingKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate signing key: %w", err)
+	}
+
+	// Processes starting together agree on whichever key was stored first
+	_, err := db.Exec(
+		`INSERT OR IGNORE INTO signing_keys (name, secret, created_at) VALUES (?, ?, ?)`,
+		name, hex.EncodeToString(secret), time.Now().UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert signing key: %w", err)
+	}
+
+	var stored string
+	if err := db.QueryRow(`SELECT secret FROM signing_keys WHERE name = ?`, name).Scan(&stored); err != nil {
+		return nil, fmt.Errorf("query signing key: %w", err)
+	}
+
+	key, err := hex.DecodeString(stored)
+	if err != nil {
+		return nil, fmt.Errorf("decode signing key %s: %w", name, err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"portfolio-v2/models"
+)
+
+// apiTokenColumns lists the columns scanned into a models.APIToken, in order
+const apiTokenColumns = `id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at`
+
+// CreateAPIToken stores a new token by its hash
+func CreateAPIToken(db *sql.DB, token *models.APIToken, hash string) error {
+	scopesJSON, err := json.Marshal(token.Scopes)
+	if err != nil {
+		return fmt.Errorf("marshal scopes: %w", err)
+	}
+
+	query := `
+		INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	token.CreatedAt = time.Now()
+	result, err := db.Exec(query, token.UserID, token.Name, hash, token.Prefix, string(scopesJSON), token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("insert api token: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+
+	token.ID = id
+	return nil
+}
+
+// GetAPITokensByUser retrieves all tokens minted by a user, newest first
+func GetAPITokensByUser(db *sql.DB, userID int64) ([]models.APIToken, error) {
+	query := `
+		SELECT ` + apiTokenColumns + `
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api token: %w", err)
+		}
+
+		tokens = append(tokens, *token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate api tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// GetAPITokenByHash retrieves a token by its hash, returning nil if not found
+func GetAPITokenByHash(db *sql.DB, hash string) (*models.APIToken, error) {
+	query := `
+		SELECT ` + apiTokenColumns + `
+		FROM api_tokens
+		WHERE token_hash = ?
+	`
+
+	token, err := scanAPIToken(db.QueryRow(query, hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query api token: %w", err)
+	}
+
+	return token, nil
+}
+
+// TouchAPIToken records that a token was just used
+func TouchAPIToken(db *sql.DB, id int64) error {
+	if _, err := db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+		return fmt.Errorf("touch api token: %w", err)
+	}
+	return nil
+}
+
+// DeleteAPIToken revokes a token, scoped to its owner so users cannot
+// revoke each other's tokens
+func DeleteAPIToken(db *sql.DB, userID, id int64) error {
+	result, err := db.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("delete api token: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("api token with id %d not found", id)
+	}
+
+	return nil
+}
+
+func scanAPIToken(row interface{ Scan(...any) error }) (*models.APIToken, error) {
+	var token models.APIToken
+	var scopesJSON string
+	var expiresAt, lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&scopesJSON,
+		&token.CreatedAt,
+		&expiresAt,
+		&lastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(scopesJSON), &token.Scopes); err != nil {
+		return nil, fmt.Errorf("unmarshal scopes: %w", err)
+	}
+
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &token, nil
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SetTOTPSecret stores a pending TOTP secret for a user without enabling it
+func SetTOTPSecret(db *sql.DB, userID int64, secret string) error {
+	query := `UPDATE users SET totp_secret = ?, totp_enabled = 0, totp_last_step = 0 WHERE id = ?`
+
+	if _, err := db.Exec(query, secret, userID); err != nil {
+		return fmt.Errorf("set totp secret: %w", err)
+	}
+	return nil
+}
+
+// EnableTOTP turns on two-factor authentication and replaces the user's
+// recovery codes in a single transaction
+func EnableTOTP(db *sql.DB, userID int64, lastStep int64, recoveryCodeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET totp_enabled = 1, totp_last_step = ? WHERE id = ? AND totp_secret != ''`
+	result, err := tx.Exec(query, lastStep, userID)
+	if err != nil {
+		return fmt.Errorf("enable totp: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %d has no pending totp secret", userID)
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two-factor authentication and removes recovery codes
+func DisableTOTP(db *sql.DB, userID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users SET totp_secret = '', totp_enabled = 0, totp_last_step = 0 WHERE id = ?`
+	if _, err := tx.Exec(query, userID); err != nil {
+		return fmt.Errorf("disable totp: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// RecordTOTPStep stores the last accepted TOTP time step. It returns false if
+// an equal or later step was already recorded, which means the code is a replay.
+func RecordTOTPStep(db *sql.DB, userID int64, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`
+
+	result, err := db.Exec(query, step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("record totp step: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("check rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new ones
+func ReplaceRecoveryCodes(db *sql.DB, userID int64, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks a matching unused recovery code as used. It returns
+// false if no unused code matches.
+func UseRecoveryCode(db *sql.DB, userID int64, codeHash string) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = ?
+		WHERE id = (
+			SELECT id FROM recovery_codes
+			WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+			LIMIT 1
+		)
+	`
+
+	result, err := db.Exec(query, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("use recovery code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("check rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left
+func CountRecoveryCodes(db *sql.DB, userID int64) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`
+
+	if err := db.QueryRow(query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// replaceRecoveryCodes swaps a user's recovery codes within tx
+func replaceRecoveryCodes(tx *sql.Tx, userID int64, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, hash := range codeHashes {
+		if _, err := stmt.Exec(userID, hash); err != nil {
+			return fmt.Errorf("insert recovery code: %w", err)
+		}
+	}
+
+	return nil
+}
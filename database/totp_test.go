@@ -0,0 +1,55 @@
+package database_test
+
+import (
+	"testing"
+
+	"portfolio-v2/database"
+	"portfolio-v2/internal/testdb"
+	"portfolio-v2/models"
+	"portfolio-v2/totp"
+)
+
+func TestUseRecoveryCodeIsSingleUse(t *testing.T) {
+	db := testdb.Open(t)
+
+	user := &models.User{Username: "owner", PasswordHash: "x", Role: models.RoleOwner}
+	if err := database.CreateUser(db, user); err != nil {
+		t.Fatal(err)
+	}
+	codes := []string{"aaaaa-11111", "bbbbb-22222"}
+	hashes := []string{totp.HashRecoveryCode(codes[0]), totp.HashRecoveryCode(codes[1])}
+	if err := database.ReplaceRecoveryCodes(db, user.ID, hashes); err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := database.UseRecoveryCode(db, user.ID, totp.HashRecoveryCode("AAAAA11111"))
+	if err != nil || !used {
+		t.Fatalf("first use = %v, %v; want true", used, err)
+	}
+	used, err = database.UseRecoveryCode(db, user.ID, hashes[0])
+	if err != nil || used {
+		t.Fatalf("second use = %v, %v; want false", used, err)
+	}
+
+	left, err := database.CountRecoveryCodes(db, user.ID)
+	if err != nil || left != 1 {
+		t.Fatalf("CountRecoveryCodes = %d, %v; want 1", left, err)
+	}
+
+	// Another user cannot spend the first user's codes
+	other := &models.User{Username: "editor", PasswordHash: "x", Role: models.RoleEditor}
+	if err := database.CreateUser(db, other); err != nil {
+		t.Fatal(err)
+	}
+	if used, err := database.UseRecoveryCode(db, other.ID, hashes[1]); err != nil || used {
+		t.Fatalf("use by another user = %v, %v; want false", used, err)
+	}
+
+	// Regenerating discards the unused code
+	if err := database.ReplaceRecoveryCodes(db, user.ID, []string{totp.HashRecoveryCode("ccccc-33333")}); err != nil {
+		t.Fatal(err)
+	}
+	if used, err := database.UseRecoveryCode(db, user.ID, hashes[1]); err != nil || used {
+		t.Fatalf("use of a replaced code = %v, %v; want false", used, err)
+	}
+}
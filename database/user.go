@@ -0,0 +1,202 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"portfolio-v2/models"
+)
+
+// userColumns lists the columns scanned into a models.User, in order
+const userColumns = `id, username, display_name, password_hash, role, created_at, totp_secret, totp_enabled, totp_last_step`
+
+// CreateUser inserts a new admin user with an already-hashed password
+func CreateUser(db *sql.DB, user *models.User) error {
+	query := `
+		INSERT INTO users (username, display_name, password_hash, role, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	user.CreatedAt = time.Now()
+	result, err := db.Exec(query, user.Username, user.DisplayName, user.PasswordHash, string(user.Role), user.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert user: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+
+	user.ID = id
+	return nil
+}
+
+// GetUserByUsername retrieves a user by username, returning nil if not found
+func GetUserByUsername(db *sql.DB, username string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE username = ?
+	`
+
+	return queryUser(db.QueryRow(query, username))
+}
+
+// GetUserByID retrieves a user by ID, returning nil if not found
+func GetUserByID(db *sql.DB, id int64) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = ?
+	`
+
+	return queryUser(db.QueryRow(query, id))
+}
+
+// GetAllUsers retrieves all admin users for the user management page
+func GetAllUsers(db *sql.DB) ([]models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+
+		users = append(users, *user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate users: %w", err)
+	}
+
+	return users, nil
+}
+
+// CountUsers returns the total number of admin users
+func CountUsers(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count users: %w", err)
+	}
+	return count, nil
+}
+
+// CountOwners returns the number of users with the owner role
+func CountOwners(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, string(models.RoleOwner)).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count owners: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateUserRole changes the role of a user
+func UpdateUserRole(db *sql.DB, id int64, role models.Role) error {
+	result, err := db.Exec(`UPDATE users SET role = ? WHERE id = ?`, string(role), id)
+	if err != nil {
+		return fmt.Errorf("update user role: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %d not found", id)
+	}
+
+	return nil
+}
+
+// UpdateUserPassword replaces a user's password hash
+func UpdateUserPassword(db *sql.DB, id int64, passwordHash string) error {
+	result, err := db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, id)
+	if err != nil {
+		return fmt.Errorf("update user password: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %d not found", id)
+	}
+
+	return nil
+}
+
+// DeleteUser deletes a user by ID
+func DeleteUser(db *sql.DB, id int64) error {
+	result, err := db.Exec(`DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %d not found", id)
+	}
+
+	return nil
+}
+
+// queryUser scans a single user row, returning nil if there is no row
+func queryUser(row *sql.Row) (*models.User, error) {
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query user: %w", err)
+	}
+	return user, nil
+}
+
+// scanUser scans the columns listed in userColumns
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
+	var user models.User
+	var role string
+	var totpEnabled int
+
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.DisplayName,
+		&user.PasswordHash,
+		&role,
+		&user.CreatedAt,
+		&user.TOTPSecret,
+		&totpEnabled,
+		&user.TOTPLastStep,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Role = models.Role(role)
+	user.TOTPEnabled = totpEnabled == 1
+	return &user, nil
+}
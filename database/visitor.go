@@ -0,0 +1,52 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+)
+
+// visitorSaltSize is the length in bytes of a generated visitor salt
+const visitorSaltSize = 32
+
+// VisitorSalt returns the salt visitors are hashed with on day (YYYY-MM-DD),
+// generating and storing one on first use. Salts of earlier days are
+// deleted, so their hashes can no longer be tied to an IP address.
+func VisitorSalt(db *sql.DB, day string) ([]byte, error) {
+	salt := make([]byte, visitorSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate visitor salt: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Processes starting together agree on whichever salt was stored first
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO visitor_salts (day, salt) VALUES (?, ?)`, day, hex.EncodeToString(salt)); err != nil {
+		return nil, fmt.Errorf("insert visitor salt: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM visitor_salts WHERE day < ?`, day); err != nil {
+		return nil, fmt.Errorf("delete old visitor salts: %w", err)
+	}
+
+	var stored string
+	if err := tx.QueryRow(`SELECT salt FROM visitor_salts WHERE day = ?`, day).Scan(&stored); err != nil {
+		return nil, fmt.Errorf("query visitor salt: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit visitor salt: %w", err)
+	}
+
+	decoded, err := hex.DecodeString(stored)
+	if err != nil {
+		return nil, fmt.Errorf("decode visitor salt: %w", err)
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,333 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"portfolio-v2/models"
+)
+
+// webhookTimeFormat matches SQLite's datetime() output so the delivery
+// queue can be ordered and compared as text
+const webhookTimeFormat = "2006-01-02 15:04:05"
+
+// webhookColumns lists the columns scanned into a models.Webhook, in order
+const webhookColumns = `id, url, description, secret, events, active, created_at`
+
+// webhookDeliveryColumns lists the columns scanned into a
+// models.WebhookDelivery, in order
+const webhookDeliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, response_body, error, created_at`
+
+// CreateWebhook stores a new webhook subscription
+func CreateWebhook(db *sql.DB, hook *models.Webhook) error {
+	eventsJSON, err := json.Marshal(hook.Events)
+	if err != nil {
+		return fmt.Errorf("marshal events: %w", err)
+	}
+
+	query := `
+		INSERT INTO webhooks (url, description, secret, events, active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	hook.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	result, err := db.Exec(query, hook.URL, hook.Description, hook.Secret, string(eventsJSON), hook.Active, hook.CreatedAt.Format(webhookTimeFormat))
+	if err != nil {
+		return fmt.Errorf("insert webhook: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+
+	hook.ID = id
+	return nil
+}
+
+// GetWebhooks retrieves every webhook, oldest first
+func GetWebhooks(db *sql.DB) ([]models.Webhook, error) {
+	rows, err := db.Query(`SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var hooks []models.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook: %w", err)
+		}
+
+		hooks = append(hooks, *hook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhooks: %w", err)
+	}
+
+	return hooks, nil
+}
+
+// GetWebhookByID retrieves a webhook, returning nil if not found
+func GetWebhookByID(db *sql.DB, id int64) (*models.Webhook, error) {
+	hook, err := scanWebhook(db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query webhook: %w", err)
+	}
+
+	return hook, nil
+}
+
+// UpdateWebhook saves a webhook's URL, description, events and active flag.
+// The secret is left unchanged.
+func UpdateWebhook(db *sql.DB, hook *models.Webhook) error {
+	eventsJSON, err := json.Marshal(hook.Events)
+	if err != nil {
+		return fmt.Errorf("marshal events: %w", err)
+	}
+
+	query := `
+		UPDATE webhooks
+		SET url = ?, description = ?, events = ?, active = ?
+		WHERE id = ?
+	`
+
+	result, err := db.Exec(query, hook.URL, hook.Description, string(eventsJSON), hook.Active, hook.ID)
+	if err != nil {
+		return fmt.Errorf("update webhook: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("webhook with id %d not found", hook.ID)
+	}
+
+	return nil
+}
+
+// DeleteWebhook removes a webhook along with its delivery log
+func DeleteWebhook(db *sql.DB, id int64) error {
+	result, err := db.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("webhook with id %d not found", id)
+	}
+
+	return nil
+}
+
+// CreateWebhookDeliveries queues payload for each webhook, due immediately.
+// The deliveries are inserted in one transaction so an event is queued for
+// every subscriber or for none.
+func CreateWebhookDeliveries(db *sql.DB, webhookIDs []int64, event models.WebhookEvent, payload string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now().UTC().Format(webhookTimeFormat)
+	for _, id := range webhookIDs {
+		if _, err := tx.Exec(query, id, string(event), payload, models.DeliveryPending, now, now); err != nil {
+			return fmt.Errorf("insert webhook delivery: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit webhook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+// GetDueWebhookDeliveries retrieves up to limit pending deliveries whose
+// next attempt is due at now, oldest first
+func GetDueWebhookDeliveries(db *sql.DB, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?
+	`
+
+	return queryWebhookDeliveries(db, query, models.DeliveryPending, now.UTC().Format(webhookTimeFormat), limit)
+}
+
+// GetWebhookDeliveries retrieves the latest deliveries for a webhook, newest
+// first
+func GetWebhookDeliveries(db *sql.DB, webhookID int64, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	return queryWebhookDeliveries(db, query, webhookID, limit)
+}
+
+// GetWebhookDeliveryByID retrieves a delivery, returning nil if not found
+func GetWebhookDeliveryByID(db *sql.DB, id int64) (*models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = ?`
+
+	delivery, err := scanWebhookDelivery(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query webhook delivery: %w", err)
+	}
+
+	return delivery, nil
+}
+
+// RecordWebhookAttempt saves the outcome of an attempt: the delivery's
+// status, attempt count, next attempt time and latest response or error
+func RecordWebhookAttempt(db *sql.DB, delivery *models.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?,
+			response_status = ?, response_body = ?, error = ?
+		WHERE id = ?
+	`
+
+	var lastAttempt any
+	if delivery.LastAttemptAt != nil {
+		lastAttempt = delivery.LastAttemptAt.UTC().Format(webhookTimeFormat)
+	}
+
+	_, err := db.Exec(query,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt.UTC().Format(webhookTimeFormat),
+		lastAttempt,
+		delivery.ResponseStatus,
+		delivery.ResponseBody,
+		delivery.Error,
+		delivery.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// PruneWebhookDeliveries deletes finished deliveries created before cutoff
+// and returns how many were removed. Pending deliveries are always kept.
+func PruneWebhookDeliveries(db *sql.DB, cutoff time.Time) (int64, error) {
+	result, err := db.Exec(
+		`DELETE FROM webhook_deliveries WHERE status != ? AND created_at < ?`,
+		models.DeliveryPending, cutoff.UTC().Format(webhookTimeFormat),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("prune webhook deliveries: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func queryWebhookDeliveries(db *sql.DB, query string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+
+		deliveries = append(deliveries, *delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func scanWebhook(row interface{ Scan(...any) error }) (*models.Webhook, error) {
+	var hook models.Webhook
+	var eventsJSON string
+
+	err := row.Scan(
+		&hook.ID,
+		&hook.URL,
+		&hook.Description,
+		&hook.Secret,
+		&eventsJSON,
+		&hook.Active,
+		&hook.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(eventsJSON), &hook.Events); err != nil {
+		return nil, fmt.Errorf("unmarshal events: %w", err)
+	}
+
+	return &hook, nil
+}
+
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var event string
+	var lastAttempt sql.NullTime
+
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&lastAttempt,
+		&delivery.ResponseStatus,
+		&delivery.ResponseBody,
+		&delivery.Error,
+		&delivery.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Event = models.WebhookEvent(event)
+	if lastAttempt.Valid {
+		delivery.LastAttemptAt = &lastAttempt.Time
+	}
+
+	return &delivery, nil
+}
@@ -0,0 +1,446 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"portfolio-v2/models"
+)
+
+// webmentionTimeFormat matches SQLite's datetime() output so mention times
+// sort and compare as text
+const webmentionTimeFormat = "2006-01-02 15:04:05"
+
+// webmentionColumns lists the columns scanned into a models.Webmention, in
+// order
+const webmentionColumns = `id, post_id, source, target, status, moderation, type, author_name, author_url, author_photo, content, url, published_at, error, created_at, verified_at`
+
+// webmentionQueueWhere holds the condition selecting each moderation queue
+var webmentionQueueWhere = map[models.WebmentionQueue]string{
+	models.QueueReview:     `status = 'verified' AND moderation = ''`,
+	models.QueueApproved:   `moderation = 'approved'`,
+	models.QueueRejected:   `moderation = 'rejected'`,
+	models.QueueUnverified: `status != 'verified' AND moderation != 'rejected'`,
+}
+
+// SaveWebmention stores a received mention as pending verification. A
+// mention from the same source to the same target is re-queued instead,
+// keeping its moderation decision, since senders resend when the source
+// changes or is deleted.
+func SaveWebmention(db *sql.DB, mention *models.Webmention) error {
+	query := `
+		INSERT INTO webmentions (post_id, source, target, status, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (source, target) DO UPDATE
+		SET post_id = excluded.post_id, status = excluded.status, error = ''
+		RETURNING id, moderation, created_at
+	`
+
+	now := time.Now().UTC().Format(webmentionTimeFormat)
+	err := db.QueryRow(query, mention.PostID, mention.Source, mention.Target, models.MentionPending, now).
+		Scan(&mention.ID, &mention.Moderation, &mention.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("save webmention: %w", err)
+	}
+
+	mention.Status = models.MentionPending
+	return nil
+}
+
+// GetPendingWebmentions retrieves up to limit mentions waiting for
+// verification, oldest first
+func GetPendingWebmentions(db *sql.DB, limit int) ([]models.Webmention, error) {
+	query := `
+		SELECT ` + webmentionColumns + `
+		FROM webmentions
+		WHERE status = ?
+		ORDER BY id
+		LIMIT ?
+	`
+
+	return queryWebmentions(db, query, models.MentionPending, limit)
+}
+
+// GetWebmentions retrieves up to limit mentions in a moderation queue,
+// newest first
+func GetWebmentions(db *sql.DB, queue models.WebmentionQueue, limit int) ([]models.Webmention, error) {
+	where, ok := webmentionQueueWhere[queue]
+	if !ok {
+		return nil, fmt.Errorf("unknown webmention queue %q", queue)
+	}
+
+	query := `
+		SELECT ` + webmentionColumns + `
+		FROM webmentions
+		WHERE ` + where + `
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	return queryWebmentions(db, query, limit)
+}
+
+// CountWebmentions returns the number of mentions in a moderation queue
+func CountWebmentions(db *sql.DB, queue models.WebmentionQueue) (int, error) {
+	where, ok := webmentionQueueWhere[queue]
+	if !ok {
+		return 0, fmt.Errorf("unknown webmention queue %q", queue)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM webmentions WHERE ` + where).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count webmentions: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetPostWebmentions retrieves the verified, approved mentions of a post,
+// oldest first
+func GetPostWebmentions(db *sql.DB, postID int64) ([]models.Webmention, error) {
+	query := `
+		SELECT ` + webmentionColumns + `
+		FROM webmentions
+		WHERE post_id = ? AND status = ? AND moderation = ?
+		ORDER BY COALESCE(published_at, verified_at), id
+	`
+
+	return queryWebmentions(db, query, postID, models.MentionVerified, models.ModerationApproved)
+}
+
+// GetWebmentionByID retrieves a mention, returning nil if not found
+func GetWebmentionByID(db *sql.DB, id int64) (*models.Webmention, error) {
+	query := `SELECT ` + webmentionColumns + ` FROM webmentions WHERE id = ?`
+
+	mention, err := scanWebmention(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query webmention: %w", err)
+	}
+
+	return mention, nil
+}
+
+// RecordWebmentionVerification saves the outcome of fetching a mention's
+// source: its status and error, and the parsed author and content
+func RecordWebmentionVerification(db *sql.DB, mention *models.Webmention) error {
+	query := `
+		UPDATE webmentions
+		SET status = ?, type = ?, author_name = ?, author_url = ?, author_photo = ?,
+			content = ?, url = ?, published_at = ?, error = ?, verified_at = ?
+		WHERE id = ?
+	`
+
+	var published, verified any
+	if mention.PublishedAt != nil {
+		published = mention.PublishedAt.UTC().Format(webmentionTimeFormat)
+	}
+	if mention.VerifiedAt != nil {
+		verified = mention.VerifiedAt.UTC().Format(webmentionTimeFormat)
+	}
+
+	_, err := db.Exec(query,
+		mention.Status,
+		string(mention.Type),
+		mention.AuthorName,
+		mention.AuthorURL,
+		mention.AuthorPhoto,
+		mention.Content,
+		mention.URL,
+		published,
+		mention.Error,
+		verified,
+		mention.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update webmention: %w", err)
+	}
+
+	return nil
+}
+
+// SetWebmentionModeration records a moderator's decision on a mention
+func SetWebmentionModeration(db *sql.DB, id int64, moderation string) error {
+	result, err := db.Exec(`UPDATE webmentions SET moderation = ? WHERE id = ?`, moderation, id)
+	if err != nil {
+		return fmt.Errorf("update webmention moderation: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("webmention with id %d not found", id)
+	}
+
+	return nil
+}
+
+// RequeueWebmention marks a mention pending so its source is fetched again
+func RequeueWebmention(db *sql.DB, id int64) error {
+	result, err := db.Exec(`UPDATE webmentions SET status = ?, error = '' WHERE id = ?`, models.MentionPending, id)
+	if err != nil {
+		return fmt.Errorf("requeue webmention: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("webmention with id %d not found", id)
+	}
+
+	return nil
+}
+
+// DeleteWebmention removes a mention. The source can send it again.
+func DeleteWebmention(db *sql.DB, id int64) error {
+	result, err := db.Exec(`DELETE FROM webmentions WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete webmention: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("webmention with id %d not found", id)
+	}
+
+	return nil
+}
+
+func queryWebmentions(db *sql.DB, query string, args ...any) ([]models.Webmention, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query webmentions: %w", err)
+	}
+	defer rows.Close()
+
+	var mentions []models.Webmention
+	for rows.Next() {
+		mention, err := scanWebmention(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webmention: %w", err)
+		}
+
+		mentions = append(mentions, *mention)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webmentions: %w", err)
+	}
+
+	return mentions, nil
+}
+
+func scanWebmention(row interface{ Scan(...any) error }) (*models.Webmention, error) {
+	var mention models.Webmention
+	var mentionType string
+	var published, verified sql.NullTime
+
+	err := row.Scan(
+		&mention.ID,
+		&mention.PostID,
+		&mention.Source,
+		&mention.Target,
+		&mention.Status,
+		&mention.Moderation,
+		&mentionType,
+		&mention.AuthorName,
+		&mention.AuthorURL,
+		&mention.AuthorPhoto,
+		&mention.Content,
+		&mention.URL,
+		&published,
+		&mention.Error,
+		&mention.CreatedAt,
+		&verified,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mention.Type = models.MentionType(mentionType)
+	if published.Valid {
+		mention.PublishedAt = &published.Time
+	}
+	if verified.Valid {
+		mention.VerifiedAt = &verified.Time
+	}
+
+	return &mention, nil
+}
+
+// outgoingWebmentionColumns lists the columns scanned into a
+// models.OutgoingWebmention, in order. Queries join blog_posts as p.
+const outgoingWebmentionColumns = `o.id, o.post_id, p.slug, o.target, o.linked, o.protocol, o.endpoint, o.status, o.response_status, o.error, o.sent_at`
+
+// ScheduleWebmentionSend queues the links of a post to be notified at dueAt.
+// Queuing a post that is already waiting replaces its source and time.
+func ScheduleWebmentionSend(db *sql.DB, postID int64, source string, dueAt time.Time) error {
+	query := `
+		INSERT INTO webmention_send_queue (post_id, source, due_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (post_id) DO UPDATE
+		SET source = excluded.source, due_at = excluded.due_at, generation = generation + 1
+	`
+
+	if _, err := db.Exec(query, postID, source, dueAt.UTC().Format(webmentionTimeFormat)); err != nil {
+		return fmt.Errorf("schedule webmention send: %w", err)
+	}
+
+	return nil
+}
+
+// GetDueWebmentionSends retrieves up to limit queued sends due at now,
+// oldest first
+func GetDueWebmentionSends(db *sql.DB, now time.Time, limit int) ([]models.WebmentionSend, error) {
+	query := `
+		SELECT post_id, source, due_at, generation
+		FROM webmention_send_queue
+		WHERE due_at <= ?
+		ORDER BY due_at, post_id
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, now.UTC().Format(webmentionTimeFormat), limit)
+	if err != nil {
+		return nil, fmt.Errorf("query webmention sends: %w", err)
+	}
+	defer rows.Close()
+
+	var sends []models.WebmentionSend
+	for rows.Next() {
+		var send models.WebmentionSend
+		if err := rows.Scan(&send.PostID, &send.Source, &send.DueAt, &send.Generation); err != nil {
+			return nil, fmt.Errorf("scan webmention send: %w", err)
+		}
+
+		sends = append(sends, send)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webmention sends: %w", err)
+	}
+
+	return sends, nil
+}
+
+// CompleteWebmentionSend removes a finished send from the queue, unless the
+// post was queued again since send was loaded
+func CompleteWebmentionSend(db *sql.DB, send *models.WebmentionSend) error {
+	_, err := db.Exec(
+		`DELETE FROM webmention_send_queue WHERE post_id = ? AND generation = ?`,
+		send.PostID, send.Generation,
+	)
+	if err != nil {
+		return fmt.Errorf("complete webmention send: %w", err)
+	}
+
+	return nil
+}
+
+// GetOutgoingWebmentions retrieves up to limit of the latest send results
+// across all posts, newest first
+func GetOutgoingWebmentions(db *sql.DB, limit int) ([]models.OutgoingWebmention, error) {
+	query := `
+		SELECT ` + outgoingWebmentionColumns + `
+		FROM outgoing_webmentions o
+		JOIN blog_posts p ON p.id = o.post_id
+		ORDER BY o.sent_at DESC, o.id DESC
+		LIMIT ?
+	`
+
+	return queryOutgoingWebmentions(db, query, limit)
+}
+
+// GetPostOutgoingWebmentions retrieves the send results for every target a
+// post has been sent to
+func GetPostOutgoingWebmentions(db *sql.DB, postID int64) ([]models.OutgoingWebmention, error) {
+	query := `
+		SELECT ` + outgoingWebmentionColumns + `
+		FROM outgoing_webmentions o
+		JOIN blog_posts p ON p.id = o.post_id
+		WHERE o.post_id = ?
+		ORDER BY o.id
+	`
+
+	return queryOutgoingWebmentions(db, query, postID)
+}
+
+// SaveOutgoingWebmention records the result of notifying a target,
+// replacing the previous result for the same post and target
+func SaveOutgoingWebmention(db *sql.DB, o *models.OutgoingWebmention) error {
+	query := `
+		INSERT INTO outgoing_webmentions (post_id, target, linked, protocol, endpoint, status, response_status, error, sent_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (post_id, target) DO UPDATE
+		SET linked = excluded.linked, protocol = excluded.protocol, endpoint = excluded.endpoint,
+			status = excluded.status, response_status = excluded.response_status,
+			error = excluded.error, sent_at = excluded.sent_at
+	`
+
+	_, err := db.Exec(query,
+		o.PostID,
+		o.Target,
+		o.Linked,
+		o.Protocol,
+		o.Endpoint,
+		o.Status,
+		o.ResponseStatus,
+		o.Error,
+		o.SentAt.UTC().Format(webmentionTimeFormat),
+	)
+	if err != nil {
+		return fmt.Errorf("save outgoing webmention: %w", err)
+	}
+
+	return nil
+}
+
+func queryOutgoingWebmentions(db *sql.DB, query string, args ...any) ([]models.OutgoingWebmention, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query outgoing webmentions: %w", err)
+	}
+	defer rows.Close()
+
+	var sent []models.OutgoingWebmention
+	for rows.Next() {
+		var o models.OutgoingWebmention
+		err := rows.Scan(
+			&o.ID,
+			&o.PostID,
+			&o.PostSlug,
+			&o.Target,
+			&o.Linked,
+			&o.Protocol,
+			&o.Endpoint,
+			&o.Status,
+			&o.ResponseStatus,
+			&o.Error,
+			&o.SentAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan outgoing webmention: %w", err)
+		}
+
+		sent = append(sent, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate outgoing webmentions: %w", err)
+	}
+
+	return sent, nil
+}
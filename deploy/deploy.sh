@@ -55,7 +55,7 @@ echo ""
 echo "Step 1: Building production binary for Linux..."
 cd "$LOCAL_DIR"
 templ generate
-CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o portfolio-v2 main.go
+CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o portfolio-v2 .
 echo "✓ Build complete"
 
 # Step 2: Create deployment package
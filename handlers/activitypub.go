@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"portfolio-v2/activitypub"
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/templates"
+)
+
+const (
+	// outboxShown is the number of latest posts in the outbox
+	outboxShown = 20
+
+	// federationDeliveriesShown is the number of deliveries on the admin page
+	federationDeliveriesShown = 50
+
+	// maxInboxBody is the largest activity the inbox accepts
+	maxInboxBody = 1 << 20
+)
+
+// federatePost queues post for the blog's fediverse followers once it is
+// live. Failures are logged but never fail the request.
+func federatePost(db *sql.DB, r *http.Request, post *models.BlogPost) {
+	if err := activitypub.Publish(db, post); err != nil {
+		slog.ErrorContext(r.Context(), "Error queueing post for followers", "post_id", post.ID, "err", err)
+	}
+}
+
+// unfederatePost tells the blog's fediverse followers a post was deleted
+func unfederatePost(db *sql.DB, r *http.Request, post *models.BlogPost) {
+	if err := activitypub.Retract(db, post); err != nil {
+		slog.ErrorContext(r.Context(), "Error queueing deletion of post for followers", "post_id", post.ID, "err", err)
+	}
+}
+
+// writeActivityJSON writes v as an ActivityPub document
+func writeActivityJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", activitypub.ContentType+"; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error encoding ActivityPub document", "err", err)
+	}
+}
+
+// WebFingerHandler resolves the blog's acct: handle, or its actor URL, to
+// the actor document, which is how fediverse servers find the blog
+func WebFingerHandler(ap *activitypub.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		resource := r.URL.Query().Get("resource")
+		if resource == "" {
+			http.Error(w, "resource is required", http.StatusBadRequest)
+			return
+		}
+
+		jrd := ap.WebFinger(resource)
+		if jrd == nil {
+			http.Error(w, "Resource not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/jrd+json; charset=utf-8")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		json.NewEncoder(w).Encode(jrd)
+	}
+}
+
+// ActorHandler serves the blog's actor document, with the public key that
+// its deliveries are signed with
+func ActorHandler(ap *activitypub.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		actor, err := ap.ActorDocument()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error building actor document", "err", err)
+			http.Error(w, "Error loading actor", http.StatusInternalServerError)
+			return
+		}
+
+		writeActivityJSON(w, actor)
+	}
+}
+
+// OutboxHandler serves the Create activities of the latest posts
+func OutboxHandler(db *sql.DB, ap *activitypub.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		total, err := database.CountPublishedBlogPosts(db)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error counting blog posts", "err", err)
+			http.Error(w, "Error loading outbox", http.StatusInternalServerError)
+			return
+		}
+
+		posts, _, err := database.ListBlogPosts(db, models.BlogPostFilter{}, outboxShown, nil)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching blog posts", "err", err)
+			http.Error(w, "Error loading outbox", http.StatusInternalServerError)
+			return
+		}
+
+		items := make([]*activitypub.Activity, 0, len(posts))
+		for i := range posts {
+			activity := ap.PostActivity(models.ActivityCreate, &posts[i], posts[i].PublishedAt)
+			activity.Context = nil
+			items = append(items, activity)
+		}
+
+		writeActivityJSON(w, map[string]any{
+			"@context":     "https://www.w3.org/ns/activitystreams",
+			"id":           ap.OutboxURL(),
+			"type":         "OrderedCollection",
+			"totalItems":   total,
+			"orderedItems": items,
+		})
+	}
+}
+
+// FollowersHandler serves the size of the followers collection. Who the
+// followers are is not published.
+func FollowersHandler(db *sql.DB, ap *activitypub.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		count, err := database.CountFollowers(db)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error counting followers", "err", err)
+			http.Error(w, "Error loading followers", http.StatusInternalServerError)
+			return
+		}
+
+		writeActivityJSON(w, map[string]any{
+			"@context":   "https://www.w3.org/ns/activitystreams",
+			"id":         ap.FollowersURL(),
+			"type":       "OrderedCollection",
+			"totalItems": count,
+		})
+	}
+}
+
+// ArticleHandler serves a published post as an Article, so servers can
+// fetch it by its ID
+func ArticleHandler(db *sql.DB, ap *activitypub.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract slug from URL path /ap/posts/{slug}
+		slug := strings.TrimPrefix(r.URL.Path, "/ap/posts/")
+		if slug == "" || strings.Contains(slug, "/") {
+			http.Error(w, "Article not found", http.StatusNotFound)
+			return
+		}
+
+		post, err := database.GetBlogPostBySlug(db, slug)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching blog post", "slug", slug, "err", err)
+			http.Error(w, "Error loading article", http.StatusInternalServerError)
+			return
+		}
+
+		if post == nil {
+			http.Error(w, "Article not found", http.StatusNotFound)
+			return
+		}
+
+		article := ap.Article(post)
+		article.Context = "https://www.w3.org/ns/activitystreams"
+		writeActivityJSON(w, article)
+	}
+}
+
+// InboxHandler receives activities from other servers. Every request must
+// be signed by the activity's actor; Follow and Undo are acted on and
+// anything else is accepted and ignored.
+func InboxHandler(ap *activitypub.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInboxBody))
+		if err != nil {
+			http.Error(w, "Activity too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		err = ap.Receive(r, body)
+		switch {
+		case err == nil:
+			w.WriteHeader(http.StatusAccepted)
+		case errors.Is(err, activitypub.ErrInvalidActivity):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, activitypub.ErrUnauthorized):
+			slog.WarnContext(r.Context(), "ActivityPub: rejected inbox request", "ip", getClientIP(r), "err", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			slog.ErrorContext(r.Context(), "Error handling activity", "err", err)
+			http.Error(w, "Error handling activity", http.StatusInternalServerError)
+		}
+	}
+}
+
+// FediversePageHandler lists the blog's followers and the latest
+// deliveries to their servers
+func FediversePageHandler(db *sql.DB, ap *activitypub.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		followers, err := database.GetFollowers(db)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching followers", "err", err)
+			http.Error(w, "Error loading followers", http.StatusInternalServerError)
+			return
+		}
+
+		deliveries, err := database.GetFederationDeliveries(db, federationDeliveriesShown)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching federation deliveries", "err", err)
+			http.Error(w, "Error loading deliveries", http.StatusInternalServerError)
+			return
+		}
+
+		props := templates.FediverseProps{
+			Handle:     "@" + ap.Username + "@" + ap.Host(),
+			Followers:  followers,
+			Deliveries: deliveries,
+		}
+
+		component := templates.AdminFediverse(props)
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
@@ -2,13 +2,26 @@ package handlers
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 	"net/http"
+	"sort"
+	"time"
 
 	"portfolio-v2/database"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
 	"portfolio-v2/templates"
 )
 
+// Ranges of the overview panel's charts
+const (
+	overviewDays    = 30 // Page views and 404s per day
+	overviewMonths  = 12 // Posts per month
+	overviewWeeks   = 12 // Contact submissions per week
+	overviewTags    = 8  // Top tags
+	overviewMissing = 5  // Paths most often not found
+)
+
 // AdminDashboardHandler shows the admin dashboard with all content
 func AdminDashboardHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -17,10 +30,16 @@ func AdminDashboardHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		// Get all blog posts
 		blogs, err := database.GetAllBlogPosts(db)
 		if err != nil {
-			log.Printf("Error fetching blog posts: %v", err)
+			slog.ErrorContext(r.Context(), "Error fetching blog posts", "err", err)
 			http.Error(w, "Error fetching blog posts", http.StatusInternalServerError)
 			return
 		}
@@ -28,13 +47,141 @@ func AdminDashboardHandler(db *sql.DB) http.HandlerFunc {
 		// Get all projects
 		projects, err := database.GetAllProjects(db)
 		if err != nil {
-			log.Printf("Error fetching projects: %v", err)
+			slog.ErrorContext(r.Context(), "Error fetching projects", "err", err)
 			http.Error(w, "Error fetching projects", http.StatusInternalServerError)
 			return
 		}
 
+		// Get reaction counts of every post
+		reactions, err := database.GetAllReactionCounts(db)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching reaction counts", "err", err)
+			http.Error(w, "Error fetching reactions", http.StatusInternalServerError)
+			return
+		}
+
+		overview, err := loadOverview(db, blogs, time.Now())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error loading overview", "err", err)
+			http.Error(w, "Error loading overview", http.StatusInternalServerError)
+			return
+		}
+
 		// Render dashboard
-		component := templates.AdminDashboard(blogs, projects)
+		component := templates.AdminDashboard(user, blogs, projects, reactions, overview)
 		component.Render(r.Context(), w)
 	}
 }
+
+// AdminOverviewHandler renders the dashboard's overview panel on its own,
+// for HTMX to refresh it in place
+func AdminOverviewHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		blogs, err := database.GetAllBlogPosts(db)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching blog posts", "err", err)
+			http.Error(w, "Error fetching blog posts", http.StatusInternalServerError)
+			return
+		}
+
+		overview, err := loadOverview(db, blogs, time.Now())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error loading overview", "err", err)
+			http.Error(w, "Error loading overview", http.StatusInternalServerError)
+			return
+		}
+
+		if err := templates.AdminOverview(overview).Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
+
+// loadOverview gathers the charts of the overview panel as of now. Post
+// charts are drawn from blogs, which hold every post including scheduled
+// ones.
+func loadOverview(db *sql.DB, blogs []models.BlogPost, now time.Time) (templates.DashboardOverview, error) {
+	var overview templates.DashboardOverview
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	views, err := database.GetDailyViews(db, overviewDays, now)
+	if err != nil {
+		return overview, err
+	}
+	for _, day := range views {
+		overview.ViewsPerDay = append(overview.ViewsPerDay, templates.ChartPoint{Label: day.Day.Format("Jan 2"), Value: day.Views})
+	}
+
+	notFound, err := database.GetDailyNotFound(db, overviewDays, now)
+	if err != nil {
+		return overview, err
+	}
+	for _, day := range notFound {
+		overview.NotFoundPerDay = append(overview.NotFoundPerDay, templates.ChartPoint{Label: day.Date.Format("Jan 2"), Value: day.Count})
+	}
+
+	if overview.TopNotFound, err = database.GetTopNotFound(db, overviewDays, now, overviewMissing); err != nil {
+		return overview, err
+	}
+
+	// Weeks start on Monday
+	firstWeek := today.AddDate(0, 0, -((int(today.Weekday())+6)%7)-7*(overviewWeeks-1))
+	submitted, err := database.GetContactSubmissionTimes(db, firstWeek)
+	if err != nil {
+		return overview, err
+	}
+	weekly := make([]int, overviewWeeks)
+	for _, t := range submitted {
+		if week := int(t.UTC().Sub(firstWeek).Hours() / (24 * 7)); week >= 0 && week < overviewWeeks {
+			weekly[week]++
+		}
+	}
+	for i, count := range weekly {
+		overview.ContactsPerWeek = append(overview.ContactsPerWeek, templates.ChartPoint{Label: firstWeek.AddDate(0, 0, 7*i).Format("Jan 2"), Value: count})
+	}
+
+	firstMonth := time.Date(now.Year(), now.Month()-overviewMonths+1, 1, 0, 0, 0, 0, time.UTC)
+	monthly := make([]int, overviewMonths)
+	tags := map[string]int{}
+	for _, post := range blogs {
+		published := post.PublishedAt.UTC()
+		if published.After(now) {
+			continue
+		}
+
+		for _, tag := range post.Tags {
+			tags[tag]++
+		}
+
+		month := (published.Year()-firstMonth.Year())*12 + int(published.Month()-firstMonth.Month())
+		if month >= 0 && month < overviewMonths {
+			monthly[month]++
+		}
+	}
+	for i, count := range monthly {
+		overview.PostsPerMonth = append(overview.PostsPerMonth, templates.ChartPoint{Label: firstMonth.AddDate(0, i, 0).Format("Jan 06"), Value: count})
+	}
+
+	for tag, count := range tags {
+		overview.TopTags = append(overview.TopTags, templates.ChartPoint{Label: tag, Value: count})
+	}
+	sort.Slice(overview.TopTags, func(i, j int) bool {
+		a, b := overview.TopTags[i], overview.TopTags[j]
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		return a.Label < b.Label
+	})
+	if len(overview.TopTags) > overviewTags {
+		overview.TopTags = overview.TopTags[:overviewTags]
+	}
+
+	return overview, nil
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/templates"
+)
+
+// defaultAnalyticsDays is the range the analytics page shows unless
+// another of models.AnalyticsRanges is asked for
+const defaultAnalyticsDays = 30
+
+// AnalyticsPageHandler shows which pages were read, where readers came
+// from and how views developed over the last ?days= days
+func AnalyticsPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		days, err := strconv.Atoi(r.URL.Query().Get("days"))
+		if err != nil || !slices.Contains(models.AnalyticsRanges, days) {
+			days = defaultAnalyticsDays
+		}
+
+		report, err := database.GetAnalyticsReport(db, days, time.Now())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching analytics", "err", err)
+			http.Error(w, "Error loading analytics", http.StatusInternalServerError)
+			return
+		}
+
+		component := templates.AdminAnalytics(*report)
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
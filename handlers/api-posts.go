@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"portfolio-v2/database"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+)
+
+const apiPostsPath = "/api/v1/posts/"
+
+// postInput is the request body for creating or updating a blog post. Nil
+// fields are left unchanged by PATCH.
+type postInput struct {
+	Title   *string   `json:"title"`
+	Excerpt *string   `json:"excerpt"`
+	Content *string   `json:"content"`
+	Tags    *[]string `json:"tags"`
+}
+
+// apply copies the set fields of in onto post
+func (in postInput) apply(post *models.BlogPost) {
+	if in.Title != nil {
+		post.Title = strings.TrimSpace(*in.Title)
+	}
+	if in.Excerpt != nil {
+		post.Excerpt = strings.TrimSpace(*in.Excerpt)
+	}
+	if in.Content != nil {
+		post.Content = strings.TrimSpace(*in.Content)
+	}
+	if in.Tags != nil {
+		post.Tags = cleanList(*in.Tags)
+	}
+}
+
+// validatePost returns a message for each invalid field of post
+func validatePost(post *models.BlogPost) map[string]string {
+	fields := map[string]string{}
+
+	switch {
+	case post.Title == "":
+		fields["title"] = "is required"
+	case len(post.Title) > 200:
+		fields["title"] = "must be at most 200 characters"
+	}
+
+	switch {
+	case post.Excerpt == "":
+		fields["excerpt"] = "is required"
+	case len(post.Excerpt) > 500:
+		fields["excerpt"] = "must be at most 500 characters"
+	}
+
+	if post.Content == "" {
+		fields["content"] = "is required"
+	}
+
+	if len(post.Tags) > 20 {
+		fields["tags"] = "must have at most 20 entries"
+	}
+	for _, tag := range post.Tags {
+		if len(tag) > 50 {
+			fields["tags"] = "entries must be at most 50 characters"
+		}
+	}
+
+	return fields
+}
+
+// APIPostsHandler serves GET (list) and POST (create) on /api/v1/posts.
+// create is wrapped separately so only writes need a token.
+func APIPostsHandler(db *sql.DB, create http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			listPostsAPI(db, w, r)
+		case http.MethodPost:
+			create(w, r)
+		default:
+			APIMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	}
+}
+
+// APIPostHandler serves GET on /api/v1/posts/{slug}, passing PUT, PATCH
+// and DELETE to write
+func APIPostHandler(db *sql.DB, write http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			getPostAPI(db, w, r)
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			write(w, r)
+		default:
+			APIMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+		}
+	}
+}
+
+// listPostsAPI returns published posts, filtered by tag and q, sorted by
+// sort and paginated by cursor and per_page. A cursor issued for a
+// different sort is rejected.
+func listPostsAPI(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	fields := map[string]string{}
+	after, perPage := parseAPIPagination(r, fields)
+
+	filter := models.BlogPostFilter{
+		Tag:    strings.TrimSpace(query.Get("tag")),
+		Search: strings.TrimSpace(query.Get("q")),
+		Sort:   query.Get("sort"),
+	}
+	if !validSort(filter.Sort, models.BlogPostSorts) {
+		fields["sort"] = "must be one of " + strings.Join(models.BlogPostSorts, ", ")
+	}
+
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	posts, next, err := database.ListBlogPosts(db, filter, perPage, after)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		writeValidationError(w, map[string]string{"cursor": "was issued for a different sort order"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error listing blog posts", "err", err)
+		writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error loading posts")
+		return
+	}
+
+	if posts == nil {
+		posts = []models.BlogPost{}
+	}
+	writeAPIList(w, posts, perPage, next)
+}
+
+// getPostAPI returns a single published post by slug
+func getPostAPI(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	post, ok := loadPostAPI(db, w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, apiItem{Data: post})
+}
+
+// APICreatePostHandler creates a blog post from a JSON body, crediting the
+// token's owner as author. siteURL is the site's public origin.
+func APICreatePostHandler(db *sql.DB, siteURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			writeAPIError(w, http.StatusUnauthorized, apiCodeUnauthorized, "Authentication required")
+			return
+		}
+
+		var in postInput
+		if !decodeAPIBody(w, r, &in) {
+			return
+		}
+
+		post := &models.BlogPost{Tags: []string{}}
+		in.apply(post)
+		if fields := validatePost(post); len(fields) > 0 {
+			writeValidationError(w, fields)
+			return
+		}
+
+		slug, err := database.CreateBlogPost(db, post.Title, post.Excerpt, post.Content, post.Tags, user.Name())
+		if database.IsUniqueViolation(err) {
+			writeAPIError(w, http.StatusConflict, apiCodeConflict, "A post with this title already exists")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error creating blog post", "err", err)
+			writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error creating post")
+			return
+		}
+
+		created, err := database.GetBlogPostBySlug(db, slug)
+		if err != nil || created == nil {
+			slog.ErrorContext(r.Context(), "Error fetching created blog post", "slug", slug, "err", err)
+			writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Post was created but could not be loaded")
+			return
+		}
+
+		recordAudit(db, r, "", models.AuditCreate, models.AuditTargetBlogPost, strconv.FormatInt(created.ID, 10), nil, created)
+		fireWebhook(db, r, models.EventPostPublished, created)
+		sendWebmentions(db, r, siteURL, created)
+		federatePost(db, r, created)
+
+		w.Header().Set("Location", apiPostsPath+created.Slug)
+		writeJSON(w, http.StatusCreated, apiItem{Data: created})
+	}
+}
+
+// APIWritePostHandler updates (PUT replaces, PATCH merges) or deletes the
+// post at /api/v1/posts/{slug}. siteURL is the site's public origin.
+func APIWritePostHandler(db *sql.DB, siteURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		before, ok := loadPostAPI(db, w, r)
+		if !ok {
+			return
+		}
+		id := int(before.ID)
+
+		if r.Method == http.MethodDelete {
+			if err := database.DeleteBlogPost(db, id); err != nil {
+				slog.ErrorContext(r.Context(), "Error deleting blog post", "err", err)
+				writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error deleting post")
+				return
+			}
+
+			recordAudit(db, r, "", models.AuditDelete, models.AuditTargetBlogPost, strconv.Itoa(id), before, nil)
+			fireWebhook(db, r, models.EventPostDeleted, before)
+			unfederatePost(db, r, before)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var in postInput
+		if !decodeAPIBody(w, r, &in) {
+			return
+		}
+
+		after := *before
+		if r.Method == http.MethodPut {
+			after.Title, after.Excerpt, after.Content, after.Tags = "", "", "", []string{}
+		}
+		in.apply(&after)
+
+		if fields := validatePost(&after); len(fields) > 0 {
+			writeValidationError(w, fields)
+			return
+		}
+
+		if err := database.UpdateBlogPost(db, id, after.Title, after.Excerpt, after.Content, after.Tags); err != nil {
+			slog.ErrorContext(r.Context(), "Error updating blog post", "err", err)
+			writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error updating post")
+			return
+		}
+
+		recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetBlogPost, strconv.Itoa(id), before, after)
+		fireWebhook(db, r, models.EventPostUpdated, after)
+		sendWebmentions(db, r, siteURL, &after)
+		federatePost(db, r, &after)
+		writeJSON(w, http.StatusOK, apiItem{Data: after})
+	}
+}
+
+// loadPostAPI fetches the post named by the request path, writing a 404 and
+// returning false if there is none
+func loadPostAPI(db *sql.DB, w http.ResponseWriter, r *http.Request) (*models.BlogPost, bool) {
+	slug := apiSlug(r, apiPostsPath)
+	if slug == "" {
+		APINotFoundHandler(w, r)
+		return nil, false
+	}
+
+	post, err := database.GetBlogPostBySlug(db, slug)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching blog post", "slug", slug, "err", err)
+		writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error loading post")
+		return nil, false
+	}
+
+	if post == nil {
+		writeAPIError(w, http.StatusNotFound, apiCodeNotFound, "Post not found")
+		return nil, false
+	}
+
+	return post, true
+}
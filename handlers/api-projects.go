@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+)
+
+const apiProjectsPath = "/api/v1/projects/"
+
+// projectSlugPattern matches lowercase, hyphen separated slugs
+var projectSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// projectInput is the request body for creating or updating a project. Nil
+// fields are left unchanged by PATCH.
+type projectInput struct {
+	Title        *string   `json:"title"`
+	Slug         *string   `json:"slug"`
+	Description  *string   `json:"description"`
+	Technologies *[]string `json:"technologies"`
+	GithubURL    *string   `json:"github_url"`
+	ImageURL     *string   `json:"image_url"`
+	Featured     *bool     `json:"featured"`
+}
+
+// apply copies the set fields of in onto project, except the slug
+func (in projectInput) apply(project *models.Project) {
+	if in.Title != nil {
+		project.Title = strings.TrimSpace(*in.Title)
+	}
+	if in.Description != nil {
+		project.Description = strings.TrimSpace(*in.Description)
+	}
+	if in.Technologies != nil {
+		project.Technologies = cleanList(*in.Technologies)
+	}
+	if in.GithubURL != nil {
+		project.GithubURL = strings.TrimSpace(*in.GithubURL)
+	}
+	if in.ImageURL != nil {
+		project.ImageURL = strings.TrimSpace(*in.ImageURL)
+	}
+	if in.Featured != nil {
+		project.Featured = *in.Featured
+	}
+}
+
+// validateProject returns a message for each invalid field of project
+func validateProject(project *models.Project) map[string]string {
+	fields := map[string]string{}
+
+	switch {
+	case project.Title == "":
+		fields["title"] = "is required"
+	case len(project.Title) > 200:
+		fields["title"] = "must be at most 200 characters"
+	}
+
+	switch {
+	case project.Slug == "":
+		fields["slug"] = "is required"
+	case !projectSlugPattern.MatchString(project.Slug):
+		fields["slug"] = "must be lowercase letters, digits and single hyphens"
+	}
+
+	if project.Description == "" {
+		fields["description"] = "is required"
+	}
+
+	if len(project.Technologies) > 20 {
+		fields["technologies"] = "must have at most 20 entries"
+	}
+
+	if project.GithubURL != "" && !isHTTPURL(project.GithubURL) {
+		fields["github_url"] = "must be an http or https URL"
+	}
+
+	switch {
+	case project.ImageURL == "":
+		fields["image_url"] = "is required"
+	case !strings.HasPrefix(project.ImageURL, "/") && !isHTTPURL(project.ImageURL):
+		fields["image_url"] = "must be an absolute path or an http or https URL"
+	}
+
+	return fields
+}
+
+// isHTTPURL reports whether raw is an absolute http or https URL
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// APIProjectsHandler serves GET (list) and POST (create) on
+// /api/v1/projects. create is wrapped separately so only writes need a token.
+func APIProjectsHandler(db *sql.DB, create http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			listProjectsAPI(db, w, r)
+		case http.MethodPost:
+			create(w, r)
+		default:
+			APIMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	}
+}
+
+// APIProjectHandler serves GET on /api/v1/projects/{slug}, passing PUT,
+// PATCH and DELETE to write
+func APIProjectHandler(db *sql.DB, write http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			getProjectAPI(db, w, r)
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			write(w, r)
+		default:
+			APIMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+		}
+	}
+}
+
+// listProjectsAPI returns projects filtered by technology, featured and q,
+// sorted by sort and paginated by cursor and per_page. A cursor issued for
+// a different sort is rejected.
+func listProjectsAPI(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	fields := map[string]string{}
+	after, perPage := parseAPIPagination(r, fields)
+
+	filter := models.ProjectFilter{
+		Technology: strings.TrimSpace(query.Get("technology")),
+		Search:     strings.TrimSpace(query.Get("q")),
+		Sort:       query.Get("sort"),
+	}
+	if value := query.Get("featured"); value != "" {
+		featured, err := strconv.ParseBool(value)
+		if err != nil {
+			fields["featured"] = "must be true or false"
+		} else {
+			filter.Featured = &featured
+		}
+	}
+	if !validSort(filter.Sort, models.ProjectSorts) {
+		fields["sort"] = "must be one of " + strings.Join(models.ProjectSorts, ", ")
+	}
+
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	projects, next, err := database.ListProjects(db, filter, perPage, after)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		writeValidationError(w, map[string]string{"cursor": "was issued for a different sort order"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error listing projects", "err", err)
+		writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error loading projects")
+		return
+	}
+
+	if projects == nil {
+		projects = []models.Project{}
+	}
+	writeAPIList(w, projects, perPage, next)
+}
+
+// getProjectAPI returns a single project by slug
+func getProjectAPI(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	project, ok := loadProjectAPI(db, w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, apiItem{Data: project})
+}
+
+// APICreateProjectHandler creates a project from a JSON body
+func APICreateProjectHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in projectInput
+		if !decodeAPIBody(w, r, &in) {
+			return
+		}
+
+		project := &models.Project{Technologies: []string{}, CreatedAt: time.Now()}
+		in.apply(project)
+		if in.Slug != nil {
+			project.Slug = strings.TrimSpace(*in.Slug)
+		}
+
+		if fields := validateProject(project); len(fields) > 0 {
+			writeValidationError(w, fields)
+			return
+		}
+
+		err := database.CreateProject(db, project)
+		if database.IsUniqueViolation(err) {
+			writeAPIError(w, http.StatusConflict, apiCodeConflict, "A project with this slug already exists")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error creating project", "err", err)
+			writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error creating project")
+			return
+		}
+
+		recordAudit(db, r, "", models.AuditCreate, models.AuditTargetProject, strconv.FormatInt(project.ID, 10), nil, project)
+		fireWebhook(db, r, models.EventProjectCreated, project)
+
+		w.Header().Set("Location", apiProjectsPath+project.Slug)
+		writeJSON(w, http.StatusCreated, apiItem{Data: project})
+	}
+}
+
+// APIWriteProjectHandler updates (PUT replaces, PATCH merges) or deletes
+// the project at /api/v1/projects/{slug}. Slugs cannot be changed.
+func APIWriteProjectHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		before, ok := loadProjectAPI(db, w, r)
+		if !ok {
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			if err := database.DeleteProject(db, int(before.ID)); err != nil {
+				slog.ErrorContext(r.Context(), "Error deleting project", "err", err)
+				writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error deleting project")
+				return
+			}
+
+			recordAudit(db, r, "", models.AuditDelete, models.AuditTargetProject, strconv.FormatInt(before.ID, 10), before, nil)
+			fireWebhook(db, r, models.EventProjectDeleted, before)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var in projectInput
+		if !decodeAPIBody(w, r, &in) {
+			return
+		}
+
+		if in.Slug != nil && strings.TrimSpace(*in.Slug) != before.Slug {
+			writeValidationError(w, map[string]string{"slug": "cannot be changed"})
+			return
+		}
+
+		after := *before
+		if r.Method == http.MethodPut {
+			after = models.Project{ID: before.ID, Slug: before.Slug, Technologies: []string{}, CreatedAt: before.CreatedAt}
+		}
+		in.apply(&after)
+
+		if fields := validateProject(&after); len(fields) > 0 {
+			writeValidationError(w, fields)
+			return
+		}
+
+		if err := database.UpdateProject(db, &after); err != nil {
+			slog.ErrorContext(r.Context(), "Error updating project", "err", err)
+			writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error updating project")
+			return
+		}
+
+		recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetProject, strconv.FormatInt(before.ID, 10), before, after)
+		fireWebhook(db, r, models.EventProjectUpdated, after)
+		writeJSON(w, http.StatusOK, apiItem{Data: after})
+	}
+}
+
+// loadProjectAPI fetches the project named by the request path, writing a
+// 404 and returning false if there is none
+func loadProjectAPI(db *sql.DB, w http.ResponseWriter, r *http.Request) (*models.Project, bool) {
+	slug := apiSlug(r, apiProjectsPath)
+	if slug == "" {
+		APINotFoundHandler(w, r)
+		return nil, false
+	}
+
+	project, err := database.GetProjectBySlug(db, slug)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching project", "slug", slug, "err", err)
+		writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error loading project")
+		return nil, false
+	}
+
+	if project == nil {
+		writeAPIError(w, http.StatusNotFound, apiCodeNotFound, "Project not found")
+		return nil, false
+	}
+
+	return project, true
+}
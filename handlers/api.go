@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"portfolio-v2/database"
+)
+
+const (
+	apiDefaultPerPage = 10
+	apiMaxPerPage     = 100
+	apiMaxBodyBytes   = 1 << 20
+)
+
+// Error codes returned in apiError.Code
+const (
+	apiCodeInvalidJSON      = "invalid_json"
+	apiCodeValidation       = "validation_failed"
+	apiCodeUnauthorized     = "unauthorized"
+	apiCodeForbidden        = "forbidden"
+	apiCodeNotFound         = "not_found"
+	apiCodeMethodNotAllowed = "method_not_allowed"
+	apiCodeConflict         = "conflict"
+	apiCodeInternal         = "internal_error"
+)
+
+// apiError is the body of every error response under /api/v1, wrapped in
+// an "error" object. Fields maps request fields to validation messages.
+type apiError struct {
+	Status  int               `json:"status"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// apiItem wraps a single resource
+type apiItem struct {
+	Data any `json:"data"`
+}
+
+// apiList wraps a page of resources
+type apiList struct {
+	Data       any           `json:"data"`
+	Pagination apiPagination `json:"pagination"`
+}
+
+// apiPagination links a page to the next. NextCursor is passed back as the
+// cursor parameter and is empty on the last page.
+type apiPagination struct {
+	PerPage    int    `json:"per_page"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// writeAPIError writes an error object with the given status
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]apiError{
+		"error": {Status: status, Code: code, Message: message},
+	})
+}
+
+// writeValidationError reports invalid request fields
+func writeValidationError(w http.ResponseWriter, fields map[string]string) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]apiError{
+		"error": {
+			Status:  http.StatusUnprocessableEntity,
+			Code:    apiCodeValidation,
+			Message: "The request has invalid fields",
+			Fields:  fields,
+		},
+	})
+}
+
+// writeAPIList writes a page of resources. items must be a non-nil slice so
+// an empty page encodes as [] rather than null.
+func writeAPIList(w http.ResponseWriter, items any, perPage int, next *database.Cursor) {
+	writeJSON(w, http.StatusOK, apiList{
+		Data: items,
+		Pagination: apiPagination{
+			PerPage:    perPage,
+			HasMore:    next != nil,
+			NextCursor: next.String(),
+		},
+	})
+}
+
+// APITokenError reports rejected API tokens as API error objects
+func APITokenError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	code := apiCodeInternal
+	switch status {
+	case http.StatusUnauthorized:
+		code = apiCodeUnauthorized
+	case http.StatusForbidden:
+		code = apiCodeForbidden
+	}
+	writeAPIError(w, status, code, message)
+}
+
+// APINotFoundHandler answers unknown /api/v1 paths with an error object
+func APINotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, apiCodeNotFound, "No such endpoint")
+}
+
+// APIMethodNotAllowed answers requests using a method the endpoint does not
+// support, listing the allowed ones
+func APIMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, apiCodeMethodNotAllowed, "Method not allowed")
+}
+
+// APIAllow answers methods other than allowed with 405 before calling next,
+// so unsupported methods are reported ahead of authentication
+func APIAllow(next http.HandlerFunc, allowed ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range allowed {
+			if r.Method == method {
+				next(w, r)
+				return
+			}
+		}
+		APIMethodNotAllowed(w, allowed...)
+	}
+}
+
+// parseAPIPagination reads cursor and per_page, recording invalid values in
+// fields
+func parseAPIPagination(r *http.Request, fields map[string]string) (after *database.Cursor, perPage int) {
+	perPage = apiDefaultPerPage
+
+	after, err := database.ParseCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		fields["cursor"] = "is not a cursor returned by this listing"
+	}
+
+	if value := r.URL.Query().Get("per_page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > apiMaxPerPage {
+			fields["per_page"] = "must be between 1 and " + strconv.Itoa(apiMaxPerPage)
+		} else {
+			perPage = n
+		}
+	}
+
+	return after, perPage
+}
+
+// validSort reports whether sort is empty or one of allowed
+func validSort(sort string, allowed []string) bool {
+	if sort == "" {
+		return true
+	}
+	for _, s := range allowed {
+		if s == sort {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeAPIBody decodes a JSON request body into v, writing an error
+// response and returning false if it cannot
+func decodeAPIBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, io.EOF):
+			writeAPIError(w, http.StatusBadRequest, apiCodeInvalidJSON, "Request body must be a JSON object")
+		case errors.As(err, &maxErr):
+			writeAPIError(w, http.StatusRequestEntityTooLarge, apiCodeInvalidJSON, "Request body is too large")
+		default:
+			writeAPIError(w, http.StatusBadRequest, apiCodeInvalidJSON, "Invalid JSON: "+err.Error())
+		}
+		return false
+	}
+
+	if decoder.More() {
+		writeAPIError(w, http.StatusBadRequest, apiCodeInvalidJSON, "Request body must contain a single JSON object")
+		return false
+	}
+
+	return true
+}
+
+// apiSlug returns the slug from a path of the form prefix + slug, or "" if
+// the path has anything else after the prefix
+func apiSlug(r *http.Request, prefix string) string {
+	slug := strings.TrimPrefix(r.URL.Path, prefix)
+	if slug == r.URL.Path || slug == "" || strings.Contains(slug, "/") {
+		return ""
+	}
+	return slug
+}
+
+// cleanList trims every entry and drops empty ones
+func cleanList(values []string) []string {
+	cleaned := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			cleaned = append(cleaned, v)
+		}
+	}
+	return cleaned
+}
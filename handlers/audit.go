@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/session"
+	"portfolio-v2/templates"
+)
+
+// auditPageSize is the number of audit entries shown per page
+const auditPageSize = 50
+
+// auditDateFormat is the format of the since/until filter fields
+const auditDateFormat = "2006-01-02"
+
+// recordAudit appends an entry to the audit log for request r. An empty
+// actor means the logged-in user, or "anonymous" if nobody is. before and
+// after are stored as JSON snapshots; pass nil when there is nothing to
+// record. Failures are logged but never fail the request.
+func recordAudit(db *sql.DB, r *http.Request, actor, action, targetType, targetID string, before, after any) {
+	if actor == "" {
+		if user, ok := middleware.GetUser(r); ok {
+			actor = user.Username
+		} else {
+			actor = "anonymous"
+		}
+	}
+
+	entry := &models.AuditEntry{
+		Actor:      actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         getClientIP(r),
+		UserAgent:  r.UserAgent(),
+		Before:     auditSnapshot(before),
+		After:      auditSnapshot(after),
+	}
+
+	if err := database.RecordAudit(db, entry); err != nil {
+		slog.ErrorContext(r.Context(), "Error recording audit entry", "action", action, "target_type", targetType, "target_id", targetID, "actor", actor, "err", err)
+	}
+}
+
+// auditSnapshot encodes v as JSON, or returns "" for nil values
+func auditSnapshot(v any) string {
+	if v == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("Error encoding audit snapshot", "err", err)
+		return ""
+	}
+
+	if string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
+
+// userSnapshot is the audited view of a user. Password hashes and TOTP
+// secrets are never written to the audit log.
+type userSnapshot struct {
+	Username    string      `json:"username"`
+	DisplayName string      `json:"display_name,omitempty"`
+	Role        models.Role `json:"role"`
+	TOTPEnabled bool        `json:"totp_enabled"`
+}
+
+// auditUser returns the snapshot of user, or nil if user is nil
+func auditUser(user *models.User) any {
+	if user == nil {
+		return nil
+	}
+	return userSnapshot{
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Role:        user.Role,
+		TOTPEnabled: user.TOTPEnabled,
+	}
+}
+
+// passkeySnapshot is the audited view of a passkey. The public key and
+// counters are left out as they change on every use.
+type passkeySnapshot struct {
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+// auditPasskey returns the snapshot of pk, or nil if pk is nil
+func auditPasskey(pk *models.Passkey) any {
+	if pk == nil {
+		return nil
+	}
+	return passkeySnapshot{UserID: pk.UserID, Name: pk.Name}
+}
+
+// sessionSnapshot is the audited view of a session. The session ID itself
+// is a credential and is never logged.
+type sessionSnapshot struct {
+	Username  string    `json:"username"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// auditSession returns the snapshot of sess, or nil if sess is nil
+func auditSession(sess *session.Session) any {
+	if sess == nil {
+		return nil
+	}
+	return sessionSnapshot{
+		Username:  sess.Username,
+		IP:        sess.IP,
+		UserAgent: sess.UserAgent,
+		CreatedAt: sess.CreatedAt,
+	}
+}
+
+// tokenSnapshot is the audited view of an API token. The token itself is
+// never logged, only its display prefix.
+type tokenSnapshot struct {
+	UserID    int64          `json:"user_id"`
+	Name      string         `json:"name"`
+	Prefix    string         `json:"prefix"`
+	Scopes    []models.Scope `json:"scopes"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"`
+}
+
+// auditToken returns the snapshot of token, or nil if token is nil
+func auditToken(token *models.APIToken) any {
+	if token == nil {
+		return nil
+	}
+	return tokenSnapshot{
+		UserID:    token.UserID,
+		Name:      token.Name,
+		Prefix:    token.Prefix,
+		Scopes:    token.Scopes,
+		ExpiresAt: token.ExpiresAt,
+	}
+}
+
+// webhookSnapshot is the audited view of a webhook. The signing secret is
+// never logged.
+type webhookSnapshot struct {
+	URL         string                `json:"url"`
+	Description string                `json:"description,omitempty"`
+	Events      []models.WebhookEvent `json:"events"`
+	Active      bool                  `json:"active"`
+}
+
+// auditWebhook returns the snapshot of hook, or nil if hook is nil
+func auditWebhook(hook *models.Webhook) any {
+	if hook == nil {
+		return nil
+	}
+	return webhookSnapshot{
+		URL:         hook.URL,
+		Description: hook.Description,
+		Events:      hook.Events,
+		Active:      hook.Active,
+	}
+}
+
+// webmentionSnapshot is the audited view of a webmention: enough to tell
+// which mention a moderator acted on
+type webmentionSnapshot struct {
+	PostID     int64              `json:"post_id"`
+	Source     string             `json:"source"`
+	Type       models.MentionType `json:"type"`
+	Status     string             `json:"status"`
+	Moderation string             `json:"moderation,omitempty"`
+}
+
+// auditWebmention returns the snapshot of mention, or nil if mention is nil
+func auditWebmention(mention *models.Webmention) any {
+	if mention == nil {
+		return nil
+	}
+	return webmentionSnapshot{
+		PostID:     mention.PostID,
+		Source:     mention.Source,
+		Type:       mention.Type,
+		Status:     mention.Status,
+		Moderation: mention.Moderation,
+	}
+}
+
+// commentSnapshot is the audited view of a comment. The author's IP and
+// user agent are left out.
+type commentSnapshot struct {
+	PostID     int64  `json:"post_id"`
+	ParentID   int64  `json:"parent_id,omitempty"`
+	AuthorName string `json:"author_name"`
+	Body       string `json:"body"`
+	Status     string `json:"status"`
+	SpamScore  int    `json:"spam_score"`
+}
+
+// auditComment returns the snapshot of c, or nil if c is nil
+func auditComment(c *models.Comment) any {
+	if c == nil {
+		return nil
+	}
+	return commentSnapshot{
+		PostID:     c.PostID,
+		ParentID:   c.ParentID,
+		AuthorName: c.AuthorName,
+		Body:       c.Body,
+		Status:     c.Status,
+		SpamScore:  c.SpamScore,
+	}
+}
+
+// AuditLogPageHandler lists audit entries with filters and pagination
+func AuditLogPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		filter := parseAuditFilter(r.URL.Query())
+
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		entries, err := database.GetAuditEntries(db, filter, auditPageSize, (page-1)*auditPageSize)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching audit log", "err", err)
+			http.Error(w, "Error loading audit log", http.StatusInternalServerError)
+			return
+		}
+
+		total, err := database.CountAuditEntries(db, filter)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error counting audit log", "err", err)
+			http.Error(w, "Error loading audit log", http.StatusInternalServerError)
+			return
+		}
+
+		actors, err := database.GetAuditActors(db)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching audit actors", "err", err)
+			http.Error(w, "Error loading audit log", http.StatusInternalServerError)
+			return
+		}
+
+		query := auditFilterQuery(r.URL.Query())
+		props := templates.AuditLogProps{
+			Entries:       entries,
+			Actors:        actors,
+			Actions:       models.AuditActions,
+			TargetTypes:   models.AuditTargetTypes,
+			Filter:        r.URL.Query(),
+			Query:         query,
+			Page:          page,
+			HasPrev:       page > 1,
+			HasNext:       page*auditPageSize < total,
+			Total:         total,
+			RetentionDays: int(database.AuditRetention / (24 * time.Hour)),
+		}
+
+		component := templates.AdminAuditLog(props)
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
+
+// AuditExportHandler downloads every entry matching the filters as CSV, or
+// as JSON with format=json
+func AuditExportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		filter := parseAuditFilter(r.URL.Query())
+
+		entries, err := database.GetAuditEntries(db, filter, 0, 0)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching audit log", "err", err)
+			http.Error(w, "Error loading audit log", http.StatusInternalServerError)
+			return
+		}
+
+		filename := "audit-log-" + time.Now().Format(auditDateFormat)
+
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+			if entries == nil {
+				entries = []models.AuditEntry{}
+			}
+			if err := json.NewEncoder(w).Encode(auditExport(entries)); err != nil {
+				slog.ErrorContext(r.Context(), "Error writing audit export", "err", err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"id", "time", "actor", "action", "target_type", "target_id", "ip", "user_agent", "before", "after"})
+		for _, entry := range entries {
+			writer.Write([]string{
+				strconv.FormatInt(entry.ID, 10),
+				entry.CreatedAt.UTC().Format(time.RFC3339),
+				entry.Actor,
+				entry.Action,
+				entry.TargetType,
+				entry.TargetID,
+				entry.IP,
+				entry.UserAgent,
+				entry.Before,
+				entry.After,
+			})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			slog.ErrorContext(r.Context(), "Error writing audit export", "err", err)
+		}
+	}
+}
+
+// auditExportEntry is the JSON export shape of an audit entry. Snapshots
+// are embedded as JSON rather than as escaped strings.
+type auditExportEntry struct {
+	ID         int64           `json:"id"`
+	Time       time.Time       `json:"time"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+}
+
+func auditExport(entries []models.AuditEntry) []auditExportEntry {
+	export := make([]auditExportEntry, 0, len(entries))
+	for _, entry := range entries {
+		item := auditExportEntry{
+			ID:         entry.ID,
+			Time:       entry.CreatedAt.UTC(),
+			Actor:      entry.Actor,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			IP:         entry.IP,
+			UserAgent:  entry.UserAgent,
+		}
+		if entry.Before != "" {
+			item.Before = json.RawMessage(entry.Before)
+		}
+		if entry.After != "" {
+			item.After = json.RawMessage(entry.After)
+		}
+		export = append(export, item)
+	}
+	return export
+}
+
+// parseAuditFilter reads the audit filter from query parameters. Dates are
+// whole days, so until includes the whole of the given day.
+func parseAuditFilter(query url.Values) models.AuditFilter {
+	filter := models.AuditFilter{
+		Actor:      query.Get("actor"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+	}
+
+	if since, err := time.ParseInLocation(auditDateFormat, query.Get("since"), time.Local); err == nil {
+		filter.Since = since
+	}
+	if until, err := time.ParseInLocation(auditDateFormat, query.Get("until"), time.Local); err == nil {
+		filter.Until = until.AddDate(0, 0, 1)
+	}
+
+	return filter
+}
+
+// auditFilterQuery returns the filter parameters of query, without the
+// page number, for building pagination and export links
+func auditFilterQuery(query url.Values) string {
+	filters := url.Values{}
+	for _, key := range []string{"actor", "action", "target_type", "since", "until"} {
+		if value := query.Get(key); value != "" {
+			filters.Set(key, value)
+		}
+	}
+	return filters.Encode()
+}
@@ -1,19 +1,32 @@
 package handlers
 
 import (
-	"log"
+	"database/sql"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
+	"portfolio-v2/database"
+	"portfolio-v2/models"
 	"portfolio-v2/ratelimit"
 	"portfolio-v2/session"
 	"portfolio-v2/templates"
+	"portfolio-v2/totp"
+	"portfolio-v2/visitor"
 )
 
+// loginChallengeTTL is how long a user has to enter their second factor
+const loginChallengeTTL = 5 * time.Minute
+
+// dummyHash is compared against when a username does not exist so that
+// failed logins take the same time whether or not the user is real
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
 // LoginPageHandler displays the login form
-func LoginPageHandler(sessionStore *session.Store) http.HandlerFunc {
+func LoginPageHandler(sessionStore session.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -34,7 +47,7 @@ func LoginPageHandler(sessionStore *session.Store) http.HandlerFunc {
 		csrfToken, err := session.GenerateCSRFToken()
 		if err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			log.Printf("Failed to generate CSRF token: %v", err)
+			slog.ErrorContext(r.Context(), "Failed to generate CSRF token", "err", err)
 			return
 		}
 
@@ -58,13 +71,13 @@ func LoginPageHandler(sessionStore *session.Store) http.HandlerFunc {
 		component := templates.Login(csrfToken, "", redirectTo)
 		if err := component.Render(r.Context(), w); err != nil {
 			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-			log.Printf("Template rendering error: %v", err)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
 		}
 	}
 }
 
 // LoginHandler handles login form submission
-func LoginHandler(sessionStore *session.Store, rateLimiter *ratelimit.Limiter, hashedPassword []byte, adminUsername string) http.HandlerFunc {
+func LoginHandler(sessionStore session.Store, rateLimiter *ratelimit.Limiter, db *sql.DB, challenges *session.ChallengeStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -76,7 +89,7 @@ func LoginHandler(sessionStore *session.Store, rateLimiter *ratelimit.Limiter, h
 
 		// Check rate limit
 		if !rateLimiter.Allow(ip) {
-			log.Printf("Rate limit exceeded for IP: %s", ip)
+			slog.WarnContext(r.Context(), "Rate limit exceeded", "ip", ip)
 			component := templates.Login("", "Too many failed attempts. Please try again later.", r.FormValue("redirect"))
 			component.Render(r.Context(), w)
 			w.WriteHeader(http.StatusTooManyRequests)
@@ -93,7 +106,7 @@ func LoginHandler(sessionStore *session.Store, rateLimiter *ratelimit.Limiter, h
 		formCSRF := r.FormValue("csrf_token")
 		cookieCSRF, err := r.Cookie("csrf_token")
 		if err != nil || formCSRF != cookieCSRF.Value {
-			log.Printf("CSRF token validation failed from IP: %s", ip)
+			slog.WarnContext(r.Context(), "CSRF token validation failed", "ip", ip)
 			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
 			return
 		}
@@ -109,105 +122,337 @@ func LoginHandler(sessionStore *session.Store, rateLimiter *ratelimit.Limiter, h
 		}
 
 		// Validate credentials
-		if username != adminUsername {
+		user, err := database.GetUserByUsername(db, username)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to load user", "err", err)
+			return
+		}
+
+		if user == nil {
+			bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
 			rateLimiter.Record(ip)
-			log.Printf("Failed login attempt from IP: %s (invalid username)", ip)
+			slog.WarnContext(r.Context(), "Failed login attempt: invalid username", "ip", ip)
+			recordAudit(db, r, username, models.AuditLoginFailed, models.AuditTargetUser, username, nil, map[string]string{"reason": "unknown username"})
 			component := templates.Login(formCSRF, "Invalid username or password", redirectTo)
 			component.Render(r.Context(), w)
 			return
 		}
 
-		if err := bcrypt.CompareHashAndPassword(hashedPassword, []byte(password)); err != nil {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
 			rateLimiter.Record(ip)
-			log.Printf("Failed login attempt from IP: %s (invalid password)", ip)
+			slog.WarnContext(r.Context(), "Failed login attempt: invalid password", "ip", ip)
+			recordAudit(db, r, username, models.AuditLoginFailed, models.AuditTargetUser, username, nil, map[string]string{"reason": "invalid password"})
 			component := templates.Login(formCSRF, "Invalid username or password", redirectTo)
 			component.Render(r.Context(), w)
 			return
 		}
 
+		// Users with two-factor authentication must pass a second step first
+		if user.TOTPEnabled {
+			token, err := challenges.Create(user.Username, redirectTo)
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Failed to create login challenge", "err", err)
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     "login_challenge",
+				Value:    token,
+				Path:     "/admin/login",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+				MaxAge:   int(loginChallengeTTL.Seconds()),
+			})
+
+			slog.InfoContext(r.Context(), "Password accepted, awaiting second factor", "user", username, "ip", ip)
+			http.Redirect(w, r, "/admin/login/verify", http.StatusSeeOther)
+			return
+		}
+
 		// Successful login
-		sess, err := sessionStore.Create(username)
-		if err != nil {
+		if err := startSession(w, r, sessionStore, user.Username); err != nil {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			log.Printf("Failed to create session: %v", err)
+			slog.ErrorContext(r.Context(), "Failed to create session", "err", err)
 			return
 		}
 
 		// Reset rate limiter for this IP
 		rateLimiter.Reset(ip)
 
-		// Set session cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_id",
-			Value:    sess.ID,
-			Path:     "/",
-			HttpOnly: true,
-			SameSite: http.SameSiteLaxMode,
-			// No MaxAge set - session cookie (persists until browser close or logout)
-		})
+		slog.InfoContext(r.Context(), "Successful login", "user", username, "ip", ip)
+		recordAudit(db, r, user.Username, models.AuditLogin, models.AuditTargetUser, user.Username, nil, map[string]string{"method": "password"})
+
+		// Redirect to intended page
+		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+	}
+}
+
+// LoginVerifyPageHandler displays the second-factor form for a pending login
+func LoginVerifyPageHandler(challenges *session.ChallengeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		cookie, err := r.Cookie("login_challenge")
+		if err != nil {
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+		if _, exists := challenges.Get(cookie.Value); !exists {
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+
+		// Generate CSRF token for the form
+		csrfToken, err := session.GenerateCSRFToken()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to generate CSRF token", "err", err)
+			return
+		}
 
-		// Clear CSRF cookie
 		http.SetCookie(w, &http.Cookie{
 			Name:     "csrf_token",
-			Value:    "",
+			Value:    csrfToken,
 			Path:     "/",
 			HttpOnly: true,
-			MaxAge:   -1,
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   600, // 10 minutes
 		})
 
-		log.Printf("Successful login for user: %s from IP: %s", username, ip)
+		component := templates.LoginVerify(csrfToken, "")
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
 
-		// Redirect to intended page
-		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+// LoginVerifyHandler checks the second factor and issues the session
+func LoginVerifyHandler(sessionStore session.Store, mfaLimiter *ratelimit.Limiter, db *sql.DB, challenges *session.ChallengeStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip := getClientIP(r)
+
+		cookie, err := r.Cookie("login_challenge")
+		if err != nil {
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+
+		challenge, exists := challenges.Get(cookie.Value)
+		if !exists {
+			clearChallengeCookie(w)
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		// Validate CSRF token
+		formCSRF := r.FormValue("csrf_token")
+		cookieCSRF, err := r.Cookie("csrf_token")
+		if err != nil || formCSRF != cookieCSRF.Value {
+			slog.WarnContext(r.Context(), "CSRF token validation failed", "ip", ip)
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		// Limit attempts per account so codes cannot be guessed from many IPs
+		if !mfaLimiter.Allow(challenge.Username) {
+			slog.WarnContext(r.Context(), "Second factor rate limit exceeded", "user", challenge.Username, "ip", ip)
+			w.WriteHeader(http.StatusTooManyRequests)
+			component := templates.LoginVerify(formCSRF, "Too many failed attempts. Please try again later.")
+			component.Render(r.Context(), w)
+			return
+		}
+
+		user, err := database.GetUserByUsername(db, challenge.Username)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to load user", "err", err)
+			return
+		}
+
+		if user == nil || !user.TOTPEnabled {
+			challenges.Delete(cookie.Value)
+			clearChallengeCookie(w)
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+
+		ok, err := verifySecondFactor(db, user, r.FormValue("code"))
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to verify second factor", "err", err)
+			return
+		}
+
+		if !ok {
+			mfaLimiter.Record(user.Username)
+			slog.WarnContext(r.Context(), "Failed second factor", "user", user.Username, "ip", ip)
+			recordAudit(db, r, user.Username, models.AuditLoginFailed, models.AuditTargetUser, user.Username, nil, map[string]string{"reason": "invalid second factor"})
+
+			if !challenges.Fail(cookie.Value) {
+				clearChallengeCookie(w)
+				component := templates.Login(formCSRF, "Too many invalid codes. Please log in again.", challenge.RedirectTo)
+				component.Render(r.Context(), w)
+				return
+			}
+
+			component := templates.LoginVerify(formCSRF, "Invalid code")
+			component.Render(r.Context(), w)
+			return
+		}
+
+		challenges.Delete(cookie.Value)
+		clearChallengeCookie(w)
+
+		if err := startSession(w, r, sessionStore, user.Username); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to create session", "err", err)
+			return
+		}
+
+		mfaLimiter.Reset(user.Username)
+
+		slog.InfoContext(r.Context(), "Successful login", "user", user.Username, "ip", ip)
+		recordAudit(db, r, user.Username, models.AuditLogin, models.AuditTargetUser, user.Username, nil, map[string]string{"method": "password+totp"})
+		http.Redirect(w, r, challenge.RedirectTo, http.StatusSeeOther)
 	}
 }
 
 // LogoutHandler handles logout requests
-func LogoutHandler(sessionStore *session.Store) http.HandlerFunc {
+func LogoutHandler(sessionStore session.Store, db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
 		// Get session cookie
 		cookie, err := r.Cookie("session_id")
 		if err == nil {
 			// Delete session from store
 			sessionStore.Delete(cookie.Value)
-			log.Printf("User logged out, session: %s", cookie.Value)
+			slog.InfoContext(r.Context(), "User logged out")
+			recordAudit(db, r, "", models.AuditLogout, models.AuditTargetSession, "", nil, nil)
 		}
 
 		// Clear session cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_id",
-			Value:    "",
-			Path:     "/",
-			HttpOnly: true,
-			MaxAge:   -1,
-		})
+		clearSessionCookie(w)
 
 		// Redirect to home page
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
 
-// getClientIP extracts the client IP address from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxies/load balancers)
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		// Take the first IP if multiple are present
-		ips := strings.Split(forwarded, ",")
-		return strings.TrimSpace(ips[0])
+// startSession issues a session for username and sets the session cookie
+func startSession(w http.ResponseWriter, r *http.Request, sessionStore session.Store, username string) error {
+	sess, err := sessionStore.Create(username, getClientIP(r), r.UserAgent())
+	if err != nil {
+		return err
+	}
+
+	setSessionCookie(w, sess)
+
+	// Clear CSRF cookie
+	http.SetCookie(w, &http.Cookie{
+		Name:     "csrf_token",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+
+	return nil
+}
+
+// rotateSession gives the current session a new ID after a privilege change,
+// so an ID captured before the change stops working. It returns the request
+// with the rotated session in its context.
+func rotateSession(w http.ResponseWriter, r *http.Request, sessionStore session.Store) *http.Request {
+	sess, ok := session.FromContext(r.Context())
+	if !ok {
+		return r
+	}
+
+	rotated, err := sessionStore.Rotate(sess.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to rotate session", "err", err)
+		return r
+	}
+
+	setSessionCookie(w, rotated)
+	return r.WithContext(session.NewContext(r.Context(), rotated))
+}
+
+// setSessionCookie sets the session cookie for sess
+func setSessionCookie(w http.ResponseWriter, sess *session.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    sess.ID,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  sess.ExpiresAt,
+	})
+}
+
+// clearSessionCookie removes the session cookie from the browser
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code. Accepted codes are consumed so they cannot be replayed.
+func verifySecondFactor(db *sql.DB, user *models.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false, nil
 	}
 
-	// Check X-Real-IP header
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
+	// Recovery codes are longer than TOTP codes and usually contain a dash
+	if len(code) > totp.Digits {
+		return database.UseRecoveryCode(db, user.ID, totp.HashRecoveryCode(code))
 	}
 
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	// Remove port if present
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return false, nil
 	}
-	return ip
+	return database.RecordTOTPStep(db, user.ID, step)
+}
+
+// clearChallengeCookie removes the pending second-factor cookie
+func clearChallengeCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "login_challenge",
+		Value:    "",
+		Path:     "/admin/login",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+}
+
+// getClientIP extracts the client IP address from the request
+func getClientIP(r *http.Request) string {
+	return visitor.ClientIP(r)
 }
@@ -2,16 +2,22 @@ package handlers
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
+	"portfolio-v2/comments"
 	"portfolio-v2/database"
+	"portfolio-v2/spam"
 	"portfolio-v2/templates"
+	"portfolio-v2/visitor"
 )
 
-// BlogPostViewHandler displays a single blog post by slug
-func BlogPostViewHandler(db *sql.DB) http.HandlerFunc {
+// BlogPostViewHandler displays a single blog post by slug, with its
+// reactions, approved comments and those the visitor wrote that are
+// waiting for review
+func BlogPostViewHandler(db *sql.DB, forms *spam.Checker, tokens *comments.Tokens, visitors *visitor.Hasher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -29,7 +35,7 @@ func BlogPostViewHandler(db *sql.DB) http.HandlerFunc {
 
 		post, err := database.GetBlogPostBySlug(db, slug)
 		if err != nil {
-			log.Printf("Error fetching blog post by slug %s: %v", slug, err)
+			slog.ErrorContext(r.Context(), "Error fetching blog post", "slug", slug, "err", err)
 			http.Error(w, "Error loading post", http.StatusInternalServerError)
 			return
 		}
@@ -38,15 +44,48 @@ func BlogPostViewHandler(db *sql.DB) http.HandlerFunc {
 			component := templates.BlogPostNotFound()
 			if err := component.Render(r.Context(), w); err != nil {
 				http.Error(w, "Error rendering template", http.StatusInternalServerError)
-				log.Printf("Template rendering error: %v", err)
+				slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
 			}
 			return
 		}
 
-		component := templates.BlogPostView(*post)
+		// Mentions are extras; the post is still shown if they fail to load
+		mentions, err := database.GetPostWebmentions(db, post.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching webmentions", "post_id", post.ID, "err", err)
+		}
+
+		now := time.Now()
+
+		// So are reactions
+		reactions, err := loadReactions(db, visitors, r, post, now)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching reactions", "post_id", post.ID, "err", err)
+		}
+
+		own := tokens.Owned(r, now)
+
+		// And comments
+		threads, err := database.GetPostComments(db, post.ID, own)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching comments", "post_id", post.ID, "err", err)
+		}
+
+		commentProps := templates.CommentsProps{
+			PostID:  post.ID,
+			PostURL: "/blog/" + post.Slug,
+			Threads: threads,
+			Own:     make(map[int64]bool, len(own)),
+			Stamp:   forms.Stamp(now),
+		}
+		for _, id := range own {
+			commentProps.Own[id] = true
+		}
+
+		component := templates.BlogPostView(*post, reactions, mentions, commentProps)
 		if err := component.Render(r.Context(), w); err != nil {
 			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-			log.Printf("Template rendering error: %v", err)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
 			return
 		}
 	}
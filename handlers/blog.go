@@ -1,80 +1,69 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
-	"strconv"
 
 	"portfolio-v2/database"
 	"portfolio-v2/models"
 	"portfolio-v2/templates"
 )
 
-const postsPerPage = 3
-
-// BlogPostsAPIHandler handles paginated blog post requests for HTMX
-func BlogPostsAPIHandler(db *sql.DB) http.HandlerFunc {
+// BlogPostsAPIHandler handles paginated blog post requests for HTMX, perPage
+// posts at a time
+func BlogPostsAPIHandler(db *sql.DB, perPage int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		page, err := strconv.Atoi(r.URL.Query().Get("page"))
-		if err != nil || page < 1 {
-			page = 1
+		after, err := database.ParseCursor(r.URL.Query().Get("cursor"))
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
 		}
 
 		tagFilter := r.URL.Query().Get("tag")
 
-		posts, err := database.GetBlogPosts(db, page, postsPerPage, tagFilter)
-		if err != nil {
-			log.Printf("Error fetching blog posts: %v", err)
-			http.Error(w, "Error loading posts", http.StatusInternalServerError)
+		posts, next, err := database.GetBlogPosts(db, perPage, tagFilter, after)
+		if errors.Is(err, database.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
 			return
 		}
-
-		totalPosts, err := database.CountBlogPosts(db, tagFilter)
 		if err != nil {
-			log.Printf("Error counting blog posts: %v", err)
-			totalPosts = 0
+			slog.ErrorContext(r.Context(), "Error fetching blog posts", "err", err)
+			http.Error(w, "Error loading posts", http.StatusInternalServerError)
+			return
 		}
 
-		hasMore := (page * postsPerPage) < totalPosts
-		nextPage := page + 1
-
-		component := templates.BlogPostList(posts, hasMore, nextPage, tagFilter)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		component := templates.BlogPostList(posts, next.String(), tagFilter)
 		if err := component.Render(r.Context(), w); err != nil {
 			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-			log.Printf("Template rendering error: %v", err)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
 			return
 		}
 	}
 }
 
-// GetInitialBlogPosts fetches the first page of blog posts for the home page
-func GetInitialBlogPosts(db *sql.DB) (posts []models.BlogPostPreview, hasMore bool, nextPage int, tags []string) {
-	blogPosts, err := database.GetBlogPosts(db, 1, postsPerPage, "")
-	if err != nil {
-		log.Printf("Error fetching initial blog posts: %v", err)
-		return []models.BlogPostPreview{}, false, 1, []string{}
-	}
-
-	totalPosts, err := database.CountBlogPosts(db, "")
+// GetInitialBlogPosts fetches the first perPage blog posts for the home page,
+// with the cursor for the next page or "" if there are no more
+func GetInitialBlogPosts(ctx context.Context, db *sql.DB, perPage int) (posts []models.BlogPostPreview, nextCursor string, tags []string) {
+	blogPosts, next, err := database.GetBlogPosts(db, perPage, "", nil)
 	if err != nil {
-		log.Printf("Error counting blog posts: %v", err)
-		totalPosts = 0
+		slog.ErrorContext(ctx, "Error fetching initial blog posts", "err", err)
+		return []models.BlogPostPreview{}, "", []string{}
 	}
 
 	allTags, err := database.GetAllTags(db)
 	if err != nil {
-		log.Printf("Error fetching tags: %v", err)
+		slog.ErrorContext(ctx, "Error fetching tags", "err", err)
 		allTags = []string{}
 	}
 
-	hasMore = postsPerPage < totalPosts
-	nextPage = 2
-
-	return blogPosts, hasMore, nextPage, allTags
+	return blogPosts, next.String(), allTags
 }
@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"portfolio-v2/comments"
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/ratelimit"
+	"portfolio-v2/spam"
+	"portfolio-v2/templates"
+)
+
+// commentsShown is the number of comments listed per moderation queue
+const commentsShown = 100
+
+// Limits on what a comment can hold
+const (
+	maxCommentName = 80
+	maxCommentURL  = 200
+	maxCommentBody = 5000
+)
+
+// isHTMX reports whether r was sent by HTMX, which swaps the response into
+// the page instead of navigating to it
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// commentStatus returns the state a comment scored as result starts in,
+// and the reasons to keep for moderators
+func commentStatus(result spam.Result) (string, string) {
+	reasons := strings.Join(result.Reasons, "; ")
+	if result.Spam() {
+		return models.CommentSpam, reasons
+	}
+	return models.CommentPending, reasons
+}
+
+// validateComment checks the fields of a submitted comment and returns
+// the first problem, or "" if there is none
+func validateComment(name, website, body string) string {
+	switch {
+	case name == "":
+		return "Please enter your name."
+	case utf8.RuneCountInString(name) > maxCommentName:
+		return "Your name can be at most " + strconv.Itoa(maxCommentName) + " characters."
+	case website != "" && !isHTTPURL(website):
+		return "Your website must be an http:// or https:// URL."
+	case len(website) > maxCommentURL:
+		return "Your website URL can be at most " + strconv.Itoa(maxCommentURL) + " characters."
+	}
+	return validateCommentBody(body)
+}
+
+// validateCommentBody checks the text of a comment
+func validateCommentBody(body string) string {
+	switch {
+	case body == "":
+		return "Please write a comment."
+	case utf8.RuneCountInString(body) > maxCommentBody:
+		return "Comments can be at most " + strconv.Itoa(maxCommentBody) + " characters."
+	}
+	return ""
+}
+
+// CreateCommentHandler saves a comment or a reply, to be shown once a
+// moderator approves it, and grants the browser a token to edit or delete
+// it. HTMX requests get the form back, fresh or with the problem, and the
+// new comment is appended to the page. Each saved comment counts against
+// the sender's IP in limiter.
+func CreateCommentHandler(db *sql.DB, forms *spam.Checker, tokens *comments.Tokens, limiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+
+		postID, err := strconv.ParseInt(r.PostFormValue("post_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid post ID", http.StatusBadRequest)
+			return
+		}
+
+		post, err := database.GetBlogPostByID(db, int(postID))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching blog post", "err", err)
+			http.Error(w, "Error loading post", http.StatusInternalServerError)
+			return
+		}
+
+		if post == nil || post.PublishedAt.After(now) {
+			http.Error(w, "Blog post not found", http.StatusNotFound)
+			return
+		}
+
+		form := templates.CommentFormProps{
+			PostID: post.ID,
+			Stamp:  forms.Stamp(now),
+			Name:   strings.TrimSpace(r.PostFormValue("name")),
+			URL:    strings.TrimSpace(r.PostFormValue("url")),
+			Body:   strings.TrimSpace(r.PostFormValue("body")),
+		}
+
+		// A reply to a reply joins the thread of the comment it answers,
+		// since threads are one level deep
+		if parentText := r.PostFormValue("parent_id"); parentText != "" {
+			parentID, err := strconv.ParseInt(parentText, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid parent ID", http.StatusBadRequest)
+				return
+			}
+
+			parent, err := database.GetCommentByID(db, parentID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error fetching comment", "err", err)
+				http.Error(w, "Error loading comment", http.StatusInternalServerError)
+				return
+			}
+
+			if parent == nil || parent.PostID != post.ID || !parent.Visible() {
+				http.Error(w, "Comment not found", http.StatusNotFound)
+				return
+			}
+
+			form.ParentID = parent.ID
+			if parent.ParentID != 0 {
+				form.ParentID = parent.ParentID
+			}
+		}
+
+		ip := getClientIP(r)
+		if !limiter.Allow(ip) {
+			form.Error = "You have posted a lot of comments lately. Please try again later."
+			renderCommentForm(w, r, form, http.StatusTooManyRequests)
+			return
+		}
+
+		if form.Error = validateComment(form.Name, form.URL, form.Body); form.Error != "" {
+			renderCommentForm(w, r, form, http.StatusBadRequest)
+			return
+		}
+
+		result := forms.Score(spam.Submission{
+			Name:     form.Name,
+			URL:      form.URL,
+			Body:     form.Body,
+			Honeypot: r.PostFormValue(spam.HoneypotField),
+			Stamp:    r.PostFormValue(spam.StampField),
+		}, now)
+
+		c := &models.Comment{
+			PostID:     post.ID,
+			PostSlug:   post.Slug,
+			ParentID:   form.ParentID,
+			AuthorName: form.Name,
+			AuthorURL:  form.URL,
+			Body:       form.Body,
+			SpamScore:  result.Score,
+			IPAddress:  ip,
+			UserAgent:  r.UserAgent(),
+		}
+		c.Status, c.SpamReasons = commentStatus(result)
+
+		if err := database.CreateComment(db, c); err != nil {
+			slog.ErrorContext(r.Context(), "Error saving comment", "err", err)
+			http.Error(w, "Error saving comment", http.StatusInternalServerError)
+			return
+		}
+
+		limiter.Record(ip)
+		tokens.Grant(w, r, c.ID, now)
+		slog.InfoContext(r.Context(), "Comment saved", "id", c.ID, "slug", post.Slug, "status", c.Status, "spam_score", c.SpamScore)
+
+		if !isHTMX(r) {
+			http.Redirect(w, r, "/blog/"+post.Slug+"#comment-"+strconv.FormatInt(c.ID, 10), http.StatusSeeOther)
+			return
+		}
+
+		// Spam is answered like any other comment, so its sender learns
+		// nothing from the response
+		fresh := templates.CommentFormProps{
+			PostID:   post.ID,
+			ParentID: form.ParentID,
+			Stamp:    form.Stamp,
+			Notice:   "Thanks! Your comment will appear once it is approved.",
+		}
+		thread := templates.CommentsProps{
+			PostID:  post.ID,
+			PostURL: "/blog/" + post.Slug,
+			Own:     map[int64]bool{c.ID: true},
+			Stamp:   form.Stamp,
+		}
+
+		component := templates.CommentPosted(fresh, *c, thread)
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
+
+// renderCommentForm answers a comment that was not saved. HTMX only swaps
+// successful responses, so it gets the form with the problem and a 200;
+// a plain form post gets the problem as an error page.
+func renderCommentForm(w http.ResponseWriter, r *http.Request, form templates.CommentFormProps, status int) {
+	if !isHTMX(r) {
+		http.Error(w, form.Error, status)
+		return
+	}
+
+	component := templates.CommentForm(form)
+	if err := component.Render(r.Context(), w); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+	}
+}
+
+// ownComment loads the comment with the ID at index in the path and checks
+// that r's browser holds its token. If not, it writes the error and
+// returns nil.
+func ownComment(w http.ResponseWriter, r *http.Request, db *sql.DB, tokens *comments.Tokens, index int) *models.Comment {
+	id, ok := idFromPath(w, r, index)
+	if !ok {
+		return nil
+	}
+
+	c, err := database.GetCommentByID(db, id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching comment", "err", err)
+		http.Error(w, "Error loading comment", http.StatusInternalServerError)
+		return nil
+	}
+
+	if c == nil || c.Status == models.CommentRejected {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return nil
+	}
+
+	if !tokens.Owns(r, c.ID, time.Now()) {
+		http.Error(w, "Comments can only be changed from the browser that posted them, for a week", http.StatusForbidden)
+		return nil
+	}
+
+	return c
+}
+
+// EditCommentPageHandler returns the form editing a comment, for its author
+func EditCommentPageHandler(db *sql.DB, forms *spam.Checker, tokens *comments.Tokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /comments/edit/{id}
+		c := ownComment(w, r, db, tokens, 2)
+		if c == nil {
+			return
+		}
+
+		component := templates.CommentEditForm(*c, forms.Stamp(time.Now()), "")
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
+
+// UpdateCommentHandler saves an author's edit of their comment. The edit
+// is scored again and waits for review like a new comment, so an approved
+// comment cannot be changed into something else.
+func UpdateCommentHandler(db *sql.DB, forms *spam.Checker, tokens *comments.Tokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /comments/edit/{id}
+		c := ownComment(w, r, db, tokens, 2)
+		if c == nil {
+			return
+		}
+
+		now := time.Now()
+		body := strings.TrimSpace(r.FormValue("body"))
+
+		if msg := validateCommentBody(body); msg != "" {
+			if !isHTMX(r) {
+				http.Error(w, msg, http.StatusBadRequest)
+				return
+			}
+			edited := *c
+			edited.Body = body
+			component := templates.CommentEditForm(edited, forms.Stamp(now), msg)
+			if err := component.Render(r.Context(), w); err != nil {
+				http.Error(w, "Error rendering template", http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+			}
+			return
+		}
+
+		result := forms.Score(spam.Submission{
+			Name:     c.AuthorName,
+			URL:      c.AuthorURL,
+			Body:     body,
+			Honeypot: r.FormValue(spam.HoneypotField),
+			Stamp:    r.FormValue(spam.StampField),
+		}, now)
+
+		c.Body = body
+		c.SpamScore = result.Score
+		c.Status, c.SpamReasons = commentStatus(result)
+
+		if err := database.UpdateCommentBody(db, c); err != nil {
+			slog.ErrorContext(r.Context(), "Error updating comment", "err", err)
+			http.Error(w, "Error saving comment", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Comment edited by its author", "id", c.ID, "status", c.Status, "spam_score", c.SpamScore)
+
+		if !isHTMX(r) {
+			http.Redirect(w, r, "/blog/"+c.PostSlug+"#comment-"+strconv.FormatInt(c.ID, 10), http.StatusSeeOther)
+			return
+		}
+
+		component := templates.CommentBody(*c, true)
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
+
+// DeleteOwnCommentHandler deletes a comment, and its replies, for its
+// author. HTMX requests get an empty response that removes it from the
+// page.
+func DeleteOwnCommentHandler(db *sql.DB, tokens *comments.Tokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /comments/delete/{id}
+		c := ownComment(w, r, db, tokens, 2)
+		if c == nil {
+			return
+		}
+
+		if err := database.DeleteComment(db, c.ID); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting comment", "err", err)
+			http.Error(w, "Error deleting comment", http.StatusInternalServerError)
+			return
+		}
+
+		tokens.Revoke(w, r, c.ID, time.Now())
+		slog.InfoContext(r.Context(), "Comment deleted by its author", "id", c.ID)
+
+		if !isHTMX(r) {
+			http.Redirect(w, r, "/blog/"+c.PostSlug+"#comments", http.StatusSeeOther)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// CommentsPageHandler lists the comments in a moderation queue, those
+// waiting for review by default
+func CommentsPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		queue := r.URL.Query().Get("queue")
+		if !models.ValidCommentStatus(queue) {
+			queue = models.CommentPending
+		}
+
+		list, err := database.GetComments(db, queue, commentsShown)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching comments", "err", err)
+			http.Error(w, "Error loading comments", http.StatusInternalServerError)
+			return
+		}
+
+		counts := make(map[string]int, len(models.CommentStatuses))
+		for _, status := range models.CommentStatuses {
+			counts[status], err = database.CountComments(db, status)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error counting comments", "err", err)
+				http.Error(w, "Error loading comments", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		props := templates.AdminCommentsProps{
+			Queue:    queue,
+			Queues:   models.CommentStatuses,
+			Counts:   counts,
+			Comments: list,
+		}
+
+		component := templates.AdminComments(props)
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
+
+// ModerateCommentHandler approves or rejects a comment, or marks it as
+// spam, then returns to the queue it was listed in
+func ModerateCommentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/comments/{id}
+		id, ok := idFromPath(w, r, 2)
+		if !ok {
+			return
+		}
+
+		before, err := database.GetCommentByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching comment", "err", err)
+			http.Error(w, "Error loading comment", http.StatusInternalServerError)
+			return
+		}
+
+		if before == nil {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+
+		after := *before
+		switch r.FormValue("action") {
+		case "approve":
+			after.Status = models.CommentApproved
+		case "reject":
+			after.Status = models.CommentRejected
+		case "spam":
+			after.Status = models.CommentSpam
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.SetCommentStatus(db, id, after.Status); err != nil {
+			slog.ErrorContext(r.Context(), "Error moderating comment", "err", err)
+			http.Error(w, "Error saving comment", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Comment moderated", "id", id, "action", r.FormValue("action"))
+		recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetComment, strconv.FormatInt(id, 10), auditComment(before), auditComment(&after))
+
+		http.Redirect(w, r, commentsPath(r.FormValue("queue")), http.StatusSeeOther)
+	}
+}
+
+// DeleteCommentHandler removes a comment and its replies
+func DeleteCommentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/comments/delete/{id}
+		id, ok := idFromPath(w, r, 3)
+		if !ok {
+			return
+		}
+
+		before, err := database.GetCommentByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching comment", "err", err)
+			http.Error(w, "Error deleting comment", http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.DeleteComment(db, id); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting comment", "err", err)
+			http.Error(w, "Error deleting comment", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Comment deleted", "id", id)
+		recordAudit(db, r, "", models.AuditDelete, models.AuditTargetComment, strconv.FormatInt(id, 10), auditComment(before), nil)
+
+		http.Redirect(w, r, commentsPath(r.FormValue("queue")), http.StatusSeeOther)
+	}
+}
+
+// commentsPath returns the moderation page for queue, or the review queue
+// if it is not a known one
+func commentsPath(queue string) string {
+	if !models.ValidCommentStatus(queue) {
+		return "/admin/comments"
+	}
+	return "/admin/comments?queue=" + queue
+}
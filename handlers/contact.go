@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/ratelimit"
+	"portfolio-v2/spam"
+	"portfolio-v2/templates"
+)
+
+// Limits on what a contact message can hold
+const (
+	maxContactName    = 100
+	maxContactEmail   = 254
+	maxContactMessage = 5000
+)
+
+// ContactHandler saves a message sent through the contact form and tells
+// webhooks about it. Messages the spam check flags are dropped but
+// answered like any other, so their sender learns nothing. Each message
+// counts against the sender's IP in limiter.
+func ContactHandler(db *sql.DB, forms *spam.Checker, limiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		form := templates.ContactFormProps{
+			Stamp:   forms.Stamp(now),
+			Name:    strings.TrimSpace(r.PostFormValue("name")),
+			Email:   strings.TrimSpace(r.PostFormValue("email")),
+			Message: strings.TrimSpace(r.PostFormValue("message")),
+		}
+
+		ip := getClientIP(r)
+		if !limiter.Allow(ip) {
+			form.Error = "You have sent several messages lately. Please try again later."
+			renderContactForm(w, r, form, http.StatusTooManyRequests)
+			return
+		}
+
+		if form.Error = validateContact(form.Name, form.Email, form.Message); form.Error != "" {
+			renderContactForm(w, r, form, http.StatusBadRequest)
+			return
+		}
+
+		limiter.Record(ip)
+
+		result := forms.Score(spam.Submission{
+			Name:     form.Name,
+			Body:     form.Message,
+			Honeypot: r.PostFormValue(spam.HoneypotField),
+			Stamp:    r.PostFormValue(spam.StampField),
+		}, now)
+
+		if result.Spam() {
+			slog.InfoContext(r.Context(), "Contact message dropped as spam", "ip", ip, "score", result.Score, "reasons", strings.Join(result.Reasons, "; "))
+		} else {
+			id, err := database.CreateContactSubmission(db, form.Name, form.Email, form.Message, ip, r.UserAgent())
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error saving contact submission", "err", err)
+				http.Error(w, "Error sending message", http.StatusInternalServerError)
+				return
+			}
+
+			slog.InfoContext(r.Context(), "Contact message received", "id", id)
+			fireWebhook(db, r, models.EventContactReceived, models.ContactSubmission{
+				ID:          id,
+				Name:        form.Name,
+				Email:       form.Email,
+				Message:     form.Message,
+				SubmittedAt: now,
+			})
+		}
+
+		if !isHTMX(r) {
+			http.Redirect(w, r, "/#contact", http.StatusSeeOther)
+			return
+		}
+
+		component := templates.ContactMessageForm(templates.ContactFormProps{Sent: true})
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
+
+// validateContact checks the fields of a contact message and returns the
+// first problem, or "" if there is none
+func validateContact(name, email, message string) string {
+	switch {
+	case name == "":
+		return "Please enter your name."
+	case utf8.RuneCountInString(name) > maxContactName:
+		return "Your name can be at most " + strconv.Itoa(maxContactName) + " characters."
+	case email == "":
+		return "Please enter your email address so I can reply."
+	case len(email) > maxContactEmail:
+		return "Your email address is too long."
+	case message == "":
+		return "Please write a message."
+	case utf8.RuneCountInString(message) > maxContactMessage:
+		return "Messages can be at most " + strconv.Itoa(maxContactMessage) + " characters."
+	}
+
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return "Please enter a valid email address."
+	}
+	return ""
+}
+
+// renderContactForm answers a message that was not sent, like
+// renderCommentForm
+func renderContactForm(w http.ResponseWriter, r *http.Request, form templates.ContactFormProps, status int) {
+	if !isHTMX(r) {
+		http.Error(w, form.Error, status)
+		return
+	}
+
+	component := templates.ContactMessageForm(form)
+	if err := component.Render(r.Context(), w); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+	}
+}
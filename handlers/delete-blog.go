@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"portfolio-v2/database"
+	"portfolio-v2/models"
 )
 
 // DeleteBlogHandler handles deleting a blog post
@@ -33,15 +34,27 @@ func DeleteBlogHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		before, err := database.GetBlogPostByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching blog post", "err", err)
+			http.Error(w, "Error deleting blog post", http.StatusInternalServerError)
+			return
+		}
+
 		// Delete blog post from database
 		err = database.DeleteBlogPost(db, id)
 		if err != nil {
-			log.Printf("Error deleting blog post: %v", err)
+			slog.ErrorContext(r.Context(), "Error deleting blog post", "err", err)
 			http.Error(w, "Error deleting blog post", http.StatusInternalServerError)
 			return
 		}
 
-		log.Printf("Blog post %d deleted successfully", id)
+		slog.InfoContext(r.Context(), "Blog post deleted", "id", id)
+		recordAudit(db, r, "", models.AuditDelete, models.AuditTargetBlogPost, strconv.Itoa(id), before, nil)
+		fireWebhook(db, r, models.EventPostDeleted, before)
+		if before != nil {
+			unfederatePost(db, r, before)
+		}
 
 		// Redirect back to admin dashboard
 		http.Redirect(w, r, "/admin", http.StatusSeeOther)
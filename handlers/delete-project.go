@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"portfolio-v2/database"
+	"portfolio-v2/models"
 )
 
 // DeleteProjectHandler handles deleting a project
@@ -33,15 +34,24 @@ func DeleteProjectHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		before, err := database.GetProjectByID(db, int(id))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching project", "err", err)
+			http.Error(w, "Error deleting project", http.StatusInternalServerError)
+			return
+		}
+
 		// Delete project from database
 		err = database.DeleteProject(db, int(id))
 		if err != nil {
-			log.Printf("Error deleting project: %v", err)
+			slog.ErrorContext(r.Context(), "Error deleting project", "err", err)
 			http.Error(w, "Error deleting project", http.StatusInternalServerError)
 			return
 		}
 
-		log.Printf("Project %d deleted successfully", id)
+		slog.InfoContext(r.Context(), "Project deleted", "id", id)
+		recordAudit(db, r, "", models.AuditDelete, models.AuditTargetProject, strconv.FormatInt(id, 10), before, nil)
+		fireWebhook(db, r, models.EventProjectDeleted, before)
 
 		// Redirect back to admin dashboard
 		http.Redirect(w, r, "/admin", http.StatusSeeOther)
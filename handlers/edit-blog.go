@@ -3,12 +3,13 @@ package handlers
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"portfolio-v2/database"
+	"portfolio-v2/models"
 	"portfolio-v2/templates"
 )
 
@@ -42,7 +43,7 @@ func EditBlogPageHandler(db *sql.DB) http.HandlerFunc {
 		// Get blog post from database
 		post, err := database.GetBlogPostByID(db, id)
 		if err != nil {
-			log.Printf("Error fetching blog post: %v", err)
+			slog.ErrorContext(r.Context(), "Error fetching blog post", "err", err)
 			http.Error(w, "Error fetching blog post", http.StatusInternalServerError)
 			return
 		}
@@ -58,8 +59,9 @@ func EditBlogPageHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// UpdateBlogHandler handles updating a blog post
-func UpdateBlogHandler(db *sql.DB) http.HandlerFunc {
+// UpdateBlogHandler handles updating a blog post. siteURL is the site's
+// public origin.
+func UpdateBlogHandler(db *sql.DB, siteURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -120,14 +122,33 @@ func UpdateBlogHandler(db *sql.DB) http.HandlerFunc {
 			}
 		}
 
+		before, err := database.GetBlogPostByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching blog post", "err", err)
+			http.Error(w, "Error fetching blog post", http.StatusInternalServerError)
+			return
+		}
+
+		if before == nil {
+			http.Error(w, "Blog post not found", http.StatusNotFound)
+			return
+		}
+
 		// Update blog post in database
 		err = database.UpdateBlogPost(db, id, title, excerpt, content, tags)
 		if err != nil {
-			log.Printf("Error updating blog post: %v", err)
+			slog.ErrorContext(r.Context(), "Error updating blog post", "err", err)
 			http.Error(w, fmt.Sprintf("Error updating blog post: %v", err), http.StatusInternalServerError)
 			return
 		}
 
+		after := *before
+		after.Title, after.Excerpt, after.Content, after.Tags = title, excerpt, content, tags
+		recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetBlogPost, strconv.Itoa(id), before, after)
+		fireWebhook(db, r, models.EventPostUpdated, after)
+		sendWebmentions(db, r, siteURL, &after)
+		federatePost(db, r, &after)
+
 		http.Redirect(w, r, "/admin", http.StatusSeeOther)
 	}
 }
@@ -3,7 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
@@ -43,7 +43,7 @@ func EditProjectPageHandler(db *sql.DB) http.HandlerFunc {
 		// Get project from database
 		project, err := database.GetProjectByID(db, int(id))
 		if err != nil {
-			log.Printf("Error fetching project: %v", err)
+			slog.ErrorContext(r.Context(), "Error fetching project", "err", err)
 			http.Error(w, "Error fetching project", http.StatusInternalServerError)
 			return
 		}
@@ -124,7 +124,7 @@ func UpdateProjectHandler(db *sql.DB) http.HandlerFunc {
 		// Get existing project to preserve slug
 		existingProject, err := database.GetProjectByID(db, int(id))
 		if err != nil {
-			log.Printf("Error fetching existing project: %v", err)
+			slog.ErrorContext(r.Context(), "Error fetching existing project", "err", err)
 			http.Error(w, "Error fetching project", http.StatusInternalServerError)
 			return
 		}
@@ -149,11 +149,15 @@ func UpdateProjectHandler(db *sql.DB) http.HandlerFunc {
 		// Update project in database
 		err = database.UpdateProject(db, project)
 		if err != nil {
-			log.Printf("Error updating project: %v", err)
+			slog.ErrorContext(r.Context(), "Error updating project", "err", err)
 			http.Error(w, fmt.Sprintf("Error updating project: %v", err), http.StatusInternalServerError)
 			return
 		}
 
+		project.CreatedAt = existingProject.CreatedAt
+		recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetProject, strconv.FormatInt(id, 10), existingProject, project)
+		fireWebhook(db, r, models.EventProjectUpdated, project)
+
 		http.Redirect(w, r, "/admin", http.StatusSeeOther)
 	}
 }
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/scheduler"
+	"portfolio-v2/templates"
+)
+
+// jobFailuresShown is how many recent failed runs the jobs page lists
+const jobFailuresShown = 50
+
+// JobsPageHandler shows the scheduled jobs with their last and next runs,
+// and the runs that failed recently
+func JobsPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		renderJobsPage(w, r, db, "")
+	}
+}
+
+// RunJobHandler runs a job now, out of its schedule
+func RunJobHandler(db *sql.DB, jobs *scheduler.Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract the name from URL path /admin/jobs/run/{name}
+		name := strings.TrimPrefix(r.URL.Path, "/admin/jobs/run/")
+
+		err := jobs.Trigger(name)
+		if errors.Is(err, scheduler.ErrUnknownJob) {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, scheduler.ErrRunning) {
+			renderJobsPage(w, r, db, "The "+name+" job is still running")
+			return
+		}
+
+		recordAudit(db, r, "", models.AuditRun, models.AuditTargetJob, name, nil, nil)
+
+		http.Redirect(w, r, "/admin/jobs", http.StatusSeeOther)
+	}
+}
+
+// renderJobsPage renders the jobs page with an optional error message
+func renderJobsPage(w http.ResponseWriter, r *http.Request, db *sql.DB, errorMsg string) {
+	jobs, err := database.GetJobs(db)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching jobs", "err", err)
+		http.Error(w, "Error loading jobs", http.StatusInternalServerError)
+		return
+	}
+
+	failures, err := database.GetJobFailures(db, jobFailuresShown)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching job failures", "err", err)
+		http.Error(w, "Error loading jobs", http.StatusInternalServerError)
+		return
+	}
+
+	component := templates.AdminJobs(jobs, failures, errorMsg)
+	if err := component.Render(r.Context(), w); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+	}
+}
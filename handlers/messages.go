@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+)
+
+// MessagesAPIHandler returns contact form submissions, newest first, in the
+// /api/v1 list envelope. It is meant for API tokens with the messages:read
+// scope.
+func MessagesAPIHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			APIMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		fields := map[string]string{}
+		after, perPage := parseAPIPagination(r, fields)
+		if len(fields) > 0 {
+			writeValidationError(w, fields)
+			return
+		}
+
+		submissions, next, err := database.GetContactSubmissions(db, perPage, after)
+		if errors.Is(err, database.ErrInvalidCursor) {
+			writeValidationError(w, map[string]string{"cursor": "is not a cursor returned by this listing"})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching contact submissions", "err", err)
+			writeAPIError(w, http.StatusInternalServerError, apiCodeInternal, "Error loading messages")
+			return
+		}
+
+		if submissions == nil {
+			submissions = []models.ContactSubmission{}
+		}
+		writeAPIList(w, submissions, perPage, next)
+	}
+}
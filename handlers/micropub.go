@@ -0,0 +1,599 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"portfolio-v2/database"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+)
+
+// Micropub (https://www.w3.org/TR/micropub/) lets IndieWeb clients publish
+// blog posts. h-entry properties map onto posts as follows:
+//
+//	name     -> title (derived from content for untitled notes)
+//	summary  -> excerpt (derived from content when missing)
+//	content  -> content, as markdown
+//	category -> tags
+//
+// Other properties are ignored. Requests are authenticated with API tokens
+// holding the posts:write scope.
+
+const micropubMaxBodyBytes = 1 << 20
+
+// Error codes defined by the Micropub specification
+const (
+	micropubInvalidRequest    = "invalid_request"
+	micropubUnauthorized      = "unauthorized"
+	micropubInsufficientScope = "insufficient_scope"
+	micropubServerError       = "server_error"
+)
+
+// micropubProperties maps property names to their values as in the JSON
+// syntax. Form-encoded requests are converted to the same shape.
+type micropubProperties map[string][]any
+
+// micropubRequest is a Micropub POST in either syntax
+type micropubRequest struct {
+	Action     string             `json:"action"`
+	URL        string             `json:"url"`
+	Type       []string           `json:"type"`
+	Properties micropubProperties `json:"properties"`
+	Replace    micropubProperties `json:"replace"`
+	Add        micropubProperties `json:"add"`
+	Delete     json.RawMessage    `json:"delete"` // Property names, or properties with values to remove
+}
+
+// writeMicropubError writes an error in the format the specification defines
+func writeMicropubError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// micropubErrorMessage returns err as the error description shown to the
+// client, which starts with a capital letter
+func micropubErrorMessage(err error) string {
+	msg := err.Error()
+	first, size := utf8.DecodeRuneInString(msg)
+	return string(unicode.ToUpper(first)) + msg[size:]
+}
+
+// MicropubTokenError reports rejected API tokens as Micropub errors
+func MicropubTokenError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	code := micropubServerError
+	switch status {
+	case http.StatusUnauthorized:
+		code = micropubUnauthorized
+	case http.StatusForbidden:
+		code = micropubInsufficientScope
+	}
+	writeMicropubError(w, status, code, message)
+}
+
+// MicropubTokenFromBody lets clients send their token as an access_token
+// form or query parameter, as Micropub allows, by moving it into the
+// Authorization header before next authenticates the request. Sending it
+// both ways is an error.
+func MicropubTokenFromBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, micropubMaxBodyBytes)
+
+		if !isJSONRequest(r) {
+			if err := parseMicropubForm(r); err != nil {
+				writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, "Could not parse the request body")
+				return
+			}
+
+			if token := r.Form.Get("access_token"); token != "" {
+				if r.Header.Get("Authorization") != "" {
+					writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, "Send the access token in the header or the body, not both")
+					return
+				}
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// MicropubHandler serves the Micropub endpoint: GET answers queries, POST
+// creates, updates and deletes posts. Post URLs are built from siteURL, the
+// site's public origin.
+func MicropubHandler(db *sql.DB, siteURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			micropubQuery(db, siteURL, w, r)
+		case http.MethodPost:
+			micropubPost(db, siteURL, w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeMicropubError(w, http.StatusMethodNotAllowed, micropubInvalidRequest, "Method not allowed")
+		}
+	}
+}
+
+// micropubQuery answers q=config, q=syndicate-to and q=source
+func micropubQuery(db *sql.DB, siteURL string, w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("q") {
+	case "config":
+		writeJSON(w, http.StatusOK, map[string]any{
+			"q":                    []string{"config", "source", "syndicate-to"},
+			"syndicate-to":         []string{},
+			"post-types":           []map[string]string{{"type": "article", "name": "Post"}, {"type": "note", "name": "Note"}},
+			"supported-vocabulary": []string{"name", "summary", "content", "category"},
+		})
+	case "syndicate-to":
+		writeJSON(w, http.StatusOK, map[string]any{"syndicate-to": []string{}})
+	case "source":
+		post, status, message := micropubPostByURL(db, r, r.URL.Query().Get("url"))
+		if post == nil {
+			writeMicropubError(w, status, micropubInvalidRequest, message)
+			return
+		}
+
+		properties := micropubSource(post, siteURL)
+
+		// Only the requested properties, if any were named
+		wanted := append(r.URL.Query()["properties[]"], r.URL.Query()["properties"]...)
+		if len(wanted) == 0 {
+			writeJSON(w, http.StatusOK, map[string]any{"type": []string{"h-entry"}, "properties": properties})
+			return
+		}
+
+		selected := micropubProperties{}
+		for _, name := range wanted {
+			if values, ok := properties[name]; ok {
+				selected[name] = values
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"properties": selected})
+	default:
+		writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, "Unsupported query; use q=config, q=syndicate-to or q=source")
+	}
+}
+
+// micropubPost dispatches a POST to create, update or delete
+func micropubPost(db *sql.DB, siteURL string, w http.ResponseWriter, r *http.Request) {
+	req, err := readMicropubRequest(r)
+	if err != nil {
+		writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, micropubErrorMessage(err))
+		return
+	}
+
+	switch req.Action {
+	case "", "create":
+		micropubCreate(db, siteURL, w, r, req)
+	case "update":
+		micropubUpdate(db, siteURL, w, r, req)
+	case "delete":
+		micropubDelete(db, w, r, req)
+	default:
+		writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, "Unsupported action "+strconv.Quote(req.Action))
+	}
+}
+
+// micropubCreate publishes a new post from an h-entry
+func micropubCreate(db *sql.DB, siteURL string, w http.ResponseWriter, r *http.Request, req *micropubRequest) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		writeMicropubError(w, http.StatusUnauthorized, micropubUnauthorized, "Authentication required")
+		return
+	}
+
+	if len(req.Type) > 0 && req.Type[0] != "h-entry" {
+		writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, "Only h-entry posts are supported")
+		return
+	}
+
+	post := &models.BlogPost{Tags: []string{}}
+	if err := applyMicropubProperties(post, req.Properties); err != nil {
+		writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, micropubErrorMessage(err))
+		return
+	}
+	deriveMicropubFields(post)
+
+	if fields := validatePost(post); len(fields) > 0 {
+		writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, describeFields(fields))
+		return
+	}
+
+	slug, err := database.CreateBlogPost(db, post.Title, post.Excerpt, post.Content, post.Tags, user.Name())
+	if database.IsUniqueViolation(err) {
+		writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, "A post with this title already exists")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creating blog post via Micropub", "err", err)
+		writeMicropubError(w, http.StatusInternalServerError, micropubServerError, "Error creating post")
+		return
+	}
+
+	created, err := database.GetBlogPostBySlug(db, slug)
+	if err != nil || created == nil {
+		slog.ErrorContext(r.Context(), "Error fetching created blog post", "slug", slug, "err", err)
+		writeMicropubError(w, http.StatusInternalServerError, micropubServerError, "Post was created but could not be loaded")
+		return
+	}
+
+	recordAudit(db, r, "", models.AuditCreate, models.AuditTargetBlogPost, strconv.FormatInt(created.ID, 10), nil, created)
+	fireWebhook(db, r, models.EventPostPublished, created)
+	sendWebmentions(db, r, siteURL, created)
+	federatePost(db, r, created)
+
+	w.Header().Set("Location", siteURL+"/blog/"+created.Slug)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// micropubUpdate applies replace, add and delete operations to a post
+func micropubUpdate(db *sql.DB, siteURL string, w http.ResponseWriter, r *http.Request, req *micropubRequest) {
+	before, status, message := micropubPostByURL(db, r, req.URL)
+	if before == nil {
+		writeMicropubError(w, status, micropubInvalidRequest, message)
+		return
+	}
+
+	after := *before
+	after.Tags = append([]string{}, before.Tags...)
+
+	if err := applyMicropubProperties(&after, req.Replace); err != nil {
+		writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, micropubErrorMessage(err))
+		return
+	}
+
+	for name, values := range req.Add {
+		if name != "category" {
+			writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, "Only category can be added to; replace "+name+" instead")
+			return
+		}
+		tags, err := micropubStrings(values)
+		if err != nil {
+			writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, "Category: "+err.Error())
+			return
+		}
+		after.Tags = cleanList(append(after.Tags, tags...))
+	}
+
+	if err := applyMicropubDelete(&after, req.Delete); err != nil {
+		writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, micropubErrorMessage(err))
+		return
+	}
+
+	if fields := validatePost(&after); len(fields) > 0 {
+		writeMicropubError(w, http.StatusBadRequest, micropubInvalidRequest, describeFields(fields))
+		return
+	}
+
+	id := int(before.ID)
+	if err := database.UpdateBlogPost(db, id, after.Title, after.Excerpt, after.Content, after.Tags); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating blog post via Micropub", "err", err)
+		writeMicropubError(w, http.StatusInternalServerError, micropubServerError, "Error updating post")
+		return
+	}
+
+	recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetBlogPost, strconv.Itoa(id), before, after)
+	fireWebhook(db, r, models.EventPostUpdated, after)
+	sendWebmentions(db, r, siteURL, &after)
+	federatePost(db, r, &after)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// micropubDelete deletes a post
+func micropubDelete(db *sql.DB, w http.ResponseWriter, r *http.Request, req *micropubRequest) {
+	before, status, message := micropubPostByURL(db, r, req.URL)
+	if before == nil {
+		writeMicropubError(w, status, micropubInvalidRequest, message)
+		return
+	}
+
+	id := int(before.ID)
+	if err := database.DeleteBlogPost(db, id); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting blog post via Micropub", "err", err)
+		writeMicropubError(w, http.StatusInternalServerError, micropubServerError, "Error deleting post")
+		return
+	}
+
+	recordAudit(db, r, "", models.AuditDelete, models.AuditTargetBlogPost, strconv.Itoa(id), before, nil)
+	fireWebhook(db, r, models.EventPostDeleted, before)
+	unfederatePost(db, r, before)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readMicropubRequest parses a JSON or form-encoded POST
+func readMicropubRequest(r *http.Request) (*micropubRequest, error) {
+	if isJSONRequest(r) {
+		var req micropubRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, errors.New("invalid JSON: " + err.Error())
+		}
+		if req.Properties == nil {
+			req.Properties = micropubProperties{}
+		}
+		return &req, nil
+	}
+
+	if err := parseMicropubForm(r); err != nil {
+		return nil, errors.New("could not parse the request body")
+	}
+
+	req := &micropubRequest{
+		Action:     r.PostForm.Get("action"),
+		URL:        r.PostForm.Get("url"),
+		Properties: micropubProperties{},
+	}
+	if req.Action == "update" {
+		return nil, errors.New("updates must be sent as JSON")
+	}
+	if h := r.PostForm.Get("h"); h != "" {
+		req.Type = []string{"h-" + h}
+	}
+
+	for key, values := range r.PostForm {
+		switch key {
+		case "h", "action", "url", "access_token":
+			continue
+		}
+		if strings.HasPrefix(key, "mp-") {
+			continue
+		}
+
+		name := strings.TrimSuffix(key, "[]")
+		for _, v := range values {
+			req.Properties[name] = append(req.Properties[name], v)
+		}
+	}
+
+	return req, nil
+}
+
+// parseMicropubForm parses a form-encoded or multipart body. Files in
+// multipart bodies are not supported and are dropped.
+func parseMicropubForm(r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if r.MultipartForm != nil {
+			return nil
+		}
+		return r.ParseMultipartForm(micropubMaxBodyBytes)
+	}
+	return r.ParseForm()
+}
+
+// isJSONRequest reports whether the request body is JSON
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// applyMicropubProperties sets the post fields named in properties
+func applyMicropubProperties(post *models.BlogPost, properties micropubProperties) error {
+	for name, values := range properties {
+		switch name {
+		case "name", "summary":
+			v, err := micropubString(values)
+			if err != nil {
+				return errors.New(name + ": " + err.Error())
+			}
+			if name == "name" {
+				post.Title = v
+			} else {
+				post.Excerpt = v
+			}
+		case "content":
+			if len(values) == 0 {
+				post.Content = ""
+				continue
+			}
+			v, err := micropubContent(values[0])
+			if err != nil {
+				return errors.New("content: " + err.Error())
+			}
+			post.Content = v
+		case "category":
+			tags, err := micropubStrings(values)
+			if err != nil {
+				return errors.New("category: " + err.Error())
+			}
+			post.Tags = cleanList(tags)
+		}
+	}
+	return nil
+}
+
+// applyMicropubDelete removes whole properties, given as a list of names,
+// or individual categories, given as {"category": [...]}
+func applyMicropubDelete(post *models.BlogPost, raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(raw, &names); err == nil {
+		for _, name := range names {
+			switch name {
+			case "category":
+				post.Tags = []string{}
+			case "summary":
+				post.Excerpt = ""
+				deriveMicropubFields(post)
+			default:
+				return errors.New(name + " cannot be deleted")
+			}
+		}
+		return nil
+	}
+
+	var values micropubProperties
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return errors.New("delete must be a list of property names or an object of values")
+	}
+
+	for name, remove := range values {
+		if name != "category" {
+			return errors.New("only category values can be deleted")
+		}
+		tags, err := micropubStrings(remove)
+		if err != nil {
+			return errors.New("category: " + err.Error())
+		}
+
+		post.Tags = slices.DeleteFunc(post.Tags, func(tag string) bool {
+			return slices.Contains(tags, tag)
+		})
+	}
+	return nil
+}
+
+// deriveMicropubFields fills in the title and excerpt of notes, which
+// Micropub clients send as content alone
+func deriveMicropubFields(post *models.BlogPost) {
+	if post.Title == "" {
+		firstLine, _, _ := strings.Cut(strings.TrimSpace(post.Content), "\n")
+		post.Title = truncateWords(strings.TrimLeft(firstLine, "# "), 60)
+	}
+	if post.Excerpt == "" {
+		post.Excerpt = truncateWords(post.Content, 160)
+	}
+}
+
+// truncateWords collapses whitespace in s and shortens it to at most limit
+// characters, cutting at a word boundary
+func truncateWords(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len([]rune(s)) <= limit {
+		return s
+	}
+
+	cut := string([]rune(s)[:limit])
+	if i := strings.LastIndex(cut, " "); i > limit/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// micropubString returns the single string value of a property
+func micropubString(values []any) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	if len(values) > 1 {
+		return "", errors.New("expected a single value")
+	}
+	s, ok := values[0].(string)
+	if !ok {
+		return "", errors.New("expected a string")
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// micropubStrings returns the string values of a property
+func micropubStrings(values []any) ([]string, error) {
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("expected strings")
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+// micropubContent returns markdown from a content value: a plain string or
+// {"value": ...}. HTML content is refused, since posts are markdown and raw
+// HTML would be dropped when rendered.
+func micropubContent(v any) (string, error) {
+	switch content := v.(type) {
+	case string:
+		return strings.TrimSpace(content), nil
+	case map[string]any:
+		if _, ok := content["html"]; ok {
+			return "", errors.New("HTML content is not supported; send markdown as plain text")
+		}
+		if value, ok := content["value"].(string); ok {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", errors.New("expected a string or {\"value\": ...}")
+}
+
+// micropubSource returns the properties of post for q=source
+func micropubSource(post *models.BlogPost, origin string) micropubProperties {
+	category := make([]any, len(post.Tags))
+	for i, tag := range post.Tags {
+		category[i] = tag
+	}
+
+	return micropubProperties{
+		"name":      {post.Title},
+		"summary":   {post.Excerpt},
+		"content":   {post.Content},
+		"category":  category,
+		"published": {post.PublishedAt.UTC().Format(time.RFC3339)},
+		"url":       {origin + "/blog/" + post.Slug},
+	}
+}
+
+// micropubPostByURL loads the post at a /blog/{slug} URL. It returns nil
+// with a status and message when the URL names no post.
+func micropubPostByURL(db *sql.DB, r *http.Request, rawURL string) (*models.BlogPost, int, string) {
+	if rawURL == "" {
+		return nil, http.StatusBadRequest, "url is required"
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, http.StatusBadRequest, "url is not a valid URL"
+	}
+
+	slug, ok := strings.CutPrefix(u.Path, "/blog/")
+	if !ok || slug == "" || strings.Contains(slug, "/") {
+		return nil, http.StatusBadRequest, "url is not a blog post on this site"
+	}
+
+	post, err := database.GetBlogPostBySlug(db, slug)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching blog post", "slug", slug, "err", err)
+		return nil, http.StatusInternalServerError, "Error loading post"
+	}
+
+	if post == nil {
+		return nil, http.StatusBadRequest, "No post at " + rawURL
+	}
+
+	return post, 0, ""
+}
+
+// describeFields joins validation messages into one sentence, for error
+// formats without per-field details
+func describeFields(fields map[string]string) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + " " + fields[name]
+	}
+	return strings.Join(parts, "; ")
+}
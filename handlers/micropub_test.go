@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"portfolio-v2/database"
+	"portfolio-v2/internal/testdb"
+)
+
+// TestMicropubSourceUsesSiteURL checks that post URLs come from the
+// configured origin, not from the Host the request was sent to
+func TestMicropubSourceUsesSiteURL(t *testing.T) {
+	const siteURL = "https://blog.example"
+
+	db := testdb.Open(t)
+	slug, err := database.CreateBlogPost(db, "Hello world", "Excerpt", "Content", nil, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/micropub?q=source&url="+siteURL+"/blog/"+slug, nil)
+	r.Host = "attacker.example"
+	r.Header.Set("X-Forwarded-Proto", "http")
+	w := httptest.NewRecorder()
+	MicropubHandler(db, siteURL)(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	var source struct {
+		Properties micropubProperties `json:"properties"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&source); err != nil {
+		t.Fatal(err)
+	}
+
+	want := siteURL + "/blog/" + slug
+	if urls := source.Properties["url"]; len(urls) != 1 || urls[0] != want {
+		t.Errorf("url = %v, want [%s]", urls, want)
+	}
+}
+
+func TestMicropubErrorDescription(t *testing.T) {
+	db := testdb.Open(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader("action=update&url=https://blog.example/blog/hello"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	MicropubHandler(db, "https://blog.example")(w, r)
+
+	var body struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Updates must be sent as JSON"
+	if w.Code != http.StatusBadRequest || body.Error != micropubInvalidRequest || body.Description != want {
+		t.Errorf("response = %d %s %q, want 400 %s %q", w.Code, body.Error, body.Description, micropubInvalidRequest, want)
+	}
+}
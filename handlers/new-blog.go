@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"portfolio-v2/database"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
 	"portfolio-v2/templates"
 )
 
@@ -20,13 +23,14 @@ func NewBlogPageHandler(w http.ResponseWriter, r *http.Request) {
 	component := templates.NewBlog()
 	if err := component.Render(r.Context(), w); err != nil {
 		http.Error(w, "Error rendering template", http.StatusInternalServerError)
-		log.Printf("Template rendering error: %v", err)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
 		return
 	}
 }
 
-// CreateBlogPostHandler handles blog post creation form submission
-func CreateBlogPostHandler(db *sql.DB) http.HandlerFunc {
+// CreateBlogPostHandler handles blog post creation form submission.
+// siteURL is the site's public origin.
+func CreateBlogPostHandler(db *sql.DB, siteURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -35,7 +39,7 @@ func CreateBlogPostHandler(db *sql.DB) http.HandlerFunc {
 
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, "Invalid form data", http.StatusBadRequest)
-			log.Printf("Form parse error: %v", err)
+			slog.ErrorContext(r.Context(), "Form parse error", "err", err)
 			return
 		}
 
@@ -60,13 +64,28 @@ func CreateBlogPostHandler(db *sql.DB) http.HandlerFunc {
 			}
 		}
 
-		_, err := database.CreateBlogPost(db, title, excerpt, content, tags)
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		slug, err := database.CreateBlogPost(db, title, excerpt, content, tags, user.Name())
 		if err != nil {
-			log.Printf("Error creating blog post: %v", err)
+			slog.ErrorContext(r.Context(), "Error creating blog post", "err", err)
 			http.Error(w, "Error creating blog post", http.StatusInternalServerError)
 			return
 		}
 
+		if post, err := database.GetBlogPostBySlug(db, slug); err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching created blog post", "err", err)
+		} else if post != nil {
+			recordAudit(db, r, "", models.AuditCreate, models.AuditTargetBlogPost, strconv.FormatInt(post.ID, 10), nil, post)
+			fireWebhook(db, r, models.EventPostPublished, post)
+			sendWebmentions(db, r, siteURL, post)
+			federatePost(db, r, post)
+		}
+
 		http.Redirect(w, r, "/admin", http.StatusSeeOther)
 	}
 }
@@ -2,8 +2,9 @@ package handlers
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,7 +23,7 @@ func NewProjectPageHandler(w http.ResponseWriter, r *http.Request) {
 	component := templates.NewProjectForm()
 	if err := component.Render(r.Context(), w); err != nil {
 		http.Error(w, "Error rendering template", http.StatusInternalServerError)
-		log.Printf("Template rendering error: %v", err)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
 		return
 	}
 }
@@ -38,7 +39,7 @@ func CreateProjectHandler(db *sql.DB) http.HandlerFunc {
 		if err := r.ParseForm(); err != nil {
 			component := templates.NewProjectError("Invalid form data")
 			component.Render(r.Context(), w)
-			log.Printf("Form parse error: %v", err)
+			slog.ErrorContext(r.Context(), "Form parse error", "err", err)
 			return
 		}
 
@@ -79,12 +80,15 @@ func CreateProjectHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		if err := database.CreateProject(db, project); err != nil {
-			log.Printf("Error creating project: %v", err)
+			slog.ErrorContext(r.Context(), "Error creating project", "err", err)
 			component := templates.NewProjectError("Error creating project. The slug may already exist.")
 			component.Render(r.Context(), w)
 			return
 		}
 
+		recordAudit(db, r, "", models.AuditCreate, models.AuditTargetProject, strconv.FormatInt(project.ID, 10), nil, project)
+		fireWebhook(db, r, models.EventProjectCreated, project)
+
 		http.Redirect(w, r, "/admin", http.StatusSeeOther)
 	}
 }
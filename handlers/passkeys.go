@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"portfolio-v2/database"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/passkey"
+	"portfolio-v2/ratelimit"
+	"portfolio-v2/session"
+	"portfolio-v2/templates"
+)
+
+// maxPasskeyNameLength caps the label users give their passkeys
+const maxPasskeyNameLength = 64
+
+// PasskeysPageHandler lists the current user's passkeys
+func PasskeysPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		renderPasskeysPage(w, r, db, "")
+	}
+}
+
+// BeginPasskeyRegistrationHandler returns the options the browser needs to
+// create a new passkey for the current user
+func BeginPasskeyRegistrationHandler(db *sql.DB, wa *webauthn.WebAuthn, ceremonies *passkey.CeremonyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		account, err := loadPasskeyUser(r, db)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error loading passkeys", "err", err)
+			http.Error(w, "Error loading passkeys", http.StatusInternalServerError)
+			return
+		}
+
+		// Stop the same authenticator from being registered twice
+		exclusions := webauthn.Credentials(account.WebAuthnCredentials()).CredentialDescriptors()
+
+		options, data, err := wa.BeginRegistration(account, webauthn.WithExclusions(exclusions))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error starting passkey registration", "err", err)
+			http.Error(w, "Error starting passkey registration", http.StatusInternalServerError)
+			return
+		}
+
+		token, err := ceremonies.Start(account.Account.ID, data)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error starting passkey registration", "err", err)
+			http.Error(w, "Error starting passkey registration", http.StatusInternalServerError)
+			return
+		}
+
+		setCeremonyCookie(w, token)
+		writeJSON(w, http.StatusOK, options)
+	}
+}
+
+// FinishPasskeyRegistrationHandler verifies the new credential and stores it
+// under the name given in the "name" query parameter
+func FinishPasskeyRegistrationHandler(db *sql.DB, sessionStore session.Store, wa *webauthn.WebAuthn, ceremonies *passkey.CeremonyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		account, err := loadPasskeyUser(r, db)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error loading passkeys", "err", err)
+			http.Error(w, "Error loading passkeys", http.StatusInternalServerError)
+			return
+		}
+
+		ceremony, ok := finishCeremony(w, r, ceremonies)
+		if !ok || ceremony.UserID != account.Account.ID {
+			http.Error(w, "Passkey registration expired, please try again", http.StatusBadRequest)
+			return
+		}
+
+		credential, err := wa.FinishRegistration(account, ceremony.Data, r)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Passkey registration failed", "user", account.Account.Username, "err", err)
+			http.Error(w, "Passkey registration failed", http.StatusBadRequest)
+			return
+		}
+
+		pk := &models.Passkey{
+			UserID:     account.Account.ID,
+			Name:       passkeyName(r.URL.Query().Get("name")),
+			Credential: *credential,
+		}
+
+		if err := database.CreatePasskey(db, pk); err != nil {
+			slog.ErrorContext(r.Context(), "Error saving passkey", "err", err)
+			http.Error(w, "Error saving passkey", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Passkey registered", "name", pk.Name, "user", account.Account.Username)
+		recordAudit(db, r, "", models.AuditCreate, models.AuditTargetPasskey, strconv.FormatInt(pk.ID, 10), nil, auditPasskey(pk))
+		rotateSession(w, r, sessionStore)
+		writeJSON(w, http.StatusOK, map[string]string{"redirect": "/admin/account/passkeys"})
+	}
+}
+
+// RenamePasskeyHandler changes the name of one of the current user's passkeys
+func RenamePasskeyHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/account/passkeys/{id}
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) != 4 {
+			http.Error(w, "Invalid URL", http.StatusBadRequest)
+			return
+		}
+
+		id, err := strconv.ParseInt(pathParts[3], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid passkey ID", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		before, err := findPasskey(db, user.ID, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error loading passkeys", "err", err)
+			renderPasskeysPage(w, r, db, "Error renaming passkey")
+			return
+		}
+
+		name := passkeyName(r.FormValue("name"))
+		if err := database.RenamePasskey(db, user.ID, id, name); err != nil {
+			slog.ErrorContext(r.Context(), "Error renaming passkey", "err", err)
+			renderPasskeysPage(w, r, db, "Error renaming passkey")
+			return
+		}
+
+		if before != nil {
+			after := *before
+			after.Name = name
+			recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetPasskey, strconv.FormatInt(id, 10), auditPasskey(before), auditPasskey(&after))
+		}
+
+		http.Redirect(w, r, "/admin/account/passkeys", http.StatusSeeOther)
+	}
+}
+
+// DeletePasskeyHandler revokes one of the current user's passkeys
+func DeletePasskeyHandler(db *sql.DB, sessionStore session.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/account/passkeys/delete/{id}
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) < 5 || pathParts[3] != "delete" {
+			http.Error(w, "Invalid URL", http.StatusBadRequest)
+			return
+		}
+
+		id, err := strconv.ParseInt(pathParts[4], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid passkey ID", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		before, err := findPasskey(db, user.ID, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error loading passkeys", "err", err)
+			renderPasskeysPage(w, r, db, "Error revoking passkey")
+			return
+		}
+
+		if err := database.DeletePasskey(db, user.ID, id); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting passkey", "err", err)
+			renderPasskeysPage(w, r, db, "Error revoking passkey")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Passkey revoked", "id", id, "user", user.Username)
+		if before != nil {
+			recordAudit(db, r, "", models.AuditDelete, models.AuditTargetPasskey, strconv.FormatInt(id, 10), auditPasskey(before), nil)
+		}
+		rotateSession(w, r, sessionStore)
+		http.Redirect(w, r, "/admin/account/passkeys", http.StatusSeeOther)
+	}
+}
+
+// BeginPasskeyLoginHandler returns the options for a passwordless login.
+// No username is needed because passkeys are discoverable credentials.
+func BeginPasskeyLoginHandler(wa *webauthn.WebAuthn, ceremonies *passkey.CeremonyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !validLoginCSRF(r) {
+			slog.WarnContext(r.Context(), "CSRF token validation failed", "ip", getClientIP(r))
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		options, data, err := wa.BeginDiscoverableLogin()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error starting passkey login", "err", err)
+			http.Error(w, "Error starting passkey login", http.StatusInternalServerError)
+			return
+		}
+
+		token, err := ceremonies.Start(0, data)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error starting passkey login", "err", err)
+			http.Error(w, "Error starting passkey login", http.StatusInternalServerError)
+			return
+		}
+
+		setCeremonyCookie(w, token)
+		writeJSON(w, http.StatusOK, options)
+	}
+}
+
+// FinishPasskeyLoginHandler verifies the passkey assertion and issues a
+// session. Passkeys require user verification on the authenticator, so they
+// count as both factors and skip the TOTP step.
+func FinishPasskeyLoginHandler(sessionStore session.Store, rateLimiter *ratelimit.Limiter, db *sql.DB, wa *webauthn.WebAuthn, ceremonies *passkey.CeremonyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip := getClientIP(r)
+
+		if !rateLimiter.Allow(ip) {
+			slog.WarnContext(r.Context(), "Rate limit exceeded", "ip", ip)
+			http.Error(w, "Too many failed attempts. Please try again later.", http.StatusTooManyRequests)
+			return
+		}
+
+		if !validLoginCSRF(r) {
+			slog.WarnContext(r.Context(), "CSRF token validation failed", "ip", ip)
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		ceremony, ok := finishCeremony(w, r, ceremonies)
+		if !ok {
+			http.Error(w, "Passkey login expired, please try again", http.StatusBadRequest)
+			return
+		}
+
+		var account *passkey.User
+		findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+			userID, ok := passkey.ParseUserHandle(userHandle)
+			if !ok {
+				return nil, errors.New("invalid user handle")
+			}
+
+			user, err := database.GetUserByID(db, userID)
+			if err != nil {
+				return nil, err
+			}
+			if user == nil {
+				return nil, errors.New("unknown user")
+			}
+
+			passkeys, err := database.GetPasskeysByUser(db, user.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			account = &passkey.User{Account: user, Passkeys: passkeys}
+			return account, nil
+		}
+
+		_, credential, err := wa.FinishPasskeyLogin(findUser, ceremony.Data, r)
+		if err == nil && credential.Authenticator.CloneWarning {
+			err = errors.New("signature counter went backwards, the authenticator may be cloned")
+		}
+		if err != nil {
+			rateLimiter.Record(ip)
+			slog.WarnContext(r.Context(), "Failed passkey login", "ip", ip, "err", err)
+
+			actor, target := "", ""
+			if account != nil {
+				actor, target = account.Account.Username, account.Account.Username
+			}
+			recordAudit(db, r, actor, models.AuditLoginFailed, models.AuditTargetUser, target, nil, map[string]string{"reason": "invalid passkey"})
+			http.Error(w, "Passkey login failed", http.StatusUnauthorized)
+			return
+		}
+
+		if stored := account.Passkey(credential.ID); stored != nil {
+			if err := database.UpdatePasskeyCredential(db, stored.ID, *credential); err != nil {
+				slog.ErrorContext(r.Context(), "Error updating passkey", "err", err)
+			}
+		}
+
+		if err := startSession(w, r, sessionStore, account.Account.Username); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Failed to create session", "err", err)
+			return
+		}
+
+		rateLimiter.Reset(ip)
+
+		redirectTo := r.URL.Query().Get("redirect")
+		if redirectTo == "" || !strings.HasPrefix(redirectTo, "/admin") {
+			redirectTo = "/admin"
+		}
+
+		slog.InfoContext(r.Context(), "Successful passkey login", "user", account.Account.Username, "ip", ip)
+		recordAudit(db, r, account.Account.Username, models.AuditLogin, models.AuditTargetUser, account.Account.Username, nil, map[string]string{"method": "passkey"})
+		writeJSON(w, http.StatusOK, map[string]string{"redirect": redirectTo})
+	}
+}
+
+// loadPasskeyUser returns the current user together with their passkeys
+func loadPasskeyUser(r *http.Request, db *sql.DB) (*passkey.User, error) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		return nil, errors.New("no user in request context")
+	}
+
+	passkeys, err := database.GetPasskeysByUser(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &passkey.User{Account: user, Passkeys: passkeys}, nil
+}
+
+// validLoginCSRF checks the X-CSRF-Token header against the login page's
+// CSRF cookie, for the JSON requests made before a session exists
+func validLoginCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie("csrf_token")
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(middleware.CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1
+}
+
+// setCeremonyCookie ties the browser to the ceremony it just started
+func setCeremonyCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "passkey_ceremony",
+		Value:    token,
+		Path:     "/admin",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   300, // 5 minutes
+	})
+}
+
+// finishCeremony consumes the ceremony named by the request's cookie
+func finishCeremony(w http.ResponseWriter, r *http.Request, ceremonies *passkey.CeremonyStore) (passkey.Ceremony, bool) {
+	cookie, err := r.Cookie("passkey_ceremony")
+	if err != nil {
+		return passkey.Ceremony{}, false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "passkey_ceremony",
+		Value:    "",
+		Path:     "/admin",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+
+	return ceremonies.Finish(cookie.Value)
+}
+
+// findPasskey returns the passkey with id owned by userID, or nil
+func findPasskey(db *sql.DB, userID, id int64) (*models.Passkey, error) {
+	passkeys, err := database.GetPasskeysByUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range passkeys {
+		if passkeys[i].ID == id {
+			return &passkeys[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// passkeyName cleans up a user-supplied passkey label
+func passkeyName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "Passkey"
+	}
+	if len(name) > maxPasskeyNameLength {
+		name = name[:maxPasskeyNameLength]
+	}
+	return name
+}
+
+// writeJSON encodes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error encoding JSON response", "err", err)
+	}
+}
+
+// renderPasskeysPage renders the passkey management page with an optional error
+func renderPasskeysPage(w http.ResponseWriter, r *http.Request, db *sql.DB, errorMsg string) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	passkeys, err := database.GetPasskeysByUser(db, user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching passkeys", "err", err)
+		http.Error(w, "Error fetching passkeys", http.StatusInternalServerError)
+		return
+	}
+
+	if errorMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	component := templates.AccountPasskeys(passkeys, errorMsg)
+	if err := component.Render(r.Context(), w); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"portfolio-v2/database"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/passwords"
+	"portfolio-v2/ratelimit"
+	"portfolio-v2/session"
+	"portfolio-v2/templates"
+)
+
+// ChangePasswordPageHandler displays the change password form
+func ChangePasswordPageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		changed := r.URL.Query().Get("changed") == "1"
+		renderChangePasswordPage(w, r, changed, "")
+	}
+}
+
+// ChangePasswordHandler changes the current user's password after checking
+// the current one. Every session of the user is revoked, and this browser is
+// given a fresh session so the user stays logged in here only.
+func ChangePasswordHandler(db *sql.DB, sessionStore session.Store, rateLimiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Guessing the current password counts against the login limit
+		ip := getClientIP(r)
+		if !rateLimiter.Allow(ip) {
+			slog.WarnContext(r.Context(), "Rate limit exceeded", "ip", ip)
+			w.WriteHeader(http.StatusTooManyRequests)
+			templates.ChangePassword(false, "Too many failed attempts. Please try again later.").Render(r.Context(), w)
+			return
+		}
+
+		currentPassword := r.FormValue("current_password")
+		newPassword := r.FormValue("new_password")
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+			rateLimiter.Record(ip)
+			slog.WarnContext(r.Context(), "Failed password change: wrong current password", "user", user.Username, "ip", ip)
+			renderChangePasswordPage(w, r, false, "Current password is incorrect")
+			return
+		}
+
+		if newPassword != r.FormValue("confirm_password") {
+			renderChangePasswordPage(w, r, false, "New passwords do not match")
+			return
+		}
+
+		if newPassword == currentPassword {
+			renderChangePasswordPage(w, r, false, "New password must be different from the current one")
+			return
+		}
+
+		if err := passwords.Check(newPassword, user.Username); err != nil {
+			renderChangePasswordPage(w, r, false, err.Error())
+			return
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to hash password", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.UpdateUserPassword(db, user.ID, string(hash)); err != nil {
+			slog.ErrorContext(r.Context(), "Error updating password", "err", err)
+			http.Error(w, "Error updating password", http.StatusInternalServerError)
+			return
+		}
+
+		removed, err := sessionStore.RevokeAll(user.Username)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error revoking sessions", "err", err)
+		}
+		recordAudit(db, r, user.Username, models.AuditPasswordSet, models.AuditTargetUser, user.Username, nil, map[string]int{"sessions_revoked": removed})
+
+		if err := startSession(w, r, sessionStore, user.Username); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to create session", "err", err)
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Password changed", "user", user.Username, "sessions_revoked", removed)
+		http.Redirect(w, r, "/admin/account/password?changed=1", http.StatusSeeOther)
+	}
+}
+
+// renderChangePasswordPage renders the change password form with an optional error
+func renderChangePasswordPage(w http.ResponseWriter, r *http.Request, changed bool, errorMsg string) {
+	if errorMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	component := templates.ChangePassword(changed, errorMsg)
+	if err := component.Render(r.Context(), w); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+	}
+}
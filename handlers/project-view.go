@@ -2,7 +2,7 @@ package handlers
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 
@@ -29,7 +29,7 @@ func ProjectViewHandler(db *sql.DB) http.HandlerFunc {
 
 		project, err := database.GetProjectBySlug(db, slug)
 		if err != nil {
-			log.Printf("Error fetching project by slug %s: %v", slug, err)
+			slog.ErrorContext(r.Context(), "Error fetching project", "slug", slug, "err", err)
 			http.Error(w, "Error loading project", http.StatusInternalServerError)
 			return
 		}
@@ -38,7 +38,7 @@ func ProjectViewHandler(db *sql.DB) http.HandlerFunc {
 			component := templates.ProjectNotFound()
 			if err := component.Render(r.Context(), w); err != nil {
 				http.Error(w, "Error rendering template", http.StatusInternalServerError)
-				log.Printf("Template rendering error: %v", err)
+				slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
 			}
 			return
 		}
@@ -46,7 +46,7 @@ func ProjectViewHandler(db *sql.DB) http.HandlerFunc {
 		component := templates.ProjectView(*project)
 		if err := component.Render(r.Context(), w); err != nil {
 			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-			log.Printf("Template rendering error: %v", err)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
 			return
 		}
 	}
@@ -1,72 +1,61 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
-	"strconv"
 
 	"portfolio-v2/database"
 	"portfolio-v2/models"
 	"portfolio-v2/templates"
 )
 
-const projectsPerPage = 3
-
-// ProjectsAPIHandler handles paginated project requests for HTMX
-func ProjectsAPIHandler(db *sql.DB) http.HandlerFunc {
+// ProjectsAPIHandler handles paginated project requests for HTMX, perPage
+// projects at a time
+func ProjectsAPIHandler(db *sql.DB, perPage int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		page, err := strconv.Atoi(r.URL.Query().Get("page"))
-		if err != nil || page < 1 {
-			page = 1
-		}
-
-		projects, err := database.GetProjects(db, page, projectsPerPage)
+		after, err := database.ParseCursor(r.URL.Query().Get("cursor"))
 		if err != nil {
-			log.Printf("Error fetching projects: %v", err)
-			http.Error(w, "Error loading projects", http.StatusInternalServerError)
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
 			return
 		}
 
-		totalProjects, err := database.CountProjects(db)
+		projects, next, err := database.GetProjects(db, perPage, after)
+		if errors.Is(err, database.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
-			log.Printf("Error counting projects: %v", err)
-			totalProjects = 0
+			slog.ErrorContext(r.Context(), "Error fetching projects", "err", err)
+			http.Error(w, "Error loading projects", http.StatusInternalServerError)
+			return
 		}
 
-		hasMore := (page * projectsPerPage) < totalProjects
-		nextPage := page + 1
-
-		component := templates.ProjectList(projects, hasMore, nextPage)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		component := templates.ProjectList(projects, next.String())
 		if err := component.Render(r.Context(), w); err != nil {
 			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-			log.Printf("Template rendering error: %v", err)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
 			return
 		}
 	}
 }
 
-// GetInitialProjects fetches the first page of projects for the home page
-func GetInitialProjects(db *sql.DB) (projects []models.Project, hasMore bool, nextPage int) {
-	projectList, err := database.GetProjects(db, 1, projectsPerPage)
-	if err != nil {
-		log.Printf("Error fetching initial projects: %v", err)
-		return []models.Project{}, false, 1
-	}
-
-	totalProjects, err := database.CountProjects(db)
+// GetInitialProjects fetches the first perPage projects for the home page,
+// with the cursor for the next page or "" if there are no more
+func GetInitialProjects(ctx context.Context, db *sql.DB, perPage int) (projects []models.Project, nextCursor string) {
+	projectList, next, err := database.GetProjects(db, perPage, nil)
 	if err != nil {
-		log.Printf("Error counting projects: %v", err)
-		totalProjects = 0
+		slog.ErrorContext(ctx, "Error fetching initial projects", "err", err)
+		return []models.Project{}, ""
 	}
 
-	hasMore = projectsPerPage < totalProjects
-	nextPage = 2
-
-	return projectList, hasMore, nextPage
+	return projectList, next.String()
 }
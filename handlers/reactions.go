@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/ratelimit"
+	"portfolio-v2/templates"
+	"portfolio-v2/visitor"
+)
+
+// loadReactions returns the reaction bar of a post as seen by the visitor
+// sending r
+func loadReactions(db *sql.DB, visitors *visitor.Hasher, r *http.Request, post *models.BlogPost, now time.Time) (templates.ReactionsProps, error) {
+	props := templates.ReactionsProps{PostID: post.ID, PostURL: "/blog/" + post.Slug}
+
+	hash, err := visitors.Hash(getClientIP(r), r.UserAgent(), now)
+	if err != nil {
+		return props, err
+	}
+
+	if props.Counts, err = database.GetReactionCounts(db, post.ID); err != nil {
+		return props, err
+	}
+
+	if props.Mine, err = database.GetVisitorReactions(db, post.ID, hash); err != nil {
+		return props, err
+	}
+
+	return props, nil
+}
+
+// ReactHandler toggles the visitor's reaction on a published post at
+// /reactions/{postID}. Visitors are told apart by a daily hash of their IP
+// and user agent rather than a cookie, so the same reader can react again
+// the next day. HTMX requests get the updated reaction bar back; others
+// are sent back to the post. Each reaction counts against the sender's IP
+// in limiter.
+func ReactHandler(db *sql.DB, visitors *visitor.Hasher, limiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		postID, ok := idFromPath(w, r, 1)
+		if !ok {
+			return
+		}
+
+		kind := models.ReactionKind(r.PostFormValue("kind"))
+		if !kind.Valid() {
+			http.Error(w, "Invalid reaction", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+
+		post, err := database.GetBlogPostByID(db, int(postID))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching blog post", "err", err)
+			http.Error(w, "Error loading post", http.StatusInternalServerError)
+			return
+		}
+
+		if post == nil || post.PublishedAt.After(now) {
+			http.Error(w, "Blog post not found", http.StatusNotFound)
+			return
+		}
+
+		ip := getClientIP(r)
+		if !limiter.Allow(ip) {
+			http.Error(w, "Too many reactions. Please try again later.", http.StatusTooManyRequests)
+			return
+		}
+
+		hash, err := visitors.Hash(ip, r.UserAgent(), now)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error hashing visitor", "err", err)
+			http.Error(w, "Error saving reaction", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := database.ToggleReaction(db, post.ID, kind, hash); err != nil {
+			slog.ErrorContext(r.Context(), "Error toggling reaction", "err", err)
+			http.Error(w, "Error saving reaction", http.StatusInternalServerError)
+			return
+		}
+		limiter.Record(ip)
+
+		if !isHTMX(r) {
+			http.Redirect(w, r, "/blog/"+post.Slug+"#reactions", http.StatusSeeOther)
+			return
+		}
+
+		props, err := loadReactions(db, visitors, r, post, now)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching reactions", "post_id", post.ID, "err", err)
+			http.Error(w, "Error loading reactions", http.StatusInternalServerError)
+			return
+		}
+
+		if err := templates.ReactionBar(props).Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/session"
+	"portfolio-v2/templates"
+)
+
+// SecurityPageHandler lists active sessions. Owners also see every other
+// user's sessions so a stolen login can be spotted and ended.
+func SecurityPageHandler(sessionStore session.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		current, _ := middleware.GetSession(r)
+
+		sessions, err := sessionStore.List(user.Username)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error listing sessions", "err", err)
+			http.Error(w, "Error loading sessions", http.StatusInternalServerError)
+			return
+		}
+
+		var others []*session.Session
+		if user.Role.Allows(models.RoleOwner) {
+			all, err := sessionStore.ListAll()
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error listing sessions", "err", err)
+				http.Error(w, "Error loading sessions", http.StatusInternalServerError)
+				return
+			}
+
+			for _, sess := range all {
+				if sess.Username != user.Username {
+					others = append(others, sess)
+				}
+			}
+		}
+
+		component := templates.AdminSecurity(user, current.Handle, sessions, others)
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
+
+// RevokeSessionHandler ends a single session by its handle. Users may end
+// their own sessions; owners may end anyone's.
+func RevokeSessionHandler(sessionStore session.Store, db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handle := r.FormValue("handle")
+		if handle == "" {
+			http.Error(w, "Missing session", http.StatusBadRequest)
+			return
+		}
+
+		target, err := findSession(sessionStore, user, handle)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error listing sessions", "err", err)
+			http.Error(w, "Error loading sessions", http.StatusInternalServerError)
+			return
+		}
+
+		if target == nil {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+
+		if err := sessionStore.Revoke(handle); err != nil {
+			slog.ErrorContext(r.Context(), "Error revoking session", "err", err)
+			http.Error(w, "Error revoking session", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Session revoked", "user", target.Username, "session_ip", target.IP, "by", user.Username)
+		recordAudit(db, r, user.Username, models.AuditRevoke, models.AuditTargetSession, handle, auditSession(target), nil)
+
+		// Revoking the current session is the same as logging out
+		if current, ok := middleware.GetSession(r); ok && current.Handle == handle {
+			clearSessionCookie(w)
+			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, "/admin/security", http.StatusSeeOther)
+	}
+}
+
+// RevokeAllSessionsHandler logs the current user out everywhere, including
+// this browser
+func RevokeAllSessionsHandler(sessionStore session.Store, db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		removed, err := sessionStore.RevokeAll(user.Username)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error revoking sessions", "err", err)
+			http.Error(w, "Error revoking sessions", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "User logged out everywhere", "user", user.Username, "sessions", removed)
+		recordAudit(db, r, user.Username, models.AuditRevoke, models.AuditTargetSession, "", nil, map[string]any{"username": user.Username, "sessions_revoked": removed})
+		clearSessionCookie(w)
+		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+	}
+}
+
+// findSession returns the active session with handle if user may see it
+func findSession(sessionStore session.Store, user *models.User, handle string) (*session.Session, error) {
+	var sessions []*session.Session
+	var err error
+	if user.Role.Allows(models.RoleOwner) {
+		sessions, err = sessionStore.ListAll()
+	} else {
+		sessions, err = sessionStore.List(user.Username)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sess := range sessions {
+		if sess.Handle == handle {
+			return sess, nil
+		}
+	}
+	return nil, nil
+}
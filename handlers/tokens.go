@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"portfolio-v2/apitoken"
+	"portfolio-v2/database"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/templates"
+)
+
+// tokenExpiryDays lists the expiry choices offered when minting a token;
+// zero means the token never expires
+var tokenExpiryDays = []int{30, 90, 365, 0}
+
+// TokensPageHandler lists the current user's API tokens
+func TokensPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		renderTokensPage(w, r, db, "", "")
+	}
+}
+
+// CreateTokenHandler mints a new API token. The token is shown once and
+// only its hash is stored.
+func CreateTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" || len(name) > 64 {
+			renderTokensPage(w, r, db, "", "Token name must be 1 to 64 characters")
+			return
+		}
+
+		var scopes []models.Scope
+		for _, value := range r.Form["scopes"] {
+			scope := models.Scope(value)
+			if !scope.Valid() {
+				renderTokensPage(w, r, db, "", "Unknown scope: "+value)
+				return
+			}
+			if !user.Role.Allows(scope.Role()) {
+				renderTokensPage(w, r, db, "", "Your role cannot grant "+value)
+				return
+			}
+			scopes = append(scopes, scope)
+		}
+
+		if len(scopes) == 0 {
+			renderTokensPage(w, r, db, "", "Choose at least one scope")
+			return
+		}
+
+		days, err := strconv.Atoi(r.FormValue("expires_in"))
+		if err != nil || !validTokenExpiry(days) {
+			renderTokensPage(w, r, db, "", "Invalid expiry")
+			return
+		}
+
+		raw, hash, err := apitoken.Generate()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to generate API token", "err", err)
+			renderTokensPage(w, r, db, "", "Error creating token")
+			return
+		}
+
+		token := &models.APIToken{
+			UserID: user.ID,
+			Name:   name,
+			Prefix: apitoken.Display(raw),
+			Scopes: scopes,
+		}
+		if days > 0 {
+			expires := time.Now().AddDate(0, 0, days)
+			token.ExpiresAt = &expires
+		}
+
+		if err := database.CreateAPIToken(db, token, hash); err != nil {
+			slog.ErrorContext(r.Context(), "Error creating API token", "err", err)
+			renderTokensPage(w, r, db, "", "Error creating token")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "API token created", "name", token.Name, "prefix", token.Prefix, "user", user.Username)
+		recordAudit(db, r, "", models.AuditCreate, models.AuditTargetToken, strconv.FormatInt(token.ID, 10), nil, auditToken(token))
+
+		renderTokensPage(w, r, db, raw, "")
+	}
+}
+
+// DeleteTokenHandler revokes one of the current user's API tokens
+func DeleteTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/account/tokens/delete/{id}
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) < 5 || pathParts[3] != "delete" {
+			http.Error(w, "Invalid URL", http.StatusBadRequest)
+			return
+		}
+
+		id, err := strconv.ParseInt(pathParts[4], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid token ID", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		before, err := findToken(db, user.ID, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error loading API tokens", "err", err)
+			renderTokensPage(w, r, db, "", "Error revoking token")
+			return
+		}
+
+		if err := database.DeleteAPIToken(db, user.ID, id); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting API token", "err", err)
+			renderTokensPage(w, r, db, "", "Error revoking token")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "API token revoked", "id", id, "user", user.Username)
+		if before != nil {
+			recordAudit(db, r, "", models.AuditDelete, models.AuditTargetToken, strconv.FormatInt(id, 10), auditToken(before), nil)
+		}
+
+		http.Redirect(w, r, "/admin/account/tokens", http.StatusSeeOther)
+	}
+}
+
+// findToken returns the API token with id owned by userID, or nil
+func findToken(db *sql.DB, userID, id int64) (*models.APIToken, error) {
+	tokens, err := database.GetAPITokensByUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tokens {
+		if tokens[i].ID == id {
+			return &tokens[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// validTokenExpiry reports whether days is one of the offered expiry choices
+func validTokenExpiry(days int) bool {
+	for _, d := range tokenExpiryDays {
+		if d == days {
+			return true
+		}
+	}
+	return false
+}
+
+// renderTokensPage renders the token list. newToken is the plaintext of a
+// token minted by this request, shown once.
+func renderTokensPage(w http.ResponseWriter, r *http.Request, db *sql.DB, newToken, errorMsg string) {
+	user, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := database.GetAPITokensByUser(db, user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching API tokens", "err", err)
+		http.Error(w, "Error loading tokens", http.StatusInternalServerError)
+		return
+	}
+
+	// Only offer scopes the user's role can actually use
+	var scopes []models.Scope
+	for _, scope := range models.Scopes {
+		if user.Role.Allows(scope.Role()) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	props := templates.TokensProps{
+		Tokens:     tokens,
+		Scopes:     scopes,
+		ExpiryDays: tokenExpiryDays,
+		NewToken:   newToken,
+		ErrorMsg:   errorMsg,
+		Now:        time.Now(),
+	}
+
+	if errorMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	component := templates.AccountTokens(props)
+	if err := component.Render(r.Context(), w); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+	}
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/bcrypt"
+
+	"portfolio-v2/database"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/session"
+	"portfolio-v2/templates"
+	"portfolio-v2/totp"
+)
+
+// recoveryCodeCount is how many recovery codes are issued at a time
+const recoveryCodeCount = 10
+
+// TwoFactorPageHandler shows two-factor status, or starts enrollment by
+// creating a pending secret for the current user
+func TwoFactorPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !user.TOTPEnabled && user.TOTPSecret == "" {
+			secret, err := totp.GenerateSecret()
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to generate TOTP secret", "err", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.SetTOTPSecret(db, user.ID, secret); err != nil {
+				slog.ErrorContext(r.Context(), "Error storing TOTP secret", "err", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			user.TOTPSecret = secret
+		}
+
+		renderTwoFactorPage(w, r, db, user, nil, "")
+	}
+}
+
+// EnableTwoFactorHandler confirms enrollment with a code from the
+// authenticator app and issues the first set of recovery codes
+func EnableTwoFactorHandler(db *sql.DB, sessionStore session.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if user.TOTPEnabled || user.TOTPSecret == "" {
+			http.Redirect(w, r, "/admin/account/2fa", http.StatusSeeOther)
+			return
+		}
+
+		step, valid := totp.Validate(user.TOTPSecret, r.FormValue("code"), time.Now(), 0)
+		if !valid {
+			renderTwoFactorPage(w, r, db, user, nil, "Invalid code. Check that your device clock is correct and try again.")
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to generate recovery codes", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.EnableTOTP(db, user.ID, step, hashes); err != nil {
+			slog.ErrorContext(r.Context(), "Error enabling TOTP", "err", err)
+			http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Two-factor authentication enabled", "user", user.Username)
+		recordAudit(db, r, "", models.AuditTwoFactorOn, models.AuditTargetUser, user.Username, nil, nil)
+		user.TOTPEnabled = true
+		r = rotateSession(w, r, sessionStore)
+		renderTwoFactorPage(w, r, db, user, codes, "")
+	}
+}
+
+// DisableTwoFactorHandler turns off two-factor authentication after
+// confirming both the password and a current code
+func DisableTwoFactorHandler(db *sql.DB, sessionStore session.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !user.TOTPEnabled {
+			http.Redirect(w, r, "/admin/account/2fa", http.StatusSeeOther)
+			return
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(r.FormValue("password"))); err != nil {
+			renderTwoFactorPage(w, r, db, user, nil, "Incorrect password or code")
+			return
+		}
+
+		valid, err := verifySecondFactor(db, user, r.FormValue("code"))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to verify second factor", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			renderTwoFactorPage(w, r, db, user, nil, "Incorrect password or code")
+			return
+		}
+
+		if err := database.DisableTOTP(db, user.ID); err != nil {
+			slog.ErrorContext(r.Context(), "Error disabling TOTP", "err", err)
+			http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Two-factor authentication disabled", "user", user.Username)
+		recordAudit(db, r, "", models.AuditTwoFactorOff, models.AuditTargetUser, user.Username, nil, nil)
+		rotateSession(w, r, sessionStore)
+		http.Redirect(w, r, "/admin/account/2fa", http.StatusSeeOther)
+	}
+}
+
+// RegenerateRecoveryCodesHandler replaces the current user's recovery codes
+func RegenerateRecoveryCodesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !user.TOTPEnabled {
+			http.Redirect(w, r, "/admin/account/2fa", http.StatusSeeOther)
+			return
+		}
+
+		valid, err := verifySecondFactor(db, user, r.FormValue("code"))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to verify second factor", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			renderTwoFactorPage(w, r, db, user, nil, "Invalid code")
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to generate recovery codes", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.ReplaceRecoveryCodes(db, user.ID, hashes); err != nil {
+			slog.ErrorContext(r.Context(), "Error replacing recovery codes", "err", err)
+			http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Recovery codes regenerated", "user", user.Username)
+		recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetUser, user.Username, nil, map[string]string{"recovery_codes": "regenerated"})
+		renderTwoFactorPage(w, r, db, user, codes, "")
+	}
+}
+
+// newRecoveryCodes returns fresh recovery codes along with their storage hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = totp.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// renderTwoFactorPage renders the two-factor settings page. The QR code is
+// generated server-side so the secret never leaves this site.
+func renderTwoFactorPage(w http.ResponseWriter, r *http.Request, db *sql.DB, user *models.User, recoveryCodes []string, errorMsg string) {
+	props := templates.TwoFactorProps{
+		Enabled:       user.TOTPEnabled,
+		RecoveryCodes: recoveryCodes,
+		Error:         errorMsg,
+	}
+
+	if user.TOTPEnabled {
+		remaining, err := database.CountRecoveryCodes(db, user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error counting recovery codes", "err", err)
+		}
+		props.RemainingCodes = remaining
+	} else {
+		issuer := r.Host
+		if host, _, err := net.SplitHostPort(issuer); err == nil {
+			issuer = host
+		}
+
+		png, err := qrcode.Encode(totp.URI(issuer, user.Username, user.TOTPSecret), qrcode.Medium, 240)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to render QR code", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		props.Secret = user.TOTPSecret
+		props.QRCode = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	}
+
+	if errorMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	component := templates.AccountTwoFactor(props)
+	if err := component.Render(r.Context(), w); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+	}
+}
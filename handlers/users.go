@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"portfolio-v2/database"
+	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/passwords"
+	"portfolio-v2/session"
+	"portfolio-v2/templates"
+)
+
+// UsersPageHandler lists admin users with a form to add more
+func UsersPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		renderUsersPage(w, r, db, "")
+	}
+}
+
+// CreateUserHandler handles the add user form submission
+func CreateUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		username := strings.TrimSpace(r.FormValue("username"))
+		displayName := strings.TrimSpace(r.FormValue("display_name"))
+		password := r.FormValue("password")
+		role := models.Role(r.FormValue("role"))
+
+		if username == "" {
+			renderUsersPage(w, r, db, "Username is required")
+			return
+		}
+
+		if err := passwords.Check(password, username); err != nil {
+			renderUsersPage(w, r, db, err.Error())
+			return
+		}
+
+		if !role.Valid() {
+			renderUsersPage(w, r, db, "Invalid role")
+			return
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to hash password", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		user := &models.User{
+			Username:     username,
+			DisplayName:  displayName,
+			PasswordHash: string(hash),
+			Role:         role,
+		}
+
+		if err := database.CreateUser(db, user); err != nil {
+			slog.ErrorContext(r.Context(), "Error creating user", "err", err)
+			renderUsersPage(w, r, db, "Error creating user. The username may already exist.")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "User created", "user", user.Username, "role", user.Role)
+		recordAudit(db, r, "", models.AuditCreate, models.AuditTargetUser, user.Username, nil, auditUser(user))
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+	}
+}
+
+// UpdateUserRoleHandler changes the role of a user
+func UpdateUserRoleHandler(db *sql.DB, sessionStore session.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/users/{id}
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) != 3 {
+			http.Error(w, "Invalid URL", http.StatusBadRequest)
+			return
+		}
+
+		id, err := strconv.ParseInt(pathParts[2], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		role := models.Role(r.FormValue("role"))
+		if !role.Valid() {
+			renderUsersPage(w, r, db, "Invalid role")
+			return
+		}
+
+		user, err := database.GetUserByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching user", "err", err)
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		// Never leave the site without an owner
+		if user.Role == models.RoleOwner && role != models.RoleOwner {
+			if lastOwner, err := isLastOwner(db, r); err != nil || lastOwner {
+				renderUsersPage(w, r, db, "The last owner cannot be demoted")
+				return
+			}
+		}
+
+		if err := database.UpdateUserRole(db, id, role); err != nil {
+			slog.ErrorContext(r.Context(), "Error updating user role", "err", err)
+			http.Error(w, "Error updating user", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "User role changed", "user", user.Username, "from", user.Role, "to", role)
+
+		after := *user
+		after.Role = role
+		recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetUser, user.Username, auditUser(user), auditUser(&after))
+
+		// Rotate the session when owners change their own role
+		if current, ok := middleware.GetUser(r); ok && current.ID == id {
+			rotateSession(w, r, sessionStore)
+		}
+
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+	}
+}
+
+// DeleteUserHandler handles deleting a user. The user's sessions are
+// revoked first: they are keyed by username, so they would otherwise sign
+// in a new account created later under the same name.
+func DeleteUserHandler(db *sql.DB, sessionStore session.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/users/delete/{id}
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) < 4 || pathParts[2] != "delete" {
+			http.Error(w, "Invalid URL", http.StatusBadRequest)
+			return
+		}
+
+		id, err := strconv.ParseInt(pathParts[3], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		current, ok := middleware.GetUser(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if current.ID == id {
+			renderUsersPage(w, r, db, "You cannot delete your own account")
+			return
+		}
+
+		user, err := database.GetUserByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching user", "err", err)
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
+
+		if user == nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if user.Role == models.RoleOwner {
+			if lastOwner, err := isLastOwner(db, r); err != nil || lastOwner {
+				renderUsersPage(w, r, db, "The last owner cannot be deleted")
+				return
+			}
+		}
+
+		removed, err := sessionStore.RevokeAll(user.Username)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error revoking sessions", "err", err)
+			http.Error(w, "Error deleting user", http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.DeleteUser(db, id); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting user", "err", err)
+			http.Error(w, "Error deleting user", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "User deleted", "user", user.Username, "by", current.Username, "sessions_revoked", removed)
+		recordAudit(db, r, current.Username, models.AuditDelete, models.AuditTargetUser, user.Username, auditUser(user), nil)
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+	}
+}
+
+// isLastOwner reports whether exactly one owner remains
+func isLastOwner(db *sql.DB, r *http.Request) (bool, error) {
+	owners, err := database.CountOwners(db)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error counting owners", "err", err)
+		return false, err
+	}
+	return owners <= 1, nil
+}
+
+// renderUsersPage renders the user management page with an optional error
+func renderUsersPage(w http.ResponseWriter, r *http.Request, db *sql.DB, errorMsg string) {
+	current, ok := middleware.GetUser(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	users, err := database.GetAllUsers(db)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching users", "err", err)
+		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		return
+	}
+
+	if errorMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	component := templates.AdminUsers(current, users, errorMsg)
+	if err := component.Render(r.Context(), w); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+	}
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/templates"
+	"portfolio-v2/webhook"
+)
+
+// webhookDeliveriesShown is the number of deliveries listed on a webhook's page
+const webhookDeliveriesShown = 50
+
+// fireWebhook queues event for subscribed webhooks. data is the payload's
+// data, usually the affected post or project. Failures are logged but
+// never fail the request.
+func fireWebhook(db *sql.DB, r *http.Request, event models.WebhookEvent, data any) {
+	if err := webhook.Enqueue(db, event, data); err != nil {
+		slog.ErrorContext(r.Context(), "Error queueing webhook event", "event", event, "err", err)
+	}
+}
+
+// WebhooksPageHandler lists webhooks with a form to add more
+func WebhooksPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		renderWebhooksPage(w, r, db, "")
+	}
+}
+
+// CreateWebhookHandler adds a webhook with a new signing secret
+func CreateWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		hook, errorMsg := parseWebhookForm(r)
+		if errorMsg != "" {
+			renderWebhooksPage(w, r, db, errorMsg)
+			return
+		}
+
+		secret, err := webhook.GenerateSecret()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to generate webhook secret", "err", err)
+			renderWebhooksPage(w, r, db, "Error creating webhook")
+			return
+		}
+		hook.Secret = secret
+		hook.Active = true
+
+		if err := database.CreateWebhook(db, hook); err != nil {
+			slog.ErrorContext(r.Context(), "Error creating webhook", "err", err)
+			renderWebhooksPage(w, r, db, "Error creating webhook")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Webhook created", "id", hook.ID, "url", hook.URL)
+		recordAudit(db, r, "", models.AuditCreate, models.AuditTargetWebhook, strconv.FormatInt(hook.ID, 10), nil, auditWebhook(hook))
+
+		http.Redirect(w, r, webhookPath(hook.ID), http.StatusSeeOther)
+	}
+}
+
+// WebhookPageHandler shows a webhook's settings, secret and delivery log
+func WebhookPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, ok := idFromPath(w, r, 2)
+		if !ok {
+			return
+		}
+
+		hook, err := database.GetWebhookByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching webhook", "err", err)
+			http.Error(w, "Error loading webhook", http.StatusInternalServerError)
+			return
+		}
+
+		if hook == nil {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+
+		renderWebhookPage(w, r, db, hook, "")
+	}
+}
+
+// UpdateWebhookHandler saves a webhook's URL, events and active flag
+func UpdateWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, ok := idFromPath(w, r, 2)
+		if !ok {
+			return
+		}
+
+		before, err := database.GetWebhookByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching webhook", "err", err)
+			http.Error(w, "Error loading webhook", http.StatusInternalServerError)
+			return
+		}
+
+		if before == nil {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+
+		hook, errorMsg := parseWebhookForm(r)
+		if errorMsg != "" {
+			renderWebhookPage(w, r, db, before, errorMsg)
+			return
+		}
+		hook.ID = before.ID
+		hook.Secret = before.Secret
+		hook.CreatedAt = before.CreatedAt
+		hook.Active = r.FormValue("active") == "on"
+
+		if err := database.UpdateWebhook(db, hook); err != nil {
+			slog.ErrorContext(r.Context(), "Error updating webhook", "err", err)
+			renderWebhookPage(w, r, db, before, "Error saving webhook")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Webhook updated", "id", hook.ID)
+		recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetWebhook, strconv.FormatInt(hook.ID, 10), auditWebhook(before), auditWebhook(hook))
+
+		http.Redirect(w, r, webhookPath(hook.ID), http.StatusSeeOther)
+	}
+}
+
+// DeleteWebhookHandler removes a webhook and its delivery log
+func DeleteWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/webhooks/delete/{id}
+		id, ok := idFromPath(w, r, 3)
+		if !ok {
+			return
+		}
+
+		before, err := database.GetWebhookByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching webhook", "err", err)
+			http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.DeleteWebhook(db, id); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting webhook", "err", err)
+			http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Webhook deleted", "id", id)
+		recordAudit(db, r, "", models.AuditDelete, models.AuditTargetWebhook, strconv.FormatInt(id, 10), auditWebhook(before), nil)
+
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+	}
+}
+
+// PingWebhookHandler queues a test event for a webhook, to check a
+// receiver and its signature verification without changing any content
+func PingWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/webhooks/ping/{id}
+		id, ok := idFromPath(w, r, 3)
+		if !ok {
+			return
+		}
+
+		hook, err := database.GetWebhookByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching webhook", "err", err)
+			http.Error(w, "Error loading webhook", http.StatusInternalServerError)
+			return
+		}
+
+		if hook == nil {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+
+		if err := webhook.Ping(db, hook); err != nil {
+			slog.ErrorContext(r.Context(), "Error queueing webhook ping", "err", err)
+			renderWebhookPage(w, r, db, hook, "Error sending test event")
+			return
+		}
+
+		http.Redirect(w, r, webhookPath(hook.ID), http.StatusSeeOther)
+	}
+}
+
+// RedeliverWebhookHandler queues a delivery's payload again, e.g. after a
+// receiver outage outlasted the retries
+func RedeliverWebhookHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/webhooks/redeliver/{deliveryID}
+		id, ok := idFromPath(w, r, 3)
+		if !ok {
+			return
+		}
+
+		delivery, err := database.GetWebhookDeliveryByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching webhook delivery", "err", err)
+			http.Error(w, "Error loading delivery", http.StatusInternalServerError)
+			return
+		}
+
+		if delivery == nil {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+			return
+		}
+
+		if err := webhook.Redeliver(db, delivery); err != nil {
+			slog.ErrorContext(r.Context(), "Error redelivering webhook delivery", "delivery_id", delivery.ID, "err", err)
+			http.Error(w, "Error redelivering", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, webhookPath(delivery.WebhookID), http.StatusSeeOther)
+	}
+}
+
+// parseWebhookForm reads the URL, description and events of the webhook
+// form, returning an error message if they are invalid
+func parseWebhookForm(r *http.Request) (*models.Webhook, string) {
+	if err := r.ParseForm(); err != nil {
+		return nil, "Invalid form data"
+	}
+
+	hook := &models.Webhook{
+		URL:         strings.TrimSpace(r.FormValue("url")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+	}
+
+	if !isHTTPURL(hook.URL) {
+		return nil, "URL must be an absolute http:// or https:// URL"
+	}
+
+	if len(hook.Description) > 200 {
+		return nil, "Description must be at most 200 characters"
+	}
+
+	for _, value := range r.Form["events"] {
+		event := models.WebhookEvent(value)
+		if !event.Valid() {
+			return nil, "Unknown event: " + value
+		}
+		hook.Events = append(hook.Events, event)
+	}
+
+	if len(hook.Events) == 0 {
+		return nil, "Choose at least one event"
+	}
+
+	return hook, ""
+}
+
+// idFromPath parses the ID at index of the path, writing an error
+// response and returning false if there is none
+func idFromPath(w http.ResponseWriter, r *http.Request, index int) (int64, bool) {
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) != index+1 {
+		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(pathParts[index], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+func webhookPath(id int64) string {
+	return "/admin/webhooks/" + strconv.FormatInt(id, 10)
+}
+
+// renderWebhooksPage renders the webhook list with an optional error
+func renderWebhooksPage(w http.ResponseWriter, r *http.Request, db *sql.DB, errorMsg string) {
+	hooks, err := database.GetWebhooks(db)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching webhooks", "err", err)
+		http.Error(w, "Error loading webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	if errorMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	component := templates.AdminWebhooks(hooks, models.WebhookEvents, errorMsg)
+	if err := component.Render(r.Context(), w); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+	}
+}
+
+// renderWebhookPage renders a webhook with its delivery log and an
+// optional error
+func renderWebhookPage(w http.ResponseWriter, r *http.Request, db *sql.DB, hook *models.Webhook, errorMsg string) {
+	deliveries, err := database.GetWebhookDeliveries(db, hook.ID, webhookDeliveriesShown)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching webhook deliveries", "err", err)
+		http.Error(w, "Error loading webhook", http.StatusInternalServerError)
+		return
+	}
+
+	props := templates.WebhookProps{
+		Webhook:     hook,
+		Events:      models.WebhookEvents,
+		Deliveries:  deliveries,
+		MaxAttempts: webhook.MaxAttempts,
+		ErrorMsg:    errorMsg,
+	}
+
+	if errorMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	component := templates.AdminWebhook(props)
+	if err := component.Render(r.Context(), w); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+	}
+}
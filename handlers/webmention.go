@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/ratelimit"
+	"portfolio-v2/templates"
+	"portfolio-v2/webmention"
+)
+
+// webmentionsShown is the number of mentions listed per moderation queue,
+// and of results on the sent page
+const webmentionsShown = 100
+
+// sendWebmentions queues notifications to the sites post links to, sent
+// once the post is live, naming its URL under siteURL as the source.
+// Failures are logged but never fail the request.
+func sendWebmentions(db *sql.DB, r *http.Request, siteURL string, post *models.BlogPost) {
+	source := siteURL + "/blog/" + post.Slug
+	if err := webmention.Schedule(db, post.ID, source, post.PublishedAt); err != nil {
+		slog.ErrorContext(r.Context(), "Error queueing webmentions", "post_id", post.ID, "err", err)
+	}
+}
+
+// WebmentionHandler receives Webmentions for blog posts. The source is
+// fetched and checked in the background, so a valid request is answered
+// 202 Accepted straight away. Each request counts against the sender's IP
+// in limiter.
+func WebmentionHandler(db *sql.DB, limiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip := getClientIP(r)
+		if !limiter.Allow(ip) {
+			http.Error(w, "Too many webmentions, try again later", http.StatusTooManyRequests)
+			return
+		}
+		limiter.Record(ip)
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		source := strings.TrimSpace(r.PostFormValue("source"))
+		target := strings.TrimSpace(r.PostFormValue("target"))
+
+		if !isHTTPURL(source) || !isHTTPURL(target) {
+			http.Error(w, "source and target must be absolute http:// or https:// URLs", http.StatusBadRequest)
+			return
+		}
+
+		if webmention.SameURL(source, target) {
+			http.Error(w, "source and target must be different", http.StatusBadRequest)
+			return
+		}
+
+		post, status, msg := webmentionTarget(db, r, target)
+		if post == nil {
+			http.Error(w, msg, status)
+			return
+		}
+
+		mention := &models.Webmention{PostID: post.ID, Source: source, Target: target}
+		if err := database.SaveWebmention(db, mention); err != nil {
+			slog.ErrorContext(r.Context(), "Error saving webmention", "err", err)
+			http.Error(w, "Error saving webmention", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Webmention received", "id", mention.ID, "source", source, "slug", post.Slug)
+		webmention.Queue()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Webmention accepted for verification\n"))
+	}
+}
+
+// webmentionTarget resolves target to a blog post on this site. If it is
+// not one, it returns nil with the status and message to respond with.
+func webmentionTarget(db *sql.DB, r *http.Request, target string) (*models.BlogPost, int, string) {
+	u, err := url.Parse(target)
+	if err != nil || !strings.EqualFold(u.Host, r.Host) {
+		return nil, http.StatusBadRequest, "target is not on this site"
+	}
+
+	slug, ok := strings.CutPrefix(strings.TrimSuffix(u.Path, "/"), "/blog/")
+	if !ok || slug == "" || strings.Contains(slug, "/") {
+		return nil, http.StatusBadRequest, "target does not accept webmentions"
+	}
+
+	post, err := database.GetBlogPostBySlug(db, slug)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching blog post", "slug", slug, "err", err)
+		return nil, http.StatusInternalServerError, "Error loading target"
+	}
+
+	if post == nil {
+		return nil, http.StatusBadRequest, "target post does not exist"
+	}
+
+	return post, 0, ""
+}
+
+// WebmentionsPageHandler lists the mentions in a moderation queue, those
+// waiting for review by default
+func WebmentionsPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		queue := models.WebmentionQueue(r.URL.Query().Get("queue"))
+		if !queue.Valid() {
+			queue = models.QueueReview
+		}
+
+		mentions, err := database.GetWebmentions(db, queue, webmentionsShown)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching webmentions", "err", err)
+			http.Error(w, "Error loading webmentions", http.StatusInternalServerError)
+			return
+		}
+
+		counts := make(map[models.WebmentionQueue]int, len(models.WebmentionQueues))
+		for _, q := range models.WebmentionQueues {
+			counts[q], err = database.CountWebmentions(db, q)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error counting webmentions", "err", err)
+				http.Error(w, "Error loading webmentions", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		props := templates.WebmentionsProps{
+			Queue:    queue,
+			Queues:   models.WebmentionQueues,
+			Counts:   counts,
+			Mentions: mentions,
+		}
+
+		component := templates.AdminWebmentions(props)
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
+
+// ModerateWebmentionHandler approves or rejects a mention, or queues its
+// source to be fetched again, then returns to the queue it was listed in
+func ModerateWebmentionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/webmentions/{id}
+		id, ok := idFromPath(w, r, 2)
+		if !ok {
+			return
+		}
+
+		before, err := database.GetWebmentionByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching webmention", "err", err)
+			http.Error(w, "Error loading webmention", http.StatusInternalServerError)
+			return
+		}
+
+		if before == nil {
+			http.Error(w, "Webmention not found", http.StatusNotFound)
+			return
+		}
+
+		after := *before
+		switch r.FormValue("action") {
+		case "approve":
+			after.Moderation = models.ModerationApproved
+			err = database.SetWebmentionModeration(db, id, after.Moderation)
+		case "reject":
+			after.Moderation = models.ModerationRejected
+			err = database.SetWebmentionModeration(db, id, after.Moderation)
+		case "verify":
+			after.Status = models.MentionPending
+			err = database.RequeueWebmention(db, id)
+			webmention.Queue()
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error moderating webmention", "err", err)
+			http.Error(w, "Error saving webmention", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Webmention moderated", "id", id, "action", r.FormValue("action"))
+		recordAudit(db, r, "", models.AuditUpdate, models.AuditTargetMention, strconv.FormatInt(id, 10), auditWebmention(before), auditWebmention(&after))
+
+		http.Redirect(w, r, webmentionsPath(r.FormValue("queue")), http.StatusSeeOther)
+	}
+}
+
+// DeleteWebmentionHandler removes a mention. Unlike rejecting it, the
+// source can send it again and it will be reviewed afresh.
+func DeleteWebmentionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract ID from URL path /admin/webmentions/delete/{id}
+		id, ok := idFromPath(w, r, 3)
+		if !ok {
+			return
+		}
+
+		before, err := database.GetWebmentionByID(db, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching webmention", "err", err)
+			http.Error(w, "Error deleting webmention", http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.DeleteWebmention(db, id); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting webmention", "err", err)
+			http.Error(w, "Error deleting webmention", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Webmention deleted", "id", id)
+		recordAudit(db, r, "", models.AuditDelete, models.AuditTargetMention, strconv.FormatInt(id, 10), auditWebmention(before), nil)
+
+		http.Redirect(w, r, webmentionsPath(r.FormValue("queue")), http.StatusSeeOther)
+	}
+}
+
+// OutgoingWebmentionsPageHandler lists the latest results of notifying the
+// sites posts link to
+func OutgoingWebmentionsPageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		sent, err := database.GetOutgoingWebmentions(db, webmentionsShown)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching outgoing webmentions", "err", err)
+			http.Error(w, "Error loading webmentions", http.StatusInternalServerError)
+			return
+		}
+
+		component := templates.AdminOutgoingWebmentions(sent)
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+		}
+	}
+}
+
+// ResendWebmentionsHandler notifies every site a post links to again, e.g.
+// after a target's endpoint was down
+func ResendWebmentionsHandler(db *sql.DB, siteURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Extract post ID from URL path /admin/webmentions/resend/{postID}
+		id, ok := idFromPath(w, r, 3)
+		if !ok {
+			return
+		}
+
+		post, err := database.GetBlogPostByID(db, int(id))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error fetching blog post", "err", err)
+			http.Error(w, "Error loading post", http.StatusInternalServerError)
+			return
+		}
+
+		if post == nil {
+			http.Error(w, "Blog post not found", http.StatusNotFound)
+			return
+		}
+
+		sendWebmentions(db, r, siteURL, post)
+
+		http.Redirect(w, r, "/admin/webmentions/sent", http.StatusSeeOther)
+	}
+}
+
+// webmentionsPath returns the moderation page for queue, or the review
+// queue if it is not a known one
+func webmentionsPath(queue string) string {
+	if !models.WebmentionQueue(queue).Valid() {
+		return "/admin/webmentions"
+	}
+	return "/admin/webmentions?queue=" + queue
+}
@@ -0,0 +1,22 @@
+// Package testdb opens throwaway databases for tests.
+package testdb
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"portfolio-v2/database"
+)
+
+// Open returns a fresh database in a temporary directory, closed when the
+// test ends
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"portfolio-v2/analytics"
+	"portfolio-v2/database"
+	"portfolio-v2/ratelimit"
+	"portfolio-v2/scheduler"
+	"portfolio-v2/session"
+)
+
+// backupsKept is how many nightly database backups are kept
+const backupsKept = 7
+
+// registerJobs schedules the periodic upkeep: reaping sessions, pruning
+// logs and rate limits, rolling up analytics and backing up the database
+// into backupDir. Publishing needs no job: posts have no draft or scheduled
+// state, and every feed and page shows a post once its published_at has
+// passed.
+func registerJobs(sched *scheduler.Scheduler, db *sql.DB, sessions session.Store, limiters []*ratelimit.Limiter, backupDir string) error {
+	jobs := []struct {
+		name string
+		spec string
+		run  scheduler.Func
+	}{
+		{"reap-sessions", "@every 10m", func(ctx context.Context) error {
+			removed, err := sessions.DeleteExpired()
+			if err != nil {
+				return err
+			}
+			if removed > 0 {
+				slog.InfoContext(ctx, "Reaped expired sessions", "count", removed)
+			}
+			return nil
+		}},
+		{"prune-rate-limits", "@every 5m", func(context.Context) error {
+			for _, limiter := range limiters {
+				limiter.Prune()
+			}
+			return nil
+		}},
+		{"rollup-analytics", "@hourly", func(context.Context) error {
+			return analytics.Maintain(db, time.Now())
+		}},
+		{"prune-audit-log", "@daily", func(ctx context.Context) error {
+			removed, err := database.PruneAuditLog(db)
+			if err != nil {
+				return err
+			}
+			if removed > 0 {
+				slog.InfoContext(ctx, "Pruned audit log entries", "count", removed, "older_than_days", int(database.AuditRetention.Hours()/24))
+			}
+			return nil
+		}},
+		{"prune-job-failures", "@daily", func(context.Context) error {
+			_, err := database.PruneJobFailures(db, time.Now().Add(-scheduler.FailureRetention))
+			return err
+		}},
+		{"backup-database", "0 3 * * *", func(ctx context.Context) error {
+			path, err := database.Backup(db, backupDir, backupsKept, time.Now())
+			if err != nil {
+				return err
+			}
+			slog.InfoContext(ctx, "Backed up the database", "path", path)
+			return nil
+		}},
+	}
+
+	for _, job := range jobs {
+		if err := sched.Add(job.name, job.spec, job.run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Package logging sets up the structured logger and carries log attributes
+// in contexts. Attributes added to a context with With, such as the ID of
+// the request being served or the name of the job being run, are added to
+// every record logged with that context, e.g. by slog.ErrorContext.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// Formats are the output formats of New
+const (
+	FormatText = "text" // key=value pairs, for reading in a terminal
+	FormatJSON = "json" // One object per line, for log collectors
+)
+
+// ctxKey is the context key of the attributes added by With
+type ctxKey struct{}
+
+// With returns a copy of ctx whose log records carry attrs as well as those
+// ctx already carries
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	return context.WithValue(ctx, ctxKey{}, append(existing[:len(existing):len(existing)], attrs...))
+}
+
+// New returns a handler writing records at level or above to w in format,
+// FormatText or FormatJSON, with the attributes of their context added
+func New(w io.Writer, format string, level slog.Level) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == FormatJSON {
+		return contextHandler{slog.NewJSONHandler(w, opts)}
+	}
+	return contextHandler{slog.NewTextHandler(w, opts)}
+}
+
+// contextHandler adds the attributes of a record's context to it
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(ctxKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -1,61 +1,225 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
-	"golang.org/x/crypto/bcrypt"
 
+	"portfolio-v2/activitypub"
+	"portfolio-v2/analytics"
+	"portfolio-v2/comments"
+	"portfolio-v2/config"
 	"portfolio-v2/database"
 	"portfolio-v2/handlers"
+	"portfolio-v2/logging"
 	"portfolio-v2/middleware"
+	"portfolio-v2/models"
+	"portfolio-v2/passkey"
 	"portfolio-v2/ratelimit"
+	"portfolio-v2/safehttp"
+	"portfolio-v2/scheduler"
 	"portfolio-v2/session"
+	"portfolio-v2/spam"
 	"portfolio-v2/templates"
+	"portfolio-v2/visitor"
+	"portfolio-v2/webhook"
+	"portfolio-v2/webmention"
 )
 
 var db *sql.DB
 
+// Server timeouts. Writes get the longest, for exports and for ActivityPub
+// inbox requests that fetch the sender's key first.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 60 * time.Second
+	idleTimeout       = 2 * time.Minute
+	shutdownTimeout   = 20 * time.Second // Time given to requests and workers to finish on shutdown
+)
+
+// forms scores what visitors send through the public forms, and stamps
+// the forms the home page renders
+var forms *spam.Checker
+
 func main() {
-	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using system environment variables")
+	// Load .env file if it exists. Whether it did is logged once the
+	// logger is set up.
+	dotenvErr := godotenv.Load()
+
+	// Subcommands run against the database and exit; flags configure the
+	// server
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1:]))
 	}
 
-	// Hash admin password on startup
-	adminUser := os.Getenv("ADMIN_USERNAME")
-	adminPass := os.Getenv("ADMIN_PASSWORD")
-	if adminUser == "" || adminPass == "" {
-		log.Fatal("ADMIN_USERNAME and ADMIN_PASSWORD must be set in .env file")
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print("\n" + commandUsage)
+		return
 	}
-	hashedPassword, err := bcrypt.GenerateFromPassword(
-		[]byte(adminPass), bcrypt.DefaultCost)
 	if err != nil {
-		log.Fatalf("Failed to hash password: %v", err)
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
 	}
 
-	// Initialize session store (no timeout - sessions persist until logout)
-	sessionStore := session.NewStore()
+	// Everything is logged through slog, including what other packages
+	// write with the log package. Records logged with a request's context
+	// carry its ID.
+	logger := slog.New(logging.New(os.Stderr, cfg.Log.Format, cfg.Log.SlogLevel()))
+	slog.SetDefault(logger)
+	if dotenvErr != nil {
+		slog.Info("No .env file found, using system environment variables")
+	}
+	slog.Info("Configuration", "config", cfg)
 
-	// Initialize rate limiter (5 attempts, 15 minute window)
-	rateLimiter := ratelimit.NewLimiter(5, 15*time.Minute)
-	go rateLimiter.Cleanup()
+	// Login attempts are limited per IP, and second-factor attempts per account
+	rateLimiter := ratelimit.NewLimiter(cfg.RateLimits.Login.Attempts, cfg.RateLimits.Login.Window)
+	mfaLimiter := ratelimit.NewLimiter(cfg.RateLimits.MFA.Attempts, cfg.RateLimits.MFA.Window)
+
+	// Received webmentions, comments, contact messages and reactions are
+	// limited per sender IP
+	webmentionLimiter := ratelimit.NewLimiter(cfg.RateLimits.Webmention.Attempts, cfg.RateLimits.Webmention.Window)
+	commentLimiter := ratelimit.NewLimiter(cfg.RateLimits.Comment.Attempts, cfg.RateLimits.Comment.Window)
+	contactLimiter := ratelimit.NewLimiter(cfg.RateLimits.Contact.Attempts, cfg.RateLimits.Contact.Window)
+	reactionLimiter := ratelimit.NewLimiter(cfg.RateLimits.Reaction.Attempts, cfg.RateLimits.Reaction.Window)
 
 	// Initialize database
-	db, err = database.InitDB("./portfolio.db")
+	db, err = database.InitDB(cfg.Database)
+	if err != nil {
+		fatal("Failed to initialize database", err)
+	}
+
+	// SIGINT and SIGTERM, e.g. from systemd, start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	// Background workers run until workersCtx is cancelled, which happens
+	// once the server has answered its last requests
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	// Public forms carry a signed stamp for the spam check, and comment
+	// authors a signed cookie to edit or delete their comments. The keys
+	// are kept in the database so both survive restarts.
+	formKey, err := database.SigningKey(db, "forms")
+	if err != nil {
+		fatal("Failed to load form signing key", err)
+	}
+	forms = spam.New(formKey)
+
+	commentKey, err := database.SigningKey(db, "comments")
+	if err != nil {
+		fatal("Failed to load comment signing key", err)
+	}
+	commentTokens := comments.NewTokens(commentKey)
+
+	// Reactions and analytics tell visitors apart by a hash with a salt
+	// that rotates daily
+	visitors := visitor.New(db)
+
+	// Page views are recorded without cookies, rolled up into daily counts
+	// once their day is over and kept for two years
+	pageViews := analytics.NewRecorder(db, visitors)
+	workers.Go(func() { pageViews.Run(workersCtx) })
+
+	// Webhook receivers, webmention sources and targets, and fediverse
+	// servers are reached with a client that refuses private addresses
+	// unless outbound_allow_private is set, which is only meant for
+	// testing against local servers
+	outbound := safehttp.NewClient(cfg.OutboundAllowPrivate)
+
+	// Webhook deliveries are queued in the database and retried with backoff
+	workers.Go(func() { webhook.Run(workersCtx, db, outbound, 15*time.Second) })
+
+	// Received webmentions are verified, and the links of published posts
+	// notified, in the background
+	workers.Go(func() { webmention.Run(workersCtx, db, outbound, 15*time.Second) })
+
+	// The blog is an ActivityPub actor that fediverse accounts can follow.
+	// Its IDs are built from site_url, so production must set it.
+	ap, err := activitypub.New(db, outbound, activitypub.Config{
+		BaseURL:  cfg.SiteURL,
+		Username: cfg.ActivityPub.Username,
+		Name:     "Michael Hegner",
+		Summary:  "Posts on Go, HTMX and full-stack development from Michael Hegner's blog.",
+	})
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("Failed to configure ActivityPub", err)
 	}
-	defer db.Close()
+	workers.Go(func() { activitypub.Run(workersCtx, ap, 15*time.Second) })
+
+	// Create the first owner from ADMIN_USERNAME/ADMIN_PASSWORD if no users exist yet
+	if err := bootstrapOwner(db, cfg.Admin); err != nil {
+		fatal("Failed to bootstrap owner", err)
+	}
+
+	// Initialize session store (persisted in SQLite, expires after 24h or 2h idle)
+	sessionStore := session.NewSQLiteStore(db, session.DefaultOptions)
+
+	// Logins waiting for a second factor (expire after 5 minutes or 5 wrong codes)
+	challenges := session.NewChallengeStore(5*time.Minute, 5)
+
+	// Passkeys are bound to the site's domain, so production must set the
+	// webauthn settings
+	wa, err := passkey.New(cfg.WebAuthn.RPID, cfg.WebAuthn.Origin)
+	if err != nil {
+		fatal("Failed to configure passkeys", err)
+	}
+	ceremonies := passkey.NewCeremonyStore(5 * time.Minute)
+
+	// Periodic upkeep runs on cron schedules, shown on /admin/jobs. The
+	// webhook, webmention and ActivityPub workers above are not jobs: they
+	// wake as soon as work is queued rather than on a schedule.
+	jobs := scheduler.New(db)
+	limiters := []*ratelimit.Limiter{rateLimiter, mfaLimiter, webmentionLimiter, commentLimiter, contactLimiter, reactionLimiter}
+	if err := registerJobs(jobs, db, sessionStore, limiters, cfg.BackupDir); err != nil {
+		fatal("Failed to schedule jobs", err)
+	}
+	workers.Go(func() { jobs.Run(workersCtx) })
 
 	// Seed database with sample projects
 	if err := database.SeedProjects(db); err != nil {
-		log.Printf("Warning: Failed to seed projects: %v", err)
+		slog.Warn("Failed to seed projects", "err", err)
+	}
+
+	// Every admin route requires a session and a role, and unsafe methods a
+	// matching CSRF token. auth checks both, and serves the login, account
+	// and security routes.
+	auth := &authRoutes{
+		db:         db,
+		sessions:   sessionStore,
+		logins:     rateLimiter,
+		mfa:        mfaLimiter,
+		challenges: challenges,
+		webAuthn:   wa,
+		ceremonies: ceremonies,
+	}
+	adminAuth := auth.adminAuth
+
+	// Content routes also accept API tokens with the matching scope, for scripts
+	// and CI. Token requests carry no cookies, so they skip the CSRF check.
+	tokenOrAdminAuth := func(scope models.Scope, next http.HandlerFunc) http.HandlerFunc {
+		withSession := adminAuth(scope.Role(), next)
+		withToken := middleware.BearerAuth(db, scope)(next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			if middleware.HasBearerToken(r) {
+				withToken(w, r)
+				return
+			}
+			withSession(w, r)
+		}
 	}
 
 	// Custom ServeMux for 404 handling
@@ -66,34 +230,39 @@ func main() {
 	mux.Handle("/static/", http.StripPrefix("/static/", fs))
 
 	// Routes
-	mux.HandleFunc("/", homeHandler)
-	mux.HandleFunc("/blog/", handlers.BlogPostViewHandler(db))
-	mux.HandleFunc("/project/", handlers.ProjectViewHandler(db))
-
-	// Authentication routes
-	mux.HandleFunc("/admin/login", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", homeHandler(cfg.Pages))
+	mux.HandleFunc("/blog/", handlers.BlogPostViewHandler(db, forms, commentTokens, visitors))
+	mux.HandleFunc("/reactions/", handlers.ReactHandler(db, visitors, reactionLimiter))
+	mux.HandleFunc("/contact", handlers.ContactHandler(db, forms, contactLimiter))
+	// Comments need no account: the browser that posted one can edit or delete it
+	mux.HandleFunc("/comments", handlers.CreateCommentHandler(db, forms, commentTokens, commentLimiter))
+	mux.HandleFunc("/comments/edit/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
-			handlers.LoginPageHandler(sessionStore)(w, r)
+			handlers.EditCommentPageHandler(db, forms, commentTokens)(w, r)
 		} else if r.Method == http.MethodPost {
-			handlers.LoginHandler(sessionStore, rateLimiter, hashedPassword, adminUser)(w, r)
+			handlers.UpdateCommentHandler(db, forms, commentTokens)(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
-	mux.HandleFunc("/admin/logout", handlers.LogoutHandler(sessionStore))
+	mux.HandleFunc("/comments/delete/", handlers.DeleteOwnCommentHandler(db, commentTokens))
+	mux.HandleFunc("/project/", handlers.ProjectViewHandler(db))
+
+	// Authentication, account and session routes
+	auth.register(mux)
 
-	// Admin routes - protected with session authentication
-	mux.HandleFunc("/admin", middleware.SessionAuth(sessionStore, true)(handlers.AdminDashboardHandler(db)))
-	mux.HandleFunc("/admin/blog/new", middleware.SessionAuth(sessionStore, true)(func(w http.ResponseWriter, r *http.Request) {
+	// Admin routes - protected with session authentication and CSRF validation
+	mux.HandleFunc("/admin", adminAuth(models.RoleViewer, handlers.AdminDashboardHandler(db)))
+	mux.HandleFunc("/admin/blog/new", tokenOrAdminAuth(models.ScopePostsWrite, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			handlers.NewBlogPageHandler(w, r)
 		} else if r.Method == http.MethodPost {
-			handlers.CreateBlogPostHandler(db)(w, r)
+			handlers.CreateBlogPostHandler(db, cfg.SiteURL)(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	}))
-	mux.HandleFunc("/admin/project/new", middleware.SessionAuth(sessionStore, true)(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/admin/project/new", tokenOrAdminAuth(models.ScopeProjectsWrite, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			handlers.NewProjectPageHandler(w, r)
 		} else if r.Method == http.MethodPost {
@@ -103,18 +272,18 @@ func main() {
 		}
 	}))
 	// Edit routes - protected with session authentication
-	mux.HandleFunc("/admin/blog/delete/", middleware.SessionAuth(sessionStore, true)(handlers.DeleteBlogHandler(db)))
-	mux.HandleFunc("/admin/blog/", middleware.SessionAuth(sessionStore, true)(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/admin/blog/delete/", tokenOrAdminAuth(models.ScopePostsWrite, handlers.DeleteBlogHandler(db)))
+	mux.HandleFunc("/admin/blog/", tokenOrAdminAuth(models.ScopePostsWrite, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			handlers.EditBlogPageHandler(db)(w, r)
 		} else if r.Method == http.MethodPost {
-			handlers.UpdateBlogHandler(db)(w, r)
+			handlers.UpdateBlogHandler(db, cfg.SiteURL)(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	}))
-	mux.HandleFunc("/admin/project/delete/", middleware.SessionAuth(sessionStore, true)(handlers.DeleteProjectHandler(db)))
-	mux.HandleFunc("/admin/project/", middleware.SessionAuth(sessionStore, true)(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/admin/project/delete/", tokenOrAdminAuth(models.ScopeProjectsWrite, handlers.DeleteProjectHandler(db)))
+	mux.HandleFunc("/admin/project/", tokenOrAdminAuth(models.ScopeProjectsWrite, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			handlers.EditProjectPageHandler(db)(w, r)
 		} else if r.Method == http.MethodPost {
@@ -123,11 +292,71 @@ func main() {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	}))
-	mux.HandleFunc("/api/blog/posts", handlers.BlogPostsAPIHandler(db))
-	mux.HandleFunc("/api/projects", handlers.ProjectsAPIHandler(db))
+	// User management routes - owners only
+	mux.HandleFunc("/admin/users", adminAuth(models.RoleOwner, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handlers.UsersPageHandler(db)(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.CreateUserHandler(db)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	mux.HandleFunc("/admin/users/delete/", adminAuth(models.RoleOwner, handlers.DeleteUserHandler(db, sessionStore)))
+	mux.HandleFunc("/admin/users/", adminAuth(models.RoleOwner, handlers.UpdateUserRoleHandler(db, sessionStore)))
+	mux.HandleFunc("/admin/audit", adminAuth(models.RoleOwner, handlers.AuditLogPageHandler(db)))
+	mux.HandleFunc("/admin/audit/export", adminAuth(models.RoleOwner, handlers.AuditExportHandler(db)))
+	mux.HandleFunc("/admin/webhooks", adminAuth(models.RoleOwner, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handlers.WebhooksPageHandler(db)(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.CreateWebhookHandler(db)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	mux.HandleFunc("/admin/webhooks/delete/", adminAuth(models.RoleOwner, handlers.DeleteWebhookHandler(db)))
+	mux.HandleFunc("/admin/webhooks/ping/", adminAuth(models.RoleOwner, handlers.PingWebhookHandler(db)))
+	mux.HandleFunc("/admin/webhooks/redeliver/", adminAuth(models.RoleOwner, handlers.RedeliverWebhookHandler(db)))
+	mux.HandleFunc("/admin/webhooks/", adminAuth(models.RoleOwner, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handlers.WebhookPageHandler(db)(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.UpdateWebhookHandler(db)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	mux.HandleFunc("/admin/jobs", adminAuth(models.RoleOwner, handlers.JobsPageHandler(db)))
+	mux.HandleFunc("/admin/jobs/run/", adminAuth(models.RoleOwner, handlers.RunJobHandler(db, jobs)))
+	mux.HandleFunc("/admin/overview", adminAuth(models.RoleViewer, handlers.AdminOverviewHandler(db)))
+	mux.HandleFunc("/admin/analytics", adminAuth(models.RoleViewer, handlers.AnalyticsPageHandler(db)))
+	mux.HandleFunc("/admin/comments", adminAuth(models.RoleEditor, handlers.CommentsPageHandler(db)))
+	mux.HandleFunc("/admin/comments/delete/", adminAuth(models.RoleEditor, handlers.DeleteCommentHandler(db)))
+	mux.HandleFunc("/admin/comments/", adminAuth(models.RoleEditor, handlers.ModerateCommentHandler(db)))
+	mux.HandleFunc("/admin/webmentions", adminAuth(models.RoleEditor, handlers.WebmentionsPageHandler(db)))
+	mux.HandleFunc("/admin/webmentions/sent", adminAuth(models.RoleEditor, handlers.OutgoingWebmentionsPageHandler(db)))
+	mux.HandleFunc("/admin/webmentions/resend/", adminAuth(models.RoleEditor, handlers.ResendWebmentionsHandler(db, cfg.SiteURL)))
+	mux.HandleFunc("/admin/webmentions/delete/", adminAuth(models.RoleEditor, handlers.DeleteWebmentionHandler(db)))
+	mux.HandleFunc("/admin/webmentions/", adminAuth(models.RoleEditor, handlers.ModerateWebmentionHandler(db)))
+	mux.HandleFunc("/admin/fediverse", adminAuth(models.RoleEditor, handlers.FediversePageHandler(db, ap)))
+	// ActivityPub lets fediverse accounts find and follow the blog
+	mux.HandleFunc("/.well-known/webfinger", handlers.WebFingerHandler(ap))
+	mux.HandleFunc("/ap/actor", handlers.ActorHandler(ap))
+	mux.HandleFunc("/ap/inbox", handlers.InboxHandler(ap))
+	mux.HandleFunc("/ap/outbox", handlers.OutboxHandler(db, ap))
+	mux.HandleFunc("/ap/followers", handlers.FollowersHandler(db, ap))
+	mux.HandleFunc("/ap/posts/", handlers.ArticleHandler(db, ap))
+	// Webmention lets other sites tell a post they link to it
+	mux.HandleFunc("/webmention", handlers.WebmentionHandler(db, webmentionLimiter))
+	// Micropub lets IndieWeb clients publish posts with an API token
+	mux.HandleFunc("/micropub", handlers.MicropubTokenFromBody(middleware.BearerAuthWithErrors(db, models.ScopePostsWrite, handlers.MicropubTokenError)(handlers.MicropubHandler(db, cfg.SiteURL))))
+	registerAPIRoutes(mux, db, cfg)
+	mux.HandleFunc("/api/v1/", handlers.APINotFoundHandler)
 
-	// Wrap mux with 404 handler
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	// Wrap mux with 404 handler, count views of the pages served, log every
+	// request if the access log is on, and give each request an ID
+	handler := pageViews.Middleware(func(w http.ResponseWriter, r *http.Request) {
 		// Create a custom ResponseWriter to capture the status code
 		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
 		mux.ServeHTTP(rw, r)
@@ -137,21 +366,87 @@ func main() {
 			handlers.NotFoundHandler(w, r)
 		}
 	})
+	if cfg.Log.Access {
+		handler = middleware.AccessLog(handler)
+	}
+	handler = middleware.RequestID(handler)
+
+	// Start server. The timeouts keep slow or idle clients from holding
+	// connections open indefinitely.
+	server := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
 
-	// Start server
-	port := "8080"
-	fmt.Printf("Server starting on http://localhost:%s\n", port)
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatal(err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	slog.Info("Server starting", "url", "http://localhost"+cfg.Addr())
+
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		slog.Error("Server failed", "err", err)
+		exitCode = 1
+	case <-ctx.Done():
+		slog.Info("Shutting down")
 	}
+	// A second signal stops the process at once
+	stop()
+
+	shutdown(server, stopWorkers, &workers)
+	os.Exit(exitCode)
+}
+
+// shutdown stops server once it has answered the requests in flight, then
+// stops the background workers and closes the database. Requests still
+// running after shutdownTimeout are cut off. Workers abandon their outbound
+// requests as soon as they are stopped, and the database is only closed
+// once every worker has returned.
+func shutdown(server *http.Server, stopWorkers context.CancelFunc, workers *sync.WaitGroup) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Failed to finish requests in flight", "err", err)
+	}
+
+	stopWorkers()
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		slog.Warn("Waiting for background workers to stop")
+		<-stopped
+	}
+
+	if err := database.Close(db); err != nil {
+		slog.Error("Failed to close database", "err", err)
+	}
+}
+
+// fatal logs err as the reason the server cannot start, and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
 
 // responseWriter wraps http.ResponseWriter to capture status code
 type responseWriter struct {
 	http.ResponseWriter
-	status       int
+	status        int
 	headerWritten bool
-	written      bool
+	written       bool
 }
 
 func (rw *responseWriter) WriteHeader(status int) {
@@ -171,26 +466,29 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
-func homeHandler(w http.ResponseWriter, r *http.Request) {
-	// Only handle exact "/" path, not catch-all
-	if r.URL.Path != "/" {
-		// Set 404 status but don't write anything - let the wrapper handle it
-		w.WriteHeader(http.StatusNotFound)
-		return
-	}
+// homeHandler renders the home page, with the first page of each feed
+func homeHandler(pages config.Pages) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Only handle exact "/" path, not catch-all
+		if r.URL.Path != "/" {
+			// Set 404 status but don't write anything - let the wrapper handle it
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-	posts, hasMore, nextPage, tags := handlers.GetInitialBlogPosts(db)
-	projects, projectsHasMore, projectsNextPage := handlers.GetInitialProjects(db)
+		posts, nextCursor, tags := handlers.GetInitialBlogPosts(r.Context(), db, pages.Posts)
+		projects, projectsNextCursor := handlers.GetInitialProjects(r.Context(), db, pages.Projects)
 
-	component := templates.Home(posts, hasMore, nextPage, tags, projects, projectsHasMore, projectsNextPage)
-	if err := component.Render(r.Context(), w); err != nil {
-		http.Error(w, "Error rendering template", http.StatusInternalServerError)
-		log.Printf("Template rendering error: %v", err)
-		return
+		component := templates.Home(posts, nextCursor, tags, projects, projectsNextCursor, forms.Stamp(time.Now()))
+		if err := component.Render(r.Context(), w); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Template rendering error", "err", err)
+			return
+		}
 	}
 }
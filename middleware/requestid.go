@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"portfolio-v2/logging"
+)
+
+// RequestIDHeader is the header carrying a request's ID, both from a proxy
+// that assigned one and back to the client
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDContextKey contextKey = "request_id"
+
+// maxRequestIDLength bounds the IDs accepted from a proxy
+const maxRequestIDLength = 64
+
+// RequestID gives every request an ID, which it sends back in the
+// X-Request-ID header and adds to the records logged with the request's
+// context. An ID a proxy already assigned is kept so both logs agree.
+func RequestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		ctx = logging.With(ctx, slog.String("request_id", id))
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// GetRequestID returns the ID RequestID gave the request
+func GetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether id is short and made only of letters,
+// digits and -_. so it cannot forge log lines or headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+)
+
+// contextKey is a custom type for context keys to avoid collisions
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// RequireRole loads the logged-in user and rejects requests from users whose
+// role does not allow the required one. It must run inside SessionAuth.
+func RequireRole(db *sql.DB, required models.Role) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			sess, ok := GetSession(r)
+			if !ok {
+				handleUnauthorized(w, r, true)
+				return
+			}
+
+			user, err := database.GetUserByUsername(db, sess.Username)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error loading user", "user", sess.Username, "err", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			// The account was deleted after the session was issued
+			if user == nil {
+				handleUnauthorized(w, r, true)
+				return
+			}
+
+			if !user.Role.Allows(required) {
+				slog.WarnContext(r.Context(), "Forbidden: role too low", "user", user.Username, "role", user.Role, "required", required, "path", r.URL.Path)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userContextKey, user)
+			next(w, r.WithContext(ctx))
+		}
+	}
+}
+
+// GetUser retrieves the logged-in user from the request context
+func GetUser(r *http.Request) (*models.User, bool) {
+	user, ok := r.Context().Value(userContextKey).(*models.User)
+	return user, ok
+}
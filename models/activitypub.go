@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Follower is a fediverse account following the blog. Deliveries go to
+// SharedInbox when the follower's server has one, so a server with many
+// followers gets each post once.
+type Follower struct {
+	ID          int64
+	Actor       string // The follower's actor ID, e.g. https://mastodon.example/users/alice
+	Inbox       string
+	SharedInbox string
+	Handle      string // @alice@mastodon.example, for display
+	CreatedAt   time.Time
+}
+
+// DeliveryInbox returns the inbox the follower's copy of an activity is
+// sent to
+func (f *Follower) DeliveryInbox() string {
+	if f.SharedInbox != "" {
+		return f.SharedInbox
+	}
+	return f.Inbox
+}
+
+// ActivityPub activities published for blog posts
+const (
+	ActivityCreate = "Create"
+	ActivityUpdate = "Update"
+	ActivityDelete = "Delete"
+)
+
+// OutboxItem is an activity about a post waiting to be sent to followers.
+// Slug is kept so a Delete can name the post after it is gone.
+type OutboxItem struct {
+	ID        int64
+	PostID    int64
+	Slug      string
+	Activity  string // One of ActivityCreate, ActivityUpdate, ActivityDelete
+	DueAt     time.Time
+	SentAt    *time.Time // When it was queued for every follower's inbox
+	CreatedAt time.Time
+}
+
+// FederationDelivery is one signed activity queued for one inbox, along
+// with the outcome of its latest attempt. It uses the Delivery* states of
+// webhook deliveries.
+type FederationDelivery struct {
+	ID             int64
+	Inbox          string
+	Activity       string // The exact JSON body sent on every attempt
+	Type           string // The activity's type, for display
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastAttemptAt  *time.Time
+	ResponseStatus int    // Zero if no response was received
+	Error          string // Why the latest attempt failed
+	CreatedAt      time.Time
+}
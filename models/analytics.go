@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Coarse device classes page views are counted under
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+)
+
+// Analytics dimensions page views are rolled up by. DimensionTotal has a
+// single value, "", holding the day's totals.
+const (
+	DimensionTotal    = "total"
+	DimensionPath     = "path"
+	DimensionReferrer = "referrer"
+	DimensionDevice   = "device"
+)
+
+// AnalyticsRanges lists the day ranges the analytics page offers
+var AnalyticsRanges = []int{7, 30, 90, 365}
+
+// PageView is one page a visitor loaded. It holds no IP address, user
+// agent or time of day: Visitor is a hash that changes daily, and
+// ReferrerHost is empty for visits from within the site or with no
+// referrer.
+type PageView struct {
+	Day          string // YYYY-MM-DD, UTC
+	Path         string
+	ReferrerHost string
+	Device       string
+	Visitor      string
+}
+
+// NotFoundHit is a request for a path that does not exist, by anyone
+// including bots
+type NotFoundHit struct {
+	Day  string // YYYY-MM-DD, UTC
+	Path string
+}
+
+// DateCount is how many of something fell on a day, or in the week or
+// month starting on it
+type DateCount struct {
+	Date  time.Time
+	Count int
+}
+
+// AnalyticsCount is how often a value of a dimension, such as a path or a
+// referrer, was seen. Visitors are counted per day, so a reader coming
+// back on another day counts again.
+type AnalyticsCount struct {
+	Value    string
+	Views    int
+	Visitors int
+}
+
+// AnalyticsDay holds the views of a day, or of the week starting on it
+type AnalyticsDay struct {
+	Day      time.Time
+	Views    int
+	Visitors int
+}
+
+// PostViews holds the views of a published blog post
+type PostViews struct {
+	PostID   int64
+	Title    string
+	Slug     string
+	Views    int
+	Visitors int
+}
+
+// AnalyticsReport is everything the analytics page shows for a range of
+// days ending today
+type AnalyticsReport struct {
+	Days      int
+	Views     int
+	Visitors  int
+	Daily     []AnalyticsDay // Oldest first, one per day of the range
+	Weekly    []AnalyticsDay // Oldest first, by the Monday starting each week
+	Pages     []AnalyticsCount
+	Referrers []AnalyticsCount
+	Devices   []AnalyticsCount
+	Posts     []PostViews // Most viewed first
+}
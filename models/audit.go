@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// Audit actions recorded in the audit log
+const (
+	AuditLogin        = "login"
+	AuditLoginFailed  = "login_failed"
+	AuditLogout       = "logout"
+	AuditCreate       = "create"
+	AuditUpdate       = "update"
+	AuditDelete       = "delete"
+	AuditRevoke       = "revoke"
+	AuditPasswordSet  = "password_change"
+	AuditTwoFactorOn  = "2fa_enable"
+	AuditTwoFactorOff = "2fa_disable"
+	AuditRun          = "run"
+)
+
+// AuditActions lists every action, in the order shown in filters
+var AuditActions = []string{
+	AuditLogin, AuditLoginFailed, AuditLogout,
+	AuditCreate, AuditUpdate, AuditDelete, AuditRevoke,
+	AuditPasswordSet, AuditTwoFactorOn, AuditTwoFactorOff, AuditRun,
+}
+
+// Kinds of object an audit entry can target
+const (
+	AuditTargetBlogPost = "blog_post"
+	AuditTargetProject  = "project"
+	AuditTargetUser     = "user"
+	AuditTargetPasskey  = "passkey"
+	AuditTargetSession  = "session"
+	AuditTargetToken    = "api_token"
+	AuditTargetWebhook  = "webhook"
+	AuditTargetMention  = "webmention"
+	AuditTargetComment  = "comment"
+	AuditTargetJob      = "job"
+)
+
+// AuditTargetTypes lists every target type, in the order shown in filters
+var AuditTargetTypes = []string{
+	AuditTargetBlogPost, AuditTargetProject, AuditTargetUser, AuditTargetPasskey, AuditTargetSession, AuditTargetToken, AuditTargetWebhook, AuditTargetMention, AuditTargetComment, AuditTargetJob,
+}
+
+// AuditEntry is one append-only record of an admin or authentication event.
+// Before and After hold JSON snapshots of the target and are empty when not
+// applicable, e.g. Before on create.
+type AuditEntry struct {
+	ID         int64
+	CreatedAt  time.Time
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	IP         string
+	UserAgent  string
+	Before     string
+	After      string
+}
+
+// AuditFilter narrows an audit log query; zero fields match everything
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	Since      time.Time
+	Until      time.Time
+}
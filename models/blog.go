@@ -4,22 +4,33 @@ import "time"
 
 // BlogPost represents a blog post in the database
 type BlogPost struct {
-	ID          int64
-	Title       string
-	Slug        string
-	Excerpt     string
-	Content     string
-	PublishedAt time.Time
-	Tags        []string
-	Author      string
+	ID          int64     `json:"id"`
+	Title       string    `json:"title"`
+	Slug        string    `json:"slug"`
+	Excerpt     string    `json:"excerpt"`
+	Content     string    `json:"content"`
+	PublishedAt time.Time `json:"published_at"`
+	Tags        []string  `json:"tags"`
+	Author      string    `json:"author"`
 }
 
 // BlogPostPreview is a lightweight version for list views
 type BlogPostPreview struct {
-	ID          int64
-	Title       string
-	Slug        string
-	Excerpt     string
-	PublishedAt time.Time
-	Tags        []string
+	ID          int64     `json:"id"`
+	Title       string    `json:"title"`
+	Slug        string    `json:"slug"`
+	Excerpt     string    `json:"excerpt"`
+	PublishedAt time.Time `json:"published_at"`
+	Tags        []string  `json:"tags"`
 }
+
+// BlogPostFilter narrows a blog post listing; zero fields match everything
+type BlogPostFilter struct {
+	Tag    string
+	Search string // Matched against title, excerpt and content
+	Sort   string // One of BlogPostSorts; empty means newest first
+}
+
+// BlogPostSorts lists the accepted BlogPostFilter.Sort values. A leading
+// "-" sorts descending.
+var BlogPostSorts = []string{"-published_at", "published_at", "title", "-title"}
@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// Comment moderation states. Every comment waits for review; those the
+// spam check flags wait in their own queue.
+const (
+	CommentPending  = "pending"  // Waiting for review
+	CommentApproved = "approved" // Shown under the post
+	CommentRejected = "rejected" // Hidden by a moderator
+	CommentSpam     = "spam"     // Flagged by the spam check or a moderator
+)
+
+// CommentStatuses lists every state, in the order shown as moderation tabs
+var CommentStatuses = []string{CommentPending, CommentSpam, CommentApproved, CommentRejected}
+
+// ValidCommentStatus reports whether status is a known comment state
+func ValidCommentStatus(status string) bool {
+	for _, s := range CommentStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Comment is a reader's comment on a blog post. Comments are threaded one
+// level deep: a reply's ParentID is always a top-level comment. Body is
+// Markdown as the reader wrote it and is only rendered through the comment
+// allowlist.
+type Comment struct {
+	ID          int64
+	PostID      int64
+	PostSlug    string
+	ParentID    int64 // Zero for a top-level comment
+	AuthorName  string
+	AuthorURL   string // Optional website
+	Body        string
+	Status      string
+	SpamScore   int
+	SpamReasons string // Why the spam check scored it, for moderators
+	IPAddress   string
+	UserAgent   string
+	CreatedAt   time.Time
+	EditedAt    *time.Time
+
+	// Replies holds the visible replies to a top-level comment, oldest
+	// first, when loaded as a thread
+	Replies []Comment
+}
+
+// Visible reports whether the comment is shown to every reader
+func (c *Comment) Visible() bool {
+	return c.Status == CommentApproved
+}
+
+// ThreadComments nests replies under their parents. comments must be in
+// display order; replies whose parent is not among them are dropped.
+func ThreadComments(comments []Comment) []Comment {
+	var threads []Comment
+	index := map[int64]int{}
+	for _, c := range comments {
+		if c.ParentID == 0 {
+			index[c.ID] = len(threads)
+			threads = append(threads, c)
+		}
+	}
+
+	for _, c := range comments {
+		if c.ParentID == 0 {
+			continue
+		}
+		if i, ok := index[c.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, c)
+		}
+	}
+
+	return threads
+}
@@ -4,11 +4,11 @@ import "time"
 
 // ContactSubmission represents a contact form submission
 type ContactSubmission struct {
-	ID          int64
-	Name        string
-	Email       string
-	Message     string
-	SubmittedAt time.Time
-	IPAddress   string
-	UserAgent   string
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Message     string    `json:"message"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	IPAddress   string    `json:"ip_address,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
 }
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// States of a background job's last run
+const (
+	JobRunning  = "running"
+	JobOK       = "ok"
+	JobFailed   = "failed"
+	JobPanicked = "panicked"
+)
+
+// Job is a named background job run on a cron schedule, with the outcome
+// of its last run. Status is "" until it first runs.
+type Job struct {
+	Name           string
+	Spec           string
+	Status         string
+	LastStartedAt  *time.Time
+	LastFinishedAt *time.Time
+	LastDuration   time.Duration
+	LastError      string
+	NextRunAt      *time.Time
+	Runs           int
+	Failures       int
+}
+
+// JobFailure is a run of a job that returned an error or panicked. Error
+// holds the panic's stack trace too.
+type JobFailure struct {
+	ID         int64
+	Job        string
+	Status     string
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
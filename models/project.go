@@ -4,13 +4,25 @@ import "time"
 
 // Project represents a project in the database
 type Project struct {
-	ID          int64
-	Title       string
-	Slug        string
-	Description string
-	Technologies []string
-	GithubURL   string
-	ImageURL    string
-	Featured    bool
-	CreatedAt   time.Time
+	ID           int64     `json:"id"`
+	Title        string    `json:"title"`
+	Slug         string    `json:"slug"`
+	Description  string    `json:"description"`
+	Technologies []string  `json:"technologies"`
+	GithubURL    string    `json:"github_url"`
+	ImageURL     string    `json:"image_url"`
+	Featured     bool      `json:"featured"`
+	CreatedAt    time.Time `json:"created_at"`
 }
+
+// ProjectFilter narrows a project listing; zero fields match everything
+type ProjectFilter struct {
+	Technology string
+	Featured   *bool  // Nil matches featured and other projects
+	Search     string // Matched against title and description
+	Sort       string // One of ProjectSorts; empty means featured first, then newest
+}
+
+// ProjectSorts lists the accepted ProjectFilter.Sort values. A leading "-"
+// sorts descending.
+var ProjectSorts = []string{"-featured", "-created_at", "created_at", "title", "-title"}
@@ -0,0 +1,34 @@
+package models
+
+// ReactionKind is a quick reaction readers can leave on a blog post
+type ReactionKind string
+
+const (
+	ReactionUseful     ReactionKind = "useful"
+	ReactionInsightful ReactionKind = "insightful"
+)
+
+// ReactionKinds lists every reaction, in the order shown on posts
+var ReactionKinds = []ReactionKind{ReactionUseful, ReactionInsightful}
+
+// Valid reports whether k is a known reaction
+func (k ReactionKind) Valid() bool {
+	for _, kind := range ReactionKinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// ReactionCounts holds how many visitors left each reaction
+type ReactionCounts map[ReactionKind]int
+
+// Total returns the number of reactions of every kind
+func (c ReactionCounts) Total() int {
+	total := 0
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
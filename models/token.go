@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Scope limits what an API token may do
+type Scope string
+
+const (
+	ScopePostsWrite    Scope = "posts:write"    // Create, edit and delete blog posts
+	ScopeProjectsWrite Scope = "projects:write" // Create, edit and delete projects
+	ScopeMessagesRead  Scope = "messages:read"  // Read contact form submissions
+)
+
+// Scopes lists every scope, in the order shown when minting a token
+var Scopes = []Scope{ScopePostsWrite, ScopeProjectsWrite, ScopeMessagesRead}
+
+// Valid reports whether s is a known scope
+func (s Scope) Valid() bool {
+	return s.Role() != ""
+}
+
+// Role returns the least privileged role allowed to use s. A token never
+// grants more than its owner's current role.
+func (s Scope) Role() Role {
+	switch s {
+	case ScopePostsWrite, ScopeProjectsWrite:
+		return RoleEditor
+	case ScopeMessagesRead:
+		// Contact submissions hold visitors' personal details
+		return RoleOwner
+	}
+	return ""
+}
+
+// APIToken is a personal access token for scripted use of the admin API.
+// Only a hash of the token is stored; Prefix is kept so it can be recognised.
+type APIToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Prefix     string
+	Scopes     []Scope
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time // Nil for tokens that never expire
+	LastUsedAt *time.Time
+}
+
+// HasScope reports whether the token was granted scope
+func (t *APIToken) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the token has passed its expiry at now
+func (t *APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Role controls what an admin user is allowed to do
+type Role string
+
+const (
+	RoleOwner  Role = "owner"  // Full access, including user management
+	RoleEditor Role = "editor" // Can create, edit and delete content
+	RoleViewer Role = "viewer" // Read-only access to the admin area
+)
+
+// Roles lists every role from most to least privileged
+var Roles = []Role{RoleOwner, RoleEditor, RoleViewer}
+
+// rank orders roles so higher values grant more access
+func (r Role) rank() int {
+	switch r {
+	case RoleOwner:
+		return 3
+	case RoleEditor:
+		return 2
+	case RoleViewer:
+		return 1
+	}
+	return 0
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	return r.rank() > 0
+}
+
+// Allows reports whether a user with role r may act with the required role
+func (r Role) Allows(required Role) bool {
+	return r.Valid() && r.rank() >= required.rank()
+}
+
+// User represents an admin user in the database
+type User struct {
+	ID           int64
+	Username     string
+	DisplayName  string
+	PasswordHash string
+	Role         Role
+	CreatedAt    time.Time
+	TOTPSecret   string // Base32 secret; set but not enabled while enrollment is pending
+	TOTPEnabled  bool
+	TOTPLastStep int64 // Last accepted TOTP time step, to reject replayed codes
+}
+
+// Name returns the name shown as a post's author
+func (u *User) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
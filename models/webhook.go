@@ -0,0 +1,92 @@
+package models
+
+import "time"
+
+// WebhookEvent names a content lifecycle event that webhooks can subscribe to
+type WebhookEvent string
+
+const (
+	EventPostPublished   WebhookEvent = "post.published"
+	EventPostUpdated     WebhookEvent = "post.updated"
+	EventPostDeleted     WebhookEvent = "post.deleted"
+	EventProjectCreated  WebhookEvent = "project.created"
+	EventProjectUpdated  WebhookEvent = "project.updated"
+	EventProjectDeleted  WebhookEvent = "project.deleted"
+	EventContactReceived WebhookEvent = "contact.received"
+
+	// EventPing is sent by the "Send test" button to every webhook,
+	// whatever it subscribes to
+	EventPing WebhookEvent = "ping"
+)
+
+// WebhookEvents lists every subscribable event, in the order shown in forms
+var WebhookEvents = []WebhookEvent{
+	EventPostPublished, EventPostUpdated, EventPostDeleted,
+	EventProjectCreated, EventProjectUpdated, EventProjectDeleted,
+	EventContactReceived,
+}
+
+// Valid reports whether e is a subscribable event
+func (e WebhookEvent) Valid() bool {
+	for _, event := range WebhookEvents {
+		if event == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook is a subscription that POSTs signed JSON payloads to URL when one
+// of Events happens. Secret is kept in clear because every delivery is
+// signed with it.
+type Webhook struct {
+	ID          int64
+	URL         string
+	Description string
+	Secret      string
+	Events      []WebhookEvent
+	Active      bool
+	CreatedAt   time.Time
+}
+
+// Subscribes reports whether the webhook should receive event. Inactive
+// webhooks receive nothing.
+func (w *Webhook) Subscribes(event WebhookEvent) bool {
+	if !w.Active {
+		return false
+	}
+	if event == EventPing {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"   // Waiting for its first or next attempt
+	DeliveryDelivered = "delivered" // The receiver answered with a 2xx status
+	DeliveryFailed    = "failed"    // Every attempt failed; no more retries
+)
+
+// WebhookDelivery is one event queued for one webhook, along with the
+// outcome of its latest attempt. Payload is the exact body sent on every
+// attempt.
+type WebhookDelivery struct {
+	ID             int64
+	WebhookID      int64
+	Event          WebhookEvent
+	Payload        string
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastAttemptAt  *time.Time
+	ResponseStatus int    // Zero if no response was received
+	ResponseBody   string // Start of the latest response, for debugging
+	Error          string // Why the latest attempt failed
+	CreatedAt      time.Time
+}
@@ -0,0 +1,120 @@
+package models
+
+import "time"
+
+// Webmention verification states
+const (
+	MentionPending  = "pending"  // Received, waiting for the source to be fetched
+	MentionVerified = "verified" // The source links to the target
+	MentionInvalid  = "invalid"  // The source could not be fetched or no longer links to the target
+)
+
+// Webmention moderation decisions. Only verified, approved mentions are shown.
+const (
+	ModerationNone     = ""         // Waiting for review
+	ModerationApproved = "approved" // Shown under the post
+	ModerationRejected = "rejected" // Hidden, and stays hidden if the source sends it again
+)
+
+// MentionType is how a source responds to a post, read from the
+// microformats2 properties of its h-entry
+type MentionType string
+
+const (
+	MentionLike     MentionType = "like"     // u-like-of
+	MentionReply    MentionType = "reply"    // u-in-reply-to
+	MentionRepost   MentionType = "repost"   // u-repost-of
+	MentionBookmark MentionType = "bookmark" // u-bookmark-of
+	MentionMention  MentionType = "mention"  // Any other link to the post
+)
+
+// Webmention is a notification that Source links to Target, one of this
+// site's blog posts. The author and content fields are parsed from Source
+// when it is verified and are empty until then.
+type Webmention struct {
+	ID          int64
+	PostID      int64
+	Source      string
+	Target      string
+	Status      string
+	Moderation  string
+	Type        MentionType
+	AuthorName  string
+	AuthorURL   string
+	AuthorPhoto string
+	Content     string // Plain text, shortened
+	URL         string // The entry's u-url, or Source if it has none
+	PublishedAt *time.Time
+	Error       string // Why verification failed
+	CreatedAt   time.Time
+	VerifiedAt  *time.Time
+}
+
+// Visible reports whether the mention is shown under its post
+func (m *Webmention) Visible() bool {
+	return m.Status == MentionVerified && m.Moderation == ModerationApproved
+}
+
+// WebmentionQueue is a tab of the moderation page
+type WebmentionQueue string
+
+const (
+	QueueReview     WebmentionQueue = "review"     // Verified and waiting for a decision
+	QueueApproved   WebmentionQueue = "approved"   // Shown under their posts
+	QueueRejected   WebmentionQueue = "rejected"   // Hidden by a moderator
+	QueueUnverified WebmentionQueue = "unverified" // Pending verification or failed it
+)
+
+// WebmentionQueues lists every queue, in the order shown as tabs
+var WebmentionQueues = []WebmentionQueue{QueueReview, QueueApproved, QueueRejected, QueueUnverified}
+
+// Valid reports whether q is a known queue
+func (q WebmentionQueue) Valid() bool {
+	for _, queue := range WebmentionQueues {
+		if queue == q {
+			return true
+		}
+	}
+	return false
+}
+
+// Outgoing webmention results
+const (
+	SendSent        = "sent"        // The endpoint accepted the notification
+	SendFailed      = "failed"      // Discovery or sending failed
+	SendUnsupported = "unsupported" // The target advertises no endpoint
+)
+
+// Protocols an outgoing notification can be sent with
+const (
+	ProtocolWebmention = "webmention"
+	ProtocolPingback   = "pingback"
+)
+
+// WebmentionSend is a queued request to notify the sites a post links to.
+// Source is the post's public URL, captured when it was queued. Generation
+// changes each time the post is queued again, so a send that was running
+// while the post was edited does not dequeue the newer request.
+type WebmentionSend struct {
+	PostID     int64
+	Source     string
+	DueAt      time.Time
+	Generation int64
+}
+
+// OutgoingWebmention is the latest result of notifying Target that a post
+// links to it. Linked is false once the post no longer links to Target;
+// the target is notified of the removal once, then left alone.
+type OutgoingWebmention struct {
+	ID             int64
+	PostID         int64
+	PostSlug       string
+	Target         string
+	Linked         bool
+	Protocol       string // Empty if no endpoint was found
+	Endpoint       string
+	Status         string
+	ResponseStatus int // Zero if no response was received
+	Error          string
+	SentAt         time.Time
+}
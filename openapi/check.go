@@ -0,0 +1,260 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// probeSlug fills path parameters when probing; no resource has this slug
+const probeSlug = "openapi-check-missing"
+
+// Routes is a ServeMux that records the patterns registered on it, so the
+// routes can be compared with a Document
+type Routes struct {
+	*http.ServeMux
+	Patterns []string
+}
+
+// NewRoutes returns an empty Routes
+func NewRoutes() *Routes {
+	return &Routes{ServeMux: http.NewServeMux()}
+}
+
+// HandleFunc registers handler for pattern and records the pattern
+func (r *Routes) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	r.Patterns = append(r.Patterns, pattern)
+	r.ServeMux.HandleFunc(pattern, handler)
+}
+
+// Check reports where doc and the handlers registered on routes disagree:
+// routes without a documented path and the reverse, documented methods the
+// handler rejects, undocumented methods it accepts, statuses missing from
+// the documented responses, and JSON bodies that do not match their schema.
+// Every operation is probed once without credentials, with path parameters
+// naming a missing resource, so checking does not modify any data.
+func Check(doc *Document, routes *Routes) []error {
+	var errs []error
+
+	documented := map[string]string{} // route pattern -> documented path
+	for path := range doc.Paths {
+		documented[routePattern(path)] = path
+	}
+
+	registered := map[string]bool{}
+	for _, pattern := range routes.Patterns {
+		registered[pattern] = true
+		if _, ok := documented[pattern]; !ok {
+			errs = append(errs, fmt.Errorf("route %s is not documented", pattern))
+		}
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if !registered[routePattern(path)] {
+			errs = append(errs, fmt.Errorf("documented path %s has no route", path))
+			continue
+		}
+
+		item := doc.Paths[path]
+		for _, method := range Methods {
+			errs = append(errs, checkOperation(doc, routes, path, method, item.Operation(method))...)
+		}
+	}
+
+	return errs
+}
+
+// checkOperation probes one method on path, where op is its documentation
+// or nil if the method is not documented
+func checkOperation(doc *Document, routes *Routes, path, method string, op *Operation) []error {
+	var body *strings.Reader
+	if method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
+		body = strings.NewReader("{}")
+	} else {
+		body = strings.NewReader("")
+	}
+
+	req := httptest.NewRequest(method, probePath(path), body)
+	req.Header.Set("Content-Type", jsonType)
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+
+	status := rec.Code
+	name := method + " " + path
+
+	if op == nil {
+		if status != http.StatusMethodNotAllowed {
+			return []error{fmt.Errorf("%s is not documented but returned %d", name, status)}
+		}
+		return nil
+	}
+
+	if status == http.StatusMethodNotAllowed {
+		return []error{fmt.Errorf("%s is documented but the handler rejects the method", name)}
+	}
+
+	response, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return []error{fmt.Errorf("%s returned undocumented status %d", name, status)}
+	}
+
+	if len(response.Content) == 0 {
+		if rec.Body.Len() > 0 {
+			return []error{fmt.Errorf("%s returned a body for %d, which documents none", name, status)}
+		}
+		return nil
+	}
+
+	contentType, _, _ := strings.Cut(rec.Header().Get("Content-Type"), ";")
+	media, ok := response.Content[contentType]
+	if !ok {
+		return []error{fmt.Errorf("%s returned undocumented content type %q for %d", name, contentType, status)}
+	}
+
+	if contentType != jsonType {
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal(rec.Body.Bytes(), &value); err != nil {
+		return []error{fmt.Errorf("%s returned invalid JSON for %d: %v", name, status, err)}
+	}
+
+	var errs []error
+	for _, problem := range validate(doc, media.Schema, value, "body") {
+		errs = append(errs, fmt.Errorf("%s %d: %s", name, status, problem))
+	}
+	return errs
+}
+
+// routePattern returns the ServeMux pattern that serves a documented path:
+// a trailing path parameter is served by a subtree pattern
+func routePattern(path string) string {
+	if prefix, _, ok := strings.Cut(path, "{"); ok {
+		return prefix
+	}
+	return path
+}
+
+// probePath fills the path parameters of a documented path
+func probePath(path string) string {
+	for {
+		start := strings.Index(path, "{")
+		end := strings.Index(path, "}")
+		if start < 0 || end < start {
+			return path
+		}
+		path = path[:start] + probeSlug + path[end+1:]
+	}
+}
+
+// validate returns a message for each way value does not match schema
+func validate(doc *Document, schema *Schema, value any, at string) []string {
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		resolved, ok := doc.Components.Schemas[name]
+		if !ok {
+			return []string{at + ": unknown schema " + schema.Ref}
+		}
+		schema = resolved
+	}
+
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return []string{at + ": is null"}
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return []string{at + ": is not an object"}
+		}
+		return validateObject(doc, schema, object, at)
+
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return []string{at + ": is not an array"}
+		}
+		var problems []string
+		for i, item := range array {
+			problems = append(problems, validate(doc, schema.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+		return problems
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{at + ": is not a string"}
+		}
+		if len(schema.Enum) > 0 && !contains(schema.Enum, s) {
+			return []string{fmt.Sprintf("%s: %q is not one of %v", at, s, schema.Enum)}
+		}
+
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return []string{at + ": is not an integer"}
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{at + ": is not a boolean"}
+		}
+	}
+
+	return nil
+}
+
+func validateObject(doc *Document, schema *Schema, object map[string]any, at string) []string {
+	var problems []string
+
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			problems = append(problems, at+": missing required property "+name)
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := schema.Properties[name]
+		switch {
+		case ok:
+			problems = append(problems, validate(doc, property, object[name], at+"."+name)...)
+		case schema.AdditionalProperties != nil:
+			problems = append(problems, validate(doc, schema.AdditionalProperties, object[name], at+"."+name)...)
+		case schema.Closed:
+			problems = append(problems, at+": undocumented property "+name)
+		}
+	}
+
+	return problems
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
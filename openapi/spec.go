@@ -0,0 +1,506 @@
+package openapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"portfolio-v2/models"
+)
+
+const (
+	jsonType = "application/json"
+	htmlType = "text/html"
+
+	bearerScheme = "bearerAuth"
+)
+
+// Spec builds the document describing every /api endpoint
+func Spec() *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:   "Portfolio API",
+			Version: "1.0.0",
+			Description: "Read endpoints are public. Writes and messages need an API token, " +
+				"minted at /admin/account/tokens, sent as `Authorization: Bearer <token>`. " +
+				"Errors are returned as `{\"error\": {...}}` objects.",
+		},
+		Tags: []Tag{
+			{Name: "posts", Description: "Blog posts"},
+			{Name: "projects", Description: "Portfolio projects"},
+			{Name: "messages", Description: "Contact form submissions"},
+			{Name: "feeds", Description: "HTML fragments for the home page's HTMX feeds"},
+			{Name: "meta", Description: "This document and its docs page"},
+		},
+		Paths: map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{
+				"BlogPost":          SchemaFor(models.BlogPost{}),
+				"Project":           SchemaFor(models.Project{}),
+				"ContactSubmission": SchemaFor(models.ContactSubmission{}),
+				"BlogPostInput":     blogPostInputSchema(),
+				"ProjectInput":      projectInputSchema(),
+				"Pagination":        paginationSchema(),
+				"Error":             errorSchema(),
+			},
+			SecuritySchemes: map[string]*SecurityScheme{
+				bearerScheme: {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "pfv2_ API token",
+					Description: "A token scoped to one or more of: " + scopeList() +
+						". The token's owner must also still hold the role each scope needs.",
+				},
+			},
+		},
+	}
+
+	addPostPaths(doc)
+	addProjectPaths(doc)
+	addMessagePaths(doc)
+	addFeedPaths(doc)
+	addMetaPaths(doc)
+
+	return doc
+}
+
+func addPostPaths(doc *Document) {
+	doc.Paths["/api/v1/posts"] = &PathItem{
+		Get: &Operation{
+			OperationID: "listPosts",
+			Summary:     "List published blog posts",
+			Tags:        []string{"posts"},
+			Parameters: append([]Parameter{
+				query("tag", "Only posts with this tag", stringSchema()),
+				query("q", "Search titles, excerpts and content", stringSchema()),
+				query("sort", "Sort order; a leading - sorts descending", enumSchema(models.BlogPostSorts)),
+			}, paginationParams()...),
+			Responses: responses(
+				listResponse("BlogPost"),
+				errorResponse(http.StatusUnprocessableEntity, "Invalid query parameters"),
+			),
+		},
+		Post: &Operation{
+			OperationID: "createPost",
+			Summary:     "Create a blog post",
+			Description: "The post is credited to the token's owner and published immediately.",
+			Tags:        []string{"posts"},
+			RequestBody: jsonBody("BlogPostInput"),
+			Responses: responses(
+				createdResponse("BlogPost"),
+				writeErrors(models.ScopePostsWrite, false),
+				errorResponse(http.StatusConflict, "A post with this title already exists"),
+			),
+			Security: requireScope(models.ScopePostsWrite),
+		},
+	}
+
+	doc.Paths["/api/v1/posts/{slug}"] = &PathItem{
+		Parameters: []Parameter{slugParam("post")},
+		Get: &Operation{
+			OperationID: "getPost",
+			Summary:     "Get a published blog post",
+			Tags:        []string{"posts"},
+			Responses: responses(
+				itemResponse(http.StatusOK, "The post", "BlogPost"),
+				errorResponse(http.StatusNotFound, "No such post"),
+			),
+		},
+		Put: &Operation{
+			OperationID: "replacePost",
+			Summary:     "Replace a blog post",
+			Description: "Omitted fields are cleared, so all required fields must be sent.",
+			Tags:        []string{"posts"},
+			RequestBody: jsonBody("BlogPostInput"),
+			Responses: responses(
+				itemResponse(http.StatusOK, "The updated post", "BlogPost"),
+				writeErrors(models.ScopePostsWrite, true),
+			),
+			Security: requireScope(models.ScopePostsWrite),
+		},
+		Patch: &Operation{
+			OperationID: "updatePost",
+			Summary:     "Update some fields of a blog post",
+			Description: "Omitted fields keep their current values.",
+			Tags:        []string{"posts"},
+			RequestBody: jsonBody("BlogPostInput"),
+			Responses: responses(
+				itemResponse(http.StatusOK, "The updated post", "BlogPost"),
+				writeErrors(models.ScopePostsWrite, true),
+			),
+			Security: requireScope(models.ScopePostsWrite),
+		},
+		Delete: &Operation{
+			OperationID: "deletePost",
+			Summary:     "Delete a blog post",
+			Tags:        []string{"posts"},
+			Responses: responses(
+				map[string]*Response{"204": {Description: "The post was deleted"}},
+				authErrors(models.ScopePostsWrite),
+				errorResponse(http.StatusNotFound, "No such post"),
+			),
+			Security: requireScope(models.ScopePostsWrite),
+		},
+	}
+}
+
+func addProjectPaths(doc *Document) {
+	doc.Paths["/api/v1/projects"] = &PathItem{
+		Get: &Operation{
+			OperationID: "listProjects",
+			Summary:     "List projects",
+			Tags:        []string{"projects"},
+			Parameters: append([]Parameter{
+				query("technology", "Only projects using this technology", stringSchema()),
+				query("featured", "Only featured (true) or other (false) projects", &Schema{Type: "boolean"}),
+				query("q", "Search titles and descriptions", stringSchema()),
+				query("sort", "Sort order; a leading - sorts descending. Defaults to featured first, then newest.", enumSchema(models.ProjectSorts)),
+			}, paginationParams()...),
+			Responses: responses(
+				listResponse("Project"),
+				errorResponse(http.StatusUnprocessableEntity, "Invalid query parameters"),
+			),
+		},
+		Post: &Operation{
+			OperationID: "createProject",
+			Summary:     "Create a project",
+			Tags:        []string{"projects"},
+			RequestBody: jsonBody("ProjectInput"),
+			Responses: responses(
+				createdResponse("Project"),
+				writeErrors(models.ScopeProjectsWrite, false),
+				errorResponse(http.StatusConflict, "A project with this slug already exists"),
+			),
+			Security: requireScope(models.ScopeProjectsWrite),
+		},
+	}
+
+	doc.Paths["/api/v1/projects/{slug}"] = &PathItem{
+		Parameters: []Parameter{slugParam("project")},
+		Get: &Operation{
+			OperationID: "getProject",
+			Summary:     "Get a project",
+			Tags:        []string{"projects"},
+			Responses: responses(
+				itemResponse(http.StatusOK, "The project", "Project"),
+				errorResponse(http.StatusNotFound, "No such project"),
+			),
+		},
+		Put: &Operation{
+			OperationID: "replaceProject",
+			Summary:     "Replace a project",
+			Description: "Omitted fields are cleared. The slug cannot be changed; if sent it must match the path.",
+			Tags:        []string{"projects"},
+			RequestBody: jsonBody("ProjectInput"),
+			Responses: responses(
+				itemResponse(http.StatusOK, "The updated project", "Project"),
+				writeErrors(models.ScopeProjectsWrite, true),
+			),
+			Security: requireScope(models.ScopeProjectsWrite),
+		},
+		Patch: &Operation{
+			OperationID: "updateProject",
+			Summary:     "Update some fields of a project",
+			Description: "Omitted fields keep their current values. The slug cannot be changed.",
+			Tags:        []string{"projects"},
+			RequestBody: jsonBody("ProjectInput"),
+			Responses: responses(
+				itemResponse(http.StatusOK, "The updated project", "Project"),
+				writeErrors(models.ScopeProjectsWrite, true),
+			),
+			Security: requireScope(models.ScopeProjectsWrite),
+		},
+		Delete: &Operation{
+			OperationID: "deleteProject",
+			Summary:     "Delete a project",
+			Tags:        []string{"projects"},
+			Responses: responses(
+				map[string]*Response{"204": {Description: "The project was deleted"}},
+				authErrors(models.ScopeProjectsWrite),
+				errorResponse(http.StatusNotFound, "No such project"),
+			),
+			Security: requireScope(models.ScopeProjectsWrite),
+		},
+	}
+}
+
+func addMessagePaths(doc *Document) {
+	doc.Paths["/api/v1/messages"] = &PathItem{
+		Get: &Operation{
+			OperationID: "listMessages",
+			Summary:     "List contact form submissions, newest first",
+			Tags:        []string{"messages"},
+			Parameters:  paginationParams(),
+			Responses: responses(
+				listResponse("ContactSubmission"),
+				authErrors(models.ScopeMessagesRead),
+				errorResponse(http.StatusUnprocessableEntity, "Invalid query parameters"),
+			),
+			Security: requireScope(models.ScopeMessagesRead),
+		},
+	}
+}
+
+func addFeedPaths(doc *Document) {
+	doc.Paths["/api/blog/posts"] = &PathItem{
+		Get: &Operation{
+			OperationID: "blogPostFeed",
+			Summary:     "Next page of the home page's blog post feed",
+			Description: "Returns an HTML fragment for HTMX, not JSON.",
+			Tags:        []string{"feeds"},
+			Parameters: []Parameter{
+				cursorParam(),
+				query("tag", "Only posts with this tag", stringSchema()),
+			},
+			Responses: map[string]*Response{
+				"200": htmlResponse("Blog post cards and, if there are more, a load-more trigger"),
+				"400": {Description: "The cursor is invalid", Content: map[string]MediaType{"text/plain": {Schema: stringSchema()}}},
+			},
+		},
+	}
+
+	doc.Paths["/api/projects"] = &PathItem{
+		Get: &Operation{
+			OperationID: "projectFeed",
+			Summary:     "Next page of the home page's project feed",
+			Description: "Returns an HTML fragment for HTMX, not JSON.",
+			Tags:        []string{"feeds"},
+			Parameters: []Parameter{
+				cursorParam(),
+			},
+			Responses: map[string]*Response{
+				"200": htmlResponse("Project cards and, if there are more, a load-more trigger"),
+				"400": {Description: "The cursor is invalid", Content: map[string]MediaType{"text/plain": {Schema: stringSchema()}}},
+			},
+		},
+	}
+}
+
+func addMetaPaths(doc *Document) {
+	doc.Paths["/api/openapi.json"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getOpenAPI",
+			Summary:     "This OpenAPI document",
+			Tags:        []string{"meta"},
+			Responses: map[string]*Response{"200": {
+				Description: "The OpenAPI 3.1 document",
+				Content:     map[string]MediaType{jsonType: {Schema: &Schema{Type: "object"}}},
+			}},
+		},
+	}
+
+	doc.Paths["/api/docs"] = &PathItem{
+		Get: &Operation{
+			OperationID: "getDocs",
+			Summary:     "Human readable API documentation",
+			Tags:        []string{"meta"},
+			Responses:   map[string]*Response{"200": htmlResponse("The docs page")},
+		},
+	}
+}
+
+// Component schemas that have no model to reflect
+
+func blogPostInputSchema() *Schema {
+	return &Schema{
+		Type:        "object",
+		Description: "title, excerpt and content are required when creating or replacing a post",
+		Closed:      true,
+		Properties: map[string]*Schema{
+			"title":   {Type: "string", MaxLength: intPtr(200)},
+			"excerpt": {Type: "string", MaxLength: intPtr(500)},
+			"content": {Type: "string", Description: "Markdown"},
+			"tags":    {Type: "array", MaxItems: intPtr(20), Items: &Schema{Type: "string", MaxLength: intPtr(50)}},
+		},
+	}
+}
+
+func projectInputSchema() *Schema {
+	return &Schema{
+		Type:        "object",
+		Description: "title, slug, description and image_url are required when creating a project",
+		Closed:      true,
+		Properties: map[string]*Schema{
+			"title":        {Type: "string", MaxLength: intPtr(200)},
+			"slug":         {Type: "string", Pattern: "^[a-z0-9]+(-[a-z0-9]+)*$"},
+			"description":  {Type: "string"},
+			"technologies": {Type: "array", MaxItems: intPtr(20), Items: &Schema{Type: "string"}},
+			"github_url":   {Type: "string", Format: "uri"},
+			"image_url":    {Type: "string", Description: "An absolute path on this site or an http(s) URL"},
+			"featured":     {Type: "boolean"},
+		},
+	}
+}
+
+func paginationSchema() *Schema {
+	return &Schema{
+		Type:     "object",
+		Closed:   true,
+		Required: []string{"per_page", "has_more"},
+		Properties: map[string]*Schema{
+			"per_page":    {Type: "integer"},
+			"has_more":    {Type: "boolean"},
+			"next_cursor": {Type: "string", Description: "Pass as the cursor parameter for the next page; absent on the last page"},
+		},
+	}
+}
+
+func errorSchema() *Schema {
+	return &Schema{
+		Type:     "object",
+		Closed:   true,
+		Required: []string{"error"},
+		Properties: map[string]*Schema{
+			"error": {
+				Type:     "object",
+				Closed:   true,
+				Required: []string{"status", "code", "message"},
+				Properties: map[string]*Schema{
+					"status": {Type: "integer"},
+					"code": {Type: "string", Enum: []string{
+						"invalid_json", "validation_failed", "unauthorized", "forbidden",
+						"not_found", "method_not_allowed", "conflict", "internal_error",
+					}},
+					"message": {Type: "string"},
+					"fields": {
+						Type:                 "object",
+						Description:          "Validation messages keyed by field name",
+						AdditionalProperties: &Schema{Type: "string"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Building blocks
+
+func responses(sets ...map[string]*Response) map[string]*Response {
+	all := map[string]*Response{}
+	for _, set := range sets {
+		for status, response := range set {
+			all[status] = response
+		}
+	}
+	return all
+}
+
+func itemResponse(status int, description, schema string) map[string]*Response {
+	return map[string]*Response{strconv.Itoa(status): {
+		Description: description,
+		Content: map[string]MediaType{jsonType: {Schema: &Schema{
+			Type:       "object",
+			Closed:     true,
+			Required:   []string{"data"},
+			Properties: map[string]*Schema{"data": Ref(schema)},
+		}}},
+	}}
+}
+
+func createdResponse(schema string) map[string]*Response {
+	created := itemResponse(http.StatusCreated, "The created resource", schema)
+	created["201"].Headers = map[string]*Header{
+		"Location": {Description: "URL of the created resource", Schema: stringSchema()},
+	}
+	return created
+}
+
+func listResponse(schema string) map[string]*Response {
+	return map[string]*Response{"200": {
+		Description: "A page of results",
+		Content: map[string]MediaType{jsonType: {Schema: &Schema{
+			Type:     "object",
+			Closed:   true,
+			Required: []string{"data", "pagination"},
+			Properties: map[string]*Schema{
+				"data":       {Type: "array", Items: Ref(schema)},
+				"pagination": Ref("Pagination"),
+			},
+		}}},
+	}}
+}
+
+func errorResponse(status int, description string) map[string]*Response {
+	return map[string]*Response{strconv.Itoa(status): {
+		Description: description,
+		Content:     map[string]MediaType{jsonType: {Schema: Ref("Error")}},
+	}}
+}
+
+// authErrors documents the responses for a missing or under-scoped token
+func authErrors(scope models.Scope) map[string]*Response {
+	return responses(
+		errorResponse(http.StatusUnauthorized, "Missing, invalid or expired API token"),
+		errorResponse(http.StatusForbidden, "The token lacks the "+string(scope)+" scope"),
+	)
+}
+
+// writeErrors documents the responses shared by endpoints that take a JSON
+// body, and the 404 for those that address an existing resource
+func writeErrors(scope models.Scope, existing bool) map[string]*Response {
+	errs := responses(
+		authErrors(scope),
+		errorResponse(http.StatusBadRequest, "The body is not a single JSON object of known fields"),
+		errorResponse(http.StatusRequestEntityTooLarge, "The body is larger than 1 MiB"),
+		errorResponse(http.StatusUnprocessableEntity, "Some fields are invalid"),
+	)
+	if existing {
+		errs = responses(errs, errorResponse(http.StatusNotFound, "No such resource"))
+	}
+	return errs
+}
+
+func htmlResponse(description string) *Response {
+	return &Response{
+		Description: description,
+		Content:     map[string]MediaType{htmlType: {Schema: stringSchema()}},
+	}
+}
+
+func jsonBody(schema string) *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]MediaType{jsonType: {Schema: Ref(schema)}}}
+}
+
+func requireScope(scope models.Scope) []SecurityRequirement {
+	return []SecurityRequirement{{bearerScheme: {string(scope)}}}
+}
+
+func query(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func slugParam(resource string) Parameter {
+	return Parameter{Name: "slug", In: "path", Required: true, Description: "The " + resource + "'s slug", Schema: stringSchema()}
+}
+
+func paginationParams() []Parameter {
+	return []Parameter{
+		cursorParam(),
+		query("per_page", "Results per page", &Schema{Type: "integer", Minimum: intPtr(1), Maximum: intPtr(100), Default: 10}),
+	}
+}
+
+func cursorParam() Parameter {
+	return query("cursor", "Opaque next_cursor from the previous page; omit for the first page. Cursors only work with the sort they were issued for.", stringSchema())
+}
+
+func stringSchema() *Schema {
+	return &Schema{Type: "string"}
+}
+
+func enumSchema(values []string) *Schema {
+	return &Schema{Type: "string", Enum: values}
+}
+
+func scopeList() string {
+	scopes := make([]string, len(models.Scopes))
+	for i, scope := range models.Scopes {
+		scopes[i] = string(scope) + " (" + string(scope.Role()) + ")"
+	}
+	return strings.Join(scopes, ", ")
+}
+
+func intPtr(n int) *int {
+	return &n
+}
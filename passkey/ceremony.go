@@ -0,0 +1,77 @@
+package passkey
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Ceremony is a registration or login that has been started in the browser
+// and is waiting for the authenticator's response
+type Ceremony struct {
+	UserID    int64 // zero for passwordless login, where the user is not known yet
+	Data      webauthn.SessionData
+	ExpiresAt time.Time
+}
+
+// CeremonyStore keeps in-progress ceremonies in memory. Each one can be
+// finished once, so a captured response cannot be replayed.
+type CeremonyStore struct {
+	ceremonies map[string]*Ceremony
+	ttl        time.Duration
+	mu         sync.Mutex
+}
+
+// NewCeremonyStore creates a ceremony store whose entries expire after ttl
+func NewCeremonyStore(ttl time.Duration) *CeremonyStore {
+	return &CeremonyStore{
+		ceremonies: make(map[string]*Ceremony),
+		ttl:        ttl,
+	}
+}
+
+// Start records a ceremony and returns the token that identifies it
+func (s *CeremonyStore) Start(userID int64, data *webauthn.SessionData) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, ceremony := range s.ceremonies {
+		if now.After(ceremony.ExpiresAt) {
+			delete(s.ceremonies, key)
+		}
+	}
+
+	s.ceremonies[token] = &Ceremony{
+		UserID:    userID,
+		Data:      *data,
+		ExpiresAt: now.Add(s.ttl),
+	}
+	return token, nil
+}
+
+// Finish removes and returns the ceremony for token if it has not expired
+func (s *CeremonyStore) Finish(token string) (Ceremony, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ceremony, exists := s.ceremonies[token]
+	if !exists {
+		return Ceremony{}, false
+	}
+	delete(s.ceremonies, token)
+
+	if time.Now().After(ceremony.ExpiresAt) {
+		return Ceremony{}, false
+	}
+	return *ceremony, true
+}
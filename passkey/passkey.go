@@ -0,0 +1,81 @@
+// Package passkey adapts admin users to WebAuthn and keeps track of
+// registration and login ceremonies that are in progress.
+package passkey
+
+import (
+	"encoding/binary"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"portfolio-v2/models"
+)
+
+// New configures the relying party. rpID is the domain passkeys are bound to
+// and origin is the full URL browsers use to reach the admin area.
+func New(rpID, origin string) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "Portfolio Admin",
+		RPOrigins:     []string{origin},
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+}
+
+// User adapts an admin user and their passkeys to webauthn.User
+type User struct {
+	Account  *models.User
+	Passkeys []models.Passkey
+}
+
+// WebAuthnID returns the user handle stored on the authenticator
+func (u *User) WebAuthnID() []byte {
+	return UserHandle(u.Account.ID)
+}
+
+// WebAuthnName returns the login name shown by the authenticator
+func (u *User) WebAuthnName() string {
+	return u.Account.Username
+}
+
+// WebAuthnDisplayName returns the friendly name shown by the authenticator
+func (u *User) WebAuthnDisplayName() string {
+	return u.Account.Name()
+}
+
+// WebAuthnCredentials returns the user's registered credentials
+func (u *User) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.Passkeys))
+	for i, passkey := range u.Passkeys {
+		credentials[i] = passkey.Credential
+	}
+	return credentials
+}
+
+// Passkey returns the registered passkey with the given credential ID, or nil
+func (u *User) Passkey(credentialID []byte) *models.Passkey {
+	for i := range u.Passkeys {
+		if string(u.Passkeys[i].Credential.ID) == string(credentialID) {
+			return &u.Passkeys[i]
+		}
+	}
+	return nil
+}
+
+// UserHandle encodes a user ID as a WebAuthn user handle
+func UserHandle(userID int64) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// ParseUserHandle decodes a user handle created by UserHandle
+func ParseUserHandle(handle []byte) (int64, bool) {
+	if len(handle) != 8 {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(handle)), true
+}
@@ -0,0 +1,69 @@
+// Package passwords holds the strength rules for admin passwords, shared by
+// the admin UI and the command line tools.
+package passwords
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MinLength is the shortest password accepted
+	MinLength = 12
+	// MaxLength is the longest password accepted; bcrypt ignores anything past 72 bytes
+	MaxLength = 72
+	// minUnique is how many different characters a password must contain
+	minUnique = 5
+)
+
+// common lists passwords that meet the length rule but are guessed first
+var common = map[string]bool{
+	"123456789012":              true,
+	"1234567890123":             true,
+	"password1234":              true,
+	"password12345":             true,
+	"password123456":            true,
+	"passwordpassword":          true,
+	"qwertyuiop123":             true,
+	"qwertyuiopasdf":            true,
+	"iloveyou12345":             true,
+	"administrator":             true,
+	"administrator1":            true,
+	"letmein123456":             true,
+	"welcome123456":             true,
+	"changeme12345":             true,
+	"changethispassword":        true,
+	"your-secure-password-here": true,
+}
+
+// Check returns an error describing why password is too weak for username,
+// or nil if it is acceptable
+func Check(password, username string) error {
+	if len(password) < MinLength {
+		return errors.New("Password must be at least " + strconv.Itoa(MinLength) + " characters")
+	}
+
+	if len(password) > MaxLength {
+		return errors.New("Password must be at most " + strconv.Itoa(MaxLength) + " bytes")
+	}
+
+	lower := strings.ToLower(password)
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		return errors.New("Password must not contain the username")
+	}
+
+	if common[lower] {
+		return errors.New("Password is too common")
+	}
+
+	unique := make(map[rune]bool)
+	for _, r := range password {
+		unique[r] = true
+	}
+	if len(unique) < minUnique {
+		return errors.New("Password must use at least " + strconv.Itoa(minUnique) + " different characters")
+	}
+
+	return nil
+}
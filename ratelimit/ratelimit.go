@@ -67,30 +67,25 @@ func (l *Limiter) Reset(ip string) {
 	delete(l.attempts, ip)
 }
 
-// Cleanup removes old entries from the limiter (run periodically)
-func (l *Limiter) Cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		l.mu.Lock()
-		now := time.Now()
-		cutoff := now.Add(-l.window)
-
-		for ip, attempts := range l.attempts {
-			validAttempts := []time.Time{}
-			for _, t := range attempts {
-				if t.After(cutoff) {
-					validAttempts = append(validAttempts, t)
-				}
-			}
+// Prune removes attempts that fell out of the window, and addresses left
+// with none
+func (l *Limiter) Prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-			if len(validAttempts) == 0 {
-				delete(l.attempts, ip)
-			} else {
-				l.attempts[ip] = validAttempts
+	cutoff := time.Now().Add(-l.window)
+	for ip, attempts := range l.attempts {
+		validAttempts := []time.Time{}
+		for _, t := range attempts {
+			if t.After(cutoff) {
+				validAttempts = append(validAttempts, t)
 			}
 		}
-		l.mu.Unlock()
+
+		if len(validAttempts) == 0 {
+			delete(l.attempts, ip)
+		} else {
+			l.attempts[ip] = validAttempts
+		}
 	}
 }
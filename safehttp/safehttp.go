@@ -0,0 +1,71 @@
+// Package safehttp provides the HTTP client used to fetch URLs that come
+// from outside, such as webmention sources and fediverse actors, without
+// letting them point the server at its own network.
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned when a URL resolves to a loopback, private
+// or otherwise non-public address and the client does not allow it
+var ErrPrivateAddress = errors.New("URL resolves to a non-public address")
+
+const (
+	dialTimeout  = 5 * time.Second
+	fetchTimeout = 10 * time.Second // How long a server has to answer
+	maxRedirects = 5
+)
+
+// NewClient returns a client that follows at most a few redirects, and only
+// to http(s) URLs. Unless allowPrivate is set it refuses to connect to
+// non-public addresses; allow them to test against servers on localhost.
+func NewClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if !allowPrivate {
+		// Checked on the resolved address of every connection, so DNS
+		// names pointing inside the network and redirects are caught too
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicIP(net.ParseIP(host)) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   fetchTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirected to a %s: URL", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// publicIP reports whether ip is a globally routable unicast address
+func publicIP(ip net.IP) bool {
+	return ip != nil &&
+		ip.IsGlobalUnicast() &&
+		!ip.IsPrivate() &&
+		!ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast()
+}
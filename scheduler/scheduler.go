@@ -0,0 +1,257 @@
+// Package scheduler runs named jobs inside the process on cron schedules.
+//
+// Each job's last run and next run are kept in the database, so a job
+// that was due while the process was stopped runs as soon as it starts
+// again, once. A job never overlaps itself: when it is due while its last
+// run is still going, that run is skipped. Errors and panics are recorded
+// as failures for the admin jobs page rather than stopping the process.
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"portfolio-v2/database"
+	"portfolio-v2/logging"
+	"portfolio-v2/models"
+)
+
+// FailureRetention is how long failed runs are kept
+const FailureRetention = 90 * 24 * time.Hour
+
+// idleWait is how long Run sleeps when no job is scheduled
+const idleWait = time.Hour
+
+var (
+	// ErrUnknownJob is returned by Trigger for a name that was never added
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrRunning is returned by Trigger while the job is still running
+	ErrRunning = errors.New("job is already running")
+)
+
+// Func is the work of a job. ctx is cancelled when the scheduler stops,
+// and a job that takes long should return when it is.
+type Func func(ctx context.Context) error
+
+// job is a job added to a Scheduler
+type job struct {
+	name     string
+	spec     string
+	schedule cron.Schedule
+	run      Func
+	next     time.Time
+	running  bool
+}
+
+// Scheduler runs jobs when their schedule says they are due
+type Scheduler struct {
+	db *sql.DB
+	wg sync.WaitGroup
+
+	mu   sync.Mutex
+	ctx  context.Context // Passed to jobs; Run's once it is called
+	jobs []*job
+}
+
+// New creates a Scheduler that keeps the state of its jobs in db
+func New(db *sql.DB) *Scheduler {
+	return &Scheduler{db: db, ctx: context.Background()}
+}
+
+// Add schedules run under name. spec is a standard five-field cron
+// expression in local time, or a descriptor such as "@daily" or
+// "@every 10m". Jobs must be added before Run is called.
+func (s *Scheduler) Add(name, spec string, run Func) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("parse schedule of job %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.find(name) != nil {
+		return fmt.Errorf("job %s added twice", name)
+	}
+
+	s.jobs = append(s.jobs, &job{name: name, spec: spec, schedule: schedule, run: run})
+	return nil
+}
+
+// Trigger runs the job called name now, out of its schedule. Its next
+// scheduled run is unchanged.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	j := s.find(name)
+	if j == nil {
+		s.mu.Unlock()
+		return ErrUnknownJob
+	}
+	if j.running {
+		s.mu.Unlock()
+		return ErrRunning
+	}
+	j.running = true
+	s.wg.Add(1)
+	ctx, next := s.ctx, j.next
+	s.mu.Unlock()
+
+	go s.execute(ctx, j, next)
+	return nil
+}
+
+// Run starts jobs as they become due until ctx is cancelled, then waits
+// for those still running to return (run in a goroutine)
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	if err := s.restore(time.Now()); err != nil {
+		slog.Error("Failed to restore job schedules", "err", err)
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		timer.Reset(time.Until(s.startDue(ctx, time.Now())))
+
+		select {
+		case <-ctx.Done():
+			s.wg.Wait()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// startDue starts every job due at now, skipping those still running, and
+// returns when the next job is due
+func (s *Scheduler) startDue(ctx context.Context, now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wakeAt := now.Add(idleWait)
+	for _, j := range s.jobs {
+		if !j.next.After(now) {
+			j.next = j.schedule.Next(now)
+
+			if j.running {
+				slog.Warn("Skipped job: its last run has not finished", "job", j.name)
+				if err := database.SetJobNextRun(s.db, j.name, j.next); err != nil {
+					slog.Error("Failed to save next run of job", "job", j.name, "err", err)
+				}
+			} else {
+				j.running = true
+				s.wg.Add(1)
+				go s.execute(ctx, j, j.next)
+			}
+		}
+
+		if j.next.Before(wakeAt) {
+			wakeAt = j.next
+		}
+	}
+	return wakeAt
+}
+
+// restore loads when each job is next due, carrying it over from the last
+// process unless its spec changed, and forgets jobs no longer added. A run
+// the last process did not see finish is recorded as failed.
+func (s *Scheduler) restore(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, len(s.jobs))
+	for i, j := range s.jobs {
+		names[i] = j.name
+
+		state, err := database.GetJob(s.db, j.name)
+		if err != nil {
+			return err
+		}
+
+		j.next = j.schedule.Next(now)
+		if state != nil && state.Spec == j.spec && state.NextRunAt != nil {
+			j.next = *state.NextRunAt
+		}
+
+		if state != nil && state.Status == models.JobRunning && state.LastStartedAt != nil {
+			err := database.FinishJobRun(s.db, j.name, models.JobFailed, "interrupted: the process stopped during the run", *state.LastStartedAt, now)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := database.ScheduleJob(s.db, j.name, j.spec, j.next); err != nil {
+			return err
+		}
+	}
+
+	return database.DeleteJobsExcept(s.db, names)
+}
+
+// execute runs j and records the outcome, with next as its next run. The
+// caller marks j running and adds it to the wait group. Records logged
+// with the context j runs with carry the job's name.
+func (s *Scheduler) execute(ctx context.Context, j *job, next time.Time) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		j.running = false
+		s.mu.Unlock()
+	}()
+
+	ctx = logging.With(ctx, slog.String("job", j.name))
+
+	started := time.Now()
+	if err := database.StartJobRun(s.db, j.name, started, next); err != nil {
+		slog.ErrorContext(ctx, "Failed to record start of job", "err", err)
+	}
+
+	status, errText := models.JobOK, ""
+	panicked, err := call(ctx, j.run)
+	if err != nil {
+		status, errText = models.JobFailed, err.Error()
+		if panicked {
+			status = models.JobPanicked
+		}
+		slog.ErrorContext(ctx, "Job did not succeed", "status", status, "err", err)
+	}
+
+	finished := time.Now()
+	if err := database.FinishJobRun(s.db, j.name, status, errText, started, finished); err != nil {
+		slog.ErrorContext(ctx, "Failed to record run of job", "err", err)
+	}
+	slog.DebugContext(ctx, "Job finished", "status", status, "duration", finished.Sub(started))
+}
+
+// call runs run, turning a panic into an error with the stack trace
+func call(ctx context.Context, run Func) (panicked bool, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			panicked, err = true, fmt.Errorf("panic: %v\n\n%s", v, debug.Stack())
+		}
+	}()
+
+	return false, run(ctx)
+}
+
+// find returns the job called name, or nil. The caller holds s.mu.
+func (s *Scheduler) find(name string) *job {
+	for _, j := range s.jobs {
+		if j.name == name {
+			return j
+		}
+	}
+	return nil
+}
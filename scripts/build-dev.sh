@@ -19,11 +19,11 @@ echo -e "${GREEN}✓ Templates generated${NC}"
 
 # Step 2: Build Go binary
 echo -e "${BLUE}🔨 Building Go binary...${NC}"
-go build -o portfolio-v2 main.go
+go build -o portfolio-v2 .
 echo -e "${GREEN}✓ Binary built${NC}"
 
 echo ""
 echo -e "${GREEN}✓ Development build complete!${NC}"
 echo -e "${BLUE}Run the server: ./portfolio-v2${NC}"
-echo -e "${BLUE}Or use: go run main.go${NC}"
+echo -e "${BLUE}Or use: go run .${NC}"
 echo ""
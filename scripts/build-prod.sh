@@ -24,7 +24,7 @@ echo -e "${GREEN}✓ Dependencies tidied${NC}"
 
 # Step 3: Build Go binary with optimizations
 echo -e "${BLUE}🔨 Building optimized Go binary for Linux...${NC}"
-CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o portfolio-v2 main.go
+CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o portfolio-v2 .
 echo -e "${GREEN}✓ Binary built (portfolio-v2)${NC}"
 
 # Step 4: Check if CSS minification tools are available
@@ -88,6 +88,12 @@ mkdir -p "$BACKUP_DIR"
 
 # Perform sync
 if [ "$SYNC_DIRECTION" = "push" ]; then
+    # Stop the remote service first: it checkpoints its write-ahead log on
+    # the way out, which must not be replayed onto the pushed database
+    echo -e "${BLUE}⏹ Stopping remote service...${NC}"
+    ssh "$SERVER" "sudo systemctl stop portfolio"
+    echo -e "${GREEN}✓ Service stopped${NC}"
+
     # Backup remote database
     echo -e "${BLUE}📦 Backing up remote database...${NC}"
     BACKUP_NAME="remote-backup-$(date +%Y%m%d-%H%M%S).db"
@@ -99,10 +105,10 @@ if [ "$SYNC_DIRECTION" = "push" ]; then
     rsync -avz "$LOCAL_DB" "$SERVER:$REMOTE_DB"
     echo -e "${GREEN}✓ Database pushed successfully${NC}"
 
-    # Restart remote service to pick up changes
-    echo -e "${BLUE}🔄 Restarting remote service...${NC}"
-    ssh "$SERVER" "sudo systemctl restart portfolio"
-    echo -e "${GREEN}✓ Service restarted${NC}"
+    # Start remote service again with the pushed database
+    echo -e "${BLUE}🔄 Starting remote service...${NC}"
+    ssh "$SERVER" "sudo systemctl start portfolio"
+    echo -e "${GREEN}✓ Service started${NC}"
 
 else
     # Backup local database
@@ -111,7 +117,9 @@ else
     cp "$LOCAL_DB" "$BACKUP_DIR/$BACKUP_NAME"
     echo -e "${GREEN}✓ Local backup created: $BACKUP_DIR/$BACKUP_NAME${NC}"
 
-    # Pull remote to local
+    # Pull remote to local. Writes since the remote service last stopped may
+    # still be in its write-ahead log; the nightly backups in
+    # /home/admin/portfolio/backups include them.
     echo -e "${BLUE}⬇ Pulling remote database to local...${NC}"
     rsync -avz "$SERVER:$REMOTE_DB" "$LOCAL_DB"
     echo -e "${GREEN}✓ Database pulled successfully${NC}"
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// Challenge is a login that passed the password check and is waiting for a
+// second factor before a session is issued
+type Challenge struct {
+	Username   string
+	RedirectTo string
+	ExpiresAt  time.Time
+	Failures   int
+}
+
+// ChallengeStore keeps pending second-factor challenges in memory. They are
+// short-lived, so losing them on restart only means logging in again.
+type ChallengeStore struct {
+	challenges  map[string]*Challenge // hashed token -> challenge
+	ttl         time.Duration
+	maxFailures int
+	mu          sync.Mutex
+}
+
+// NewChallengeStore creates a challenge store. Challenges expire after ttl
+// and are discarded after maxFailures wrong codes.
+func NewChallengeStore(ttl time.Duration, maxFailures int) *ChallengeStore {
+	return &ChallengeStore{
+		challenges:  make(map[string]*Challenge),
+		ttl:         ttl,
+		maxFailures: maxFailures,
+	}
+}
+
+// Create starts a challenge for username and returns its token
+func (s *ChallengeStore) Create(username, redirectTo string) (string, error) {
+	token, err := generateID()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeExpired(time.Now())
+	s.challenges[hashID(token)] = &Challenge{
+		Username:   username,
+		RedirectTo: redirectTo,
+		ExpiresAt:  time.Now().Add(s.ttl),
+	}
+	return token, nil
+}
+
+// Get returns the challenge for token if it exists and has not expired
+func (s *ChallengeStore) Get(token string) (Challenge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	challenge, exists := s.challenges[hashID(token)]
+	if !exists || time.Now().After(challenge.ExpiresAt) {
+		return Challenge{}, false
+	}
+	return *challenge, true
+}
+
+// Fail records a wrong code and reports whether the challenge is still usable
+func (s *ChallengeStore) Fail(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := hashID(token)
+	challenge, exists := s.challenges[key]
+	if !exists {
+		return false
+	}
+
+	challenge.Failures++
+	if challenge.Failures >= s.maxFailures {
+		delete(s.challenges, key)
+		return false
+	}
+	return true
+}
+
+// Delete removes a challenge once it has been completed
+func (s *ChallengeStore) Delete(token string) {
+	s.mu.Lock()
+	delete(s.challenges, hashID(token))
+	s.mu.Unlock()
+}
+
+// removeExpired drops expired challenges; callers must hold the lock
+func (s *ChallengeStore) removeExpired(now time.Time) {
+	for key, challenge := range s.challenges {
+		if now.After(challenge.ExpiresAt) {
+			delete(s.challenges, key)
+		}
+	}
+}
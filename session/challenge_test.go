@@ -0,0 +1,61 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChallengeStoreExpires(t *testing.T) {
+	store := NewChallengeStore(20*time.Millisecond, 5)
+
+	token, err := store.Create("owner", "/admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, ok := store.Get(token)
+	if !ok || challenge.Username != "owner" || challenge.RedirectTo != "/admin" {
+		t.Fatalf("Get = %+v, %v; want the owner's challenge", challenge, ok)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := store.Get(token); ok {
+		t.Fatal("expired challenge still returned")
+	}
+}
+
+func TestChallengeStoreDropsAfterMaxFailures(t *testing.T) {
+	store := NewChallengeStore(time.Minute, 3)
+
+	token, err := store.Create("owner", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i < 3; i++ {
+		if !store.Fail(token) {
+			t.Fatalf("challenge dropped after %d failures, want 3", i)
+		}
+	}
+	if store.Fail(token) {
+		t.Fatal("challenge usable after 3 failures")
+	}
+	if _, ok := store.Get(token); ok {
+		t.Fatal("challenge still returned after max failures")
+	}
+}
+
+func TestChallengeStoreDelete(t *testing.T) {
+	store := NewChallengeStore(time.Minute, 3)
+
+	token, err := store.Create("owner", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Delete(token)
+	if _, ok := store.Get(token); ok {
+		t.Fatal("deleted challenge still returned")
+	}
+	if _, ok := store.Get("unknown"); ok {
+		t.Fatal("unknown token returned a challenge")
+	}
+}
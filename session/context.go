@@ -0,0 +1,19 @@
+package session
+
+import "context"
+
+// contextKey is a custom type for context keys to avoid collisions
+type contextKey string
+
+const sessionContextKey contextKey = "session"
+
+// NewContext returns a copy of ctx carrying the given session
+func NewContext(ctx context.Context, sess *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey, sess)
+}
+
+// FromContext retrieves the session stored in ctx, if any
+func FromContext(ctx context.Context) (*Session, bool) {
+	sess, ok := ctx.Value(sessionContextKey).(*Session)
+	return sess, ok
+}
@@ -0,0 +1,187 @@
+package session
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore manages sessions in memory. Sessions are lost on restart,
+// so it is only suitable for development.
+type MemoryStore struct {
+	sessions map[string]*Session // hashed ID -> session
+	opts     Options
+	mu       sync.RWMutex
+}
+
+// NewMemoryStore creates a new in-memory session store
+func NewMemoryStore(opts Options) *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]*Session),
+		opts:     opts,
+	}
+}
+
+// Create creates a new session for the given username and client
+func (s *MemoryStore) Create(username, ip, userAgent string) (*Session, error) {
+	sess, err := newSession(username, ip, userAgent, s.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := *sess
+	stored.ID = ""
+
+	s.mu.Lock()
+	s.sessions[sess.Handle] = &stored
+	s.mu.Unlock()
+
+	return sess, nil
+}
+
+// Get retrieves a session by ID
+func (s *MemoryStore) Get(sessionID string) (*Session, bool) {
+	key := hashID(sessionID)
+
+	s.mu.RLock()
+	stored, exists := s.sessions[key]
+	s.mu.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	if s.opts.expired(stored, time.Now()) {
+		s.Delete(sessionID)
+		return nil, false
+	}
+
+	sess := *stored
+	sess.ID = sessionID
+	return &sess, true
+}
+
+// Touch slides the idle deadline of a session forward
+func (s *MemoryStore) Touch(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, exists := s.sessions[hashID(sessionID)]
+	if !exists {
+		return nil
+	}
+
+	now := time.Now()
+	if now.Sub(stored.LastSeenAt) >= touchInterval {
+		stored.LastSeenAt = now
+	}
+	return nil
+}
+
+// Delete removes a session from the store
+func (s *MemoryStore) Delete(sessionID string) {
+	s.mu.Lock()
+	delete(s.sessions, hashID(sessionID))
+	s.mu.Unlock()
+}
+
+// DeleteExpired removes all expired sessions
+func (s *MemoryStore) DeleteExpired() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for key, sess := range s.sessions {
+		if s.opts.expired(sess, now) {
+			delete(s.sessions, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// List returns the active sessions of username, most recently used first
+func (s *MemoryStore) List(username string) ([]*Session, error) {
+	return s.list(func(sess *Session) bool { return sess.Username == username }), nil
+}
+
+// ListAll returns every active session, most recently used first
+func (s *MemoryStore) ListAll() ([]*Session, error) {
+	return s.list(func(*Session) bool { return true }), nil
+}
+
+// Revoke removes the session with the given handle
+func (s *MemoryStore) Revoke(handle string) error {
+	s.mu.Lock()
+	delete(s.sessions, handle)
+	s.mu.Unlock()
+	return nil
+}
+
+// RevokeAll removes every session of username
+func (s *MemoryStore) RevokeAll(username string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for key, sess := range s.sessions {
+		if sess.Username == username {
+			delete(s.sessions, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Rotate replaces a session's ID and CSRF token
+func (s *MemoryStore) Rotate(sessionID string) (*Session, error) {
+	newID, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	csrfToken, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldKey := hashID(sessionID)
+	stored, exists := s.sessions[oldKey]
+	if !exists {
+		return nil, errors.New("rotate session: session not found")
+	}
+
+	delete(s.sessions, oldKey)
+	stored.Handle = hashID(newID)
+	stored.CSRFToken = csrfToken
+	s.sessions[stored.Handle] = stored
+
+	sess := *stored
+	sess.ID = newID
+	return &sess, nil
+}
+
+// list returns copies of the active sessions matching keep
+func (s *MemoryStore) list(keep func(*Session) bool) []*Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var sessions []*Session
+	for _, stored := range s.sessions {
+		if keep(stored) && !s.opts.expired(stored, now) {
+			sess := *stored
+			sessions = append(sessions, &sess)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions
+}
@@ -2,34 +2,78 @@ package session
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
-	"sync"
+	"encoding/hex"
 	"time"
 )
 
 // Session represents a user session
 type Session struct {
-	ID        string
-	Username  string
-	CreatedAt time.Time
-	CSRFToken string
+	ID         string // Cookie value; empty for sessions loaded by List
+	Handle     string // Hash of the ID, safe to show and use for revocation
+	Username   string
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	CSRFToken  string
 }
 
-// Store manages sessions in memory
-type Store struct {
-	sessions map[string]*Session
-	mu       sync.RWMutex
+// Store persists sessions. Implementations key sessions by a hash of the
+// session ID so a leaked store never contains usable cookie values.
+type Store interface {
+	// Create creates a new session for the given username and client
+	Create(username, ip, userAgent string) (*Session, error)
+	// Get retrieves a session by ID, returning false if it is unknown or expired
+	Get(sessionID string) (*Session, bool)
+	// Touch records activity on a session, sliding its idle deadline forward
+	Touch(sessionID string) error
+	// Delete removes a session from the store
+	Delete(sessionID string)
+	// DeleteExpired removes every expired session and returns how many were removed
+	DeleteExpired() (int, error)
+	// List returns the active sessions of username, most recently used first
+	List(username string) ([]*Session, error)
+	// ListAll returns every active session, most recently used first
+	ListAll() ([]*Session, error)
+	// Revoke removes the session with the given handle
+	Revoke(handle string) error
+	// RevokeAll removes every session of username and returns how many were removed
+	RevokeAll(username string) (int, error)
+	// Rotate replaces a session's ID and CSRF token, keeping its owner and deadlines
+	Rotate(sessionID string) (*Session, error)
 }
 
-// NewStore creates a new session store
-func NewStore() *Store {
-	return &Store{
-		sessions: make(map[string]*Session),
+// Options controls session lifetimes
+type Options struct {
+	AbsoluteTimeout time.Duration // Maximum session lifetime regardless of activity
+	IdleTimeout     time.Duration // Maximum time allowed between requests
+}
+
+// DefaultOptions are the session lifetimes used by the admin area
+var DefaultOptions = Options{
+	AbsoluteTimeout: 24 * time.Hour,
+	IdleTimeout:     2 * time.Hour,
+}
+
+// touchInterval limits how often activity is written back to the store
+const touchInterval = time.Minute
+
+// expired reports whether a session has passed its absolute or idle deadline
+func (o Options) expired(sess *Session, now time.Time) bool {
+	if !now.Before(sess.ExpiresAt) {
+		return true
 	}
+	return now.Sub(sess.LastSeenAt) >= o.IdleTimeout
 }
 
-// Create creates a new session for the given username
-func (s *Store) Create(username string) (*Session, error) {
+// maxUserAgentLength caps the stored user agent string
+const maxUserAgentLength = 256
+
+// newSession builds a session with fresh ID and CSRF token
+func newSession(username, ip, userAgent string, opts Options) (*Session, error) {
 	sessionID, err := generateID()
 	if err != nil {
 		return nil, err
@@ -40,34 +84,28 @@ func (s *Store) Create(username string) (*Session, error) {
 		return nil, err
 	}
 
-	session := &Session{
-		ID:        sessionID,
-		Username:  username,
-		CreatedAt: time.Now(),
-		CSRFToken: csrfToken,
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
 	}
 
-	s.mu.Lock()
-	s.sessions[sessionID] = session
-	s.mu.Unlock()
-
-	return session, nil
-}
-
-// Get retrieves a session by ID
-func (s *Store) Get(sessionID string) (*Session, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	session, exists := s.sessions[sessionID]
-	return session, exists
+	now := time.Now().UTC()
+	return &Session{
+		ID:         sessionID,
+		Handle:     hashID(sessionID),
+		Username:   username,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(opts.AbsoluteTimeout),
+		CSRFToken:  csrfToken,
+	}, nil
 }
 
-// Delete removes a session from the store
-func (s *Store) Delete(sessionID string) {
-	s.mu.Lock()
-	delete(s.sessions, sessionID)
-	s.mu.Unlock()
+// hashID returns the storage key for a session ID
+func hashID(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:])
 }
 
 // generateID generates a cryptographically secure random ID
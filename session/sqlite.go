@@ -0,0 +1,228 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// SQLiteStore persists sessions in the sessions table so they survive
+// restarts and deploys. Only a SHA-256 hash of each session ID is stored.
+type SQLiteStore struct {
+	db   *sql.DB
+	opts Options
+}
+
+// NewSQLiteStore creates a session store backed by the given database
+func NewSQLiteStore(db *sql.DB, opts Options) *SQLiteStore {
+	return &SQLiteStore{
+		db:   db,
+		opts: opts,
+	}
+}
+
+// sessionColumns lists the columns scanned by scanSession, in order
+const sessionColumns = `id_hash, username, ip, user_agent, csrf_token, created_at, last_seen_at, expires_at`
+
+// Create creates a new session for the given username and client
+func (s *SQLiteStore) Create(username, ip, userAgent string) (*Session, error) {
+	sess, err := newSession(username, ip, userAgent, s.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO sessions (id_hash, username, ip, user_agent, csrf_token, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = s.db.Exec(query, sess.Handle, sess.Username, sess.IP, sess.UserAgent, sess.CSRFToken, sess.CreatedAt, sess.LastSeenAt, sess.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert session: %w", err)
+	}
+
+	return sess, nil
+}
+
+// Get retrieves a session by ID
+func (s *SQLiteStore) Get(sessionID string) (*Session, bool) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE id_hash = ?
+	`
+
+	sess, err := scanSession(s.db.QueryRow(query, hashID(sessionID)))
+	if err == sql.ErrNoRows {
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("Error loading session", "err", err)
+		return nil, false
+	}
+
+	if s.opts.expired(sess, time.Now().UTC()) {
+		s.Delete(sessionID)
+		return nil, false
+	}
+
+	sess.ID = sessionID
+	return sess, true
+}
+
+// Touch slides the idle deadline of a session forward
+func (s *SQLiteStore) Touch(sessionID string) error {
+	now := time.Now().UTC()
+	query := `UPDATE sessions SET last_seen_at = ? WHERE id_hash = ? AND last_seen_at <= ?`
+
+	if _, err := s.db.Exec(query, now, hashID(sessionID), now.Add(-touchInterval)); err != nil {
+		return fmt.Errorf("touch session: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a session from the store
+func (s *SQLiteStore) Delete(sessionID string) {
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE id_hash = ?`, hashID(sessionID)); err != nil {
+		slog.Error("Error deleting session", "err", err)
+	}
+}
+
+// DeleteExpired removes all sessions past their absolute or idle deadline
+func (s *SQLiteStore) DeleteExpired() (int, error) {
+	now := time.Now().UTC()
+	query := `DELETE FROM sessions WHERE expires_at <= ? OR last_seen_at <= ?`
+
+	result, err := s.db.Exec(query, now, now.Add(-s.opts.IdleTimeout))
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("check rows affected: %w", err)
+	}
+
+	return int(removed), nil
+}
+
+// List returns the active sessions of username, most recently used first
+func (s *SQLiteStore) List(username string) ([]*Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE username = ? AND expires_at > ? AND last_seen_at > ?
+		ORDER BY last_seen_at DESC
+	`
+
+	now := time.Now().UTC()
+	return s.query(query, username, now, now.Add(-s.opts.IdleTimeout))
+}
+
+// ListAll returns every active session, most recently used first
+func (s *SQLiteStore) ListAll() ([]*Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE expires_at > ? AND last_seen_at > ?
+		ORDER BY last_seen_at DESC
+	`
+
+	now := time.Now().UTC()
+	return s.query(query, now, now.Add(-s.opts.IdleTimeout))
+}
+
+// Revoke removes the session with the given handle
+func (s *SQLiteStore) Revoke(handle string) error {
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE id_hash = ?`, handle); err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeAll removes every session of username
+func (s *SQLiteStore) RevokeAll(username string) (int, error) {
+	result, err := s.db.Exec(`DELETE FROM sessions WHERE username = ?`, username)
+	if err != nil {
+		return 0, fmt.Errorf("revoke sessions: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("check rows affected: %w", err)
+	}
+
+	return int(removed), nil
+}
+
+// Rotate replaces a session's ID and CSRF token
+func (s *SQLiteStore) Rotate(sessionID string) (*Session, error) {
+	sess, exists := s.Get(sessionID)
+	if !exists {
+		return nil, fmt.Errorf("rotate session: session not found")
+	}
+
+	newID, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	csrfToken, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE sessions SET id_hash = ?, csrf_token = ? WHERE id_hash = ?`
+	if _, err := s.db.Exec(query, hashID(newID), csrfToken, sess.Handle); err != nil {
+		return nil, fmt.Errorf("rotate session: %w", err)
+	}
+
+	sess.ID = newID
+	sess.Handle = hashID(newID)
+	sess.CSRFToken = csrfToken
+	return sess, nil
+}
+
+// query runs a session query and scans every row
+func (s *SQLiteStore) query(query string, args ...any) ([]*Session, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		sessions = append(sessions, sess)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// scanSession scans the columns listed in sessionColumns
+func scanSession(row interface{ Scan(...any) error }) (*Session, error) {
+	var sess Session
+	err := row.Scan(
+		&sess.Handle,
+		&sess.Username,
+		&sess.IP,
+		&sess.UserAgent,
+		&sess.CSRFToken,
+		&sess.CreatedAt,
+		&sess.LastSeenAt,
+		&sess.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
@@ -0,0 +1,40 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"portfolio-v2/internal/testdb"
+)
+
+// TestSQLiteStoreSurvivesZoneChange checks that sessions written before the
+// local offset changes, as it does across a DST switch, are not pruned early
+func TestSQLiteStoreSurvivesZoneChange(t *testing.T) {
+	local := time.Local
+	t.Cleanup(func() { time.Local = local })
+
+	store := NewSQLiteStore(testdb.Open(t), DefaultOptions)
+
+	time.Local = time.FixedZone("UTC-10", -10*60*60)
+	sess, err := store.Create("owner", "192.0.2.1", "Firefox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Local = time.FixedZone("UTC+10", 10*60*60)
+	removed, err := store.DeleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 {
+		t.Errorf("DeleteExpired removed %d sessions, want 0", removed)
+	}
+
+	sessions, err := store.List("owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Handle != sess.Handle {
+		t.Errorf("List = %d sessions, want the new session", len(sessions))
+	}
+}
@@ -0,0 +1,181 @@
+// Package spam scores what visitors submit through the site's public
+// forms, the contact form and blog comments, for how likely it is to come
+// from a bot. Scoring is heuristic: a hidden honeypot field, a signed stamp
+// of when the form was rendered, and the content itself. Nothing is sent
+// to outside services.
+package spam
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Threshold is the score at and above which a submission is treated as
+// spam
+const Threshold = 5
+
+// Names of the hidden fields every public form carries
+const (
+	// HoneypotField is hidden from people with CSS, so only bots fill it
+	HoneypotField = "fax"
+
+	// StampField holds the signed time the form was rendered
+	StampField = "form_stamp"
+)
+
+const (
+	// MinFillTime is how long a person takes at least to fill in a form
+	MinFillTime = 3 * time.Second
+
+	// MaxStampAge is how long a rendered form can be submitted without
+	// counting against it
+	MaxStampAge = 24 * time.Hour
+
+	// maxLinks is how many links a submission can contain for free
+	maxLinks = 2
+)
+
+// spamPhrases are phrases that legitimate comments and messages on this
+// site are not expected to contain. Each one found adds to the score.
+var spamPhrases = []string{
+	"viagra", "cialis", "casino", "porn", "escort", "payday loan",
+	"forex", "backlinks", "seo services", "buy followers", "work from home",
+	"make money online", "crypto signals", "adult dating",
+}
+
+var (
+	linkPattern   = regexp.MustCompile(`(?i)https?://|www\.`)
+	bbcodePattern = regexp.MustCompile(`(?i)\[url[=\]]`)
+	htmlPattern   = regexp.MustCompile(`(?i)<a\s+href`)
+)
+
+// Submission is what a visitor sent through a form. Fields a form does not
+// have are left empty.
+type Submission struct {
+	Name     string
+	URL      string // The sender's website
+	Body     string
+	Honeypot string // Value of HoneypotField
+	Stamp    string // Value of StampField
+}
+
+// Result is the score of a submission and the reasons it was given, for
+// moderators
+type Result struct {
+	Score   int
+	Reasons []string
+}
+
+// Spam reports whether the submission should be treated as spam
+func (r Result) Spam() bool {
+	return r.Score >= Threshold
+}
+
+func (r *Result) add(points int, reason string) {
+	r.Score += points
+	r.Reasons = append(r.Reasons, reason)
+}
+
+// Checker scores submissions. Its key signs form stamps, so a bot cannot
+// claim a form was rendered long before it was submitted.
+type Checker struct {
+	key []byte
+}
+
+// New returns a checker signing form stamps with key
+func New(key []byte) *Checker {
+	return &Checker{key: key}
+}
+
+// Stamp returns the value of StampField for a form rendered at now
+func (c *Checker) Stamp(now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	return ts + "." + c.sign(ts)
+}
+
+func (c *Checker) sign(ts string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(ts))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// renderedAt returns the time in a stamp made by Stamp, or false if it was
+// not signed with c's key
+func (c *Checker) renderedAt(stamp string) (time.Time, bool) {
+	ts, sig, ok := strings.Cut(stamp, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(c.sign(ts))) {
+		return time.Time{}, false
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// Score rates a submission received at now. Bots betray themselves by
+// filling the honeypot, skipping or forging the stamp, or answering faster
+// than anyone can type; their content by links and stock phrases.
+func (c *Checker) Score(s Submission, now time.Time) Result {
+	var r Result
+
+	if strings.TrimSpace(s.Honeypot) != "" {
+		r.add(Threshold, "filled the hidden field")
+	}
+
+	if renderedAt, ok := c.renderedAt(s.Stamp); !ok {
+		r.add(Threshold, "form stamp missing or forged")
+	} else if elapsed := now.Sub(renderedAt); elapsed < MinFillTime {
+		r.add(Threshold, fmt.Sprintf("sent %s after the form loaded", elapsed.Round(100*time.Millisecond)))
+	} else if elapsed > MaxStampAge {
+		r.add(1, "form loaded over a day earlier")
+	}
+
+	text := strings.ToLower(s.Name + "\n" + s.URL + "\n" + s.Body)
+
+	if links := len(linkPattern.FindAllString(s.Body, -1)); links > maxLinks {
+		r.add(links-maxLinks, fmt.Sprintf("%d links", links))
+	}
+
+	if bbcodePattern.MatchString(s.Body) || htmlPattern.MatchString(s.Body) {
+		r.add(3, "HTML or BBCode links")
+	}
+
+	if linkPattern.MatchString(s.Name) {
+		r.add(3, "link in the name")
+	}
+
+	for _, phrase := range spamPhrases {
+		if strings.Contains(text, phrase) {
+			r.add(3, fmt.Sprintf("contains %q", phrase))
+		}
+	}
+
+	if shouting(s.Body) {
+		r.add(1, "mostly capitals")
+	}
+
+	return r
+}
+
+// shouting reports whether text of some length is mostly upper case
+func shouting(text string) bool {
+	var upper, letters int
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	return letters >= 20 && upper*10 > letters*7
+}
@@ -0,0 +1,118 @@
+// Passkey registration and login using the WebAuthn browser API
+document.addEventListener('DOMContentLoaded', () => {
+    const loginButton = document.querySelector('[data-passkey-login]');
+    const registerForm = document.querySelector('[data-passkey-register]');
+    const errorBox = document.querySelector('[data-passkey-error]');
+
+    if (!loginButton && !registerForm) return;
+
+    // Browsers without WebAuthn keep the password form only
+    if (!window.PublicKeyCredential) {
+        if (registerForm) showError('This browser does not support passkeys.');
+        return;
+    }
+
+    document.querySelectorAll('[data-passkey-only]').forEach(el => el.hidden = false);
+
+    if (loginButton) {
+        loginButton.addEventListener('click', async () => {
+            const form = loginButton.closest('form');
+            const csrf = form.querySelector('input[name="csrf_token"]').value;
+            const redirect = form.querySelector('input[name="redirect"]').value;
+
+            try {
+                const options = await postJSON('/admin/login/passkey/begin', csrf);
+                options.publicKey.challenge = decode(options.publicKey.challenge);
+                (options.publicKey.allowCredentials || []).forEach(c => c.id = decode(c.id));
+
+                const credential = await navigator.credentials.get({ publicKey: options.publicKey });
+                const result = await postJSON(
+                    '/admin/login/passkey/finish?redirect=' + encodeURIComponent(redirect),
+                    csrf,
+                    {
+                        id: credential.id,
+                        rawId: encode(credential.rawId),
+                        type: credential.type,
+                        response: {
+                            clientDataJSON: encode(credential.response.clientDataJSON),
+                            authenticatorData: encode(credential.response.authenticatorData),
+                            signature: encode(credential.response.signature),
+                            userHandle: credential.response.userHandle ? encode(credential.response.userHandle) : null,
+                        },
+                        clientExtensionResults: credential.getClientExtensionResults(),
+                    }
+                );
+                window.location.href = result.redirect;
+            } catch (err) {
+                showError(err.message || 'Passkey login failed.');
+            }
+        });
+    }
+
+    if (registerForm) {
+        registerForm.addEventListener('submit', async (event) => {
+            event.preventDefault();
+            const csrf = registerForm.querySelector('input[name="csrf_token"]').value;
+            const name = registerForm.querySelector('input[name="name"]').value;
+
+            try {
+                const options = await postJSON('/admin/account/passkeys/register/begin', csrf);
+                options.publicKey.challenge = decode(options.publicKey.challenge);
+                options.publicKey.user.id = decode(options.publicKey.user.id);
+                (options.publicKey.excludeCredentials || []).forEach(c => c.id = decode(c.id));
+
+                const credential = await navigator.credentials.create({ publicKey: options.publicKey });
+                const result = await postJSON(
+                    '/admin/account/passkeys/register/finish?name=' + encodeURIComponent(name),
+                    csrf,
+                    {
+                        id: credential.id,
+                        rawId: encode(credential.rawId),
+                        type: credential.type,
+                        response: {
+                            clientDataJSON: encode(credential.response.clientDataJSON),
+                            attestationObject: encode(credential.response.attestationObject),
+                            transports: credential.response.getTransports ? credential.response.getTransports() : [],
+                        },
+                        clientExtensionResults: credential.getClientExtensionResults(),
+                    }
+                );
+                window.location.href = result.redirect;
+            } catch (err) {
+                showError(err.message || 'Passkey registration failed.');
+            }
+        });
+    }
+
+    // POST JSON with the CSRF header and return the decoded response
+    async function postJSON(url, csrf, body) {
+        const response = await fetch(url, {
+            method: 'POST',
+            credentials: 'same-origin',
+            headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrf },
+            body: body ? JSON.stringify(body) : null,
+        });
+        if (!response.ok) {
+            throw new Error((await response.text()).trim());
+        }
+        return response.json();
+    }
+
+    function showError(message) {
+        if (!errorBox) return;
+        errorBox.textContent = message;
+        errorBox.hidden = false;
+    }
+
+    // base64url <-> ArrayBuffer, the encoding WebAuthn uses on the wire
+    function decode(value) {
+        const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+        const padded = base64 + '='.repeat((4 - base64.length % 4) % 4);
+        return Uint8Array.from(atob(padded), c => c.charCodeAt(0)).buffer;
+    }
+
+    function encode(buffer) {
+        const bytes = String.fromCharCode(...new Uint8Array(buffer));
+        return btoa(bytes).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+});
@@ -0,0 +1,101 @@
+// Package visitor tells anonymous visitors apart without cookies and
+// without storing who they are. A visitor is a hash of their IP address
+// and user agent with a salt that changes every day (UTC) and is deleted
+// once the day is over, so the same person gets a new hash each day and
+// no hash can be traced back to an address afterwards.
+package visitor
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"portfolio-v2/database"
+)
+
+// dayFormat is the format of the day a salt belongs to
+const dayFormat = "2006-01-02"
+
+// Hasher hashes visitors with the current day's salt, which is kept in
+// the database so restarts and other processes hash alike
+type Hasher struct {
+	db *sql.DB
+
+	mu   sync.Mutex
+	day  string // Day the cached salt belongs to
+	salt []byte
+}
+
+// New returns a Hasher loading its salts from db
+func New(db *sql.DB) *Hasher {
+	return &Hasher{db: db}
+}
+
+// Hash returns the visitor hash of ip and userAgent at now
+func (h *Hasher) Hash(ip, userAgent string, now time.Time) (string, error) {
+	salt, err := h.saltFor(now.UTC().Format(dayFormat))
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.New()
+	sum.Write(salt)
+	sum.Write([]byte(ip))
+	sum.Write([]byte{0})
+	sum.Write([]byte(userAgent))
+	return hex.EncodeToString(sum.Sum(nil)[:16]), nil
+}
+
+// saltFor returns the salt of day, loading it when the day changes
+func (h *Hasher) saltFor(day string) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.day == day {
+		return h.salt, nil
+	}
+
+	salt, err := database.VisitorSalt(h.db, day)
+	if err != nil {
+		return nil, err
+	}
+
+	h.day, h.salt = day, salt
+	return salt, nil
+}
+
+// ClientIP returns the address of the client that sent r. Behind a reverse
+// proxy on the same host, as in deploy/, that is the last address in
+// X-Forwarded-For, the one the proxy appended: the ones before it are
+// whatever the client sent and can be forged. Forwarding headers on
+// requests that did not come through a local proxy are ignored.
+func ClientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if ip := net.ParseIP(remote); ip == nil || !ip.IsLoopback() {
+		return remote
+	}
+
+	// A client may send several X-Forwarded-For headers; the proxy
+	// appends to the last one
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(forwarded[len(forwarded)-1], ",")
+		if hop := strings.TrimSpace(hops[len(hops)-1]); hop != "" {
+			return hop
+		}
+	}
+
+	// nginx can be set up to send the address as X-Real-IP instead
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+
+	return remote
+}
@@ -0,0 +1,42 @@
+package visitor
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{name: "direct", remote: "192.0.2.1:4711", want: "192.0.2.1"},
+		{name: "direct with a forged header", remote: "192.0.2.1:4711", forwarded: []string{"203.0.113.9"}, realIP: "203.0.113.9", want: "192.0.2.1"},
+		{name: "proxied", remote: "127.0.0.1:4711", forwarded: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "proxied with a forged header", remote: "127.0.0.1:4711", forwarded: []string{"203.0.113.9, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "proxied with forged header lines", remote: "127.0.0.1:4711", forwarded: []string{"203.0.113.9", "203.0.113.10, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "proxied over IPv6", remote: "[::1]:4711", forwarded: []string{"2001:db8::7"}, want: "2001:db8::7"},
+		{name: "proxied with X-Real-IP", remote: "127.0.0.1:4711", realIP: "198.51.100.7", want: "198.51.100.7"},
+		{name: "local without a proxy", remote: "127.0.0.1:4711", want: "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
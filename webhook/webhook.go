@@ -0,0 +1,170 @@
+// Package webhook queues signed event notifications for subscribed URLs and
+// delivers them with retries.
+//
+// Every delivery is a POST of a JSON Payload with these headers:
+//
+//	X-Webhook-Event:     the event name, e.g. post.published
+//	X-Webhook-Delivery:  the delivery ID, which stays the same across retries
+//	X-Webhook-Timestamp: Unix seconds when the attempt was signed
+//	X-Webhook-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// Receivers should check the signature with Verify and deduplicate on the
+// payload ID, as a delivery may arrive more than once.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+)
+
+// SecretPrefix starts every signing secret so it is easy to recognise
+const SecretPrefix = "whsec_"
+
+// Tolerance is how far a signature timestamp may be from the receiver's
+// clock before Verify rejects it as a possible replay
+const Tolerance = 5 * time.Minute
+
+// Request headers set on every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload is the JSON body of a delivery. ID identifies the event and is
+// shared by the deliveries to every subscriber.
+type Payload struct {
+	ID        string              `json:"id"`
+	Event     models.WebhookEvent `json:"event"`
+	CreatedAt time.Time           `json:"created_at"`
+	Data      any                 `json:"data"`
+}
+
+// GenerateSecret returns a new random signing secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Sign returns the X-Webhook-Signature value for body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a delivery against body, as a
+// receiver would. It rejects timestamps more than Tolerance from now.
+func Verify(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid " + HeaderTimestamp)
+	}
+
+	if age := now.Sub(time.Unix(timestamp, 0)); age > Tolerance || age < -Tolerance {
+		return errors.New("timestamp is outside the allowed tolerance")
+	}
+
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(HeaderSignature))) {
+		return errors.New("signature does not match")
+	}
+
+	return nil
+}
+
+// Enqueue queues event for every active webhook subscribed to it. data is
+// encoded as the payload's data, e.g. the post that was published. Nothing
+// is sent until the worker started by Run picks the deliveries up.
+func Enqueue(db *sql.DB, event models.WebhookEvent, data any) error {
+	hooks, err := database.GetWebhooks(db)
+	if err != nil {
+		return err
+	}
+
+	var ids []int64
+	for i := range hooks {
+		if hooks[i].Subscribes(event) {
+			ids = append(ids, hooks[i].ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return enqueue(db, ids, event, data)
+}
+
+// Ping queues a test event for hook alone, whatever it subscribes to
+func Ping(db *sql.DB, hook *models.Webhook) error {
+	data := map[string]any{
+		"webhook_id": hook.ID,
+		"url":        hook.URL,
+		"events":     hook.Events,
+	}
+	return enqueue(db, []int64{hook.ID}, models.EventPing, data)
+}
+
+// Redeliver queues a new delivery with the same payload as delivery, for
+// resending an event the receiver missed
+func Redeliver(db *sql.DB, delivery *models.WebhookDelivery) error {
+	if err := database.CreateWebhookDeliveries(db, []int64{delivery.WebhookID}, delivery.Event, delivery.Payload); err != nil {
+		return err
+	}
+
+	wake()
+	return nil
+}
+
+func enqueue(db *sql.DB, webhookIDs []int64, event models.WebhookEvent, data any) error {
+	id, err := eventID()
+	if err != nil {
+		return fmt.Errorf("generate event id: %w", err)
+	}
+
+	payload, err := json.Marshal(Payload{
+		ID:        id,
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %w", err)
+	}
+
+	if err := database.CreateWebhookDeliveries(db, webhookIDs, event, string(payload)); err != nil {
+		return err
+	}
+
+	wake()
+	return nil
+}
+
+// eventID returns a random identifier for a payload
+func eventID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "evt_" + hex.EncodeToString(b), nil
+}
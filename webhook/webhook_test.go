@@ -0,0 +1,243 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/internal/testdb"
+	"portfolio-v2/models"
+	"portfolio-v2/safehttp"
+)
+
+const testSecret = "whsec_test"
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+
+	signed := func(secret string, at time.Time) http.Header {
+		header := http.Header{}
+		header.Set(HeaderTimestamp, strconv.FormatInt(at.Unix(), 10))
+		header.Set(HeaderSignature, Sign(secret, at.Unix(), body))
+		return header
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		valid  bool
+	}{
+		{"signed now", signed(testSecret, now), body, true},
+		{"at the tolerance", signed(testSecret, now.Add(-Tolerance)), body, true},
+		{"ahead within tolerance", signed(testSecret, now.Add(Tolerance)), body, true},
+		{"too old", signed(testSecret, now.Add(-Tolerance-time.Second)), body, false},
+		{"too far ahead", signed(testSecret, now.Add(Tolerance+time.Second)), body, false},
+		{"wrong secret", signed("whsec_other", now), body, false},
+		{"altered body", signed(testSecret, now), []byte(`{"id":"evt_2"}`), false},
+		{"no timestamp", http.Header{HeaderSignature: {Sign(testSecret, now.Unix(), body)}}, body, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(testSecret, tt.header, tt.body, now)
+			if (err == nil) != tt.valid {
+				t.Errorf("Verify = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	want := []time.Duration{time.Minute, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}
+	for attempts, delay := range want {
+		if got := Backoff(attempts); got != delay {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, delay)
+		}
+	}
+}
+
+// subscribe stores an active webhook for url and queues a ping to it,
+// returning the queued delivery
+func subscribe(t *testing.T, db *sql.DB, url string) *models.WebhookDelivery {
+	t.Helper()
+	hook := &models.Webhook{URL: url, Secret: testSecret, Events: []models.WebhookEvent{models.EventPostPublished}, Active: true}
+	if err := database.CreateWebhook(db, hook); err != nil {
+		t.Fatal(err)
+	}
+	if err := Ping(db, hook); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := database.GetWebhookDeliveries(db, hook.ID, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("queued deliveries = %d, %v; want 1", len(deliveries), err)
+	}
+	return &deliveries[0]
+}
+
+// reload returns the stored state of delivery
+func reload(t *testing.T, db *sql.DB, delivery *models.WebhookDelivery) *models.WebhookDelivery {
+	t.Helper()
+	stored, err := database.GetWebhookDeliveryByID(db, delivery.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func TestDeliverySigned(t *testing.T) {
+	db := testdb.Open(t)
+
+	var verifyErr error
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = Verify(testSecret, r.Header, body, time.Now())
+		if r.Header.Get(HeaderEvent) != string(models.EventPing) {
+			t.Errorf("%s = %q, want %q", HeaderEvent, r.Header.Get(HeaderEvent), models.EventPing)
+		}
+	}))
+	defer receiver.Close()
+
+	delivery := subscribe(t, db, receiver.URL)
+	deliverDue(t.Context(), db, newClient(safehttp.NewClient(true)))
+
+	if verifyErr != nil {
+		t.Errorf("receiver rejected the signature: %v", verifyErr)
+	}
+	if stored := reload(t, db, delivery); stored.Status != models.DeliveryDelivered || stored.Attempts != 1 {
+		t.Errorf("delivery = %s after %d attempts, want delivered after 1", stored.Status, stored.Attempts)
+	}
+}
+
+func TestDeliveryRetriesUntilMaxAttempts(t *testing.T) {
+	db := testdb.Open(t)
+
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	delivery := subscribe(t, db, receiver.URL)
+
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		deliverDue(t.Context(), db, newClient(safehttp.NewClient(true)))
+
+		stored := reload(t, db, delivery)
+		if stored.Attempts != attempt {
+			t.Fatalf("attempts = %d, want %d", stored.Attempts, attempt)
+		}
+		if stored.ResponseStatus != http.StatusServiceUnavailable || stored.Error != "receiver answered 503" {
+			t.Errorf("attempt %d recorded status %d, error %q", attempt, stored.ResponseStatus, stored.Error)
+		}
+
+		if attempt == MaxAttempts {
+			if stored.Status != models.DeliveryFailed {
+				t.Errorf("status after %d attempts = %s, want failed", attempt, stored.Status)
+			}
+			break
+		}
+
+		if stored.Status != models.DeliveryPending {
+			t.Fatalf("status after attempt %d = %s, want pending", attempt, stored.Status)
+		}
+		if delay := stored.NextAttemptAt.Sub(*stored.LastAttemptAt); delay != Backoff(attempt) {
+			t.Errorf("retry %d scheduled after %v, want %v", attempt, delay, Backoff(attempt))
+		}
+
+		// Nothing is sent again before the backoff has passed
+		deliverDue(t.Context(), db, newClient(safehttp.NewClient(true)))
+		if got := int(hits.Load()); got != attempt {
+			t.Fatalf("receiver hit %d times before the retry was due, want %d", got, attempt)
+		}
+
+		// Make the retry due now instead of waiting for it
+		stored.NextAttemptAt = time.Now().Add(-time.Second)
+		if err := database.RecordWebhookAttempt(db, stored); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A failed delivery is not retried
+	deliverDue(t.Context(), db, newClient(safehttp.NewClient(true)))
+	if got := int(hits.Load()); got != MaxAttempts {
+		t.Errorf("receiver hit %d times, want %d", got, MaxAttempts)
+	}
+}
+
+func TestDeliveryRefusesRedirect(t *testing.T) {
+	db := testdb.Open(t)
+
+	var followed atomic.Bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed.Store(true)
+	}))
+	defer target.Close()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	delivery := subscribe(t, db, receiver.URL)
+	deliverDue(t.Context(), db, newClient(safehttp.NewClient(true)))
+
+	if followed.Load() {
+		t.Error("the redirect was followed")
+	}
+	stored := reload(t, db, delivery)
+	if stored.Status != models.DeliveryPending || stored.ResponseStatus != http.StatusTemporaryRedirect {
+		t.Errorf("delivery = %s with response %d, want pending with %d", stored.Status, stored.ResponseStatus, http.StatusTemporaryRedirect)
+	}
+}
+
+func TestDeliveryInterruptedByShutdown(t *testing.T) {
+	db := testdb.Open(t)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The worker is stopped while the receiver is answering
+		cancel()
+	}))
+	defer receiver.Close()
+
+	delivery := subscribe(t, db, receiver.URL)
+	deliverDue(ctx, db, newClient(safehttp.NewClient(true)))
+
+	stored := reload(t, db, delivery)
+	if stored.Status != models.DeliveryPending || stored.Attempts != 0 {
+		t.Errorf("delivery = %s after %d attempts, want pending after 0", stored.Status, stored.Attempts)
+	}
+}
+
+func TestDeliveryRefusesPrivateAddress(t *testing.T) {
+	db := testdb.Open(t)
+
+	var hit atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit.Store(true)
+	}))
+	defer receiver.Close()
+
+	delivery := subscribe(t, db, receiver.URL)
+	deliverDue(t.Context(), db, newClient(safehttp.NewClient(false)))
+
+	if hit.Load() {
+		t.Error("the delivery was sent to a loopback address")
+	}
+	stored := reload(t, db, delivery)
+	if stored.Status != models.DeliveryPending || stored.Attempts != 1 || !strings.Contains(stored.Error, safehttp.ErrPrivateAddress.Error()) {
+		t.Errorf("delivery = %s after %d attempts with error %q, want pending after 1 refused", stored.Status, stored.Attempts, stored.Error)
+	}
+}
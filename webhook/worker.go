@@ -0,0 +1,217 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+)
+
+// MaxAttempts is how many times a delivery is tried before it is marked
+// failed. With the backoff below the last retry is about two hours after
+// the event.
+const MaxAttempts = 8
+
+// Retention is how long finished deliveries are kept in the delivery log
+const Retention = 30 * 24 * time.Hour
+
+const (
+	retryBase       = time.Minute      // Delay before the first retry, doubled for each one after
+	attemptTimeout  = 10 * time.Second // How long a receiver has to answer
+	batchSize       = 20               // Deliveries loaded per query
+	maxResponseBody = 1024             // Bytes of each response kept for the log
+	userAgent       = "portfolio-v2-webhooks"
+)
+
+// wakeup lets Enqueue start a running worker early instead of waiting for
+// its next tick, so local receivers see events straight away
+var wakeup = make(chan struct{}, 1)
+
+func wake() {
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Backoff returns the delay before the next attempt after attempts failed
+// ones: 1, 2, 4 ... minutes
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return retryBase << (attempts - 1)
+}
+
+// Run delivers due webhooks now, then whenever an event is queued and every
+// interval, until ctx is cancelled (run in a goroutine). The queue lives in
+// the database, so deliveries pending when the process stops are sent
+// after it restarts. Deliveries are sent with a copy of client that
+// does not follow redirects.
+func Run(ctx context.Context, db *sql.DB, client *http.Client, interval time.Duration) {
+	client = newClient(client)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastPruned time.Time
+	for {
+		deliverDue(ctx, db, client)
+
+		if time.Since(lastPruned) > 24*time.Hour {
+			removed, err := database.PruneWebhookDeliveries(db, time.Now().Add(-Retention))
+			if err != nil {
+				slog.Error("Failed to prune webhook deliveries", "err", err)
+			} else if removed > 0 {
+				slog.Info("Pruned webhook deliveries", "count", removed)
+			}
+			lastPruned = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-wakeup:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// newClient returns the client deliveries are sent with: base, with the
+// attempt timeout and without redirects
+func newClient(base *http.Client) *http.Client {
+	client := *base
+	client.Timeout = attemptTimeout
+	// A redirect is reported as a failure rather than followed, so the
+	// signed body is only ever sent to the configured URL
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &client
+}
+
+// deliverDue attempts every delivery that is due, a batch at a time, until
+// ctx is cancelled
+func deliverDue(ctx context.Context, db *sql.DB, client *http.Client) {
+	hooks := map[int64]*models.Webhook{}
+
+	for {
+		deliveries, err := database.GetDueWebhookDeliveries(db, time.Now(), batchSize)
+		if err != nil {
+			slog.Error("Failed to load webhook deliveries", "err", err)
+			return
+		}
+
+		for i := range deliveries {
+			if ctx.Err() != nil {
+				return
+			}
+			delivery := &deliveries[i]
+
+			hook, ok := hooks[delivery.WebhookID]
+			if !ok {
+				hook, err = database.GetWebhookByID(db, delivery.WebhookID)
+				if err != nil {
+					slog.Error("Failed to load webhook", "id", delivery.WebhookID, "err", err)
+					return
+				}
+				hooks[delivery.WebhookID] = hook
+			}
+
+			attempt(ctx, client, hook, delivery)
+			if ctx.Err() != nil {
+				// Cut off by shutdown, which is not the receiver's fault;
+				// the delivery stays due and is retried after a restart
+				return
+			}
+			if err := database.RecordWebhookAttempt(db, delivery); err != nil {
+				slog.Error("Failed to record webhook delivery", "delivery_id", delivery.ID, "err", err)
+				return
+			}
+		}
+
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// attempt sends delivery to hook once and updates it with the outcome
+func attempt(ctx context.Context, client *http.Client, hook *models.Webhook, delivery *models.WebhookDelivery) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = 0
+	delivery.ResponseBody = ""
+	delivery.Error = ""
+
+	if hook == nil || !hook.Active {
+		// Nothing left to retry for; redeliver once the webhook is back
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "webhook is disabled"
+		return
+	}
+
+	status, body, err := send(ctx, client, hook, delivery, now)
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		delivery.Status = models.DeliveryDelivered
+		return
+	case err != nil:
+		delivery.Error = err.Error()
+	default:
+		delivery.Error = "receiver answered " + strconv.Itoa(status)
+	}
+
+	if delivery.Attempts >= MaxAttempts {
+		delivery.Status = models.DeliveryFailed
+		slog.Warn("Webhook delivery failed for good", "delivery_id", delivery.ID, "url", hook.URL, "attempts", delivery.Attempts, "reason", delivery.Error)
+		return
+	}
+
+	delivery.Status = models.DeliveryPending
+	delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+	slog.Warn("Webhook delivery failed", "delivery_id", delivery.ID, "url", hook.URL, "attempt", delivery.Attempts, "reason", delivery.Error)
+}
+
+// send POSTs the signed payload and returns the response status and the
+// start of the response body
+func send(ctx context.Context, client *http.Client, hook *models.Webhook, delivery *models.WebhookDelivery, now time.Time) (int, string, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", fmt.Errorf("build request: %w", err)
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEvent, string(delivery.Event))
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	return resp.StatusCode, strings.ToValidUTF8(string(snippet), "�"), nil
+}
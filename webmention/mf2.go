@@ -0,0 +1,364 @@
+package webmention
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// entry holds the microformats2 properties of a source's h-entry that a
+// mention displays. It is a deliberately small subset of the mf2 parsing
+// rules: class names only, no value-class pattern, no implied properties
+// beyond the author falling back to the entry's own h-card.
+type entry struct {
+	name        string
+	content     string
+	url         string
+	published   string
+	authorName  string
+	authorURL   string
+	authorPhoto string
+	inReplyTo   []string
+	likeOf      []string
+	repostOf    []string
+	bookmarkOf  []string
+}
+
+// parseEntry reads the h-entry of doc that links to target, or the first
+// h-entry if none does. Relative URLs are resolved against base. It returns
+// nil if doc has no h-entry.
+func parseEntry(doc *html.Node, base *url.URL, target string) *entry {
+	roots := findRoots(doc, "h-entry")
+	if len(roots) == 0 {
+		return nil
+	}
+
+	root := roots[0]
+	for _, candidate := range roots {
+		if linksTo(candidate, base, target) {
+			root = candidate
+			break
+		}
+	}
+
+	e := &entry{
+		name:       propertyText(root, "p-name"),
+		url:        propertyURL(root, "u-url", base),
+		published:  propertyDate(root, "dt-published"),
+		inReplyTo:  propertyURLs(root, "u-in-reply-to", base),
+		likeOf:     propertyURLs(root, "u-like-of", base),
+		repostOf:   propertyURLs(root, "u-repost-of", base),
+		bookmarkOf: propertyURLs(root, "u-bookmark-of", base),
+	}
+
+	for _, class := range []string{"e-content", "p-content", "p-summary"} {
+		if n := findProperty(root, class); n != nil {
+			e.content = textContent(n)
+			break
+		}
+	}
+
+	if author := findProperty(root, "p-author"); author != nil {
+		if hasClass(author, "h-card") {
+			e.authorName = propertyText(author, "p-name")
+			if e.authorName == "" {
+				e.authorName = textContent(author)
+			}
+			e.authorURL = propertyURL(author, "u-url", base)
+			e.authorPhoto = propertyURL(author, "u-photo", base)
+		} else {
+			e.authorName = textContent(author)
+		}
+	} else if author := findProperty(root, "u-author"); author != nil {
+		e.authorURL = urlValue(author, base)
+	}
+
+	return e
+}
+
+// documentTitle returns the text of doc's <title>, for sources without an
+// h-entry
+func documentTitle(doc *html.Node) string {
+	var title string
+	walk(doc, func(n *html.Node) bool {
+		if n.DataAtom == atom.Title {
+			title = textContent(n)
+			return false
+		}
+		return true
+	})
+	return title
+}
+
+// linksTo reports whether any link, image or media element under n points
+// at target
+func linksTo(n *html.Node, base *url.URL, target string) bool {
+	found := false
+	walk(n, func(n *html.Node) bool {
+		if found {
+			return false
+		}
+
+		var attr string
+		switch n.DataAtom {
+		case atom.A, atom.Area, atom.Link:
+			attr = "href"
+		case atom.Img, atom.Video, atom.Audio, atom.Source:
+			attr = "src"
+		default:
+			return true
+		}
+
+		if value, ok := attribute(n, attr); ok && SameURL(resolve(base, value), target) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// findRoots returns every element with the root class, outermost first,
+// without looking inside the ones found
+func findRoots(n *html.Node, class string) []*html.Node {
+	var roots []*html.Node
+	walk(n, func(n *html.Node) bool {
+		if hasClass(n, class) {
+			roots = append(roots, n)
+			return false
+		}
+		return true
+	})
+	return roots
+}
+
+// findProperty returns the first element below root with class, without
+// descending into nested microformats. A nested microformat can itself
+// carry the property, as in class="p-author h-card".
+func findProperty(root *html.Node, class string) *html.Node {
+	nodes := findProperties(root, class)
+	if len(nodes) == 0 {
+		return nil
+	}
+	return nodes[0]
+}
+
+// findProperties returns every element below root with class, without
+// descending into nested microformats
+func findProperties(root *html.Node, class string) []*html.Node {
+	var nodes []*html.Node
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, func(n *html.Node) bool {
+			if hasClass(n, class) {
+				nodes = append(nodes, n)
+			}
+			return !isRoot(n)
+		})
+	}
+	return nodes
+}
+
+// propertyText returns the value of a p-* property: an image's alt text,
+// an abbreviation's title, a data element's value or the text content
+func propertyText(root *html.Node, class string) string {
+	n := findProperty(root, class)
+	if n == nil {
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Img, atom.Area:
+		if alt, ok := attribute(n, "alt"); ok {
+			return strings.TrimSpace(alt)
+		}
+	case atom.Abbr:
+		if title, ok := attribute(n, "title"); ok {
+			return strings.TrimSpace(title)
+		}
+	case atom.Data, atom.Input:
+		if value, ok := attribute(n, "value"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return textContent(n)
+}
+
+// propertyURL returns the value of the first u-* property with class
+func propertyURL(root *html.Node, class string, base *url.URL) string {
+	n := findProperty(root, class)
+	if n == nil {
+		return ""
+	}
+	return urlValue(n, base)
+}
+
+// propertyURLs returns the values of every u-* property with class. A
+// property that is a nested h-cite or h-entry contributes its own u-url.
+func propertyURLs(root *html.Node, class string, base *url.URL) []string {
+	var urls []string
+	for _, n := range findProperties(root, class) {
+		value := urlValue(n, base)
+		if isRoot(n) {
+			if nested := propertyURL(n, "u-url", base); nested != "" {
+				value = nested
+			}
+		}
+		if value != "" {
+			urls = append(urls, value)
+		}
+	}
+	return urls
+}
+
+// urlValue returns the URL an element carries, resolved against base
+func urlValue(n *html.Node, base *url.URL) string {
+	var attr string
+	switch n.DataAtom {
+	case atom.A, atom.Area, atom.Link:
+		attr = "href"
+	case atom.Img, atom.Audio, atom.Video, atom.Source, atom.Iframe:
+		attr = "src"
+	case atom.Object:
+		attr = "data"
+	}
+
+	value, ok := attribute(n, attr)
+	if !ok {
+		value = textContent(n)
+	}
+	if value == "" {
+		return ""
+	}
+	return resolve(base, value)
+}
+
+// propertyDate returns the value of a dt-* property: the datetime
+// attribute of time, ins and del elements, or the text content
+func propertyDate(root *html.Node, class string) string {
+	n := findProperty(root, class)
+	if n == nil {
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Time, atom.Ins, atom.Del:
+		if value, ok := attribute(n, "datetime"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return textContent(n)
+}
+
+// dateLayouts are the published date formats accepted, most specific first
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseDate parses an mf2 date, returning nil if it is empty or in an
+// unknown format
+func parseDate(value string) *time.Time {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// textContent returns the text under n with whitespace collapsed, leaving
+// out scripts and styles
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(n *html.Node) bool {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		case n.DataAtom == atom.Script || n.DataAtom == atom.Style || n.DataAtom == atom.Template:
+			return false
+		case n.DataAtom == atom.Img:
+			if alt, ok := attribute(n, "alt"); ok {
+				b.WriteString(alt)
+				b.WriteByte(' ')
+			}
+		}
+		return true
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// walk calls fn for n and its descendants in document order, skipping the
+// children of nodes for which fn returns false
+func walk(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+// isRoot reports whether n is a microformat, i.e. has an h-* class
+func isRoot(n *html.Node) bool {
+	for _, class := range classes(n) {
+		if isMicroformatClass(class, "h-") {
+			return true
+		}
+	}
+	return false
+}
+
+// isMicroformatClass reports whether class is prefix followed by a
+// lowercase name, e.g. h-entry but not h-1 or h-Foo
+func isMicroformatClass(class, prefix string) bool {
+	name, ok := strings.CutPrefix(class, prefix)
+	return ok && name != "" && name[0] >= 'a' && name[0] <= 'z'
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range classes(n) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func classes(n *html.Node) []string {
+	if n.Type != html.ElementNode {
+		return nil
+	}
+	value, _ := attribute(n, "class")
+	return strings.Fields(value)
+}
+
+func attribute(n *html.Node, name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// resolve returns ref made absolute against base, or ref unchanged if it
+// cannot be parsed
+func resolve(base *url.URL, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
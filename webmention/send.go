@@ -0,0 +1,432 @@
+package webmention
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+	"portfolio-v2/templates"
+)
+
+const (
+	sendBatchSize   = 10   // Queued posts loaded per query
+	maxResponseBody = 1024 // Bytes of an endpoint's response kept as the error
+)
+
+// pingbackAlreadyRegistered is the XML-RPC fault a pingback server returns
+// for a ping it already has, which counts as sent
+const pingbackAlreadyRegistered = 48
+
+// Schedule queues a notification to every site the post links to, sent at
+// at or straight away if that has passed. source is the post's public URL.
+// Scheduling an updated post again also notifies links it no longer has.
+func Schedule(db *sql.DB, postID int64, source string, at time.Time) error {
+	if err := database.ScheduleWebmentionSend(db, postID, source, at); err != nil {
+		return err
+	}
+
+	Queue()
+	return nil
+}
+
+// sendDue notifies the links of every post whose send is due, a batch at a
+// time, until ctx is cancelled
+func sendDue(ctx context.Context, db *sql.DB, client *http.Client) {
+	for {
+		sends, err := database.GetDueWebmentionSends(db, time.Now(), sendBatchSize)
+		if err != nil {
+			slog.Error("Failed to load queued webmention sends", "err", err)
+			return
+		}
+
+		for i := range sends {
+			if ctx.Err() != nil {
+				return
+			}
+			send := &sends[i]
+
+			if err := sendPost(ctx, db, client, send); err != nil {
+				if ctx.Err() != nil {
+					// Cut off by shutdown; the send stays queued and
+					// is finished after a restart
+					return
+				}
+				slog.Error("Failed to send webmentions", "post_id", send.PostID, "err", err)
+				return
+			}
+
+			if err := database.CompleteWebmentionSend(db, send); err != nil {
+				slog.Error("Failed to dequeue webmention send", "post_id", send.PostID, "err", err)
+				return
+			}
+		}
+
+		if len(sends) < sendBatchSize {
+			return
+		}
+	}
+}
+
+// sendPost notifies every site the post links to now, plus those it linked
+// to when last sent, so they can drop mentions of links that were removed
+func sendPost(ctx context.Context, db *sql.DB, client *http.Client, send *models.WebmentionSend) error {
+	post, err := database.GetBlogPostByID(db, int(send.PostID))
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		// Deleted while queued; its results went with it
+		return nil
+	}
+
+	source, err := url.Parse(send.Source)
+	if err != nil {
+		return fmt.Errorf("parse source %q: %w", send.Source, err)
+	}
+
+	previous, err := database.GetPostOutgoingWebmentions(db, send.PostID)
+	if err != nil {
+		return err
+	}
+
+	links := Links(templates.RenderMarkdown(post.Content), source)
+
+	linked := make(map[string]bool, len(links))
+	targets := links
+	for _, link := range links {
+		linked[link] = true
+	}
+	for _, o := range previous {
+		if o.Linked && !linked[o.Target] {
+			targets = append(targets, o.Target)
+		}
+	}
+
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		result := notify(ctx, client, send.Source, target)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		result.PostID = send.PostID
+		result.Linked = linked[target]
+
+		if err := database.SaveOutgoingWebmention(db, result); err != nil {
+			return err
+		}
+
+		switch result.Status {
+		case models.SendSent:
+			slog.Info("Sent webmention", "protocol", result.Protocol, "source", send.Source, "target", target)
+		case models.SendFailed:
+			slog.Warn("Failed to notify target", "target", target, "source", send.Source, "reason", result.Error)
+		}
+	}
+
+	return nil
+}
+
+// Links returns the distinct absolute http(s) URLs that the anchors in
+// content point to, resolved against source, in document order. Links to
+// source's own host are left out.
+func Links(content string, source *url.URL) []string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var links []string
+	walk(doc, func(n *html.Node) bool {
+		if n.DataAtom != atom.A {
+			return true
+		}
+
+		href, ok := attribute(n, "href")
+		if !ok {
+			return true
+		}
+
+		u, err := source.Parse(strings.TrimSpace(href))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return true
+		}
+		if strings.EqualFold(u.Host, source.Host) {
+			return true
+		}
+
+		u.Fragment = ""
+		u.RawFragment = ""
+		link := u.String()
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+		return true
+	})
+	return links
+}
+
+// notify discovers target's endpoint and tells it that source links to
+// target, by Webmention or, failing that, Pingback
+func notify(ctx context.Context, client *http.Client, source, target string) *models.OutgoingWebmention {
+	result := &models.OutgoingWebmention{
+		Target: target,
+		SentAt: time.Now(),
+	}
+
+	protocol, endpoint, err := Discover(ctx, client, target)
+	if err != nil {
+		result.Status = models.SendFailed
+		result.Error = "discovery: " + err.Error()
+		return result
+	}
+
+	if endpoint == "" {
+		result.Status = models.SendUnsupported
+		return result
+	}
+
+	result.Protocol = protocol
+	result.Endpoint = endpoint
+
+	if protocol == models.ProtocolPingback {
+		result.ResponseStatus, err = sendPingback(ctx, client, endpoint, source, target)
+	} else {
+		result.ResponseStatus, err = sendWebmention(ctx, client, endpoint, source, target)
+	}
+
+	if err != nil {
+		result.Status = models.SendFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = models.SendSent
+	return result
+}
+
+// Discover fetches target and returns the protocol and endpoint it
+// advertises: a Webmention endpoint from its Link header or the first
+// link or a element with rel="webmention", or else a Pingback server from
+// its X-Pingback header or <link rel="pingback">. The endpoint is empty if
+// target advertises neither.
+func Discover(ctx context.Context, client *http.Client, target string) (string, string, error) {
+	resp, err := fetch(ctx, client, target)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", "", fmt.Errorf("target answered %d", resp.StatusCode)
+	}
+
+	// Endpoints are relative to where the target ended up after redirects
+	base := resp.Request.URL
+
+	for _, value := range resp.Header.Values("Link") {
+		if href, ok := linkHeaderRel(value, "webmention"); ok {
+			return models.ProtocolWebmention, resolve(base, href), nil
+		}
+	}
+
+	var doc *html.Node
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		doc, err = html.Parse(io.LimitReader(resp.Body, maxSourceSize))
+		if err != nil {
+			return "", "", fmt.Errorf("parse target: %w", err)
+		}
+
+		if href, ok := relLink(doc, "webmention", atom.Link, atom.A); ok {
+			return models.ProtocolWebmention, resolve(base, href), nil
+		}
+	}
+
+	if server := resp.Header.Get("X-Pingback"); server != "" {
+		return models.ProtocolPingback, resolve(base, server), nil
+	}
+
+	if doc != nil {
+		if href, ok := relLink(doc, "pingback", atom.Link); ok && href != "" {
+			return models.ProtocolPingback, resolve(base, href), nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// linkHeaderRel returns the URL of the first link in a Link header value
+// whose rel includes rel, e.g. `<https://example.com/wm>; rel="webmention"`
+func linkHeaderRel(value, rel string) (string, bool) {
+	for _, link := range strings.Split(value, ",") {
+		parts := strings.Split(link, ";")
+		href := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(href, "<") || !strings.HasSuffix(href, ">") {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			name, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+				continue
+			}
+			for _, r := range strings.Fields(strings.Trim(strings.TrimSpace(val), `"`)) {
+				if strings.EqualFold(r, rel) {
+					return strings.TrimSuffix(strings.TrimPrefix(href, "<"), ">"), true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// relLink returns the href of the first element of the given kinds in doc
+// whose rel includes rel. An empty href is allowed and means the page
+// itself.
+func relLink(doc *html.Node, rel string, kinds ...atom.Atom) (string, bool) {
+	var href string
+	found := false
+	walk(doc, func(n *html.Node) bool {
+		if found {
+			return false
+		}
+
+		matches := false
+		for _, kind := range kinds {
+			if n.DataAtom == kind {
+				matches = true
+			}
+		}
+		if !matches {
+			return true
+		}
+
+		value, hasHref := attribute(n, "href")
+		rels, _ := attribute(n, "rel")
+		for _, r := range strings.Fields(rels) {
+			if hasHref && strings.EqualFold(r, rel) {
+				href, found = value, true
+			}
+		}
+		return !found
+	})
+	return href, found
+}
+
+// sendWebmention POSTs source and target to a Webmention endpoint. Any 2xx
+// status means it was accepted.
+func sendWebmention(ctx context.Context, client *http.Client, endpoint, source, target string) (int, error) {
+	form := url.Values{"source": {source}, "target": {target}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d: %s", resp.StatusCode, responseSnippet(resp.Body))
+	}
+
+	return resp.StatusCode, nil
+}
+
+// pingbackResponse is the part of an XML-RPC response that tells success
+// from failure
+type pingbackResponse struct {
+	Fault *struct {
+		Members []struct {
+			Name  string `xml:"name"`
+			Int   string `xml:"value>int"`
+			I4    string `xml:"value>i4"`
+			Value string `xml:"value>string"`
+		} `xml:"value>struct>member"`
+	} `xml:"fault"`
+}
+
+// sendPingback calls pingback.ping on an XML-RPC server. A fault saying
+// the ping is already registered counts as success.
+func sendPingback(ctx context.Context, client *http.Client, endpoint, source, target string) (int, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?><methodCall><methodName>pingback.ping</methodName><params>`)
+	for _, uri := range []string{source, target} {
+		body.WriteString(`<param><value><string>`)
+		xml.EscapeText(&body, []byte(uri))
+		body.WriteString(`</string></value></param>`)
+	}
+	body.WriteString(`</params></methodCall>`)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("server answered %d: %s", resp.StatusCode, responseSnippet(resp.Body))
+	}
+
+	var parsed pingbackResponse
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxSourceSize)).Decode(&parsed); err != nil {
+		return resp.StatusCode, fmt.Errorf("parse pingback response: %w", err)
+	}
+
+	if parsed.Fault == nil {
+		return resp.StatusCode, nil
+	}
+
+	code, message := 0, ""
+	for _, m := range parsed.Fault.Members {
+		switch m.Name {
+		case "faultCode":
+			code, _ = strconv.Atoi(strings.TrimSpace(m.Int + m.I4))
+		case "faultString":
+			message = m.Value
+		}
+	}
+
+	if code == pingbackAlreadyRegistered {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, fmt.Errorf("pingback fault %d: %s", code, message)
+}
+
+// responseSnippet returns the start of an error response, for the log
+func responseSnippet(body io.Reader) string {
+	snippet, _ := io.ReadAll(io.LimitReader(body, maxResponseBody))
+	return strings.TrimSpace(strings.ToValidUTF8(string(snippet), "�"))
+}
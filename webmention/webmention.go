@@ -0,0 +1,63 @@
+// Package webmention receives and sends Webmentions (https://www.w3.org/TR/webmention/).
+//
+// A received mention is stored as pending. The worker started by Run then
+// fetches its source, checks that the source links to the target and reads
+// the author and content from the source's microformats2 h-entry. Verified
+// mentions still need a moderator's approval before they are shown.
+//
+// When a post is published or updated, Schedule queues a notification to
+// every site it links to. The worker discovers each target's Webmention
+// endpoint, falling back to Pingback, and records the result per link.
+package webmention
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const userAgent = "portfolio-v2-webmention"
+
+// ValidURL reports whether raw is an absolute http:// or https:// URL with
+// a host, the only kind of source or target accepted
+func ValidURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// SameURL reports whether a and b address the same page, ignoring
+// fragments, the case of the scheme and host, and a trailing slash
+func SameURL(a, b string) bool {
+	return normalizeURL(a) == normalizeURL(b)
+}
+
+func normalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return raw
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+
+	return u.String()
+}
+
+// fetch GETs source asking for HTML. The caller closes the body.
+func fetch(ctx context.Context, client *http.Client, source string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/html, application/xhtml+xml;q=0.9, */*;q=0.1")
+	req.Header.Set("User-Agent", userAgent)
+
+	return client.Do(req)
+}
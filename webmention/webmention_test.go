@@ -0,0 +1,178 @@
+package webmention
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"portfolio-v2/database"
+	"portfolio-v2/internal/testdb"
+	"portfolio-v2/models"
+	"portfolio-v2/safehttp"
+)
+
+const testTarget = "https://blog.example/blog/hello-world"
+
+// sources are the pages served to the worker, by path
+var sources = map[string]string{
+	"/reply": `<!DOCTYPE html>
+<html><head><title>A reply</title></head><body>
+<article class="h-entry">
+  <a class="u-url" href="/reply">Permalink</a>
+  <time class="dt-published" datetime="2026-03-14T15:09:26Z">14 March</time>
+  <div class="p-author h-card">
+    <img class="u-photo" src="/me.jpg" alt="">
+    <a class="p-name u-url" href="https://alice.example/">Alice Example</a>
+  </div>
+  <p>In reply to <a class="u-in-reply-to" href="` + testTarget + `">your post</a></p>
+  <div class="e-content">Great post, <b>thanks</b> for writing it.</div>
+</article>
+</body></html>`,
+
+	"/like": `<!DOCTYPE html>
+<html><body>
+<div class="h-entry">
+  <span class="p-author">Bob</span>
+  <a class="u-like-of" href="` + testTarget + `/">liked</a>
+</div>
+</body></html>`,
+
+	"/plain-link": `<!DOCTYPE html>
+<html><head><title>Reading list</title></head><body>
+<p>See <a href="` + testTarget + `#comments">this</a>.</p>
+</body></html>`,
+
+	"/no-link": `<!DOCTYPE html>
+<html><body>
+<article class="h-entry">
+  <span class="p-author">Mallory</span>
+  <div class="e-content">Mentions ` + testTarget + ` in text but never links to it.</div>
+  <a href="https://blog.example/blog/another-post">Another post</a>
+</article>
+</body></html>`,
+}
+
+// sourceServer serves sources as HTML, and 410 Gone for /gone
+func sourceServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.Error(w, "deleted", http.StatusGone)
+			return
+		}
+		page, ok := sources[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// receive stores a pending mention of the test post from source
+func receive(t *testing.T, db *sql.DB, source string) *models.Webmention {
+	t.Helper()
+	slug, err := database.CreateBlogPost(db, "Hello world", "Excerpt", "Content", nil, "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := database.GetBlogPostBySlug(db, slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mention := &models.Webmention{PostID: int64(post.ID), Source: source, Target: testTarget}
+	if err := database.SaveWebmention(db, mention); err != nil {
+		t.Fatal(err)
+	}
+	return mention
+}
+
+// verified runs the worker over the pending mentions and returns the stored
+// state of mention
+func verified(t *testing.T, db *sql.DB, mention *models.Webmention) *models.Webmention {
+	t.Helper()
+	verifyPending(t.Context(), db, safehttp.NewClient(true))
+
+	stored, err := database.GetWebmentionByID(db, mention.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func TestVerifyReadsTheSourceEntry(t *testing.T) {
+	db := testdb.Open(t)
+	server := sourceServer(t)
+
+	stored := verified(t, db, receive(t, db, server.URL+"/reply"))
+
+	if stored.Status != models.MentionVerified {
+		t.Fatalf("status = %s (%s), want verified", stored.Status, stored.Error)
+	}
+
+	published := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	tests := []struct {
+		field, got, want string
+	}{
+		{"type", string(stored.Type), string(models.MentionReply)},
+		{"author name", stored.AuthorName, "Alice Example"},
+		{"author url", stored.AuthorURL, "https://alice.example/"},
+		{"author photo", stored.AuthorPhoto, server.URL + "/me.jpg"},
+		{"content", stored.Content, "Great post, thanks for writing it."},
+		{"url", stored.URL, server.URL + "/reply"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.field, tt.got, tt.want)
+		}
+	}
+	if stored.PublishedAt == nil || !stored.PublishedAt.Equal(published) {
+		t.Errorf("published = %v, want %v", stored.PublishedAt, published)
+	}
+}
+
+func TestVerifyStatus(t *testing.T) {
+	tests := []struct {
+		path       string
+		status     string
+		error      string
+		mention    models.MentionType
+		authorName string
+		content    string
+	}{
+		{path: "/like", status: models.MentionVerified, mention: models.MentionLike, authorName: "Bob"},
+		// Without an h-entry the author is the source's host and the content its title
+		{path: "/plain-link", status: models.MentionVerified, mention: models.MentionMention, authorName: "127.0.0.1", content: "Reading list"},
+		{path: "/no-link", status: models.MentionInvalid, error: errNoLink.Error()},
+		{path: "/missing", status: models.MentionInvalid, error: "source answered 404"},
+		{path: "/gone", status: models.MentionInvalid, error: "source is gone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			db := testdb.Open(t)
+			server := sourceServer(t)
+
+			stored := verified(t, db, receive(t, db, server.URL+tt.path))
+
+			if stored.Status != tt.status || stored.Error != tt.error {
+				t.Fatalf("status = %s (%q), want %s (%q)", stored.Status, stored.Error, tt.status, tt.error)
+			}
+			if tt.status != models.MentionVerified {
+				return
+			}
+
+			if stored.Type != tt.mention || stored.AuthorName != tt.authorName || stored.Content != tt.content {
+				t.Errorf("mention = %s by %q saying %q, want %s by %q saying %q",
+					stored.Type, stored.AuthorName, stored.Content, tt.mention, tt.authorName, tt.content)
+			}
+		})
+	}
+}
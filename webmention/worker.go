@@ -0,0 +1,258 @@
+package webmention
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"portfolio-v2/database"
+	"portfolio-v2/models"
+)
+
+const (
+	batchSize     = 20      // Mentions loaded per query
+	maxSourceSize = 1 << 20 // Bytes of a source read when looking for the link
+	maxContent    = 500     // Characters of content kept for display
+)
+
+// errNoLink is recorded when a source does not link to its target
+var errNoLink = errors.New("source does not link to the target")
+
+// wakeup lets Queue start a running worker early instead of waiting for its
+// next tick, so a mention is usually verified or sent within a second
+var wakeup = make(chan struct{}, 1)
+
+// Queue wakes the worker to verify newly received mentions and send newly
+// scheduled ones
+func Queue() {
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Run verifies pending mentions and sends due ones now, then whenever Queue
+// is called and every interval, until ctx is cancelled (run in a
+// goroutine). Both queues live in the database, so work left when the
+// process stops is done after it restarts.
+func Run(ctx context.Context, db *sql.DB, client *http.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		verifyPending(ctx, db, client)
+		sendDue(ctx, db, client)
+
+		select {
+		case <-ticker.C:
+		case <-wakeup:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// verifyPending verifies every pending mention, a batch at a time, until
+// ctx is cancelled
+func verifyPending(ctx context.Context, db *sql.DB, client *http.Client) {
+	for {
+		mentions, err := database.GetPendingWebmentions(db, batchSize)
+		if err != nil {
+			slog.Error("Failed to load pending webmentions", "err", err)
+			return
+		}
+
+		for i := range mentions {
+			if ctx.Err() != nil {
+				return
+			}
+			mention := &mentions[i]
+
+			Verify(ctx, client, mention)
+			if ctx.Err() != nil {
+				// Cut off by shutdown rather than by the source; the
+				// mention stays pending and is verified after a restart
+				return
+			}
+			if err := database.RecordWebmentionVerification(db, mention); err != nil {
+				slog.Error("Failed to record webmention", "id", mention.ID, "err", err)
+				return
+			}
+
+			if mention.Status == models.MentionVerified {
+				slog.Info("Webmention verified", "id", mention.ID, "source", mention.Source, "type", mention.Type)
+			} else {
+				slog.Info("Webmention is invalid", "id", mention.ID, "source", mention.Source, "reason", mention.Error)
+			}
+		}
+
+		if len(mentions) < batchSize {
+			return
+		}
+	}
+}
+
+// Verify fetches mention's source once and updates mention with the
+// outcome: verified with the author and content of its h-entry, or invalid
+// with the reason. A source that is gone has its content cleared.
+func Verify(ctx context.Context, client *http.Client, mention *models.Webmention) {
+	now := time.Now()
+	mention.VerifiedAt = &now
+
+	resp, err := fetch(ctx, client, mention.Source)
+	if err != nil {
+		invalidate(mention, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSourceSize))
+	if err != nil {
+		invalidate(mention, "read source: "+err.Error())
+		return
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		// The source was deleted, so the mention is too
+		invalidate(mention, "source is gone")
+		mention.Content = ""
+		return
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		invalidate(mention, "source answered "+strconv.Itoa(resp.StatusCode))
+		return
+	}
+
+	// Relative links resolve against where the source ended up after
+	// redirects
+	base := resp.Request.URL
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		// Plain text, JSON and the like only need to contain the URL
+		if !bytes.Contains(body, []byte(mention.Target)) {
+			invalidate(mention, errNoLink.Error())
+			return
+		}
+		describe(mention, nil, base)
+		return
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		invalidate(mention, fmt.Sprintf("parse source: %v", err))
+		return
+	}
+
+	if !linksTo(doc, base, mention.Target) {
+		invalidate(mention, errNoLink.Error())
+		return
+	}
+
+	e := parseEntry(doc, base, mention.Target)
+	if e == nil {
+		e = &entry{content: documentTitle(doc)}
+	}
+	describe(mention, e, base)
+}
+
+// invalidate marks mention as failing verification
+func invalidate(mention *models.Webmention, reason string) {
+	mention.Status = models.MentionInvalid
+	mention.Error = reason
+}
+
+// describe marks mention verified and fills its display fields from e,
+// falling back to the source's host when e has no author
+func describe(mention *models.Webmention, e *entry, base *url.URL) {
+	mention.Status = models.MentionVerified
+	mention.Error = ""
+	mention.Type = models.MentionMention
+	mention.AuthorName = ""
+	mention.AuthorURL = ""
+	mention.AuthorPhoto = ""
+	mention.Content = ""
+	mention.URL = mention.Source
+	mention.PublishedAt = nil
+
+	if e != nil {
+		mention.Type = mentionType(e, mention.Target)
+		mention.AuthorName = truncate(e.authorName, 100)
+		mention.AuthorURL = httpURLOrEmpty(e.authorURL)
+		mention.AuthorPhoto = httpURLOrEmpty(e.authorPhoto)
+		mention.Content = truncate(e.content, maxContent)
+		if e.content == "" {
+			mention.Content = truncate(e.name, maxContent)
+		}
+		if u := httpURLOrEmpty(e.url); u != "" {
+			mention.URL = u
+		}
+		mention.PublishedAt = parseDate(e.published)
+	}
+
+	if mention.AuthorName == "" {
+		mention.AuthorName = base.Hostname()
+	}
+	if mention.AuthorURL == "" {
+		mention.AuthorURL = base.Scheme + "://" + base.Host + "/"
+	}
+}
+
+// mentionType returns how e responds to target, checking the response
+// properties in order of precedence
+func mentionType(e *entry, target string) models.MentionType {
+	properties := []struct {
+		urls        []string
+		mentionType models.MentionType
+	}{
+		{e.inReplyTo, models.MentionReply},
+		{e.likeOf, models.MentionLike},
+		{e.repostOf, models.MentionRepost},
+		{e.bookmarkOf, models.MentionBookmark},
+	}
+
+	for _, p := range properties {
+		for _, u := range p.urls {
+			if SameURL(u, target) {
+				return p.mentionType
+			}
+		}
+	}
+	return models.MentionMention
+}
+
+// httpURLOrEmpty returns raw if it is an absolute http(s) URL, so nothing
+// else ends up in a link or image on the post page
+func httpURLOrEmpty(raw string) string {
+	if !ValidURL(raw) {
+		return ""
+	}
+	return raw
+}
+
+// truncate shortens s to at most limit characters, cutting at a word
+// boundary and adding an ellipsis
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+
+	cut := string(runes[:limit-1])
+	if i := strings.LastIndexByte(cut, ' '); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}